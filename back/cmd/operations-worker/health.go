@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"sangehassan/back/internal/usecase"
+)
+
+// healthServer exposes the worker's own state to the container runtime and
+// to Prometheus. It binds to its own address and is never published by the
+// reverse proxy.
+type healthServer struct {
+	service    *usecase.OperationsService
+	monitor    *usecase.WorkerMonitor
+	staleAfter time.Duration
+}
+
+func newHealthServer(addr string, h healthServer) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", h.health)
+	mux.HandleFunc("/metrics", h.metrics)
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second, WriteTimeout: 10 * time.Second}
+}
+
+func (h healthServer) backlog(r *http.Request) ([]usecase.OutboxBacklog, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	return h.service.WorkerBacklog(ctx)
+}
+
+// health answers 503 only when the worker itself is stuck; an unreachable
+// database is reported in the body but is not something a restart fixes.
+func (h healthServer) health(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.monitor.Snapshot(time.Now(), h.staleAfter)
+	body := map[string]any{"status": "ok", "worker": snapshot}
+	if backlog, err := h.backlog(r); err != nil {
+		body["backlog_error"] = err.Error()
+	} else {
+		body["backlog"] = backlog
+	}
+	status := http.StatusOK
+	if !snapshot.Healthy {
+		status, body["status"] = http.StatusServiceUnavailable, "stuck"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (h healthServer) metrics(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.monitor.Snapshot(time.Now(), h.staleAfter)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	healthy := 0
+	if snapshot.Healthy {
+		healthy = 1
+	}
+	fmt.Fprintf(w, "# TYPE operations_worker_healthy gauge\noperations_worker_healthy %d\n", healthy)
+	if snapshot.LastCycleAt != nil {
+		fmt.Fprintf(w, "# TYPE operations_worker_last_cycle_timestamp_seconds gauge\noperations_worker_last_cycle_timestamp_seconds %d\n", snapshot.LastCycleAt.Unix())
+	}
+	fmt.Fprint(w, "# TYPE operations_worker_job_runs_total counter\n")
+	for _, job := range snapshot.Jobs {
+		fmt.Fprintf(w, "operations_worker_job_runs_total{job=%q} %d\n", job.Job, job.Runs)
+	}
+	fmt.Fprint(w, "# TYPE operations_worker_job_failures_total counter\n")
+	for _, job := range snapshot.Jobs {
+		fmt.Fprintf(w, "operations_worker_job_failures_total{job=%q} %d\n", job.Job, job.Failures)
+	}
+	fmt.Fprint(w, "# TYPE operations_worker_job_last_duration_seconds gauge\n")
+	for _, job := range snapshot.Jobs {
+		fmt.Fprintf(w, "operations_worker_job_last_duration_seconds{job=%q} %.3f\n", job.Job, float64(job.LastDurationMS)/1000)
+	}
+	fmt.Fprint(w, "# TYPE operations_worker_job_last_success_timestamp_seconds gauge\n")
+	for _, job := range snapshot.Jobs {
+		if job.LastSuccessAt != nil {
+			fmt.Fprintf(w, "operations_worker_job_last_success_timestamp_seconds{job=%q} %d\n", job.Job, job.LastSuccessAt.Unix())
+		}
+	}
+	backlog, err := h.backlog(r)
+	if err != nil {
+		slog.Error("worker_backlog_failed", "error", err)
+		return
+	}
+	for _, metric := range []struct {
+		name  string
+		value func(usecase.OutboxBacklog) int64
+	}{
+		{"operations_worker_outbox_pending", func(b usecase.OutboxBacklog) int64 { return int64(b.Pending) }},
+		{"operations_worker_outbox_due", func(b usecase.OutboxBacklog) int64 { return int64(b.Due) }},
+		{"operations_worker_outbox_processing", func(b usecase.OutboxBacklog) int64 { return int64(b.Processing) }},
+		{"operations_worker_outbox_oldest_due_age_seconds", func(b usecase.OutboxBacklog) int64 { return b.OldestDueSeconds }},
+	} {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
+		for _, b := range backlog {
+			fmt.Fprintf(w, "%s{outbox=%q} %d\n", metric.name, b.Outbox, metric.value(b))
+		}
+	}
+}
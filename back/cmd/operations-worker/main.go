@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"sangehassan/back/internal/adapters/email"
 	"sangehassan/back/internal/adapters/persistence/postgres"
+	"sangehassan/back/internal/adapters/sms"
 	"sangehassan/back/internal/config"
 	"sangehassan/back/internal/usecase"
 )
@@ -25,37 +29,81 @@ func main() {
 		log.Fatalf("database error: %v", err)
 	}
 	defer db.Close()
-	var provider usecase.SMSProvider = usecase.DisabledSMSProvider{}
-	if cfg.SMSProvider == "fake" && cfg.AppEnv != "production" {
-		provider = &usecase.FakeSMSProvider{}
+	provider, err := sms.NewProvider(cfg)
+	if err != nil {
+		log.Fatalf("sms provider error: %v", err)
+	}
+	emailSender, err := email.NewSender(cfg)
+	if err != nil {
+		log.Fatalf("email sender error: %v", err)
 	}
 	service := usecase.NewOperationsService(db)
 	service.ConfigureFinanceAndDocuments(cfg.WorkflowFileDir, provider)
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	service.ConfigureEmail(emailSender)
+	service.ConfigureWebhooks(cfg.WebhookTimeout)
+	monitor := usecase.NewWorkerMonitor()
+	service.ConfigureWorkerMonitor(monitor)
+	// A signal only stops new jobs from starting. Jobs run on their own
+	// context so the one in flight can finish within WORKER_SHUTDOWN_TIMEOUT.
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
 	interval := time.Duration(cfg.WorkerPollSeconds) * time.Second
 	if interval < 5*time.Second {
 		interval = 5 * time.Second
 	}
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	for {
-		results, runErr := service.RunWorkerOnce(ctx, cfg.NotificationRetrySchedule)
-		if runErr != nil {
-			slog.Error("worker_cycle_failed", "error", runErr)
-		}
-		for _, result := range results {
-			if result.Error != "" {
-				slog.Error("worker_job_failed", "job", result.Job, "affected", result.Affected, "error", result.Error)
+	var health *http.Server
+	if cfg.WorkerHealthAddr != "" {
+		health = newHealthServer(cfg.WorkerHealthAddr, healthServer{service: service, monitor: monitor, staleAfter: 3 * interval})
+		go func() {
+			if err := health.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("worker_health_listener_failed", "error", err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			results, runErr := service.RunWorkerCycle(runCtx, signalCtx.Done(), cfg.NotificationRetrySchedule)
+			if runErr != nil {
+				slog.Error("worker_cycle_failed", "error", runErr)
+			}
+			for _, result := range results {
+				if result.Error != "" {
+					slog.Error("worker_job_failed", "job", result.Job, "affected", result.Affected, "error", result.Error)
+				}
+			}
+			if signalCtx.Err() != nil {
+				return
+			}
+			if _, cleanupErr := service.CleanupOrphanDocumentFiles(runCtx); cleanupErr != nil {
+				slog.Error("orphan_cleanup_failed", "error", cleanupErr)
+			}
+			monitor.CycleFinished(time.Now())
+			select {
+			case <-signalCtx.Done():
+				return
+			case <-ticker.C:
 			}
 		}
-		if _, cleanupErr := service.CleanupOrphanDocumentFiles(ctx); cleanupErr != nil {
-			slog.Error("orphan_cleanup_failed", "error", cleanupErr)
-		}
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-		}
+	}()
+	<-signalCtx.Done()
+	slog.Info("worker_draining", "timeout", cfg.WorkerShutdownTimeout.String())
+	select {
+	case <-done:
+	case <-time.After(cfg.WorkerShutdownTimeout):
+		slog.Warn("worker_shutdown_deadline_exceeded")
+		cancelRun()
+		<-done
+	}
+	if health != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = health.Shutdown(shutdownCtx)
 	}
+	slog.Info("worker_stopped")
 }
@@ -9,9 +9,11 @@ import (
 	"path/filepath"
 	"strings"
 
+	"sangehassan/back/internal/adapters/email"
 	httpapi "sangehassan/back/internal/adapters/http"
 	"sangehassan/back/internal/adapters/http/handlers"
 	"sangehassan/back/internal/adapters/persistence/postgres"
+	"sangehassan/back/internal/adapters/sms"
 	"sangehassan/back/internal/config"
 	"sangehassan/back/internal/usecase"
 )
@@ -71,8 +73,27 @@ func main() {
 	dealRequestService := usecase.NewDealRequestService(dealRequestRepo, listingRepo)
 	stoneSampleRequestService := usecase.NewStoneSampleRequestService(stoneSampleRequestRepo, userRepo)
 	contactSubmissionService := usecase.NewContactSubmissionService(contactSubmissionRepo)
+	// The API sends template test messages itself, so it needs the same
+	// providers as the worker.
+	smsProvider, err := sms.NewProvider(cfg)
+	if err != nil {
+		log.Fatalf("sms provider error: %v", err)
+	}
+	emailSender, err := email.NewSender(cfg)
+	if err != nil {
+		log.Fatalf("email sender error: %v", err)
+	}
 	operationsService := usecase.NewOperationsService(db)
-	operationsService.ConfigureFinanceAndDocuments(cfg.WorkflowFileDir, usecase.DisabledSMSProvider{})
+	operationsService.ConfigureFinanceAndDocuments(cfg.WorkflowFileDir, smsProvider)
+	operationsService.ConfigureEmail(emailSender)
+	notificationHub := usecase.NewNotificationHub()
+	operationsService.ConfigureNotificationStream(notificationHub)
+	go func() {
+		resync := `{"kind":"` + usecase.StreamResync + `"}`
+		if err := postgres.ListenEvents(context.Background(), cfg, usecase.NotificationEventChannel, resync, notificationHub.Publish); err != nil {
+			slog.Error("notification_listener_stopped", "error", err)
+		}
+	}()
 	if strings.EqualFold(cfg.AppEnv, "production") {
 		if err := operationsService.Ready(context.Background()); err != nil {
 			log.Fatalf("readiness error: %v", err)
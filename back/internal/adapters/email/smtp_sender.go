@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"sangehassan/back/internal/config"
+	"sangehassan/back/internal/usecase"
+)
+
+// SMTPSender delivers EMAIL outbox rows through an SMTP relay. STARTTLS is
+// used whenever the relay offers it; credentials are only sent over TLS or
+// to a loopback relay.
+type SMTPSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     mail.Address
+	timeout  time.Duration
+}
+
+func NewSMTPSender(host string, port int, username, password, from string, timeout time.Duration) (*SMTPSender, error) {
+	host = strings.TrimSpace(host)
+	if host == "" || port <= 0 || port > 65535 {
+		return nil, errors.New("smtp host and port are required")
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, errors.New("smtp from address is invalid")
+	}
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	return &SMTPSender{host: host, port: port, username: username, password: password, from: *sender, timeout: timeout}, nil
+}
+
+func NewSender(cfg config.Config) (usecase.EmailSender, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.EmailProvider)) {
+	case "", "disabled":
+		return usecase.DisabledEmailSender{}, nil
+	case "smtp":
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTimeout)
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", cfg.EmailProvider)
+	}
+}
+
+func (*SMTPSender) Name() string { return "smtp" }
+
+func (s *SMTPSender) SendEmail(ctx context.Context, msg usecase.EmailMessage) (string, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return "", errors.New("email recipient is invalid")
+	}
+	messageID := "<" + randomToken() + "@" + s.host + ">"
+	raw, err := buildMessage(s.from, *to, messageID, msg)
+	if err != nil {
+		return "", err
+	}
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return "", fmt.Errorf("smtp connect failed: %w", err)
+	}
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return "", fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return "", fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+	if err = client.Mail(s.from.Address); err != nil {
+		return "", fmt.Errorf("smtp sender rejected: %w", err)
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return "", fmt.Errorf("smtp recipient rejected: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", fmt.Errorf("smtp data rejected: %w", err)
+	}
+	if _, err = w.Write(raw); err != nil {
+		return "", fmt.Errorf("smtp write failed: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return "", fmt.Errorf("smtp message rejected: %w", err)
+	}
+	_ = client.Quit()
+	return messageID, nil
+}
+
+// buildMessage renders an RFC 5322 message: text/plain alone, or
+// multipart/alternative with the HTML part last when an HTML body exists.
+func buildMessage(from, to mail.Address, messageID string, msg usecase.EmailMessage) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("email subject must be a single line")
+	}
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().UTC().Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+	if strings.TrimSpace(msg.HTMLBody) == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.TextBody); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/alternative; boundary="`+parts.Boundary()+`"`)
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{{"text/plain", msg.TextBody}, {"text/html", msg.HTMLBody}} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + `; charset="utf-8"`}, "Content-Transfer-Encoding": {"quoted-printable"}})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func randomToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
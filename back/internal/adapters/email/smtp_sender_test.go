@@ -0,0 +1,164 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"sangehassan/back/internal/config"
+	"sangehassan/back/internal/usecase"
+)
+
+type sinkMessage struct {
+	from, to string
+	data     string
+}
+
+// startSMTPSink accepts one session per connection and records each
+// message, answering just enough of RFC 5321 for net/smtp.
+func startSMTPSink(t *testing.T, rejectRecipient string) (string, int, <-chan sinkMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan sinkMessage, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+				reply("220 sink ready")
+				var msg sinkMessage
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 sink")
+					case strings.HasPrefix(cmd, "MAIL FROM:"):
+						msg.from = strings.Trim(strings.TrimSpace(line)[10:], "<>")
+						reply("250 ok")
+					case strings.HasPrefix(cmd, "RCPT TO:"):
+						msg.to = strings.Trim(strings.TrimSpace(line)[8:], "<>")
+						if msg.to == rejectRecipient {
+							reply("550 mailbox unavailable")
+							continue
+						}
+						reply("250 ok")
+					case cmd == "DATA":
+						reply("354 end with .")
+						var data strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+							data.WriteString(strings.TrimPrefix(l, "."))
+						}
+						msg.data = data.String()
+						received <- msg
+						reply("250 queued")
+					case cmd == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}(conn)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestSMTPSenderDeliversMultipartMessage(t *testing.T) {
+	host, port, received := startSMTPSink(t, "")
+	sender, err := NewSMTPSender(host, port, "", "", "Sang-e Hassan <noreply@sangehassan.test>", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := sender.SendEmail(context.Background(), usecase.EmailMessage{To: "customer@example.test", Subject: "تأیید سفارش", TextBody: "سفارش شما تأیید شد.", HTMLBody: "<p>سفارش شما تأیید شد.</p>"})
+	if err != nil || !strings.HasPrefix(id, "<") {
+		t.Fatalf("id=%q err=%v", id, err)
+	}
+	var msg sinkMessage
+	select {
+	case msg = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sink received nothing")
+	}
+	if msg.from != "noreply@sangehassan.test" || msg.to != "customer@example.test" {
+		t.Fatalf("envelope from=%q to=%q", msg.from, msg.to)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "تأیید سفارش" {
+		t.Fatalf("subject=%q", subject)
+	}
+	if parsed.Header.Get("Message-Id") != id {
+		t.Fatalf("message id header=%q want %q", parsed.Header.Get("Message-Id"), id)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type=%q err=%v", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+"|"+string(raw))
+	}
+	if len(bodies) != 2 || !strings.HasPrefix(bodies[0], "text/plain") || !strings.Contains(bodies[0], "سفارش شما تأیید شد.") || !strings.HasPrefix(bodies[1], "text/html") || !strings.Contains(bodies[1], "<p>") {
+		t.Fatalf("parts=%q", bodies)
+	}
+}
+
+func TestSMTPSenderRejections(t *testing.T) {
+	host, port, _ := startSMTPSink(t, "blocked@example.test")
+	sender, err := NewSMTPSender(host, port, "", "", "noreply@sangehassan.test", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sender.SendEmail(context.Background(), usecase.EmailMessage{To: "blocked@example.test", Subject: "x", TextBody: "x"}); err == nil {
+		t.Fatal("rejected recipient reported as sent")
+	}
+	if _, err = sender.SendEmail(context.Background(), usecase.EmailMessage{To: "a@example.test", Subject: "x\r\nBcc: b@example.test", TextBody: "x"}); err == nil {
+		t.Fatal("header injection accepted")
+	}
+	if _, err = NewSender(config.Config{EmailProvider: "carrier-pigeon"}); err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+	if s, err := NewSender(config.Config{EmailProvider: "disabled"}); err != nil || s.Name() != "disabled" {
+		t.Fatalf("disabled sender=%v err=%v", s, err)
+	}
+}
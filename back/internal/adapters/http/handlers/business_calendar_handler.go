@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) BusinessCalendar(c *gin.Context) {
+	year, _ := strconv.Atoi(c.DefaultQuery("year", "0"))
+	okOrError(c, operationResult(h.service.GetBusinessCalendar(c.Request.Context(), c.Query("location_id"), year)))
+}
+
+func (h *OperationsHandler) SaveBusinessCalendarHours(c *gin.Context) {
+	p, ok := bindOperation[usecase.BusinessCalendarHoursPayload](c)
+	if !ok {
+		return
+	}
+	if err := h.service.SaveBusinessCalendarHours(c.Request.Context(), actorID(c), p); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"saved": true})
+}
+
+func (h *OperationsHandler) SaveBusinessCalendarDay(c *gin.Context) {
+	p, ok := bindOperation[usecase.BusinessCalendarDay](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.SaveBusinessCalendarDay(c.Request.Context(), actorID(c), p)))
+}
+
+func (h *OperationsHandler) DeleteBusinessCalendarDay(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteBusinessCalendarDay(c.Request.Context(), actorID(c), id); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"deleted": true})
+}
+
+func (h *OperationsHandler) ImportBusinessCalendar(c *gin.Context) {
+	p, ok := bindOperation[usecase.BusinessCalendarImportPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.ImportBusinessCalendarICS(c.Request.Context(), actorID(c), p)))
+}
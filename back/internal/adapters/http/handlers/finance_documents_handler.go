@@ -212,12 +212,13 @@ func (h *OperationsHandler) NotificationPreferences(c *gin.Context) {
 }
 func (h *OperationsHandler) SaveNotificationPreferences(c *gin.Context) {
 	p, ok := bindOperation[struct {
-		Items []usecase.NotificationPreferencePayload `json:"items"`
+		Items      []usecase.NotificationPreferencePayload `json:"items"`
+		QuietHours *usecase.NotificationQuietHours         `json:"quiet_hours"`
 	}](c)
 	if !ok {
 		return
 	}
-	if err := h.service.SaveNotificationPreferences(c.Request.Context(), actorID(c), p.Items); err != nil {
+	if err := h.service.SaveNotificationPreferences(c.Request.Context(), actorID(c), p.Items, p.QuietHours); err != nil {
 		operationError(c, err)
 		return
 	}
@@ -241,6 +242,24 @@ func (h *OperationsHandler) UpdateNotificationTemplate(c *gin.Context) {
 	}
 	respondOK(c, gin.H{"updated": true})
 }
+func (h *OperationsHandler) PreviewNotificationTemplate(c *gin.Context) {
+	p, ok := bindOperation[usecase.NotificationTemplatePreviewRequest](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.PreviewNotificationTemplate(c.Request.Context(), c.Param("id"), p)))
+}
+func (h *OperationsHandler) TestSendNotificationTemplate(c *gin.Context) {
+	key, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.NotificationTemplatePreviewRequest](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.TestSendNotificationTemplate(c.Request.Context(), actorID(c), c.Param("id"), key, p)))
+}
 func (h *OperationsHandler) RetryNotification(c *gin.Context) {
 	key, ok := idempotencyKey(c)
 	if !ok {
@@ -394,6 +413,37 @@ func (h *OperationsHandler) ReportProfitability(c *gin.Context) {
 func (h *OperationsHandler) ReportOperations(c *gin.Context) {
 	okOrError(c, operationResult(h.service.ReportOperations(c.Request.Context())))
 }
+func (h *OperationsHandler) ReportWorkflowAnalytics(c *gin.Context) {
+	var templateID int64
+	if value := c.Query("template_id"); value != "" {
+		var err error
+		if templateID, err = strconv.ParseInt(value, 10, 64); err != nil || templateID <= 0 {
+			respondError(c, http.StatusBadRequest, "invalid template_id")
+			return
+		}
+	}
+	report, err := h.service.WorkflowAnalytics(c.Request.Context(), c.Param("kind"), usecase.WorkflowAnalyticsFilter{From: c.Query("from"), To: c.Query("to"), TemplateID: templateID, StepCode: c.Query("step_code")})
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	if c.Query("format") == "csv" {
+		writeCSV(c, "workflow-"+report.Kind+".csv", report.Columns, report.CSVRows(c.Query("calendar")))
+		return
+	}
+	respondOK(c, report)
+}
+func (h *OperationsHandler) ReportWorkload(c *gin.Context) {
+	var roleID int64
+	if value := c.Query("role_id"); value != "" {
+		var err error
+		if roleID, err = strconv.ParseInt(value, 10, 64); err != nil || roleID <= 0 {
+			respondError(c, http.StatusBadRequest, "invalid role_id")
+			return
+		}
+	}
+	okOrError(c, operationResult(h.service.WorkflowWorkload(c.Request.Context(), roleID)))
+}
 func (h *OperationsHandler) ReportSales(c *gin.Context) {
 	okOrError(c, operationResult(h.service.ReportSales(c.Request.Context())))
 }
@@ -538,6 +538,17 @@ func (h *OperationsHandler) DeleteWorkflowTransition(c *gin.Context) {
 	}
 	respondOK(c, gin.H{"deleted": true})
 }
+func (h *OperationsHandler) DryRunWorkflowConditions(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WorkflowConditionDryRunPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.DryRunWorkflowConditions(c.Request.Context(), id, p)))
+}
 func (h *OperationsHandler) RuntimeTransitions(c *gin.Context) {
 	okOrError(c, operationResult(h.service.GetRuntimeTransitions(c.Request.Context(), actorID(c), c.Param("id"))))
 }
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+// notificationStreamHeartbeat keeps proxies from closing an idle stream.
+const notificationStreamHeartbeat = 25 * time.Second
+
+// NotificationStream pushes notification and action-item events as
+// Server-Sent Events. The first event is a resync carrying the unread count.
+func (h *OperationsHandler) NotificationStream(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := actorID(c)
+	events, cancel, err := h.service.SubscribeNotifications(ctx, user)
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	defer cancel()
+	initial, err := h.service.StreamMessage(ctx, user, usecase.StreamEvent{Kind: usecase.StreamResync})
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	// The server-wide write timeout would otherwise cut the stream.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.SSEvent(usecase.StreamResync, initial)
+	c.Writer.Flush()
+	heartbeat := time.NewTicker(notificationStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			msg, err := h.service.StreamMessage(ctx, user, ev)
+			if err != nil {
+				slog.WarnContext(ctx, "notification_stream_event_skipped", "kind", ev.Kind, "error", err)
+				continue
+			}
+			if msg == nil {
+				continue
+			}
+			c.SSEvent(ev.Kind, msg)
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -267,13 +267,19 @@ func (h *OperationsHandler) ExportCSV(c *gin.Context) {
 		return
 	}
 	limit, _ := strconv.Atoi(c.Query("limit"))
-	headers, rows, err := h.service.ExportRows(c.Request.Context(), kind, c.Query("search"), c.Query("status"), limit)
+	headers, rows, err := h.service.ExportRows(c.Request.Context(), kind, c.Query("search"), c.Query("status"), c.Query("calendar"), limit)
 	if err != nil {
 		operationError(c, err)
 		return
 	}
+	writeCSV(c, kind+"-export.csv", headers, rows)
+}
+
+// writeCSV sends a UTF-8 CSV with a BOM for spreadsheet programs, prefixing
+// cells that a spreadsheet would read as a formula.
+func writeCSV(c *gin.Context, filename string, headers []string, rows [][]string) {
 	c.Header("Content-Type", "text/csv; charset=utf-8")
-	c.Header("Content-Disposition", `attachment; filename="`+kind+`-export.csv"`)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
 	c.Status(http.StatusOK)
 	_, _ = c.Writer.Write([]byte{0xEF, 0xBB, 0xBF})
 	writer := csv.NewWriter(c.Writer)
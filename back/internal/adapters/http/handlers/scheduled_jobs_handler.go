@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *OperationsHandler) ScheduledJobs(c *gin.Context) {
+	okOrError(c, operationResult(h.service.ListScheduledJobs(c.Request.Context())))
+}
+func (h *OperationsHandler) ScheduledJobRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	okOrError(c, operationResult(h.service.ListScheduledJobRuns(c.Request.Context(), c.Param("code"), limit)))
+}
+
+// ControlScheduledJob serves the pause, resume and run actions; the action
+// is the last path segment.
+func (h *OperationsHandler) ControlScheduledJob(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := idempotencyKey(c)
+		if !ok {
+			return
+		}
+		if err := h.service.ControlScheduledJob(c.Request.Context(), actorID(c), c.Param("code"), action, key); err != nil {
+			operationError(c, err)
+			return
+		}
+		respondOK(c, gin.H{"job": c.Param("code"), "action": action})
+	}
+}
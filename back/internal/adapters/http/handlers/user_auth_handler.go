@@ -38,6 +38,7 @@ type userUpdatePayload struct {
 	Email    *string `json:"email"`
 	FullName *string `json:"full_name"`
 	Phone    *string `json:"phone"`
+	Locale   *string `json:"preferred_locale"`
 }
 type changePasswordPayload struct {
 	CurrentPassword string `json:"current_password"`
@@ -167,7 +168,7 @@ func (h *UserAuthHandler) UpdateMe(c *gin.Context) {
 		respondError(c, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	user, err := h.service.UpdateMe(c.Request.Context(), idStr, payload.FullName, payload.Phone, payload.Email)
+	user, err := h.service.UpdateMe(c.Request.Context(), idStr, payload.FullName, payload.Phone, payload.Email, payload.Locale)
 	if err != nil {
 		switch err {
 		case usecase.ErrEmailExists:
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) UserDelegations(c *gin.Context) {
+	items, err := h.service.ListUserDelegations(c.Request.Context(), actorID(c), c.Query("active") == "true")
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, items)
+}
+
+func (h *OperationsHandler) CreateUserDelegation(c *gin.Context) {
+	p, ok := bindOperation[usecase.UserDelegationPayload](c)
+	if !ok {
+		return
+	}
+	v, err := h.service.CreateUserDelegation(c.Request.Context(), actorID(c), p)
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	respondCreated(c, v)
+}
+
+func (h *OperationsHandler) RevokeUserDelegation(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.RevokeUserDelegation(c.Request.Context(), actorID(c), id); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"revoked": true})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) WebhookSubscriptions(c *gin.Context) {
+	okOrError(c, operationResult(h.service.ListWebhookSubscriptions(c.Request.Context())))
+}
+func (h *OperationsHandler) CreateWebhookSubscription(c *gin.Context) {
+	key, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WebhookSubscriptionPayload](c)
+	if !ok {
+		return
+	}
+	createdOrError(c, operationResult(h.service.CreateWebhookSubscription(c.Request.Context(), actorID(c), key, p)))
+}
+func (h *OperationsHandler) UpdateWebhookSubscription(c *gin.Context) {
+	key, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WebhookSubscriptionPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.UpdateWebhookSubscription(c.Request.Context(), actorID(c), c.Param("id"), key, p)))
+}
+func (h *OperationsHandler) WebhookDeliveries(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	okOrError(c, operationResult(h.service.ListWebhookDeliveries(c.Request.Context(), c.Query("subscription_id"), c.Query("status"), limit)))
+}
+func (h *OperationsHandler) RetryWebhookDelivery(c *gin.Context) {
+	key, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+	if err := h.service.RetryWebhookDelivery(c.Request.Context(), actorID(c), c.Param("id"), key); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"queued": true})
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) SaveWorkflowStepApprovalLevels(c *gin.Context) {
+	id, ok := int64Param(c, "stepId")
+	if !ok {
+		return
+	}
+	levels, ok := bindOperation[[]usecase.WorkflowStepApprovalLevel](c)
+	if !ok {
+		return
+	}
+	if err := h.service.SaveWorkflowStepApprovalLevels(c.Request.Context(), actorID(c), id, levels); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"saved": true})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) ExportWorkflowTemplate(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.ExportWorkflowTemplate(c.Request.Context(), id)))
+}
+
+func (h *OperationsHandler) ImportWorkflowTemplate(c *gin.Context) {
+	p, ok := bindOperation[usecase.WorkflowTemplateImportPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.ImportWorkflowTemplate(c.Request.Context(), actorID(c), p)))
+}
+
+func (h *OperationsHandler) MigrateWorkflowInstances(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WorkflowInstanceMigrationPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.MigrateWorkflowInstances(c.Request.Context(), actorID(c), id, p)))
+}
+
+func (h *OperationsHandler) SimulateWorkflowTemplate(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WorkflowSimulationPayload](c)
+	if !ok {
+		return
+	}
+	okOrError(c, operationResult(h.service.SimulateWorkflowTemplate(c.Request.Context(), id, p)))
+}
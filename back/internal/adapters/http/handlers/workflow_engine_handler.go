@@ -105,13 +105,35 @@ func (h *OperationsHandler) PublishWorkflowTemplate(c *gin.Context) {
 	if !ok {
 		return
 	}
-	if err := h.service.PublishWorkflowTemplate(c.Request.Context(), actorID(c), id); err != nil {
+	var p usecase.WorkflowPublishPayload
+	if c.Request.ContentLength != 0 {
+		if p, ok = bindOperation[usecase.WorkflowPublishPayload](c); !ok {
+			return
+		}
+	}
+	if err := h.service.PublishWorkflowTemplate(c.Request.Context(), actorID(c), id, p); err != nil {
 		operationError(c, err)
 		return
 	}
 	respondOK(c, gin.H{"published": true})
 }
 
+func (h *OperationsHandler) DiffWorkflowTemplates(c *gin.Context) {
+	id, ok := int64Param(c, "id")
+	if !ok {
+		return
+	}
+	var from int64
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil || from <= 0 {
+			respondError(c, http.StatusBadRequest, "invalid from")
+			return
+		}
+	}
+	okOrError(c, operationResult(h.service.DiffWorkflowTemplateVersions(c.Request.Context(), from, id)))
+}
+
 func (h *OperationsHandler) ArchiveWorkflowTemplate(c *gin.Context) {
 	id, ok := int64Param(c, "id")
 	if !ok {
@@ -452,6 +474,18 @@ func (h *OperationsHandler) SubmitWorkflowStep(c *gin.Context) {
 	respondOK(c, gin.H{"submitted": true})
 }
 
+func (h *OperationsHandler) AccountSubmitWorkflowStep(c *gin.Context) {
+	p, ok := bindOperation[usecase.StepValuesPayload](c)
+	if !ok {
+		return
+	}
+	if err := h.service.SubmitCustomerWorkflowStep(c.Request.Context(), actorID(c), c.Param("id"), p); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"submitted": true})
+}
+
 func (h *OperationsHandler) ApproveWorkflowStep(c *gin.Context) {
 	h.stepReason(c, h.service.ApproveWorkflowStep, "approved")
 }
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"sangehassan/back/internal/usecase"
+)
+
+func (h *OperationsHandler) SaveWorkflowStepSLA(c *gin.Context) {
+	id, ok := int64Param(c, "stepId")
+	if !ok {
+		return
+	}
+	p, ok := bindOperation[usecase.WorkflowStepSLAPolicy](c)
+	if !ok {
+		return
+	}
+	if err := h.service.SaveWorkflowStepSLA(c.Request.Context(), actorID(c), id, p); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"saved": true})
+}
+
+func (h *OperationsHandler) DeleteWorkflowStepSLA(c *gin.Context) {
+	id, ok := int64Param(c, "stepId")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteWorkflowStepSLA(c.Request.Context(), actorID(c), id); err != nil {
+		operationError(c, err)
+		return
+	}
+	respondOK(c, gin.H{"deleted": true})
+}
@@ -154,6 +154,9 @@ func NewRouter(
 			v1.POST("/saved-views", operationsMiddleware.RequireInternal, operationsHandler.CreateSavedView)
 			v1.PUT("/saved-views/:id", operationsMiddleware.RequireInternal, operationsHandler.UpdateSavedView)
 			v1.DELETE("/saved-views/:id", operationsMiddleware.RequireInternal, operationsHandler.DeleteSavedView)
+			v1.GET("/delegations", operationsMiddleware.RequireInternal, operationsHandler.UserDelegations)
+			v1.POST("/delegations", operationsMiddleware.RequireInternal, operationsHandler.CreateUserDelegation)
+			v1.POST("/delegations/:id/revoke", operationsMiddleware.RequireInternal, operationsHandler.RevokeUserDelegation)
 			v1.GET("/dashboard/action-items", operationsMiddleware.RequirePermission("action_items.view_own"), operationsHandler.ActionItems)
 			v1.GET("/dashboard/workflow-templates", operationsMiddleware.RequirePermission("workflow_templates.view"), operationsHandler.Workflows)
 			v1.GET("/dashboard/workflow-summary", operationsMiddleware.RequirePermission("dashboard.internal.view"), operationsHandler.WorkflowDashboard)
@@ -203,6 +206,7 @@ func NewRouter(
 			v1.POST("/costs/:id/cancel", operationsMiddleware.RequirePermission("finance.costs.approve"), operationsHandler.CancelCost)
 
 			v1.GET("/notifications", operationsMiddleware.RequirePermission("notifications.view_own"), operationsHandler.Notifications)
+			v1.GET("/notifications/stream", operationsMiddleware.RequireUser, operationsHandler.NotificationStream)
 			v1.POST("/notifications/read-all", operationsMiddleware.RequirePermission("notifications.view_own"), operationsHandler.ReadAllNotifications)
 			v1.POST("/notifications/:id/read", operationsMiddleware.RequirePermission("notifications.view_own"), operationsHandler.ReadNotification)
 			v1.GET("/notifications/preferences", operationsMiddleware.RequirePermission("notifications.preferences.manage"), operationsHandler.NotificationPreferences)
@@ -229,6 +233,8 @@ func NewRouter(
 			v1.GET("/account/orders/:id/payments", operationsMiddleware.RequirePermission("customer_portal.payments.view_own"), operationsMiddleware.RequireFeature("customer_portal_enabled"), operationsHandler.AccountPayments)
 			v1.GET("/account/orders/:id/documents", operationsMiddleware.RequirePermission("customer_portal.documents.view_own"), operationsMiddleware.RequireFeature("customer_portal_enabled"), operationsHandler.AccountDocuments)
 			v1.GET("/account/documents/:id/download", operationsMiddleware.RequirePermission("customer_portal.documents.view_own"), operationsMiddleware.RequireFeature("customer_portal_enabled"), operationsHandler.DownloadAccountDocument)
+			v1.POST("/account/workflow-steps/:id/submit", operationsMiddleware.RequirePermission("customer_portal.workflow.submit_own"), operationsMiddleware.RequireFeature("customer_portal_enabled"), operationsHandler.AccountSubmitWorkflowStep)
+			v1.POST("/account/workflow-steps/:id/files", operationsMiddleware.RequirePermission("customer_portal.workflow.submit_own"), operationsMiddleware.RequireFeature("customer_portal_enabled"), workflowFileHandler.Upload)
 
 			v1.GET("/dashboard/operations-summary", operationsMiddleware.RequirePermission("dashboard.internal.view"), operationsHandler.OperationsDashboardSummary)
 			v1.GET("/orders/:id/items", operationsMiddleware.RequirePermission("orders.view_all"), operationsHandler.OrderItems)
@@ -351,8 +357,25 @@ func NewRouter(
 				opsAdmin.POST("/exchange-rates", operationsMiddleware.RequirePermission("finance.exchange_rates.manage"), operationsHandler.SaveExchangeRate)
 				opsAdmin.GET("/notification-templates", operationsMiddleware.RequirePermission("notifications.templates.manage"), operationsHandler.NotificationTemplates)
 				opsAdmin.PUT("/notification-templates/:id", operationsMiddleware.RequirePermission("notifications.templates.manage"), operationsHandler.UpdateNotificationTemplate)
+				opsAdmin.POST("/notification-templates/:id/preview", operationsMiddleware.RequirePermission("notifications.templates.manage"), operationsHandler.PreviewNotificationTemplate)
+				opsAdmin.POST("/notification-templates/:id/test-send", operationsMiddleware.RequirePermission("notifications.templates.manage"), operationsHandler.TestSendNotificationTemplate)
 				opsAdmin.GET("/notification-deliveries", operationsMiddleware.RequireAnyPermission("notifications.delivery.view", "notifications.deliveries.retry", "notifications.retry"), operationsHandler.NotificationDeliveries)
 				opsAdmin.POST("/notification-deliveries/:id/retry", operationsMiddleware.RequireAnyPermission("notifications.deliveries.retry", "notifications.retry"), operationsHandler.RetryNotification)
+				opsAdmin.GET("/webhooks", operationsMiddleware.RequireAnyPermission("webhooks.view", "webhooks.manage"), operationsHandler.WebhookSubscriptions)
+				opsAdmin.POST("/webhooks", operationsMiddleware.RequirePermission("webhooks.manage"), operationsHandler.CreateWebhookSubscription)
+				opsAdmin.PUT("/webhooks/:id", operationsMiddleware.RequirePermission("webhooks.manage"), operationsHandler.UpdateWebhookSubscription)
+				opsAdmin.GET("/webhook-deliveries", operationsMiddleware.RequireAnyPermission("webhooks.view", "webhooks.manage"), operationsHandler.WebhookDeliveries)
+				opsAdmin.POST("/webhook-deliveries/:id/retry", operationsMiddleware.RequirePermission("webhooks.manage"), operationsHandler.RetryWebhookDelivery)
+				opsAdmin.GET("/scheduled-jobs", operationsMiddleware.RequireAnyPermission("scheduled_jobs.view", "scheduled_jobs.manage"), operationsHandler.ScheduledJobs)
+				opsAdmin.GET("/scheduled-jobs/:code/runs", operationsMiddleware.RequireAnyPermission("scheduled_jobs.view", "scheduled_jobs.manage"), operationsHandler.ScheduledJobRuns)
+				opsAdmin.POST("/scheduled-jobs/:code/pause", operationsMiddleware.RequirePermission("scheduled_jobs.manage"), operationsHandler.ControlScheduledJob("pause"))
+				opsAdmin.POST("/scheduled-jobs/:code/resume", operationsMiddleware.RequirePermission("scheduled_jobs.manage"), operationsHandler.ControlScheduledJob("resume"))
+				opsAdmin.POST("/scheduled-jobs/:code/run", operationsMiddleware.RequirePermission("scheduled_jobs.manage"), operationsHandler.ControlScheduledJob("run"))
+				opsAdmin.GET("/business-calendar", operationsMiddleware.RequireAnyPermission("business_calendar.view", "business_calendar.manage"), operationsHandler.BusinessCalendar)
+				opsAdmin.PUT("/business-calendar/hours", operationsMiddleware.RequirePermission("business_calendar.manage"), operationsHandler.SaveBusinessCalendarHours)
+				opsAdmin.POST("/business-calendar/days", operationsMiddleware.RequirePermission("business_calendar.manage"), operationsHandler.SaveBusinessCalendarDay)
+				opsAdmin.DELETE("/business-calendar/days/:id", operationsMiddleware.RequirePermission("business_calendar.manage"), operationsHandler.DeleteBusinessCalendarDay)
+				opsAdmin.POST("/business-calendar/import", operationsMiddleware.RequirePermission("business_calendar.manage"), operationsHandler.ImportBusinessCalendar)
 				opsAdmin.GET("/document-templates", operationsMiddleware.RequireAnyPermission("document_templates.manage", "documents.templates.manage"), operationsHandler.DocumentTemplates)
 				opsAdmin.PUT("/document-templates/:id", operationsMiddleware.RequireAnyPermission("document_templates.manage", "documents.templates.manage"), operationsHandler.UpdateDocumentTemplate)
 				opsAdmin.GET("/reports/overview", operationsMiddleware.RequirePermission("reports.overview.view"), operationsHandler.ReportOverview)
@@ -360,6 +383,8 @@ func NewRouter(
 				opsAdmin.GET("/reports/costs", operationsMiddleware.RequirePermission("reports.costs.view"), operationsHandler.ReportCosts)
 				opsAdmin.GET("/reports/profitability", operationsMiddleware.RequirePermission("reports.profitability.view"), operationsHandler.ReportProfitability)
 				opsAdmin.GET("/reports/operations", operationsMiddleware.RequirePermission("reports.operations.view"), operationsHandler.ReportOperations)
+				opsAdmin.GET("/reports/workflow/:kind", operationsMiddleware.RequirePermission("reports.operations.view"), operationsHandler.ReportWorkflowAnalytics)
+				opsAdmin.GET("/reports/workload", operationsMiddleware.RequirePermission("reports.operations.view"), operationsHandler.ReportWorkload)
 				opsAdmin.GET("/reports/sales", operationsMiddleware.RequirePermission("reports.sales.view"), operationsHandler.ReportSales)
 				opsAdmin.GET("/users", operationsMiddleware.RequirePermission("users.view"), operationsHandler.Users)
 				opsAdmin.POST("/users", operationsMiddleware.RequirePermission("users.create"), operationsHandler.CreateUser)
@@ -381,9 +406,14 @@ func NewRouter(
 				{
 					workflowAdmin.GET("", operationsHandler.WorkflowTemplateVersions)
 					workflowAdmin.POST("", operationsHandler.CreateWorkflowTemplate)
+					workflowAdmin.POST("/import", operationsHandler.ImportWorkflowTemplate)
 					workflowAdmin.GET("/:id", operationsHandler.WorkflowTemplateVersion)
 					workflowAdmin.PATCH("/:id", operationsHandler.UpdateWorkflowTemplate)
 					workflowAdmin.POST("/:id/clone", operationsHandler.CloneWorkflowTemplate)
+					workflowAdmin.GET("/:id/export", operationsHandler.ExportWorkflowTemplate)
+					workflowAdmin.GET("/:id/diff", operationsHandler.DiffWorkflowTemplates)
+					workflowAdmin.POST("/:id/simulate", operationsHandler.SimulateWorkflowTemplate)
+					workflowAdmin.POST("/:id/migrate-instances", operationsMiddleware.RequirePermission("workflow_instances.migrate"), operationsHandler.MigrateWorkflowInstances)
 					workflowAdmin.POST("/:id/publish", operationsMiddleware.RequirePermission("workflow_templates.publish"), operationsHandler.PublishWorkflowTemplate)
 					workflowAdmin.POST("/:id/archive", operationsMiddleware.RequirePermission("workflow_templates.archive"), operationsHandler.ArchiveWorkflowTemplate)
 					workflowAdmin.POST("/:id/steps", operationsHandler.AddWorkflowStep)
@@ -391,6 +421,9 @@ func NewRouter(
 					workflowAdmin.PATCH("/:id/steps/:stepId", operationsHandler.UpdateWorkflowStep)
 					workflowAdmin.DELETE("/:id/steps/:stepId", operationsHandler.DeleteWorkflowStep)
 					workflowAdmin.POST("/:id/steps/:stepId/duplicate", operationsHandler.DuplicateWorkflowStep)
+					workflowAdmin.PUT("/:id/steps/:stepId/sla", operationsHandler.SaveWorkflowStepSLA)
+					workflowAdmin.DELETE("/:id/steps/:stepId/sla", operationsHandler.DeleteWorkflowStepSLA)
+					workflowAdmin.PUT("/:id/steps/:stepId/approval-levels", operationsHandler.SaveWorkflowStepApprovalLevels)
 					workflowAdmin.POST("/:id/steps/:stepId/fields", operationsHandler.AddWorkflowField)
 					workflowAdmin.PUT("/:id/steps/:stepId/fields/reorder", operationsHandler.ReorderWorkflowFields)
 					workflowAdmin.PATCH("/:id/steps/:stepId/fields/:fieldId", operationsHandler.UpdateWorkflowField)
@@ -408,6 +441,7 @@ func NewRouter(
 					workflowAdmin.POST("/:id/transitions", operationsMiddleware.RequirePermission("workflow_transitions.manage"), operationsHandler.CreateWorkflowTransition)
 					workflowAdmin.PATCH("/:id/transitions/:transitionId", operationsMiddleware.RequirePermission("workflow_transitions.manage"), operationsHandler.UpdateWorkflowTransition)
 					workflowAdmin.DELETE("/:id/transitions/:transitionId", operationsMiddleware.RequirePermission("workflow_transitions.manage"), operationsHandler.DeleteWorkflowTransition)
+					workflowAdmin.POST("/:id/transitions/dry-run", operationsMiddleware.RequirePermission("workflow_transitions.manage"), operationsHandler.DryRunWorkflowConditions)
 					workflowAdmin.GET("/:id/document-requirements", operationsMiddleware.RequirePermission("workflow_document_requirements.manage"), operationsHandler.DocumentRequirements)
 					workflowAdmin.POST("/:id/document-requirements", operationsMiddleware.RequirePermission("workflow_document_requirements.manage"), operationsHandler.SaveDocumentRequirement)
 					workflowAdmin.DELETE("/:id/document-requirements/:requirementId", operationsMiddleware.RequirePermission("workflow_document_requirements.manage"), operationsHandler.DeleteDocumentRequirement)
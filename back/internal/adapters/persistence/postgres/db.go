@@ -11,9 +11,12 @@ import (
 	"sangehassan/back/internal/config"
 )
 
+func dataSourceName(cfg config.Config) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode)
+}
+
 func NewDB(cfg config.Config) (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode)
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", dataSourceName(cfg))
 	if err != nil {
 		return nil, err
 	}
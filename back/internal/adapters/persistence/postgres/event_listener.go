@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"sangehassan/back/internal/config"
+)
+
+// ListenEvents relays NOTIFY payloads on channel to publish until ctx ends.
+// The listener uses its own connection outside the pool and reconnects with
+// backoff; publish receives resync after every reconnect because NOTIFY
+// messages sent while disconnected are lost.
+func ListenEvents(ctx context.Context, cfg config.Config, channel, resync string, publish func(string)) error {
+	listener := pq.NewListener(dataSourceName(cfg), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("database_listener_event", "channel", channel, "event", event, "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification marks a re-established connection.
+			if n == nil {
+				publish(resync)
+				continue
+			}
+			publish(n.Extra)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -21,7 +21,7 @@ func (r *UserRepository) Create(ctx context.Context, user domain.User) (domain.U
 		INSERT INTO users (email, password_hash, full_name, phone, phone_normalized, role, is_active, user_type, status)
 		VALUES ($1, $2, $3, $4, $4, COALESCE($5, 'user'), $6, COALESCE(NULLIF($7,''),'CUSTOMER'), CASE WHEN $6 THEN 'ACTIVE' ELSE 'DISABLED' END)
 		RETURNING id, email, password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
 	`, user.Email, user.PasswordHash, user.FullName, user.Phone, user.Role, user.IsActive, user.UserType)
 
 	return scanUser(row)
@@ -37,7 +37,7 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]domain.
 
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, COALESCE(email,''), password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -57,7 +57,7 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]domain.
 		)
 		var phoneNormalized, firstName, lastName sql.NullString
 		var disabledAt sql.NullTime
-		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &fullName, &phone, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt, &lastLogin, &phoneNormalized, &firstName, &lastName, &u.UserType, &u.Status, &u.MustChangePassword, &disabledAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &fullName, &phone, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt, &lastLogin, &phoneNormalized, &firstName, &lastName, &u.UserType, &u.Status, &u.MustChangePassword, &disabledAt, &u.PreferredLocale); err != nil {
 			return nil, err
 		}
 		if fullName.Valid {
@@ -88,7 +88,7 @@ func (r *UserRepository) Count(ctx context.Context) (int, error) {
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, COALESCE(email,''), password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
 		FROM users
 		WHERE email = $1
 	`, email)
@@ -98,7 +98,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (domain.U
 func (r *UserRepository) GetByPhone(ctx context.Context, phone string) (domain.User, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, COALESCE(email,''), password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
 		FROM users
 		WHERE phone_normalized = $1 OR phone = $1
 	`, phone)
@@ -108,7 +108,7 @@ func (r *UserRepository) GetByPhone(ctx context.Context, phone string) (domain.U
 func (r *UserRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, COALESCE(email,''), password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
 		FROM users
 		WHERE id = $1
 	`, id)
@@ -118,11 +118,11 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (domain.User, e
 func (r *UserRepository) UpdateProfile(ctx context.Context, user domain.User) (domain.User, error) {
 	row := r.db.QueryRowContext(ctx, `
 		UPDATE users
-		SET email = $2, full_name = $3, phone = $4, phone_normalized = $4, updated_at = NOW()
+		SET email = $2, full_name = $3, phone = $4, phone_normalized = $4, preferred_locale = COALESCE(NULLIF($5,''), preferred_locale), updated_at = NOW()
 		WHERE id = $1
 		RETURNING id, COALESCE(email,''), password_hash, full_name, phone, role, is_active, created_at, updated_at, last_login_at,
-		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at
-	`, user.ID, user.Email, user.FullName, user.Phone)
+		phone_normalized, first_name, last_name, user_type, status, must_change_password, disabled_at, preferred_locale
+	`, user.ID, user.Email, user.FullName, user.Phone, user.PreferredLocale)
 	return scanUser(row)
 }
 
@@ -142,7 +142,7 @@ func scanUser(row *sql.Row) (domain.User, error) {
 		phoneNormalized, firstName, lastName sql.NullString
 		disabledAt                           sql.NullTime
 	)
-	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &fullName, &phone, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt, &lastLogin, &phoneNormalized, &firstName, &lastName, &u.UserType, &u.Status, &u.MustChangePassword, &disabledAt); err != nil {
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &fullName, &phone, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt, &lastLogin, &phoneNormalized, &firstName, &lastName, &u.UserType, &u.Status, &u.MustChangePassword, &disabledAt, &u.PreferredLocale); err != nil {
 		return domain.User{}, err
 	}
 	if fullName.Valid {
@@ -0,0 +1,126 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const maxProviderResponseBytes = 64 * 1024
+
+// HTTPProvider talks to a JSON gateway exposing
+// POST {base}/messages and GET {base}/messages/{id}.
+type HTTPProvider struct {
+	baseURL string
+	apiKey  string
+	sender  string
+	client  *http.Client
+}
+
+func NewHTTPProvider(baseURL, apiKey, sender string, timeout time.Duration) (*HTTPProvider, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	parsed, err := url.Parse(baseURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("sms base url is invalid")
+	}
+	if strings.TrimSpace(apiKey) == "" || strings.TrimSpace(sender) == "" {
+		return nil, errors.New("sms api key and sender are required")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPProvider{baseURL: baseURL, apiKey: apiKey, sender: sender, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (*HTTPProvider) Name() string { return "http" }
+
+func (p *HTTPProvider) SendMessage(ctx context.Context, recipient, message string) (string, error) {
+	body, err := json.Marshal(map[string]string{"from": p.sender, "to": recipient, "text": message})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		MessageID string `json:"message_id"`
+		ID        string `json:"id"`
+	}
+	if err = p.do(ctx, http.MethodPost, p.baseURL+"/messages", body, &out); err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(out.MessageID)
+	if id == "" {
+		id = strings.TrimSpace(out.ID)
+	}
+	if id == "" {
+		return "", errors.New("sms provider returned no message id")
+	}
+	return id, nil
+}
+
+func (p *HTTPProvider) GetDeliveryStatus(ctx context.Context, providerMessageID string) (string, error) {
+	if strings.TrimSpace(providerMessageID) == "" {
+		return "", errors.New("provider message id is required")
+	}
+	var out struct {
+		Status string `json:"status"`
+	}
+	if err := p.do(ctx, http.MethodGet, p.baseURL+"/messages/"+url.PathEscape(providerMessageID), nil, &out); err != nil {
+		return "", err
+	}
+	return normalizeDeliveryStatus(out.Status)
+}
+
+func (p *HTTPProvider) do(ctx context.Context, method, endpoint string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponseBytes))
+	if err != nil {
+		return fmt.Errorf("sms provider response unreadable: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sms provider responded with HTTP %d", resp.StatusCode)
+	}
+	if err = json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("sms provider response is not valid JSON: %w", err)
+	}
+	return nil
+}
+
+// normalizeDeliveryStatus maps gateway vocabularies onto the outbox delivery
+// states: SENT (accepted, not yet final), DELIVERED, UNDELIVERED and EXPIRED.
+func normalizeDeliveryStatus(raw string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(raw)) {
+	case "DELIVERED", "DELIVRD":
+		return "DELIVERED", nil
+	case "SENT", "ACCEPTED", "QUEUED", "PENDING", "ENROUTE", "SUBMITTED":
+		return "SENT", nil
+	case "UNDELIVERED", "UNDELIV", "FAILED", "REJECTED", "BLOCKED":
+		return "UNDELIVERED", nil
+	case "EXPIRED":
+		return "EXPIRED", nil
+	default:
+		return "", fmt.Errorf("unknown sms delivery status %q", raw)
+	}
+}
@@ -0,0 +1,88 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sangehassan/back/internal/config"
+)
+
+func newGatewayStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	sent := map[string]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload["from"] != "3000" || payload["to"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		id := "msg-" + payload["to"]
+		sent[id] = payload["text"]
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"message_id": id})
+	})
+	mux.HandleFunc("/messages/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/messages/")
+		mu.Lock()
+		_, ok := sent[id]
+		mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "delivrd"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPProviderSendAndStatus(t *testing.T) {
+	server := newGatewayStandIn(t)
+	provider, err := NewHTTPProvider(server.URL+"/", "test-key", "3000", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := provider.SendMessage(context.Background(), "+989123456789", "پیام تست")
+	if err != nil || id != "msg-+989123456789" {
+		t.Fatalf("send id=%q err=%v", id, err)
+	}
+	status, err := provider.GetDeliveryStatus(context.Background(), id)
+	if err != nil || status != "DELIVERED" {
+		t.Fatalf("status=%q err=%v", status, err)
+	}
+	if _, err = provider.GetDeliveryStatus(context.Background(), "missing"); err == nil {
+		t.Fatal("unknown message accepted")
+	}
+	rejected, _ := NewHTTPProvider(server.URL, "wrong-key", "3000", time.Second)
+	if _, err = rejected.SendMessage(context.Background(), "+989123456789", "x"); err == nil || strings.Contains(err.Error(), "wrong-key") {
+		t.Fatalf("unauthorized send err=%v", err)
+	}
+}
+
+func TestProviderRegistry(t *testing.T) {
+	server := newGatewayStandIn(t)
+	provider, err := NewProvider(config.Config{SMSProvider: "http", SMSBaseURL: server.URL, SMSAPIKey: "test-key", SMSSender: "3000", SMSTimeout: time.Second})
+	if err != nil || provider.Name() != "http" {
+		t.Fatalf("provider=%v err=%v", provider, err)
+	}
+	if _, err = NewProvider(config.Config{SMSProvider: "fake", AppEnv: "production"}); err == nil {
+		t.Fatal("fake provider accepted in production")
+	}
+	if _, err = NewProvider(config.Config{SMSProvider: "carrier-pigeon"}); err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+}
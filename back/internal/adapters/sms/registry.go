@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sangehassan/back/internal/config"
+	"sangehassan/back/internal/usecase"
+)
+
+type Factory func(cfg config.Config) (usecase.SMSProvider, error)
+
+var factories = map[string]Factory{
+	"disabled": func(config.Config) (usecase.SMSProvider, error) { return usecase.DisabledSMSProvider{}, nil },
+	"fake": func(cfg config.Config) (usecase.SMSProvider, error) {
+		if strings.EqualFold(cfg.AppEnv, "production") {
+			return nil, fmt.Errorf("sms provider fake is not allowed in production")
+		}
+		return &usecase.FakeSMSProvider{}, nil
+	},
+	"http": func(cfg config.Config) (usecase.SMSProvider, error) {
+		return NewHTTPProvider(cfg.SMSBaseURL, cfg.SMSAPIKey, cfg.SMSSender, cfg.SMSTimeout)
+	},
+}
+
+// Register adds or replaces a named provider factory. It is intended for
+// process start-up only and is not safe for concurrent use.
+func Register(name string, factory Factory) {
+	factories[strings.ToLower(strings.TrimSpace(name))] = factory
+}
+
+// Registered reports whether a provider factory exists for name. SMS_PROVIDER
+// is checked against the registry rather than a fixed list, so providers
+// added with Register are accepted without touching the configuration.
+func Registered(name string) bool {
+	_, ok := factories[strings.ToLower(strings.TrimSpace(name))]
+	return ok
+}
+
+func Names() []string {
+	out := make([]string, 0, len(factories))
+	for name := range factories {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func NewProvider(cfg config.Config) (usecase.SMSProvider, error) {
+	if !Registered(cfg.SMSProvider) {
+		return nil, fmt.Errorf("SMS_PROVIDER %q is not registered; use one of %s", cfg.SMSProvider, strings.Join(Names(), ", "))
+	}
+	return factories[strings.ToLower(strings.TrimSpace(cfg.SMSProvider))](cfg)
+}
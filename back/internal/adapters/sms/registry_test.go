@@ -0,0 +1,26 @@
+package sms
+
+import (
+	"testing"
+
+	"sangehassan/back/internal/config"
+	"sangehassan/back/internal/usecase"
+)
+
+func TestNewProviderUsesRegistry(t *testing.T) {
+	if _, err := NewProvider(config.Config{SMSProvider: "acme"}); err == nil {
+		t.Fatal("expected an unregistered provider to be rejected")
+	}
+	Register("Acme", func(config.Config) (usecase.SMSProvider, error) { return &usecase.FakeSMSProvider{}, nil })
+	t.Cleanup(func() { delete(factories, "acme") })
+	if !Registered("acme") {
+		t.Fatal("expected acme to be registered")
+	}
+	provider, err := NewProvider(config.Config{SMSProvider: "acme"})
+	if err != nil {
+		t.Fatalf("NewProvider() returned error: %v", err)
+	}
+	if _, ok := provider.(*usecase.FakeSMSProvider); !ok {
+		t.Fatalf("provider=%T", provider)
+	}
+}
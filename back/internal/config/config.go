@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"net/mail"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -33,7 +34,21 @@ type Config struct {
 	BootstrapSuperAdminFirstName string
 	BootstrapSuperAdminLastName  string
 	SMSProvider                  string
+	SMSBaseURL                   string
+	SMSAPIKey                    string
+	SMSSender                    string
+	SMSTimeout                   time.Duration
+	EmailProvider                string
+	SMTPHost                     string
+	SMTPPort                     int
+	SMTPUsername                 string
+	SMTPPassword                 string
+	SMTPFrom                     string
+	SMTPTimeout                  time.Duration
+	WebhookTimeout               time.Duration
 	WorkerPollSeconds            int
+	WorkerHealthAddr             string
+	WorkerShutdownTimeout        time.Duration
 	NotificationRetrySchedule    []time.Duration
 	DBMaxOpenConns               int
 	DBMaxIdleConns               int
@@ -74,7 +89,21 @@ func Load() (Config, error) {
 		BootstrapSuperAdminFirstName: getEnv("BOOTSTRAP_SUPER_ADMIN_FIRST_NAME", ""),
 		BootstrapSuperAdminLastName:  getEnv("BOOTSTRAP_SUPER_ADMIN_LAST_NAME", ""),
 		SMSProvider:                  strings.ToLower(getEnv("SMS_PROVIDER", "disabled")),
+		SMSBaseURL:                   strings.TrimRight(getEnv("SMS_BASE_URL", ""), "/"),
+		SMSAPIKey:                    getEnv("SMS_API_KEY", ""),
+		SMSSender:                    getEnv("SMS_SENDER", ""),
+		SMSTimeout:                   durationDefault(getEnv("SMS_TIMEOUT", "10s"), 10*time.Second),
+		EmailProvider:                strings.ToLower(getEnv("EMAIL_PROVIDER", "disabled")),
+		SMTPHost:                     getEnv("SMTP_HOST", ""),
+		SMTPPort:                     atoiDefault(getEnv("SMTP_PORT", "587"), 587),
+		SMTPUsername:                 getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                 getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                     getEnv("SMTP_FROM", ""),
+		SMTPTimeout:                  durationDefault(getEnv("SMTP_TIMEOUT", "15s"), 15*time.Second),
+		WebhookTimeout:               durationDefault(getEnv("WEBHOOK_TIMEOUT", "10s"), 10*time.Second),
 		WorkerPollSeconds:            atoiDefault(getEnv("WORKER_POLL_SECONDS", "30"), 30),
+		WorkerHealthAddr:             workerHealthAddr(getEnv("WORKER_HEALTH_ADDR", "127.0.0.1:8081")),
+		WorkerShutdownTimeout:        durationDefault(getEnv("WORKER_SHUTDOWN_TIMEOUT", "60s"), 60*time.Second),
 		DBMaxOpenConns:               atoiDefault(getEnv("DB_MAX_OPEN_CONNS", "20"), 20),
 		DBMaxIdleConns:               atoiDefault(getEnv("DB_MAX_IDLE_CONNS", "10"), 10),
 		DBConnMaxLifetime:            durationDefault(getEnv("DB_CONN_MAX_LIFETIME", "30m"), 30*time.Minute),
@@ -151,8 +180,28 @@ func Load() (Config, error) {
 			return Config{}, errors.New("WORKFLOW_FILE_DIR must be outside the public UPLOAD_DIR")
 		}
 	}
-	if cfg.SMSProvider != "disabled" && cfg.SMSProvider != "fake" {
-		return Config{}, errors.New("SMS_PROVIDER must be disabled or fake")
+	if cfg.SMSProvider == "http" {
+		parsed, parseErr := url.Parse(cfg.SMSBaseURL)
+		if parseErr != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return Config{}, errors.New("SMS_BASE_URL must be an absolute HTTP(S) URL")
+		}
+		if strings.EqualFold(cfg.AppEnv, "production") && parsed.Scheme != "https" {
+			return Config{}, errors.New("SMS_BASE_URL must use HTTPS in production")
+		}
+		if cfg.SMSAPIKey == "" || cfg.SMSSender == "" {
+			return Config{}, errors.New("SMS_API_KEY and SMS_SENDER are required for the http SMS provider")
+		}
+	}
+	if cfg.EmailProvider != "disabled" && cfg.EmailProvider != "smtp" {
+		return Config{}, errors.New("EMAIL_PROVIDER must be disabled or smtp")
+	}
+	if cfg.EmailProvider == "smtp" {
+		if cfg.SMTPHost == "" || cfg.SMTPPort <= 0 || cfg.SMTPPort > 65535 {
+			return Config{}, errors.New("SMTP_HOST and a valid SMTP_PORT are required for the smtp email provider")
+		}
+		if _, parseErr := mail.ParseAddress(cfg.SMTPFrom); parseErr != nil {
+			return Config{}, errors.New("SMTP_FROM must be a valid email address")
+		}
 	}
 
 	return cfg, nil
@@ -179,6 +228,15 @@ func parseDurations(raw string) []time.Duration {
 	return result
 }
 
+// workerHealthAddr turns the "off" sentinel into an empty address, which
+// disables the worker health listener.
+func workerHealthAddr(value string) string {
+	if strings.EqualFold(value, "off") {
+		return ""
+	}
+	return value
+}
+
 func getEnv(key, fallback string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
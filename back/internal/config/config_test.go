@@ -18,9 +18,13 @@ func setProductionBaseline(t *testing.T) {
 func TestProductionConfigurationValidation(t *testing.T) {
 	t.Run("valid baseline", func(t *testing.T) {
 		setProductionBaseline(t)
-		if _, err := Load(); err != nil {
+		cfg, err := Load()
+		if err != nil {
 			t.Fatalf("Load() returned error: %v", err)
 		}
+		if cfg.WorkerHealthAddr != "127.0.0.1:8081" {
+			t.Fatalf("WorkerHealthAddr=%q, want loopback by default", cfg.WorkerHealthAddr)
+		}
 	})
 	t.Run("short JWT", func(t *testing.T) {
 		setProductionBaseline(t)
@@ -43,6 +47,57 @@ func TestProductionConfigurationValidation(t *testing.T) {
 			t.Fatal("expected fake production SMS provider to be rejected")
 		}
 	})
+	t.Run("SMS provider left to the registry", func(t *testing.T) {
+		setProductionBaseline(t)
+		t.Setenv("SMS_PROVIDER", "Acme")
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() returned error: %v", err)
+		}
+		if cfg.SMSProvider != "acme" {
+			t.Fatalf("SMSProvider=%q", cfg.SMSProvider)
+		}
+	})
+	t.Run("http SMS", func(t *testing.T) {
+		setProductionBaseline(t)
+		t.Setenv("SMS_PROVIDER", "http")
+		t.Setenv("SMS_BASE_URL", "https://sms.example.test/v1/")
+		t.Setenv("SMS_API_KEY", "test-only")
+		t.Setenv("SMS_SENDER", "3000")
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() returned error: %v", err)
+		}
+		if cfg.SMSBaseURL != "https://sms.example.test/v1" {
+			t.Fatalf("SMSBaseURL=%q", cfg.SMSBaseURL)
+		}
+	})
+	t.Run("insecure SMS base URL", func(t *testing.T) {
+		setProductionBaseline(t)
+		t.Setenv("SMS_PROVIDER", "http")
+		t.Setenv("SMS_BASE_URL", "http://sms.example.test")
+		t.Setenv("SMS_API_KEY", "test-only")
+		t.Setenv("SMS_SENDER", "3000")
+		if _, err := Load(); err == nil {
+			t.Fatal("expected a non-HTTPS production SMS base URL to be rejected")
+		}
+	})
+	t.Run("http SMS without credentials", func(t *testing.T) {
+		setProductionBaseline(t)
+		t.Setenv("SMS_PROVIDER", "http")
+		t.Setenv("SMS_BASE_URL", "https://sms.example.test")
+		if _, err := Load(); err == nil {
+			t.Fatal("expected the http SMS provider without credentials to be rejected")
+		}
+	})
+	t.Run("smtp email without sender", func(t *testing.T) {
+		setProductionBaseline(t)
+		t.Setenv("EMAIL_PROVIDER", "smtp")
+		t.Setenv("SMTP_HOST", "smtp.example.test")
+		if _, err := Load(); err == nil {
+			t.Fatal("expected the smtp email provider without SMTP_FROM to be rejected")
+		}
+	})
 	t.Run("insecure origin", func(t *testing.T) {
 		setProductionBaseline(t)
 		t.Setenv("ALLOWED_ORIGINS", "http://example.test")
@@ -20,6 +20,7 @@ type User struct {
 	Status             string
 	MustChangePassword bool
 	DisabledAt         *time.Time
+	PreferredLocale    string
 }
 
 // UserInfo is safe to expose to clients.
@@ -38,6 +39,7 @@ type UserInfo struct {
 	Roles              []string   `json:"roles"`
 	Permissions        []string   `json:"permissions"`
 	LastLoginAt        *time.Time `json:"last_login_at,omitempty"`
+	PreferredLocale    string     `json:"preferred_locale"`
 }
 
 func (u User) SafeInfo() UserInfo {
@@ -58,5 +60,6 @@ func (u User) SafeInfo() UserInfo {
 		Status:             u.Status,
 		MustChangePassword: u.MustChangePassword,
 		LastLoginAt:        u.LastLoginAt,
+		PreferredLocale:    u.PreferredLocale,
 	}
 }
@@ -0,0 +1,569 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BusinessCalendarHours is one working span of a weekday. Weekday follows
+// time.Weekday (0 is Sunday, 5 is Friday); Start and End are HH:MM on the
+// Tehran clock.
+type BusinessCalendarHours struct {
+	Weekday int    `json:"weekday"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// BusinessCalendarDay overrides the weekly hours on one date. A closed day is
+// a holiday; a working day opens the date with its own Start and End. Days
+// without a location apply everywhere and a location's own day wins over a
+// shared one. Annual days repeat on the same Jalali month and day.
+type BusinessCalendarDay struct {
+	ID             int64   `json:"id"`
+	LocationID     *string `json:"location_id,omitempty"`
+	Date           string  `json:"date"`
+	JalaliDate     string  `json:"jalali_date"`
+	TitleFA        string  `json:"title_fa"`
+	IsWorking      bool    `json:"is_working"`
+	Start          *string `json:"start,omitempty"`
+	End            *string `json:"end,omitempty"`
+	RecursAnnually bool    `json:"recurs_annually"`
+	Source         string  `json:"source"`
+}
+
+type BusinessCalendarView struct {
+	LocationID      *string                 `json:"location_id,omitempty"`
+	HoursOverridden bool                    `json:"hours_overridden"`
+	Hours           []BusinessCalendarHours `json:"hours"`
+	Days            []BusinessCalendarDay   `json:"days"`
+}
+
+// BusinessCalendarHoursPayload replaces the week of the shared calendar or of
+// one location. An empty week removes a location's override.
+type BusinessCalendarHoursPayload struct {
+	LocationID *string                 `json:"location_id"`
+	Hours      []BusinessCalendarHours `json:"hours"`
+}
+
+type BusinessCalendarImportPayload struct {
+	LocationID *string `json:"location_id"`
+	ICS        string  `json:"ics"`
+}
+
+type BusinessCalendarImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+type workingSpan struct{ start, end int }
+
+// businessCalendar is the working time of one location, resolved for a
+// window of dates. days maps YYYY-MM-DD to its spans; a closed day maps to
+// an empty list.
+type businessCalendar struct {
+	week [7][]workingSpan
+	days map[string][]workingSpan
+}
+
+// calendarHorizonDays bounds every walk over the calendar and the window of
+// days loaded for it.
+const calendarHorizonDays = 3 * 366
+
+// defaultBusinessCalendar is the week used when none is configured:
+// Saturday to Wednesday 08:00-17:00 and Thursday 08:00-13:00.
+func defaultBusinessCalendar() businessCalendar {
+	c := businessCalendar{days: map[string][]workingSpan{}}
+	for _, d := range []time.Weekday{time.Saturday, time.Sunday, time.Monday, time.Tuesday, time.Wednesday} {
+		c.week[d] = []workingSpan{{8 * 60, 17 * 60}}
+	}
+	c.week[time.Thursday] = []workingSpan{{8 * 60, 13 * 60}}
+	return c
+}
+
+func (c businessCalendar) spansOn(day time.Time) []workingSpan {
+	if spans, ok := c.days[day.Format("2006-01-02")]; ok {
+		return spans
+	}
+	return c.week[day.Weekday()]
+}
+
+func calendarDay(t time.Time) time.Time {
+	local := t.In(tehranLocation)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, tehranLocation)
+}
+
+func atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, tehranLocation)
+}
+
+// add advances start by d of working time. A calendar without working time
+// inside the horizon falls back to clock hours.
+func (c businessCalendar) add(start time.Time, d time.Duration) time.Time {
+	remaining := d
+	day := calendarDay(start)
+	for i := 0; i < calendarHorizonDays; i++ {
+		for _, span := range c.spansOn(day) {
+			from, to := atMinute(day, span.start), atMinute(day, span.end)
+			if !to.After(start) {
+				continue
+			}
+			if from.Before(start) {
+				from = start
+			}
+			if remaining <= to.Sub(from) {
+				return from.Add(remaining)
+			}
+			remaining -= to.Sub(from)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return start.Add(d)
+}
+
+// workingDaysAfter returns the close of the nth working day after the day of
+// start.
+func (c businessCalendar) workingDaysAfter(start time.Time, n int) time.Time {
+	day := calendarDay(start)
+	for i := 0; i < calendarHorizonDays; i++ {
+		day = day.AddDate(0, 0, 1)
+		spans := c.spansOn(day)
+		if len(spans) == 0 {
+			continue
+		}
+		if n--; n <= 0 {
+			return atMinute(day, spans[len(spans)-1].end)
+		}
+	}
+	return start.AddDate(0, 0, n)
+}
+
+type calendarQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// loadBusinessCalendar resolves the calendar of locationID ("" for the
+// shared calendar) for the horizon starting at from. A location without its
+// own week uses the shared one.
+func loadBusinessCalendar(ctx context.Context, q calendarQuerier, locationID string, from time.Time) (businessCalendar, error) {
+	c := businessCalendar{days: map[string][]workingSpan{}}
+	rows, err := q.QueryContext(ctx, `SELECT weekday,start_minute,end_minute FROM business_calendar_hours WHERE location_id IS NOT DISTINCT FROM (SELECT CASE WHEN EXISTS(SELECT 1 FROM business_calendar_hours WHERE location_id::text=$1) THEN NULLIF($1,'')::uuid END) ORDER BY weekday,start_minute`, locationID)
+	if err != nil {
+		return c, err
+	}
+	configured := false
+	for rows.Next() {
+		var weekday int
+		var span workingSpan
+		if err = rows.Scan(&weekday, &span.start, &span.end); err != nil {
+			rows.Close()
+			return c, err
+		}
+		c.week[weekday] = append(c.week[weekday], span)
+		configured = true
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return c, err
+	}
+	rows.Close()
+	if !configured {
+		c = defaultBusinessCalendar()
+	}
+	first := calendarDay(from).AddDate(0, 0, -1)
+	rows, err = q.QueryContext(ctx, `SELECT TO_CHAR(calendar_date,'YYYY-MM-DD'),is_working,start_minute,end_minute,recurs_annually FROM business_calendar_days WHERE (location_id IS NULL OR location_id::text=$1) AND (recurs_annually OR calendar_date BETWEEN $2::date AND $2::date+$3::int) ORDER BY location_id NULLS FIRST,calendar_date`, locationID, first.Format("2006-01-02"), calendarHorizonDays)
+	if err != nil {
+		return c, err
+	}
+	defer rows.Close()
+	firstYear, _, _ := timeToJalali(first)
+	for rows.Next() {
+		var date string
+		var working, annual bool
+		var start, end sql.NullInt64
+		if err = rows.Scan(&date, &working, &start, &end, &annual); err != nil {
+			return c, err
+		}
+		spans := []workingSpan{}
+		if working && start.Valid && end.Valid {
+			spans = append(spans, workingSpan{int(start.Int64), int(end.Int64)})
+		}
+		if !annual {
+			c.days[date] = spans
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", date, tehranLocation)
+		if err != nil {
+			return c, err
+		}
+		originYear, jm, jd := timeToJalali(t)
+		for jy := firstYear; jy <= firstYear+3; jy++ {
+			if jy >= originYear && validJalaliDate(jy, jm, jd) {
+				c.days[jalaliToTime(jy, jm, jd).Format("2006-01-02")] = spans
+			}
+		}
+	}
+	return c, rows.Err()
+}
+
+// workflowCalendarTx loads the calendar that governs a workflow: that of
+// the origin of a shipment-scoped workflow, of the source location of a
+// batch-scoped one, and the shared calendar otherwise.
+func (s *OperationsService) workflowCalendarTx(ctx context.Context, tx *sql.Tx, workflowID string, from time.Time) (businessCalendar, error) {
+	var location string
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(CASE wi.scope_type WHEN 'SHIPMENT' THEN (SELECT origin_location_id FROM shipments WHERE id=wi.scope_id) WHEN 'BATCH' THEN (SELECT COALESCE(source_location_id,target_location_id) FROM fulfillment_batches WHERE id=wi.scope_id) END::text,'') FROM workflow_instances wi WHERE wi.id=$1`, workflowID).Scan(&location)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return businessCalendar{}, err
+	}
+	return loadBusinessCalendar(ctx, tx, location, from)
+}
+
+func parseClockMinutes(value string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, errors.New("time must be HH:MM")
+	}
+	return h*60 + m, nil
+}
+
+func formatClockMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func validateCalendarHours(hours []BusinessCalendarHours) ([]BusinessCalendarHours, [][2]int, error) {
+	sorted := append([]BusinessCalendarHours(nil), hours...)
+	spans := make([][2]int, len(sorted))
+	for i, h := range sorted {
+		if h.Weekday < 0 || h.Weekday > 6 {
+			return nil, nil, errors.New("weekday must be between 0 and 6")
+		}
+		start, err := parseClockMinutes(h.Start)
+		if err != nil {
+			return nil, nil, err
+		}
+		end, err := parseClockMinutes(h.End)
+		if err != nil {
+			return nil, nil, err
+		}
+		if start >= end {
+			return nil, nil, errors.New("working hours must end after they start")
+		}
+		spans[i] = [2]int{start, end}
+	}
+	order := make([]int, len(sorted))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		x, y := order[a], order[b]
+		return sorted[x].Weekday < sorted[y].Weekday || sorted[x].Weekday == sorted[y].Weekday && spans[x][0] < spans[y][0]
+	})
+	for i := 1; i < len(order); i++ {
+		prev, cur := order[i-1], order[i]
+		if sorted[prev].Weekday == sorted[cur].Weekday && spans[cur][0] < spans[prev][1] {
+			return nil, nil, errors.New("working hours of a weekday overlap")
+		}
+	}
+	return sorted, spans, nil
+}
+
+func (s *OperationsService) validCalendarLocation(ctx context.Context, locationID *string) (string, error) {
+	if locationID == nil || strings.TrimSpace(*locationID) == "" {
+		return "", nil
+	}
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM inventory_locations WHERE id::text=$1)`, *locationID).Scan(&exists); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", errors.New("unknown location")
+	}
+	return *locationID, nil
+}
+
+// GetBusinessCalendar returns the effective week of a location ("" for the
+// shared calendar) and the days that apply to it. jalaliYear limits dated
+// days to one Solar Hijri year; annual days are always listed.
+func (s *OperationsService) GetBusinessCalendar(ctx context.Context, locationID string, jalaliYear int) (BusinessCalendarView, error) {
+	out := BusinessCalendarView{Hours: []BusinessCalendarHours{}, Days: []BusinessCalendarDay{}}
+	if locationID != "" {
+		if _, err := s.validCalendarLocation(ctx, &locationID); err != nil {
+			return out, err
+		}
+		out.LocationID = &locationID
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM business_calendar_hours WHERE location_id::text=$1)`, locationID).Scan(&out.HoursOverridden); err != nil {
+			return out, err
+		}
+	}
+	c, err := loadBusinessCalendar(ctx, s.db, locationID, time.Now())
+	if err != nil {
+		return out, err
+	}
+	for weekday, spans := range c.week {
+		for _, span := range spans {
+			out.Hours = append(out.Hours, BusinessCalendarHours{Weekday: weekday, Start: formatClockMinutes(span.start), End: formatClockMinutes(span.end)})
+		}
+	}
+	from, to := "0001-01-01", "9999-12-31"
+	if jalaliYear > 0 {
+		if !validJalaliDate(jalaliYear, 1, 1) {
+			return out, ErrValidation
+		}
+		from, to = jalaliToTime(jalaliYear, 1, 1).Format("2006-01-02"), jalaliToTime(jalaliYear+1, 1, 1).AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id,location_id::text,TO_CHAR(calendar_date,'YYYY-MM-DD'),title_fa,is_working,start_minute,end_minute,recurs_annually,source FROM business_calendar_days WHERE (location_id IS NULL OR location_id::text=$1) AND (recurs_annually OR calendar_date BETWEEN $2::date AND $3::date) ORDER BY calendar_date,location_id NULLS FIRST`, locationID, from, to)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d BusinessCalendarDay
+		var location sql.NullString
+		var start, end sql.NullInt64
+		if err = rows.Scan(&d.ID, &location, &d.Date, &d.TitleFA, &d.IsWorking, &start, &end, &d.RecursAnnually, &d.Source); err != nil {
+			return out, err
+		}
+		d.LocationID = scanNullableString(location)
+		if start.Valid && end.Valid {
+			a, b := formatClockMinutes(int(start.Int64)), formatClockMinutes(int(end.Int64))
+			d.Start, d.End = &a, &b
+		}
+		if t, err := time.ParseInLocation("2006-01-02", d.Date, tehranLocation); err == nil {
+			d.JalaliDate = formatJalaliDate(t)
+		}
+		out.Days = append(out.Days, d)
+	}
+	return out, rows.Err()
+}
+
+// SaveBusinessCalendarHours replaces a week. Deadlines already computed keep
+// the hours they were computed with.
+func (s *OperationsService) SaveBusinessCalendarHours(ctx context.Context, actor string, p BusinessCalendarHoursPayload) error {
+	location, err := s.validCalendarLocation(ctx, p.LocationID)
+	if err != nil {
+		return err
+	}
+	if location == "" && len(p.Hours) == 0 {
+		return errors.New("the shared calendar needs working hours")
+	}
+	hours, spans, err := validateCalendarHours(p.Hours)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, `DELETE FROM business_calendar_hours WHERE location_id IS NOT DISTINCT FROM NULLIF($1,'')::uuid`, location); err != nil {
+		return err
+	}
+	for i, h := range hours {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO business_calendar_hours(location_id,weekday,start_minute,end_minute) VALUES(NULLIF($1,'')::uuid,$2,$3,$4)`, location, h.Weekday, spans[i][0], spans[i][1]); err != nil {
+			return err
+		}
+	}
+	s.auditTx(ctx, tx, actor, "business_calendar.hours.save", "business_calendar", location, nil, p)
+	return tx.Commit()
+}
+
+// SaveBusinessCalendarDay creates or replaces the override of a date. The
+// date may be given as JalaliDate or as the Gregorian Date.
+func (s *OperationsService) SaveBusinessCalendarDay(ctx context.Context, actor string, p BusinessCalendarDay) (BusinessCalendarDay, error) {
+	location, err := s.validCalendarLocation(ctx, p.LocationID)
+	if err != nil {
+		return p, err
+	}
+	var day time.Time
+	if strings.TrimSpace(p.JalaliDate) != "" {
+		day, err = parseJalaliDate(p.JalaliDate)
+	} else {
+		day, err = time.ParseInLocation("2006-01-02", strings.TrimSpace(p.Date), tehranLocation)
+	}
+	if err != nil {
+		return p, errors.New("date or jalali_date is required")
+	}
+	p.TitleFA = strings.TrimSpace(p.TitleFA)
+	if p.TitleFA == "" {
+		return p, errors.New("title_fa is required")
+	}
+	var start, end any
+	if p.IsWorking {
+		if p.Start == nil || p.End == nil {
+			return p, errors.New("a working day needs start and end")
+		}
+		_, spans, err := validateCalendarHours([]BusinessCalendarHours{{Weekday: int(day.Weekday()), Start: *p.Start, End: *p.End}})
+		if err != nil {
+			return p, err
+		}
+		start, end = spans[0][0], spans[0][1]
+	} else if p.Start != nil || p.End != nil {
+		return p, errors.New("a closed day has no hours")
+	}
+	p.Date, p.JalaliDate, p.Source = day.Format("2006-01-02"), formatJalaliDate(day), "MANUAL"
+	if location == "" {
+		p.LocationID = nil
+	}
+	err = s.db.QueryRowContext(ctx, `INSERT INTO business_calendar_days(location_id,calendar_date,title_fa,is_working,start_minute,end_minute,recurs_annually,source,created_by_user_id) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,$5,$6,$7,'MANUAL',NULLIF($8,'')::uuid) ON CONFLICT(COALESCE(location_id,'00000000-0000-0000-0000-000000000000'::uuid),calendar_date) DO UPDATE SET title_fa=EXCLUDED.title_fa,is_working=EXCLUDED.is_working,start_minute=EXCLUDED.start_minute,end_minute=EXCLUDED.end_minute,recurs_annually=EXCLUDED.recurs_annually,source='MANUAL',ics_uid=NULL RETURNING id`, location, p.Date, p.TitleFA, p.IsWorking, start, end, p.RecursAnnually, actor).Scan(&p.ID)
+	if err != nil {
+		return p, err
+	}
+	s.audit(ctx, actor, "business_calendar.days.save", "business_calendar_day", fmt.Sprint(p.ID), p)
+	return p, nil
+}
+
+func (s *OperationsService) DeleteBusinessCalendarDay(ctx context.Context, actor string, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM business_calendar_days WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	s.audit(ctx, actor, "business_calendar.days.delete", "business_calendar_day", fmt.Sprint(id), nil)
+	return nil
+}
+
+type icsEvent struct {
+	uid, summary string
+	start, end   time.Time
+}
+
+// maxICSBytes bounds an uploaded calendar; a year of public holidays is a
+// few kilobytes.
+const maxICSBytes = 1 << 20
+
+// parseICSHolidays reads the VEVENTs of an iCalendar file as whole days on
+// the Tehran clock. DTEND is exclusive, as RFC 5545 defines it; recurrence
+// rules are not expanded.
+func parseICSHolidays(data string) ([]icsEvent, int, error) {
+	if len(data) > maxICSBytes {
+		return nil, 0, errors.New("calendar file is too large")
+	}
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxICSBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	var out []icsEvent
+	var cur *icsEvent
+	skipped, seen := 0, false
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		params := strings.Split(name, ";")
+		switch key := strings.ToUpper(params[0]); {
+		case key == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			seen = true
+		case key == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			cur = &icsEvent{}
+		case key == "END" && strings.EqualFold(value, "VEVENT") && cur != nil:
+			if cur.start.IsZero() || cur.summary == "" {
+				skipped++
+			} else {
+				if !cur.end.After(cur.start) {
+					cur.end = cur.start.AddDate(0, 0, 1)
+				}
+				out = append(out, *cur)
+			}
+			cur = nil
+		case cur == nil:
+		case key == "UID":
+			cur.uid = value
+		case key == "SUMMARY":
+			cur.summary = strings.TrimSpace(strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value))
+		case key == "DTSTART" || key == "DTEND":
+			t, err := parseICSDate(value, params[1:])
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "DTSTART" {
+				cur.start = t
+			} else {
+				cur.end = t
+			}
+		}
+	}
+	if !seen {
+		return nil, 0, errors.New("not an iCalendar file")
+	}
+	return out, skipped, nil
+}
+
+func parseICSDate(value string, params []string) (time.Time, error) {
+	location := tehranLocation
+	for _, p := range params {
+		if k, v, ok := strings.Cut(p, "="); ok && strings.EqualFold(k, "TZID") {
+			if loaded, err := time.LoadLocation(v); err == nil {
+				location = loaded
+			}
+		}
+	}
+	value = strings.TrimSpace(value)
+	var t time.Time
+	var err error
+	switch {
+	case len(value) == 8:
+		t, err = time.ParseInLocation("20060102", value, tehranLocation)
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse("20060102T150405Z", value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, location)
+	}
+	if err != nil {
+		return time.Time{}, errors.New("unsupported date")
+	}
+	return calendarDay(t), nil
+}
+
+// ImportBusinessCalendarICS adds the events of an iCalendar file as closed
+// days. Days entered by hand are kept; days of an earlier import are
+// replaced.
+func (s *OperationsService) ImportBusinessCalendarICS(ctx context.Context, actor string, p BusinessCalendarImportPayload) (BusinessCalendarImportResult, error) {
+	var out BusinessCalendarImportResult
+	location, err := s.validCalendarLocation(ctx, p.LocationID)
+	if err != nil {
+		return out, err
+	}
+	events, skipped, err := parseICSHolidays(p.ICS)
+	if err != nil {
+		return out, err
+	}
+	out.Skipped = skipped
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback()
+	for _, e := range events {
+		for day, n := e.start, 0; day.Before(e.end) && n < 366; day, n = day.AddDate(0, 0, 1), n+1 {
+			res, err := tx.ExecContext(ctx, `INSERT INTO business_calendar_days(location_id,calendar_date,title_fa,source,ics_uid,created_by_user_id) VALUES(NULLIF($1,'')::uuid,$2,$3,'ICS',NULLIF($4,''),NULLIF($5,'')::uuid) ON CONFLICT(COALESCE(location_id,'00000000-0000-0000-0000-000000000000'::uuid),calendar_date) DO UPDATE SET title_fa=EXCLUDED.title_fa,ics_uid=EXCLUDED.ics_uid,is_working=FALSE,start_minute=NULL,end_minute=NULL WHERE business_calendar_days.source='ICS'`, location, day.Format("2006-01-02"), e.summary, e.uid, actor)
+			if err != nil {
+				return out, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				out.Imported++
+			} else {
+				out.Skipped++
+			}
+		}
+	}
+	s.auditTx(ctx, tx, actor, "business_calendar.import", "business_calendar", location, nil, out)
+	return out, tx.Commit()
+}
@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBusinessCalendarCountsWorkingHours(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, tehranLocation) }
+	calendar := defaultBusinessCalendar()
+	tests := []struct {
+		name  string
+		start time.Time
+		d     time.Duration
+		want  time.Time
+	}{
+		{"thursday closes early and friday is closed", at(15, 10), 24 * time.Hour, at(19, 11)},
+		{"start on a closed day", at(16, 9), 2 * time.Hour, at(17, 10)},
+		{"zero waits for the next opening", at(14, 18), 0, at(15, 8)},
+	}
+	for _, test := range tests {
+		if got := calendar.add(test.start, test.d); !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+	calendar.days["2026-10-17"] = []workingSpan{}
+	if got := calendar.add(at(15, 10), 24*time.Hour); !got.Equal(at(20, 11)) {
+		t.Errorf("holiday counted: got %v", got)
+	}
+	calendar.days["2026-10-16"] = []workingSpan{{9 * 60, 12 * 60}}
+	if got := calendar.add(at(15, 12), 4*time.Hour); !got.Equal(at(16, 12)) {
+		t.Errorf("working friday skipped: got %v", got)
+	}
+	if got := defaultBusinessCalendar().workingDaysAfter(at(14, 10), 2); !got.Equal(at(17, 17)) {
+		t.Errorf("working days: got %v", got)
+	}
+}
+
+var (
+	calendarHoursQuery = "FROM business_calendar_hours WHERE location_id IS NOT DISTINCT FROM \\(SELECT CASE WHEN EXISTS"
+	calendarDaysQuery  = "FROM business_calendar_days WHERE \\(location_id IS NULL OR location_id::text=\\$1\\)"
+)
+
+func calendarDayRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"calendar_date", "is_working", "start_minute", "end_minute", "recurs_annually"})
+}
+
+func TestLoadBusinessCalendarResolvesLocation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	from := time.Date(2027, 6, 1, 9, 0, 0, 0, tehranLocation)
+	// The location has no week of its own, so the query answers with the
+	// shared week: Saturday to Thursday 07:00-15:00.
+	hours := sqlmock.NewRows([]string{"weekday", "start_minute", "end_minute"})
+	for _, d := range []int{6, 0, 1, 2, 3, 4} {
+		hours.AddRow(d, 7*60, 15*60)
+	}
+	mock.ExpectQuery(calendarHoursQuery).WithArgs("loc-1").WillReturnRows(hours)
+	// Rows come shared first, so the location's working day on 2027-06-04
+	// (a shared holiday) wins; 2025-03-21 repeats on 1 Farvardin, which
+	// falls on 2028-03-20 in 1407.
+	mock.ExpectQuery(calendarDaysQuery).WithArgs("loc-1", "2027-05-31", calendarHorizonDays).WillReturnRows(calendarDayRows().
+		AddRow("2025-03-21", false, nil, nil, true).
+		AddRow("2027-06-04", false, nil, nil, false).
+		AddRow("2027-06-04", true, 9*60, 12*60, false))
+	c, err := loadBusinessCalendar(context.Background(), db, "loc-1", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans := c.week[time.Saturday]; len(spans) != 1 || spans[0] != (workingSpan{7 * 60, 15 * 60}) {
+		t.Errorf("shared week not used: %v", spans)
+	}
+	if len(c.week[time.Friday]) != 0 {
+		t.Errorf("friday open: %v", c.week[time.Friday])
+	}
+	if spans := c.days["2027-06-04"]; len(spans) != 1 || spans[0] != (workingSpan{9 * 60, 12 * 60}) {
+		t.Errorf("location day did not override the shared day: %v", spans)
+	}
+	if spans, ok := c.days["2028-03-20"]; !ok || len(spans) != 0 {
+		t.Errorf("annual holiday missing in 1407: %v %v", spans, ok)
+	}
+	if _, ok := c.days["2028-03-21"]; ok {
+		t.Error("annual holiday kept its Gregorian date")
+	}
+	if got, want := c.add(time.Date(2027, 6, 4, 11, 0, 0, 0, tehranLocation), 2*time.Hour), time.Date(2027, 6, 5, 8, 0, 0, 0, tehranLocation); !got.Equal(want) {
+		t.Errorf("add across the overridden day: got %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkflowCalendarUsesShipmentOrigin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	from := time.Date(2026, 10, 17, 9, 0, 0, 0, tehranLocation)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE\\(CASE wi.scope_type WHEN 'SHIPMENT'").WithArgs("wf-1").WillReturnRows(sqlmock.NewRows([]string{"location"}).AddRow("loc-2"))
+	mock.ExpectQuery(calendarHoursQuery).WithArgs("loc-2").WillReturnRows(sqlmock.NewRows([]string{"weekday", "start_minute", "end_minute"}))
+	mock.ExpectQuery(calendarDaysQuery).WithArgs("loc-2", "2026-10-16", calendarHorizonDays).WillReturnRows(calendarDayRows().AddRow("2026-10-18", false, nil, nil, false))
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewOperationsService(db).workflowCalendarTx(context.Background(), tx, "wf-1", from)
+	_ = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No week configured anywhere: the default week applies, with the
+	// location's holiday on Sunday.
+	if got, want := c.add(from, 10*time.Hour), time.Date(2026, 10, 19, 10, 0, 0, 0, tehranLocation); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateCalendarHoursRejectsOverlaps(t *testing.T) {
+	if _, _, err := validateCalendarHours([]BusinessCalendarHours{{Weekday: 6, Start: "13:00", End: "17:00"}, {Weekday: 6, Start: "08:00", End: "12:00"}, {Weekday: 0, Start: "08:00", End: "24:00"}}); err != nil {
+		t.Fatalf("valid week rejected: %v", err)
+	}
+	for _, hours := range [][]BusinessCalendarHours{
+		{{Weekday: 6, Start: "08:00", End: "12:00"}, {Weekday: 6, Start: "11:00", End: "17:00"}},
+		{{Weekday: 7, Start: "08:00", End: "12:00"}},
+		{{Weekday: 1, Start: "12:00", End: "08:00"}},
+		{{Weekday: 1, Start: "8", End: "12:00"}},
+	} {
+		if _, _, err := validateCalendarHours(hours); err == nil {
+			t.Errorf("%v accepted", hours)
+		}
+	}
+}
+
+func TestJalaliConversion(t *testing.T) {
+	for jalali, gregorian := range map[string]string{"1403-01-01": "2024-03-20", "1403-12-30": "2025-03-20", "1404-01-01": "2025-03-21", "1404-11-22": "2026-02-11", "1405-07-01": "2026-09-23"} {
+		day, err := parseJalaliDate(jalali)
+		if err != nil || day.Format("2006-01-02") != gregorian {
+			t.Errorf("%s: got %v, %v; want %s", jalali, day, err, gregorian)
+			continue
+		}
+		if back := formatJalaliDate(day); back != jalali {
+			t.Errorf("%s round-tripped to %s", jalali, back)
+		}
+	}
+	if day, err := parseJalaliDate("۱۴۰۵/۰۱/۰۱"); err != nil || day.Format("2006-01-02") != "2026-03-21" {
+		t.Errorf("persian digits: got %v, %v", day, err)
+	}
+	for _, invalid := range []string{"1404-12-30", "1404-13-01", "1404-07-31", "1404/1", "x"} {
+		if _, err := parseJalaliDate(invalid); err == nil {
+			t.Errorf("%s accepted", invalid)
+		}
+	}
+}
+
+func TestJalaliDateFormatting(t *testing.T) {
+	at := time.Date(2026, 5, 20, 7, 0, 0, 0, time.UTC)
+	if got := formatJalaliDateTime(at); got != "1405-02-30 10:30" {
+		t.Errorf("formatJalaliDateTime = %s", got)
+	}
+	if got := exportCell(at, ""); got != "1405-02-30 10:30" {
+		t.Errorf("export jalali = %s", got)
+	}
+	if got := exportCell(at, "gregorian"); got != "2026-05-20 10:30" {
+		t.Errorf("export gregorian = %s", got)
+	}
+	if got := exportCell(nil, ""); got != "" {
+		t.Errorf("export nil = %q", got)
+	}
+	if got := documentValue(at.Format(time.RFC3339)); got != "1405-02-30 10:30" {
+		t.Errorf("document value = %s", got)
+	}
+	if got := documentValue("PF-1"); got != "PF-1" {
+		t.Errorf("document text = %s", got)
+	}
+	for input, want := range map[string]string{"": "", "1405-02-30": "2026-05-20T00:00:00+03:30", "۱۴۰۵/۰۲/۳۰": "2026-05-20T00:00:00+03:30", "2026-05-20": "2026-05-20T00:00:00+03:30"} {
+		if got, err := parseDateFilter(input); err != nil || got != want {
+			t.Errorf("parseDateFilter(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, invalid := range []string{"1404-12-30", "2026-02-30", "yesterday"} {
+		if _, err := parseDateFilter(invalid); err == nil {
+			t.Errorf("parseDateFilter(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestParseICSHolidays(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:nowruz-1405\r\nDTSTART;VALUE=DATE:20260321\r\nDTEND;VALUE=DATE:20260325\r\nSUMMARY:Nowruz\\, new\r\n  year\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nUID:one-day\r\nDTSTART:20260401T060000Z\r\nSUMMARY:Republic day\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nSUMMARY:no date\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	events, skipped, err := parseICSHolidays(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 || len(events) != 2 {
+		t.Fatalf("got %d events, %d skipped", len(events), skipped)
+	}
+	if e := events[0]; e.uid != "nowruz-1405" || e.summary != "Nowruz, new year" || e.start.Format("2006-01-02") != "2026-03-21" || e.end.Sub(e.start) != 4*24*time.Hour {
+		t.Errorf("multi-day event: %+v", e)
+	}
+	if e := events[1]; e.start.Format("2006-01-02") != "2026-04-01" || e.end.Sub(e.start) != 24*time.Hour {
+		t.Errorf("single-day event: %+v", e)
+	}
+	if _, _, err := parseICSHolidays("not a calendar"); err == nil {
+		t.Error("plain text accepted")
+	}
+}
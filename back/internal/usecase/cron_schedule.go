@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard five-field cron expression (minute hour
+// day-of-month month day-of-week) evaluated on the Tehran wall clock. Each
+// field accepts "*", numbers, ranges "a-b", steps "*/n" or "a-b/n" and
+// comma-separated lists. Like cron, a restricted day-of-month and
+// day-of-week match when either of them does.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func parseCronSchedule(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	var c cronSchedule
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}}
+	for i, b := range bounds {
+		if *b.dst, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return cronSchedule{}, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+	}
+	// Both 0 and 7 mean Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first matching minute strictly after t.
+func (c cronSchedule) Next(t time.Time) time.Time {
+	local := t.In(tehranLocation).Truncate(time.Minute).Add(time.Minute)
+	// Five years covers every satisfiable expression, including 29 February.
+	limit := local.AddDate(5, 0, 0)
+	for local.Before(limit) {
+		if c.month&(1<<uint(local.Month())) == 0 {
+			local = time.Date(local.Year(), local.Month()+1, 1, 0, 0, 0, 0, tehranLocation)
+			continue
+		}
+		if !c.dayMatches(local) {
+			local = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, tehranLocation)
+			continue
+		}
+		if c.hour&(1<<uint(local.Hour())) == 0 {
+			// Truncate would round on UTC hours, which are half an hour off
+			// the Tehran clock.
+			local = time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, tehranLocation)
+			continue
+		}
+		if c.minute&(1<<uint(local.Minute())) == 0 {
+			local = local.Add(time.Minute)
+			continue
+		}
+		return local
+	}
+	return time.Time{}
+}
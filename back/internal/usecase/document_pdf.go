@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/signintech/gopdf"
@@ -124,7 +125,7 @@ func generatePersianPDF(title string, snapshot map[string]any) ([]byte, error) {
 	}
 	sort.Strings(keys)
 	for _, k := range keys {
-		value := fmt.Sprint(snapshot[k])
+		value := documentValue(snapshot[k])
 		if len([]rune(value)) > 90 {
 			value = string([]rune(value)[:90]) + "…"
 		}
@@ -154,7 +155,7 @@ func generatePersianPDF(title string, snapshot map[string]any) ([]byte, error) {
 			parts := []string{fmt.Sprintf("%d", index+1)}
 			for _, key := range rowKeys {
 				if row[key] != nil && fmt.Sprint(row[key]) != "<nil>" {
-					parts = append(parts, fmt.Sprintf("%s: %v", documentLabel(key), row[key]))
+					parts = append(parts, fmt.Sprintf("%s: %s", documentLabel(key), documentValue(row[key])))
 				}
 			}
 			line := strings.Join(parts, " | ")
@@ -169,6 +170,25 @@ func generatePersianPDF(title string, snapshot map[string]any) ([]byte, error) {
 	return pdf.GetBytesPdfReturnErr()
 }
 
+// documentValue renders a snapshot value for print. Snapshots keep
+// timestamps as RFC3339 so they stay machine-readable; on paper they are
+// shown as Jalali dates on the Tehran clock.
+func documentValue(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return formatJalaliDateTime(v)
+	case *time.Time:
+		if v != nil {
+			return formatJalaliDateTime(*v)
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return formatJalaliDateTime(t)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
 func documentLabel(key string) string {
 	labels := map[string]string{"document_number": "شماره سند", "proforma_number": "شماره پیش‌فاکتور", "order_number": "شماره سفارش", "customer_name": "مشتری", "status": "وضعیت", "currency": "ارز", "subtotal": "جمع", "discount": "تخفیف", "tax": "مالیات", "charges": "هزینه‌های اضافی", "total": "مبلغ نهایی", "issued_at": "تاریخ صدور", "estimated_delivery_at": "تحویل تقریبی", "payment_terms": "شرایط پرداخت", "delivery_terms": "شرایط تحویل", "payment_number": "شماره پرداخت", "amount": "مبلغ", "paid_at": "تاریخ پرداخت", "reference": "شماره پیگیری", "shipment_number": "شماره محموله", "receiver_name": "تحویل‌گیرنده", "delivered_at": "تاریخ تحویل", "description": "شرح", "quantity": "مقدار", "unit": "واحد", "unit_price": "قیمت واحد", "line_amount": "مبلغ ردیف", "package_number": "شماره بسته", "gross_weight": "وزن ناخالص", "net_weight": "وزن خالص", "weight_unit": "واحد وزن", "container_number": "شماره کانتینر", "container_type": "نوع کانتینر", "seal_number": "شماره پلمب"}
 	if v := labels[key]; v != "" {
@@ -378,6 +378,9 @@ func (s *OperationsService) ConfirmOrder(ctx context.Context, actor, orderID, ke
 	if err = emitNotificationTx(ctx, tx, customer, "ORDER_CONFIRMED", "order-confirmed:"+orderID, "ORDER", orderID, "/account", map[string]string{}); err != nil {
 		return nil, err
 	}
+	if err = emitWebhookEventTx(ctx, tx, "ORDER_CONFIRMED", "order-confirmed:"+orderID, "ORDER", orderID); err != nil {
+		return nil, err
+	}
 	if salesOwner.Valid {
 		if err = emitNotificationTx(ctx, tx, salesOwner.String, "ORDER_CONFIRMED", "order-confirmed:"+orderID, "ORDER", orderID, "/panel/dashboard/orders/"+orderID, map[string]string{"order_number": orderNumber}); err != nil {
 			return nil, err
@@ -596,6 +599,9 @@ func (s *OperationsService) ConfirmPayment(ctx context.Context, actor, paymentID
 	if err = emitNotificationTx(ctx, tx, customer, "PAYMENT_CONFIRMED", "payment-confirmed:"+paymentID, "PAYMENT", paymentID, "/account", map[string]string{"order_number": orderNumber, "amount": out.Amount, "currency": out.Currency}); err != nil {
 		return out, err
 	}
+	if err = emitWebhookEventTx(ctx, tx, "PAYMENT_CONFIRMED", "payment-confirmed:"+paymentID, "PAYMENT", paymentID); err != nil {
+		return out, err
+	}
 	if salesOwner.Valid {
 		if err = emitNotificationTx(ctx, tx, salesOwner.String, "PAYMENT_CONFIRMED", "payment-confirmed:"+paymentID, "PAYMENT", paymentID, "/panel/dashboard/orders/"+out.OrderID, map[string]string{"order_number": orderNumber, "amount": out.Amount, "currency": out.Currency}); err != nil {
 			return out, err
@@ -863,6 +869,19 @@ func (s *OperationsService) evaluatePaymentTriggerTx(ctx context.Context, tx *sq
 	if err != nil {
 		return 0, err
 	}
+	// A triggered installment without a date falls due default_payment_due_days
+	// working days after its trigger.
+	var dueDays int
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE((SELECT (setting_value_json #>> '{}')::int FROM application_settings WHERE setting_key='default_payment_due_days'),7)`).Scan(&dueDays); err != nil {
+		return 0, err
+	}
+	calendar, err := s.workflowCalendarTx(ctx, tx, workflowID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE order_payment_schedule SET due_at=$4,updated_at=NOW() WHERE order_id=$1 AND trigger_type=$2 AND due_at IS NULL AND status NOT IN ('PAID','CANCELLED') AND amount>paid_amount AND (trigger_step_code IS NULL OR trigger_step_code='' OR trigger_step_code=$3)`, orderID, event, stepCode.String, calendar.workingDaysAfter(time.Now(), dueDays)); err != nil {
+		return 0, err
+	}
 	rows, err := tx.QueryContext(ctx, `SELECT id,title_fa,(amount-paid_amount)::text,currency FROM order_payment_schedule WHERE order_id=$1 AND trigger_type=$2 AND status NOT IN ('PAID','CANCELLED') AND amount>paid_amount AND (trigger_step_code IS NULL OR trigger_step_code='' OR trigger_step_code=$3) FOR UPDATE`, orderID, event, stepCode.String)
 	if err != nil {
 		return 0, err
@@ -3,8 +3,11 @@ package usecase
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommercialTermsFormula(t *testing.T) {
@@ -31,6 +34,19 @@ func TestNotificationTemplateAllowlist(t *testing.T) {
 	}
 }
 
+func TestTemplatePreviewVariableIssues(t *testing.T) {
+	allowed := []string{"order_number", "amount", "currency"}
+	missing, disallowed := templateVariableIssues(allowed, map[string]string{"order_number": "ORD-1", "currency": " "}, "{{order_number}} {{ amount }}", "{{currency}} {{secret}} {{amount}}")
+	if strings.Join(missing, ",") != "amount,currency" || strings.Join(disallowed, ",") != "secret" {
+		t.Fatalf("missing=%v disallowed=%v", missing, disallowed)
+	}
+	for _, key := range []string{"order_number", "shipment_number", "amount", "currency", "eta", "step_name"} {
+		if notificationSampleValues[key] == "" {
+			t.Fatalf("no sample value for %s", key)
+		}
+	}
+}
+
 func TestSMSProviders(t *testing.T) {
 	if _, err := (DisabledSMSProvider{}).SendMessage(context.Background(), "+989123456789", "test"); !errors.Is(err, ErrSMSProviderDisabled) {
 		t.Fatalf("disabled provider error=%v", err)
@@ -42,6 +58,148 @@ func TestSMSProviders(t *testing.T) {
 	}
 }
 
+func TestSMSDeliveryOutcome(t *testing.T) {
+	retry := []time.Duration{time.Minute, 5 * time.Minute}
+	if next, _ := deliveryOutcome("DELIVERED", 1, retry); next != "DELIVERED" {
+		t.Fatalf("delivered report moved to %s", next)
+	}
+	if next, delay := deliveryOutcome("UNDELIVERED", 1, retry); next != "RETRY" || delay != 5*time.Minute {
+		t.Fatalf("undelivered report next=%s delay=%s", next, delay)
+	}
+	if next, delay := deliveryOutcome("EXPIRED", 2, retry); next != "EXPIRED" || delay != 0 {
+		t.Fatalf("exhausted report next=%s delay=%s", next, delay)
+	}
+	if next, delay := deliveryOutcome(smsReportMissing, 0, retry); next != "EXPIRED" || delay != 0 {
+		t.Fatalf("missing report next=%s delay=%s", next, delay)
+	}
+}
+
+func TestEmailChannelHelpers(t *testing.T) {
+	for address, want := range map[string]bool{"customer@example.test": true, "u989121234567@phone.sangehassan.local": false, "": false, "not-an-address": false, "Name <x@example.test>": false} {
+		if got := deliverableEmail(address); got != want {
+			t.Fatalf("deliverableEmail(%q)=%v want %v", address, got, want)
+		}
+	}
+	out, err := renderEmailHTML("<p>{{order_number}}</p>", []string{"order_number"}, map[string]string{"order_number": "<script>1</script>"})
+	if err != nil || out != "<p>&lt;script&gt;1&lt;/script&gt;</p>" {
+		t.Fatalf("html=%q err=%v", out, err)
+	}
+	sender := &FakeEmailSender{Failures: 1}
+	if _, err = sender.SendEmail(context.Background(), EmailMessage{To: "a@example.test"}); err == nil {
+		t.Fatal("fake failure not returned")
+	}
+	if _, err = (DisabledEmailSender{}).SendEmail(context.Background(), EmailMessage{}); !errors.Is(err, ErrEmailSenderDisabled) {
+		t.Fatalf("disabled sender err=%v", err)
+	}
+}
+
+func TestNotificationTemplateLocalesShareVariables(t *testing.T) {
+	allowed := []string{"order_number", "amount", "currency"}
+	en := NotificationTemplateTranslation{Locale: "en", TitleTemplate: "Payment confirmed", BodyTemplate: "Payment of {{amount}} {{currency}} for {{order_number}}"}
+	if err := validateNotificationTemplateText("SMS", allowed, en); err != nil {
+		t.Fatalf("valid translation rejected: %v", err)
+	}
+	ar := NotificationTemplateTranslation{Locale: "ar", TitleTemplate: "x", BodyTemplate: "{{customer_name}}"}
+	if err := validateNotificationTemplateText("SMS", allowed, ar); err == nil {
+		t.Fatal("translation with a foreign variable accepted")
+	}
+	en.HTMLTemplate = "<p>{{amount}}</p>"
+	if err := validateNotificationTemplateText("SMS", allowed, en); err == nil {
+		t.Fatal("html body accepted on an SMS template")
+	}
+	if err := validateNotificationTemplateText("EMAIL", allowed, en); err != nil {
+		t.Fatalf("email html rejected: %v", err)
+	}
+	if !supportedLocale("ar") || supportedLocale("de") {
+		t.Fatal("unexpected locale support")
+	}
+	var saved NotificationTemplateTranslation
+	if err := json.Unmarshal([]byte(`{"locale":"en","title_template":"t","body_template":"b"}`), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !translationActive(saved, map[string]bool{}) {
+		t.Fatal("new translation without is_active saved inactive")
+	}
+	if translationActive(saved, map[string]bool{"en": false}) {
+		t.Fatal("omitted is_active re-activated a disabled translation")
+	}
+	off := false
+	saved.IsActive = &off
+	if translationActive(saved, map[string]bool{"en": true}) {
+		t.Fatal("explicit is_active=false ignored")
+	}
+}
+
+func TestQuietHoursRelease(t *testing.T) {
+	at := func(clock string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", "2026-03-10 "+clock, tehranLocation)
+		return v
+	}
+	night, _ := parseClock("22:00")
+	morning, _ := parseClock("07:30")
+	for clock, want := range map[string]string{"23:10": "2026-03-11 07:30", "02:00": "2026-03-10 07:30", "07:30": "", "12:00": ""} {
+		release, quiet := quietHoursRelease(at(clock).UTC(), night, morning)
+		got := ""
+		if quiet {
+			got = release.In(tehranLocation).Format("2006-01-02 15:04")
+		}
+		if got != want {
+			t.Fatalf("overnight window at %s: release=%q want %q", clock, got, want)
+		}
+	}
+	if release, quiet := quietHoursRelease(at("14:00"), 13*time.Hour, 16*time.Hour); !quiet || !release.Equal(at("16:00")) {
+		t.Fatalf("daytime window release=%s quiet=%v", release, quiet)
+	}
+	if err := validateQuietHours(NotificationQuietHours{Start: "22:00", End: "22:00"}); err == nil {
+		t.Fatal("empty window accepted")
+	}
+	if err := validateQuietHours(NotificationQuietHours{Start: "25:00", End: "07:00"}); err == nil {
+		t.Fatal("invalid clock accepted")
+	}
+	if mode, err := normalizeDeliveryMode("daily_digest"); err != nil || mode != notificationDeliveryDigest {
+		t.Fatalf("mode=%q err=%v", mode, err)
+	}
+	if _, err := normalizeDeliveryMode("WEEKLY"); err == nil {
+		t.Fatal("unknown delivery mode accepted")
+	}
+}
+
+func TestNotificationHubRouting(t *testing.T) {
+	hub := NewNotificationHub()
+	alice, stopAlice := hub.Subscribe("alice", []string{"7"})
+	bob, stopBob := hub.Subscribe("bob", nil)
+	defer stopBob()
+	hub.Publish(`{"kind":"notification.created","user_id":"alice","id":"1"}`)
+	hub.Publish(`{"kind":"action_item.assigned","role_id":"7","id":"a"}`)
+	hub.Publish(`{"kind":"action_item.assigned","user_id":"bob","role_id":"7","id":"b"}`)
+	hub.Publish(`not json`)
+	hub.Publish(`{"kind":"stream.resync"}`)
+	want := map[<-chan StreamEvent][]string{alice: {"notification.created", "action_item.assigned", "stream.resync"}, bob: {"action_item.assigned", "stream.resync"}}
+	for ch, kinds := range want {
+		for _, kind := range kinds {
+			select {
+			case ev := <-ch:
+				if ev.Kind != kind {
+					t.Fatalf("kind=%q want %q", ev.Kind, kind)
+				}
+			default:
+				t.Fatalf("missing %q event", kind)
+			}
+		}
+		select {
+		case ev := <-ch:
+			t.Fatalf("unexpected event %+v", ev)
+		default:
+		}
+	}
+	stopAlice()
+	stopAlice()
+	hub.Publish(`{"kind":"notification.created","user_id":"alice","id":"2"}`)
+	if len(alice) != 0 {
+		t.Fatal("event delivered after unsubscribe")
+	}
+}
+
 func TestPersianPDFIsValidAndEmbedsFont(t *testing.T) {
 	pdf, err := generatePersianPDF("پیش‌فاکتور", map[string]any{"document_number": "PF-1", "customer_name": "حسن", "total": "100000", "currency": "IRR"})
 	if err != nil {
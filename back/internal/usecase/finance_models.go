@@ -145,6 +145,22 @@ type NotificationPreferencePayload struct {
 	EventType    string `json:"event_type"`
 	InAppEnabled bool   `json:"in_app_enabled"`
 	SMSEnabled   bool   `json:"sms_enabled"`
+	EmailEnabled bool   `json:"email_enabled"`
+	DeliveryMode string `json:"delivery_mode"`
+}
+
+// NotificationQuietHours is a daily window on the Tehran wall clock, as
+// "HH:MM" bounds, during which SMS messages stay queued. End before start
+// spans midnight.
+type NotificationQuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+type NotificationPreferences struct {
+	Items      []NotificationPreferencePayload `json:"items"`
+	QuietHours *NotificationQuietHours         `json:"quiet_hours"`
 }
 
 type DocumentGeneratePayload struct {
@@ -457,6 +457,11 @@ func (s *OperationsService) transitionInstallation(ctx context.Context, actor, i
 			return nil, err
 		}
 	}
+	if event == "INSTALLATION_COMPLETED" {
+		if err = emitWebhookEventTx(ctx, tx, event, "installation-completed:"+id, "INSTALLATION", id); err != nil {
+			return nil, err
+		}
+	}
 	action := map[string]string{"IN_PROGRESS": "INSTALLATION_STARTED", "PAUSED": "INSTALLATION_UPDATED", "COMPLETED": "INSTALLATION_COMPLETED", "CANCELLED": "INSTALLATION_CANCELLED"}[target]
 	s.auditTx(ctx, tx, actor, action, "installation_job", id, map[string]any{"status": current}, map[string]any{"status": target, "reason": p.Reason, "warnings": warnings})
 	out := map[string]any{"id": id, "status": target, "warnings": warnings}
@@ -0,0 +1,169 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jalaliBreaks are the years in which the 33-year leap cycle of the Solar
+// Hijri calendar is re-anchored (Borkowski's arithmetic; valid to 3177).
+var jalaliBreaks = [...]int{-61, 9, 38, 199, 426, 686, 756, 818, 1111, 1181, 1210, 1635, 2060, 2097, 2192, 2262, 2324, 2394, 2456, 3178}
+
+// jalaliNewYear returns 1 Farvardin of jy as a Tehran calendar day.
+func jalaliNewYear(jy int) time.Time {
+	gy, leapJ, jp, jump := jy+621, -14, jalaliBreaks[0], 0
+	for _, jm := range jalaliBreaks[1:] {
+		jump = jm - jp
+		if jy < jm {
+			break
+		}
+		leapJ += jump/33*8 + jump%33/4
+		jp = jm
+	}
+	n := jy - jp
+	leapJ += n/33*8 + (n%33+3)/4
+	if jump%33 == 4 && jump-n == 4 {
+		leapJ++
+	}
+	leapG := gy/4 - (gy/100+1)*3/4 - 150
+	return time.Date(gy, time.March, 20+leapJ-leapG, 0, 0, 0, 0, tehranLocation)
+}
+
+func jalaliYearLength(jy int) int {
+	return int(jalaliNewYear(jy+1).Sub(jalaliNewYear(jy)).Hours() / 24)
+}
+
+func jalaliMonthLength(jy, jm int) int {
+	switch {
+	case jm <= 6:
+		return 31
+	case jm <= 11:
+		return 30
+	case jalaliYearLength(jy) == 366:
+		return 30
+	}
+	return 29
+}
+
+func validJalaliDate(jy, jm, jd int) bool {
+	return jy > 0 && jy < 3178 && jm >= 1 && jm <= 12 && jd >= 1 && jd <= jalaliMonthLength(jy, jm)
+}
+
+// jalaliToTime returns the Tehran calendar day of a valid Jalali date.
+func jalaliToTime(jy, jm, jd int) time.Time {
+	offset := (jm-1)*31 + jd - 1
+	if jm > 7 {
+		offset = 186 + (jm-7)*30 + jd - 1
+	}
+	start := jalaliNewYear(jy)
+	return time.Date(start.Year(), start.Month(), start.Day()+offset, 0, 0, 0, 0, tehranLocation)
+}
+
+// timeToJalali returns the Jalali date of t on the Tehran clock.
+func timeToJalali(t time.Time) (jy, jm, jd int) {
+	local := t.In(tehranLocation)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, tehranLocation)
+	jy = local.Year() - 621
+	start := jalaliNewYear(jy)
+	if day.Before(start) {
+		jy--
+		start = jalaliNewYear(jy)
+	}
+	k := int(day.Sub(start).Hours() / 24)
+	if k < 186 {
+		return jy, 1 + k/31, k%31 + 1
+	}
+	k -= 186
+	return jy, 7 + k/30, k%30 + 1
+}
+
+func formatJalaliDate(t time.Time) string {
+	jy, jm, jd := timeToJalali(t)
+	return fmt.Sprintf("%04d-%02d-%02d", jy, jm, jd)
+}
+
+// parseJalaliDate accepts YYYY-MM-DD or YYYY/MM/DD with Latin, Persian or
+// Arabic-Indic digits.
+func parseJalaliDate(value string) (time.Time, error) {
+	parts := strings.Split(normalizeDateDigits(value), "-")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("jalali date must be YYYY-MM-DD")
+	}
+	var n [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, errors.New("jalali date must be YYYY-MM-DD")
+		}
+		n[i] = v
+	}
+	if !validJalaliDate(n[0], n[1], n[2]) {
+		return time.Time{}, errors.New("invalid jalali date")
+	}
+	return jalaliToTime(n[0], n[1], n[2]), nil
+}
+
+// normalizeDateDigits maps Persian and Arabic-Indic digits to Latin and "/"
+// separators to "-".
+func normalizeDateDigits(value string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(value) {
+		switch {
+		case r >= '۰' && r <= '۹':
+			b.WriteRune('0' + (r - '۰'))
+		case r >= '٠' && r <= '٩':
+			b.WriteRune('0' + (r - '٠'))
+		case r == '/':
+			b.WriteRune('-')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// formatJalaliDateTime renders t as "YYYY-MM-DD HH:MM" in the Jalali calendar
+// on the Tehran clock, the form used in documents, exports and notifications.
+func formatJalaliDateTime(t time.Time) string {
+	return formatJalaliDate(t) + t.In(tehranLocation).Format(" 15:04")
+}
+
+// formatCalendarTime renders t for people: Jalali unless calendar is
+// "gregorian". The zero time renders as an empty string.
+func formatCalendarTime(t time.Time, calendar string) string {
+	if t.IsZero() {
+		return ""
+	}
+	if strings.EqualFold(calendar, "gregorian") {
+		return t.In(tehranLocation).Format("2006-01-02 15:04")
+	}
+	return formatJalaliDateTime(t)
+}
+
+// parseDateFilter accepts a Gregorian or Jalali calendar day (years below
+// 1700 are read as Jalali) and returns the start of that day in Tehran as
+// RFC3339, ready for a timestamptz parameter. An empty value stays empty.
+func parseDateFilter(value string) (string, error) {
+	value = normalizeDateDigits(value)
+	if value == "" {
+		return "", nil
+	}
+	invalid := conflict("VALIDATION_FAILED", "تاریخ "+value+" معتبر نیست")
+	year, err := strconv.Atoi(strings.SplitN(value, "-", 2)[0])
+	if err != nil {
+		return "", invalid
+	}
+	var day time.Time
+	if year < 1700 {
+		day, err = parseJalaliDate(value)
+	} else {
+		day, err = time.ParseInLocation("2006-01-02", value, tehranLocation)
+	}
+	if err != nil {
+		return "", invalid
+	}
+	return day.Format(time.RFC3339), nil
+}
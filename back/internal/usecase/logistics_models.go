@@ -311,6 +311,7 @@ type ShipmentPayload struct {
 	VehicleID             *string    `json:"vehicle_id"`
 	PlannedDepartureAt    *time.Time `json:"planned_departure_at"`
 	EstimatedArrivalAt    *time.Time `json:"estimated_arrival_at"`
+	TransitHours          *int       `json:"transit_hours"`
 	DeliveryContactName   string     `json:"delivery_contact_name"`
 	DeliveryContactPhone  string     `json:"delivery_contact_phone"`
 	DeliveryAddress       string     `json:"delivery_address"`
@@ -457,6 +458,7 @@ type WorkflowTransitionPayload struct {
 	LabelFA                string  `json:"label_fa"`
 	TransitionType         string  `json:"transition_type"`
 	ResultCode             *string `json:"result_code"`
+	ConditionExpression    *string `json:"condition_expression"`
 	IsDefault              bool    `json:"is_default"`
 	RequiresPermissionCode *string `json:"requires_permission_code"`
 	RequiresReason         bool    `json:"requires_reason"`
@@ -471,6 +473,7 @@ type WorkflowTransitionDefinition struct {
 	LabelFA                string  `json:"label_fa"`
 	TransitionType         string  `json:"transition_type"`
 	ResultCode             *string `json:"result_code,omitempty"`
+	ConditionExpression    *string `json:"condition_expression,omitempty"`
 	IsDefault              bool    `json:"is_default"`
 	RequiresPermissionCode *string `json:"requires_permission_code,omitempty"`
 	RequiresReason         bool    `json:"requires_reason"`
@@ -485,6 +488,22 @@ type RuntimeTransition struct {
 	RequiresReason bool    `json:"requires_reason"`
 	TargetStepCode string  `json:"target_step_code"`
 }
+type WorkflowConditionDryRunPayload struct {
+	SourceStepID int64                      `json:"source_step_id"`
+	Expression   *string                    `json:"expression"`
+	Values       map[string]json.RawMessage `json:"values"`
+}
+type WorkflowConditionResult struct {
+	TransitionID        *int64  `json:"transition_id,omitempty"`
+	TransitionCode      *string `json:"transition_code,omitempty"`
+	ConditionExpression string  `json:"condition_expression"`
+	Matched             bool    `json:"matched"`
+	Error               *string `json:"error,omitempty"`
+}
+type WorkflowConditionDryRun struct {
+	Results  []WorkflowConditionResult `json:"results"`
+	Selected *string                   `json:"selected_transition_code,omitempty"`
+}
 type SelectTransitionPayload struct {
 	TransitionCode string  `json:"transition_code"`
 	ResultCode     *string `json:"result_code"`
@@ -0,0 +1,219 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// tehranLocation is the business wall clock. Iran has not observed daylight
+// saving time since 2022, so a fixed offset is exact.
+var tehranLocation = time.FixedZone("Tehran", 12600)
+
+const (
+	notificationDeliveryImmediate = "IMMEDIATE"
+	notificationDeliveryDigest    = "DAILY_DIGEST"
+	// notificationDigestHour is the Tehran hour from which the previous
+	// days' digest items are collapsed into one notification per event type.
+	notificationDigestHour  = 9
+	notificationDigestLines = 5
+)
+
+func normalizeDeliveryMode(mode string) (string, error) {
+	switch mode = strings.ToUpper(strings.TrimSpace(mode)); mode {
+	case "":
+		return notificationDeliveryImmediate, nil
+	case notificationDeliveryImmediate, notificationDeliveryDigest:
+		return mode, nil
+	}
+	return "", fmt.Errorf("delivery_mode must be %s or %s", notificationDeliveryImmediate, notificationDeliveryDigest)
+}
+
+// parseClock reads an "HH:MM" time of day as an offset from midnight.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// quietHoursRelease reports whether now falls inside the daily [start,end)
+// window on the Tehran clock and, if so, the instant the window closes.
+func quietHoursRelease(now time.Time, start, end time.Duration) (time.Time, bool) {
+	local := now.In(tehranLocation)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, tehranLocation)
+	offset := local.Sub(midnight)
+	if start < end {
+		if offset >= start && offset < end {
+			return midnight.Add(end), true
+		}
+		return time.Time{}, false
+	}
+	if offset >= start {
+		return midnight.AddDate(0, 0, 1).Add(end), true
+	}
+	if offset < end {
+		return midnight.Add(end), true
+	}
+	return time.Time{}, false
+}
+
+func validateQuietHours(q NotificationQuietHours) error {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.New("quiet hours start and end must differ")
+	}
+	return nil
+}
+
+func loadQuietHours(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, userID string) (*NotificationQuietHours, error) {
+	var out NotificationQuietHours
+	err := q.QueryRowContext(ctx, `SELECT is_enabled,to_char(starts_at,'HH24:MI'),to_char(ends_at,'HH24:MI') FROM notification_quiet_hours WHERE user_id=$1`, userID).Scan(&out.Enabled, &out.Start, &out.End)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// smsQuietUntilTx returns when the user's quiet hours end if now falls inside
+// them; the zero time means the message may be sent right away.
+func smsQuietUntilTx(ctx context.Context, tx *sql.Tx, userID string, now time.Time) (time.Time, error) {
+	q, err := loadQuietHours(ctx, tx, userID)
+	if err != nil || q == nil || !q.Enabled {
+		return time.Time{}, err
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, err
+	}
+	release, quiet := quietHoursRelease(now, start, end)
+	if !quiet {
+		return time.Time{}, nil
+	}
+	return release, nil
+}
+
+// runNotificationDigestJob collapses the digest items queued before today's
+// Tehran midnight into one in-app notification per user and event type.
+func (s *OperationsService) runNotificationDigestJob(ctx context.Context) (int, error) {
+	now := time.Now().In(tehranLocation)
+	if now.Hour() < notificationDigestHour {
+		return 0, nil
+	}
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, tehranLocation)
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT user_id::text,event_type FROM notification_digest_items WHERE digested_at IS NULL AND created_at<$1 ORDER BY 1,2 LIMIT 500`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	type group struct{ user, eventType string }
+	groups := []group{}
+	for rows.Next() {
+		var g group
+		if err = rows.Scan(&g.user, &g.eventType); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		groups = append(groups, g)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, g := range groups {
+		if err = s.flushNotificationDigest(ctx, g.user, g.eventType, cutoff); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *OperationsService) flushNotificationDigest(ctx context.Context, userID, eventType string, cutoff time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Items that arrive after the day's digest was delivered are folded into
+	// it: the digest is rebuilt from everything it already holds plus the new
+	// items, and resurfaces as a new unread notification.
+	key := "digest:" + userID + ":" + eventType + ":" + cutoff.Format("2006-01-02")
+	rows, err := tx.QueryContext(ctx, `SELECT id,title,COALESCE(entity_type,''),COALESCE(entity_id::text,''),COALESCE(deep_link,''),created_at,digested_at IS NULL FROM notification_digest_items WHERE user_id=$1 AND event_type=$2 AND ((digested_at IS NULL AND created_at<$3) OR digest_notification_id=(SELECT id FROM notifications WHERE event_key=$4)) ORDER BY created_at FOR UPDATE SKIP LOCKED`, userID, eventType, cutoff, key)
+	if err != nil {
+		return err
+	}
+	ids := []int64{}
+	items := []map[string]any{}
+	lines := []string{}
+	link := ""
+	fresh := 0
+	for rows.Next() {
+		var id int64
+		var title, entityType, entityID, deepLink string
+		var createdAt time.Time
+		var pending bool
+		if err = rows.Scan(&id, &title, &entityType, &entityID, &deepLink, &createdAt, &pending); err != nil {
+			rows.Close()
+			return err
+		}
+		if pending {
+			fresh++
+		}
+		if len(ids) == 0 {
+			link = deepLink
+		} else if link != deepLink {
+			link = ""
+		}
+		ids = append(ids, id)
+		items = append(items, map[string]any{"title": title, "entity_type": entityType, "entity_id": entityID, "deep_link": deepLink, "created_at": createdAt})
+		if len(lines) < notificationDigestLines {
+			lines = append(lines, title)
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	if fresh == 0 {
+		return nil
+	}
+	if len(ids) > len(lines) {
+		lines = append(lines, fmt.Sprintf("و %d مورد دیگر", len(ids)-len(lines)))
+	}
+	data, _ := json.Marshal(map[string]any{"count": len(ids), "items": items})
+	var notificationID int64
+	err = tx.QueryRowContext(ctx, `INSERT INTO notifications(user_id,type,payload,event_type,event_key,title,body,deep_link,data_json) VALUES($1,$2,$6::jsonb,$2,$3,$4,$5,NULLIF($7,''),$6::jsonb) ON CONFLICT(event_key) DO UPDATE SET user_id=EXCLUDED.user_id,type=EXCLUDED.type,payload=EXCLUDED.payload,event_type=EXCLUDED.event_type,title=EXCLUDED.title,body=EXCLUDED.body,deep_link=EXCLUDED.deep_link,data_json=EXCLUDED.data_json,status='UNREAD',read_at=NULL,created_at=NOW() RETURNING id`, userID, eventType, key, fmt.Sprintf("خلاصه روزانه: %d اعلان", len(ids)), strings.Join(lines, "\n"), string(data), link).Scan(&notificationID)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE notification_digest_items SET digested_at=COALESCE(digested_at,NOW()),digest_notification_id=$2 WHERE id=ANY($1)`, pq.Array(ids), notificationID); err != nil {
+		return err
+	}
+	if err = notifyStream(ctx, tx, StreamEvent{Kind: StreamNotificationCreated, UserID: userID, ID: strconv.FormatInt(notificationID, 10)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+type EmailMessage struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// EmailSender is the outbound port for the EMAIL notification channel.
+type EmailSender interface {
+	SendEmail(ctx context.Context, msg EmailMessage) (string, error)
+	Name() string
+}
+
+var ErrEmailSenderDisabled = errors.New("email sender disabled")
+
+type DisabledEmailSender struct{}
+
+func (DisabledEmailSender) SendEmail(context.Context, EmailMessage) (string, error) {
+	return "", ErrEmailSenderDisabled
+}
+func (DisabledEmailSender) Name() string { return "disabled" }
+
+type FakeEmailSender struct {
+	mu       sync.Mutex
+	Messages []EmailMessage
+	Failures int
+}
+
+func (p *FakeEmailSender) SendEmail(_ context.Context, msg EmailMessage) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Failures > 0 {
+		p.Failures--
+		return "", errors.New("fake email failure")
+	}
+	p.Messages = append(p.Messages, msg)
+	return fmt.Sprintf("fake-email-%d", len(p.Messages)), nil
+}
+func (*FakeEmailSender) Name() string { return "fake" }
+
+func (s *OperationsService) ConfigureEmail(sender EmailSender) {
+	if sender != nil {
+		s.emailSender = sender
+	}
+}
+
+// deliverableEmail reports whether a stored users.email can receive mail;
+// phone-only accounts carry a placeholder alias that must never be used.
+func deliverableEmail(address string) bool {
+	address = strings.TrimSpace(address)
+	if address == "" || strings.HasSuffix(strings.ToLower(address), "@"+phoneAliasEmailDomain) {
+		return false
+	}
+	parsed, err := mail.ParseAddress(address)
+	return err == nil && parsed.Address == address
+}
+
+// renderEmailHTML renders an HTML template with every substituted value
+// escaped, so customer-controlled text cannot inject markup.
+func renderEmailHTML(template string, allowed []string, values map[string]string) (string, error) {
+	escaped := make(map[string]string, len(values))
+	for k, v := range values {
+		escaped[k] = html.EscapeString(v)
+	}
+	return renderNotificationTemplate(template, allowed, escaped)
+}
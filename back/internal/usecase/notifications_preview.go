@@ -0,0 +1,265 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notificationSampleValues fill template variables that neither the request
+// nor the selected entity provide, so a preview always renders.
+var notificationSampleValues = map[string]string{
+	"order_number":          "ORD-2026-000123",
+	"shipment_number":       "SHP-2026-000045",
+	"payment_number":        "PAY-2026-000078",
+	"document_number":       "DOC-2026-000090",
+	"amount":                "125000000",
+	"currency":              "IRR",
+	"eta":                   "1405-02-30 10:30",
+	"step_name":             "تأیید نقشه اجرایی",
+	"customer_name":         "مشتری نمونه",
+	"receiver_name":         "گیرنده نمونه",
+	"status":                "در حال آماده‌سازی",
+	"reference":             "REF-123456",
+	"items":                 "سنگ مرمر سفید، ۲۴ متر مربع",
+	"packages":              "۳ پالت",
+	"issued_at":             "1405-02-28",
+	"paid_at":               "1405-02-28",
+	"delivered_at":          "1405-02-31",
+	"estimated_delivery_at": "1405-03-04",
+	"subtotal":              "120000000",
+	"discount":              "0",
+	"tax":                   "10800000",
+	"charges":               "0",
+	"total":                 "130800000",
+}
+
+// NotificationTemplatePreviewRequest renders a stored template, or a draft of
+// it when the template texts are given. Values take precedence over values
+// derived from EntityType/EntityID, which take precedence over samples.
+type NotificationTemplatePreviewRequest struct {
+	TitleTemplate *string           `json:"title_template"`
+	BodyTemplate  *string           `json:"body_template"`
+	HTMLTemplate  *string           `json:"html_template"`
+	Values        map[string]string `json:"values"`
+	EntityType    string            `json:"entity_type"`
+	EntityID      string            `json:"entity_id"`
+}
+
+type NotificationTemplatePreview struct {
+	TemplateID          string            `json:"template_id"`
+	EventType           string            `json:"event_type"`
+	Channel             string            `json:"channel"`
+	Locale              string            `json:"locale"`
+	Title               string            `json:"title"`
+	Body                string            `json:"body"`
+	HTML                string            `json:"html,omitempty"`
+	AllowedVariables    []string          `json:"allowed_variables"`
+	MissingVariables    []string          `json:"missing_variables"`
+	DisallowedVariables []string          `json:"disallowed_variables"`
+	Values              map[string]string `json:"values"`
+	Renderable          bool              `json:"renderable"`
+}
+
+type NotificationTestSendResult struct {
+	Preview           NotificationTemplatePreview `json:"preview"`
+	Recipient         string                      `json:"recipient"`
+	Provider          string                      `json:"provider"`
+	ProviderMessageID string                      `json:"provider_message_id,omitempty"`
+	NotificationID    string                      `json:"notification_id,omitempty"`
+}
+
+// templateVariableIssues lists the variables referenced by texts that are
+// not allowed, and the allowed ones for which values has no usable value.
+func templateVariableIssues(allowed []string, values map[string]string, texts ...string) (missing, disallowed []string) {
+	allowedSet := map[string]bool{}
+	for _, x := range allowed {
+		allowedSet[x] = true
+	}
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, m := range templateVariablePattern.FindAllStringSubmatch(text, -1) {
+			key := m[1]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if !allowedSet[key] {
+				disallowed = append(disallowed, key)
+			} else if strings.TrimSpace(values[key]) == "" {
+				missing = append(missing, key)
+			}
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(disallowed)
+	return missing, disallowed
+}
+
+// entityTemplateValues derives variables from a real record so a preview can
+// show what an actual event would send.
+func entityTemplateValues(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, entityType, entityID string) (map[string]string, error) {
+	out := map[string]string{}
+	var err error
+	switch strings.ToUpper(strings.TrimSpace(entityType)) {
+	case "":
+		return out, nil
+	case "ORDER":
+		var number, customer string
+		err = q.QueryRowContext(ctx, `SELECT o.order_number,COALESCE(u.full_name,'') FROM orders o LEFT JOIN users u ON u.id=o.customer_user_id WHERE o.id=$1`, entityID).Scan(&number, &customer)
+		out["order_number"], out["customer_name"] = number, customer
+	case "PAYMENT":
+		var number, order, amount, currency string
+		var paidAt time.Time
+		err = q.QueryRowContext(ctx, `SELECT p.payment_number,o.order_number,p.amount::text,p.currency,p.paid_at FROM customer_payments p JOIN orders o ON o.id=p.order_id WHERE p.id=$1`, entityID).Scan(&number, &order, &amount, &currency, &paidAt)
+		out["payment_number"], out["order_number"], out["amount"], out["currency"], out["paid_at"] = number, order, amount, currency, formatJalaliDate(paidAt)
+	case "SHIPMENT":
+		var number, order string
+		var eta sql.NullTime
+		err = q.QueryRowContext(ctx, `SELECT s.shipment_number,o.order_number,s.estimated_arrival_at FROM shipments s JOIN orders o ON o.id=s.order_id WHERE s.id=$1`, entityID).Scan(&number, &order, &eta)
+		out["shipment_number"], out["order_number"] = number, order
+		if eta.Valid {
+			out["eta"] = formatJalaliDateTime(eta.Time)
+		}
+	default:
+		return nil, conflict("PREVIEW_ENTITY_UNSUPPORTED", "preview values can be derived from ORDER, PAYMENT or SHIPMENT only")
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, conflict("PREVIEW_ENTITY_NOT_FOUND", "preview entity was not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range out {
+		if strings.TrimSpace(v) == "" {
+			delete(out, k)
+		}
+	}
+	return out, nil
+}
+
+// PreviewNotificationTemplate renders a template without emitting anything.
+// Variable problems are reported in the result rather than as an error.
+func (s *OperationsService) PreviewNotificationTemplate(ctx context.Context, id string, p NotificationTemplatePreviewRequest) (NotificationTemplatePreview, error) {
+	out := NotificationTemplatePreview{TemplateID: id}
+	var title, body, htmlBody string
+	var raw []byte
+	err := s.db.QueryRowContext(ctx, `SELECT event_type,channel,locale,title_template,body_template,COALESCE(html_template,''),allowed_variables FROM notification_templates WHERE id=$1`, id).Scan(&out.EventType, &out.Channel, &out.Locale, &title, &body, &htmlBody, &raw)
+	if err != nil {
+		return out, err
+	}
+	if err = json.Unmarshal(raw, &out.AllowedVariables); err != nil {
+		return out, err
+	}
+	if p.TitleTemplate != nil {
+		title = *p.TitleTemplate
+	}
+	if p.BodyTemplate != nil {
+		body = *p.BodyTemplate
+	}
+	if p.HTMLTemplate != nil {
+		htmlBody = *p.HTMLTemplate
+	}
+	if out.Channel != "EMAIL" && strings.TrimSpace(htmlBody) != "" {
+		return out, conflict("HTML_TEMPLATE_NOT_SUPPORTED", "only email templates carry an html body")
+	}
+	derived, err := entityTemplateValues(ctx, s.db, p.EntityType, p.EntityID)
+	if err != nil {
+		return out, err
+	}
+	out.Values = map[string]string{}
+	for _, key := range out.AllowedVariables {
+		if v := strings.TrimSpace(p.Values[key]); v != "" {
+			out.Values[key] = v
+		} else if v, ok := derived[key]; ok {
+			out.Values[key] = v
+		} else if v, ok := notificationSampleValues[key]; ok {
+			out.Values[key] = v
+		}
+	}
+	out.MissingVariables, out.DisallowedVariables = templateVariableIssues(out.AllowedVariables, out.Values, title, body, htmlBody)
+	if len(out.MissingVariables) > 0 || len(out.DisallowedVariables) > 0 {
+		return out, nil
+	}
+	if out.Title, err = renderNotificationTemplate(title, out.AllowedVariables, out.Values); err != nil {
+		return out, nil
+	}
+	if out.Body, err = renderNotificationTemplate(body, out.AllowedVariables, out.Values); err != nil {
+		return out, nil
+	}
+	if strings.TrimSpace(htmlBody) != "" {
+		if out.HTML, err = renderEmailHTML(htmlBody, out.AllowedVariables, out.Values); err != nil {
+			return out, nil
+		}
+	}
+	out.Renderable = true
+	return out, nil
+}
+
+// TestSendNotificationTemplate renders the template like a preview and sends
+// it to the acting admin only, through the provider of the template channel.
+// Nothing is written to the outbox, so preferences and quiet hours do not apply.
+func (s *OperationsService) TestSendNotificationTemplate(ctx context.Context, actor, id, key string, p NotificationTemplatePreviewRequest) (NotificationTestSendResult, error) {
+	var out NotificationTestSendResult
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback()
+	claim, err := claimOperationTx(ctx, tx, actor, "NOTIFICATION_TEMPLATE_TEST_SEND", key, map[string]any{"id": id, "payload": p})
+	if err != nil {
+		return out, err
+	}
+	if claim.Existing {
+		err = json.Unmarshal(claim.Response, &out)
+		if err == nil {
+			err = tx.Commit()
+		}
+		return out, err
+	}
+	if out.Preview, err = s.PreviewNotificationTemplate(ctx, id, p); err != nil {
+		return out, err
+	}
+	if !out.Preview.Renderable {
+		return out, conflict("TEMPLATE_NOT_RENDERABLE", "template has missing or disallowed variables")
+	}
+	var phone string
+	var email sql.NullString
+	if err = tx.QueryRowContext(ctx, `SELECT phone_normalized,email FROM users WHERE id=$1`, actor).Scan(&phone, &email); err != nil {
+		return out, err
+	}
+	switch out.Preview.Channel {
+	case "IN_APP":
+		out.Recipient, out.Provider = actor, "in_app"
+		err = tx.QueryRowContext(ctx, `INSERT INTO notifications(user_id,type,payload,event_type,event_key,title,body,data_json) VALUES($1,$2,$5::jsonb,$2,$3,$4,$6,$5::jsonb) RETURNING id`, actor, out.Preview.EventType, actor+":template-test:"+id+":"+key, "[آزمایشی] "+out.Preview.Title, jsonText(out.Preview.Values), out.Preview.Body).Scan(&out.NotificationID)
+		if err == nil {
+			err = notifyStream(ctx, tx, StreamEvent{Kind: StreamNotificationCreated, UserID: actor, ID: out.NotificationID})
+		}
+	case "SMS":
+		out.Recipient, out.Provider = phone, s.smsProvider.Name()
+		out.ProviderMessageID, err = s.smsProvider.SendMessage(ctx, phone, out.Preview.Body)
+	case "EMAIL":
+		if !deliverableEmail(email.String) {
+			return out, conflict("TEST_RECIPIENT_UNAVAILABLE", "your account has no deliverable email address")
+		}
+		out.Recipient, out.Provider = email.String, s.emailSender.Name()
+		out.ProviderMessageID, err = s.emailSender.SendEmail(ctx, EmailMessage{To: email.String, Subject: "[آزمایشی] " + out.Preview.Title, TextBody: out.Preview.Body, HTMLBody: out.Preview.HTML})
+	}
+	if errors.Is(err, ErrSMSProviderDisabled) || errors.Is(err, ErrEmailSenderDisabled) {
+		return out, conflict("PROVIDER_DISABLED", "the provider for this channel is disabled")
+	}
+	if err != nil {
+		return out, err
+	}
+	s.auditTx(ctx, tx, actor, "NOTIFICATION_TEMPLATE_TEST_SENT", "NOTIFICATION_TEMPLATE", id, nil, map[string]any{"channel": out.Preview.Channel, "provider": out.Provider, "provider_message_id": out.ProviderMessageID})
+	if err = finishOperationTx(ctx, tx, actor, "NOTIFICATION_TEMPLATE_TEST_SEND", key, out); err != nil {
+		return out, err
+	}
+	return out, tx.Commit()
+}
@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// NotificationEventChannel is the PostgreSQL LISTEN/NOTIFY channel shared by
+// every API replica. Payloads only identify what changed; each replica loads
+// the row itself so the 8000-byte NOTIFY limit never applies.
+const NotificationEventChannel = "operations_events"
+
+const (
+	StreamNotificationCreated = "notification.created"
+	StreamNotificationRead    = "notification.read"
+	StreamActionItemAssigned  = "action_item.assigned"
+	// StreamResync tells clients that events may have been missed, e.g.
+	// after the listener connection was re-established.
+	StreamResync = "stream.resync"
+)
+
+// StreamEvent is a NOTIFY payload. RoleID targets every subscriber holding
+// the role when UserID is empty.
+type StreamEvent struct {
+	Kind   string `json:"kind"`
+	UserID string `json:"user_id,omitempty"`
+	RoleID string `json:"role_id,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+type streamSubscriber struct {
+	userID string
+	roles  map[string]bool
+	events chan StreamEvent
+}
+
+// NotificationHub fans events received from the database out to the SSE
+// connections open on this replica. Slow subscribers lose events rather
+// than block the listener; clients refetch the list when they reconnect.
+type NotificationHub struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+}
+
+func NewNotificationHub() *NotificationHub {
+	return &NotificationHub{subscribers: map[*streamSubscriber]struct{}{}}
+}
+
+func (h *NotificationHub) Subscribe(userID string, roleIDs []string) (<-chan StreamEvent, func()) {
+	sub := &streamSubscriber{userID: userID, roles: map[string]bool{}, events: make(chan StreamEvent, 32)}
+	for _, id := range roleIDs {
+		sub.roles[id] = true
+	}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, sub)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Publish dispatches one raw NOTIFY payload. Malformed payloads are dropped.
+func (h *NotificationHub) Publish(payload string) {
+	var ev StreamEvent
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil || ev.Kind == "" {
+		slog.Warn("notification_stream_payload_rejected", "error", err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if ev.Kind != StreamResync && ev.UserID != sub.userID && (ev.UserID != "" || !sub.roles[ev.RoleID]) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+		}
+	}
+}
+
+func (s *OperationsService) ConfigureNotificationStream(hub *NotificationHub) {
+	if hub != nil {
+		s.streamHub = hub
+	}
+}
+
+func notifyStream(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}, ev StreamEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `SELECT pg_notify($1,$2)`, NotificationEventChannel, string(payload))
+	return err
+}
+
+// SubscribeNotifications registers a stream for the user and the roles the
+// user holds at connect time.
+func (s *OperationsService) SubscribeNotifications(ctx context.Context, userID string) (<-chan StreamEvent, func(), error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT r.id FROM user_roles ur JOIN roles r ON r.id=ur.role_id WHERE ur.user_id=$1 AND r.is_active`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		roles = append(roles, strconv.FormatInt(id, 10))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	events, cancel := s.streamHub.Subscribe(userID, roles)
+	return events, cancel, nil
+}
+
+// StreamMessage loads what a client needs to render an event: the new
+// notification or action item plus the current unread count. A nil message
+// means the row is gone and the event should be skipped.
+func (s *OperationsService) StreamMessage(ctx context.Context, userID string, ev StreamEvent) (map[string]any, error) {
+	out := map[string]any{"kind": ev.Kind}
+	switch ev.Kind {
+	case StreamNotificationCreated:
+		var n Notification
+		var et, eid, link sql.NullString
+		var raw []byte
+		err := s.db.QueryRowContext(ctx, `SELECT id,event_type,title,body,entity_type,entity_id::text,deep_link,data_json,status,created_at FROM notifications WHERE id=$1 AND user_id=$2`, ev.ID, userID).Scan(&n.ID, &n.EventType, &n.Title, &n.Body, &et, &eid, &link, &raw, &n.Status, &n.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.EntityType = scanNullableString(et)
+		n.EntityID = scanNullableString(eid)
+		n.DeepLink = scanNullableString(link)
+		_ = json.Unmarshal(raw, &n.Data)
+		out["notification"] = n
+	case StreamNotificationRead:
+		if ev.ID != "" {
+			out["id"] = ev.ID
+		}
+	case StreamActionItemAssigned:
+		var title, status, priority string
+		err := s.db.QueryRowContext(ctx, `SELECT title_fa,status,priority FROM action_items WHERE id=$1`, ev.ID).Scan(&title, &status, &priority)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out["action_item"] = map[string]any{"id": ev.ID, "title_fa": title, "status": status, "priority": priority}
+		return out, nil
+	}
+	var unread int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id=$1 AND status='UNREAD'`, userID).Scan(&unread); err != nil {
+		return nil, err
+	}
+	out["unread_count"] = unread
+	return out, nil
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type SMSProvider interface {
@@ -94,7 +96,7 @@ func emitNotificationTx(ctx context.Context, tx *sql.Tx, userID, eventType, even
 	if _, err := tx.ExecContext(ctx, `SAVEPOINT notification_side_effect`); err != nil {
 		return err
 	}
-	if err := emitNotificationUnsafeTx(ctx, tx, userID, eventType, eventKey, entityType, entityID, deepLink, values); err != nil {
+	if err := emitNotificationWithDelegatesUnsafeTx(ctx, tx, userID, eventType, eventKey, entityType, entityID, deepLink, values); err != nil {
 		_, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT notification_side_effect`)
 		_, releaseErr := tx.ExecContext(ctx, `RELEASE SAVEPOINT notification_side_effect`)
 		slog.WarnContext(ctx, "notification_side_effect_skipped", "eventType", eventType, "entityType", entityType, "entityId", entityID, "error", err)
@@ -107,49 +109,126 @@ func emitNotificationTx(ctx context.Context, tx *sql.Tx, userID, eventType, even
 	return err
 }
 
+// delegatedNotificationEvents are the workflow and work-item events a
+// delegate receives for their delegator. Account, order-owner and other
+// personal notifications stay with the delegator.
+var delegatedNotificationEvents = map[string]bool{
+	"ACTION_ITEM_ASSIGNED":          true,
+	"ACTION_ITEM_OVERDUE":           true,
+	"COST_APPROVAL_REQUIRED":        true,
+	"DISCREPANCY_CREATED":           true,
+	"DISCREPANCY_RESOLVED":          true,
+	"PAYMENT_CONFIRMATION_REQUIRED": true,
+	"WORKFLOW_DELAYED":              true,
+	"WORKFLOW_SLA_WARNING":          true,
+	"WORKFLOW_STARTED":              true,
+	"WORKFLOW_STEP_COMPLETED":       true,
+	"WORKFLOW_STEP_STARTED":         true,
+}
+
+// emitNotificationWithDelegatesUnsafeTx notifies userID and, for workflow
+// and work-item events, whoever stands in for them through a delegation in
+// force that covers the event: an unscoped one, or one scoped to the role of
+// the step or action item it is about. Role notifications reach role-scoped
+// delegates through their acting roles as well.
+func emitNotificationWithDelegatesUnsafeTx(ctx context.Context, tx *sql.Tx, userID, eventType, eventKey, entityType, entityID, deepLink string, values map[string]string) error {
+	if err := emitNotificationUnsafeTx(ctx, tx, userID, eventType, eventKey, entityType, entityID, deepLink, values); err != nil {
+		return err
+	}
+	if !delegatedNotificationEvents[eventType] {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT d.delegate_user_id FROM active_user_delegations d WHERE d.delegator_user_id=$1 AND (d.role_id IS NULL OR d.role_id=CASE $2 WHEN 'WORKFLOW_STEP' THEN (SELECT responsible_role_id FROM workflow_step_instances WHERE id::text=$3) WHEN 'ACTION_ITEM' THEN (SELECT assigned_role_id FROM action_items WHERE id::text=$3) END)`, userID, entityType, entityID)
+	if err != nil {
+		return err
+	}
+	delegates := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		delegates = append(delegates, id)
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	for _, id := range delegates {
+		if err = emitNotificationUnsafeTx(ctx, tx, id, eventType, eventKey, entityType, entityID, deepLink, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func emitNotificationUnsafeTx(ctx context.Context, tx *sql.Tx, userID, eventType, eventKey, entityType, entityID, deepLink string, values map[string]string) error {
 	if strings.Contains(deepLink, "://") || (!strings.HasPrefix(deepLink, "/panel/dashboard") && !strings.HasPrefix(deepLink, "/account") && deepLink != "") {
 		return errors.New("unsafe notification deep link")
 	}
-	rows, err := tx.QueryContext(ctx, `SELECT channel,title_template,body_template,allowed_variables FROM notification_templates WHERE event_type=$1 AND locale='fa' AND is_active=TRUE ORDER BY channel`, eventType)
+	rows, err := tx.QueryContext(ctx, `SELECT channel,title_template,body_template,COALESCE(html_template,''),allowed_variables FROM (SELECT DISTINCT ON (t.channel) t.* FROM notification_templates t WHERE t.event_type=$1 AND t.is_active=TRUE AND t.locale IN ('fa',(SELECT preferred_locale FROM users WHERE id=$2)) ORDER BY t.channel,t.locale<>'fa' DESC)x ORDER BY channel<>'IN_APP',channel`, eventType, userID)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	type channelTemplate struct {
+		channel, title, body, html string
+		allowed                    []string
+	}
+	templates := []channelTemplate{}
 	for rows.Next() {
-		var channel, titleTemplate, bodyTemplate string
+		var t channelTemplate
 		var raw []byte
-		if err = rows.Scan(&channel, &titleTemplate, &bodyTemplate, &raw); err != nil {
-			return err
-		}
-		var allowed []string
-		if err = json.Unmarshal(raw, &allowed); err != nil {
+		if err = rows.Scan(&t.channel, &t.title, &t.body, &t.html, &raw); err != nil {
+			rows.Close()
 			return err
 		}
-		title, err := renderNotificationTemplate(titleTemplate, allowed, values)
-		if err != nil {
+		if err = json.Unmarshal(raw, &t.allowed); err != nil {
+			rows.Close()
 			return err
 		}
-		body, err := renderNotificationTemplate(bodyTemplate, allowed, values)
+		templates = append(templates, t)
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	inApp, sms, email, mode := true, false, false, notificationDeliveryImmediate
+	err = tx.QueryRowContext(ctx, `SELECT in_app_enabled,sms_enabled,email_enabled,delivery_mode FROM notification_preferences WHERE user_id=$1 AND event_type=$2`, userID, eventType).Scan(&inApp, &sms, &email, &mode)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if eventType == "CUSTOMER_ACCOUNT_CREATED" || eventType == "CUSTOMER_ACCOUNT_ACTIVATED" {
+		inApp, sms, mode = true, true, notificationDeliveryImmediate
+	}
+	for _, t := range templates {
+		title, err := renderNotificationTemplate(t.title, t.allowed, values)
 		if err != nil {
 			return err
 		}
-		var inApp, sms bool
-		err = tx.QueryRowContext(ctx, `SELECT COALESCE((SELECT in_app_enabled FROM notification_preferences WHERE user_id=$1 AND event_type=$2),TRUE),COALESCE((SELECT sms_enabled FROM notification_preferences WHERE user_id=$1 AND event_type=$2),FALSE)`, userID, eventType).Scan(&inApp, &sms)
+		body, err := renderNotificationTemplate(t.body, t.allowed, values)
 		if err != nil {
 			return err
 		}
-		if eventType == "CUSTOMER_ACCOUNT_CREATED" || eventType == "CUSTOMER_ACCOUNT_ACTIVATED" {
-			inApp, sms = true, true
-		}
-		if channel == "IN_APP" && inApp {
-			data, _ := json.Marshal(values)
-			_, err = tx.ExecContext(ctx, `INSERT INTO notifications(user_id,type,payload,event_type,event_key,title,body,entity_type,entity_id,deep_link,data_json) VALUES($1,$2,$9::jsonb,$2,$3,$4,$5,NULLIF($6,''),NULLIF($7,'')::uuid,NULLIF($8,''),$9::jsonb) ON CONFLICT(event_key) DO NOTHING`, userID, eventType, userID+":"+eventKey, title, body, entityType, entityID, deepLink, string(data))
+		if t.channel == "IN_APP" && inApp && mode == notificationDeliveryDigest {
+			_, err = tx.ExecContext(ctx, `INSERT INTO notification_digest_items(user_id,event_type,event_key,title,body,entity_type,entity_id,deep_link) VALUES($1,$2,$3,$4,$5,NULLIF($6,''),NULLIF($7,'')::uuid,NULLIF($8,'')) ON CONFLICT(event_key) DO NOTHING`, userID, eventType, userID+":"+eventKey, title, body, entityType, entityID, deepLink)
 			if err != nil {
 				return err
 			}
+		} else if t.channel == "IN_APP" && inApp {
+			data, _ := json.Marshal(values)
+			var id string
+			err = tx.QueryRowContext(ctx, `INSERT INTO notifications(user_id,type,payload,event_type,event_key,title,body,entity_type,entity_id,deep_link,data_json) VALUES($1,$2,$9::jsonb,$2,$3,$4,$5,NULLIF($6,''),NULLIF($7,'')::uuid,NULLIF($8,''),$9::jsonb) ON CONFLICT(event_key) DO NOTHING RETURNING id`, userID, eventType, userID+":"+eventKey, title, body, entityType, entityID, deepLink, string(data)).Scan(&id)
+			if err == nil {
+				// Delivered to listeners only when the surrounding tx commits.
+				err = notifyStream(ctx, tx, StreamEvent{Kind: StreamNotificationCreated, UserID: userID, ID: id})
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
 		}
-		if channel == "SMS" && sms {
+		if t.channel == "SMS" && sms {
 			var phone string
 			if err = tx.QueryRowContext(ctx, `SELECT phone_normalized FROM users WHERE id=$1`, userID).Scan(&phone); err != nil {
 				return err
@@ -159,8 +238,27 @@ func emitNotificationUnsafeTx(ctx context.Context, tx *sql.Tx, userID, eventType
 				return err
 			}
 		}
+		if t.channel == "EMAIL" && email {
+			var address sql.NullString
+			if err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id=$1`, userID).Scan(&address); err != nil {
+				return err
+			}
+			if !deliverableEmail(address.String) {
+				continue
+			}
+			htmlBody := ""
+			if strings.TrimSpace(t.html) != "" {
+				if htmlBody, err = renderEmailHTML(t.html, t.allowed, values); err != nil {
+					return err
+				}
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO notification_outbox(notification_id,user_id,channel,event_key,recipient,message_subject,message_body,message_html) VALUES((SELECT id FROM notifications WHERE event_key=$2),$1,'EMAIL',$3,$4,$5,$6,NULLIF($7,'')) ON CONFLICT(event_key) DO NOTHING`, userID, userID+":"+eventKey, userID+":"+eventKey+":email", address.String, title, body, htmlBody)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	return rows.Err()
+	return nil
 }
 
 func emitNotificationToRoleTx(ctx context.Context, tx *sql.Tx, roleCode, eventType, eventKey, entityType, entityID, deepLink string, values map[string]string) error {
@@ -181,7 +279,7 @@ func emitNotificationToRoleTx(ctx context.Context, tx *sql.Tx, roleCode, eventTy
 }
 
 func emitNotificationToRoleUnsafeTx(ctx context.Context, tx *sql.Tx, roleCode, eventType, eventKey, entityType, entityID, deepLink string, values map[string]string) error {
-	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT u.id FROM users u JOIN user_roles ur ON ur.user_id=u.id JOIN roles r ON r.id=ur.role_id WHERE r.code=$1 AND r.is_active AND u.status='ACTIVE'`, roleCode)
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT u.id FROM users u JOIN workflow_acting_roles ar ON ar.user_id=u.id JOIN roles r ON r.id=ar.role_id WHERE r.code=$1 AND r.is_active AND u.status='ACTIVE'`, roleCode)
 	if err != nil {
 		return err
 	}
@@ -268,38 +366,56 @@ func (s *OperationsService) ReadNotification(ctx context.Context, userID, id str
 	if n, _ := r.RowsAffected(); n == 0 {
 		return ErrForbidden
 	}
-	return nil
+	return notifyStream(ctx, s.db, StreamEvent{Kind: StreamNotificationRead, UserID: userID, ID: id})
 }
 func (s *OperationsService) ReadAllNotifications(ctx context.Context, userID string) error {
-	_, err := s.db.ExecContext(ctx, `UPDATE notifications SET status='READ',read_at=COALESCE(read_at,NOW()) WHERE user_id=$1 AND status='UNREAD'`, userID)
-	return err
+	if _, err := s.db.ExecContext(ctx, `UPDATE notifications SET status='READ',read_at=COALESCE(read_at,NOW()) WHERE user_id=$1 AND status='UNREAD'`, userID); err != nil {
+		return err
+	}
+	return notifyStream(ctx, s.db, StreamEvent{Kind: StreamNotificationRead, UserID: userID})
 }
-func (s *OperationsService) ListNotificationPreferences(ctx context.Context, userID string) ([]NotificationPreferencePayload, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT t.event_type,COALESCE(p.in_app_enabled,TRUE),COALESCE(p.sms_enabled,FALSE) FROM (SELECT DISTINCT event_type FROM notification_templates WHERE is_active=TRUE)t LEFT JOIN notification_preferences p ON p.event_type=t.event_type AND p.user_id=$1 ORDER BY t.event_type`, userID)
+func (s *OperationsService) ListNotificationPreferences(ctx context.Context, userID string) (NotificationPreferences, error) {
+	out := NotificationPreferences{Items: []NotificationPreferencePayload{}}
+	rows, err := s.db.QueryContext(ctx, `SELECT t.event_type,COALESCE(p.in_app_enabled,TRUE),COALESCE(p.sms_enabled,FALSE),COALESCE(p.email_enabled,FALSE),COALESCE(p.delivery_mode,'IMMEDIATE') FROM (SELECT DISTINCT event_type FROM notification_templates WHERE is_active=TRUE)t LEFT JOIN notification_preferences p ON p.event_type=t.event_type AND p.user_id=$1 ORDER BY t.event_type`, userID)
 	if err != nil {
-		return nil, err
+		return out, err
 	}
 	defer rows.Close()
-	out := []NotificationPreferencePayload{}
 	for rows.Next() {
 		var p NotificationPreferencePayload
-		if err = rows.Scan(&p.EventType, &p.InAppEnabled, &p.SMSEnabled); err != nil {
-			return nil, err
+		if err = rows.Scan(&p.EventType, &p.InAppEnabled, &p.SMSEnabled, &p.EmailEnabled, &p.DeliveryMode); err != nil {
+			return out, err
 		}
-		out = append(out, p)
+		out.Items = append(out.Items, p)
 	}
-	return out, rows.Err()
+	if err = rows.Err(); err != nil {
+		return out, err
+	}
+	out.QuietHours, err = loadQuietHours(ctx, s.db, userID)
+	return out, err
 }
-func (s *OperationsService) SaveNotificationPreferences(ctx context.Context, userID string, items []NotificationPreferencePayload) error {
+
+// SaveNotificationPreferences upserts the given per-event preferences. A nil
+// quiet-hours value leaves the stored window untouched.
+func (s *OperationsService) SaveNotificationPreferences(ctx context.Context, userID string, items []NotificationPreferencePayload, quiet *NotificationQuietHours) error {
+	if quiet != nil {
+		if err := validateQuietHours(*quiet); err != nil {
+			return err
+		}
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 	for _, p := range items {
+		if p.DeliveryMode, err = normalizeDeliveryMode(p.DeliveryMode); err != nil {
+			return err
+		}
 		if p.EventType == "CUSTOMER_ACCOUNT_CREATED" || p.EventType == "CUSTOMER_ACCOUNT_ACTIVATED" {
 			p.InAppEnabled = true
 			p.SMSEnabled = true
+			p.DeliveryMode = notificationDeliveryImmediate
 		}
 		var exists bool
 		if err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM notification_templates WHERE event_type=$1)`, p.EventType).Scan(&exists); err != nil {
@@ -308,7 +424,13 @@ func (s *OperationsService) SaveNotificationPreferences(ctx context.Context, use
 		if !exists {
 			return ErrValidation
 		}
-		_, err = tx.ExecContext(ctx, `INSERT INTO notification_preferences(user_id,event_type,in_app_enabled,sms_enabled,updated_at) VALUES($1,$2,$3,$4,NOW()) ON CONFLICT(user_id,event_type) DO UPDATE SET in_app_enabled=EXCLUDED.in_app_enabled,sms_enabled=EXCLUDED.sms_enabled,updated_at=NOW()`, userID, p.EventType, p.InAppEnabled, p.SMSEnabled)
+		_, err = tx.ExecContext(ctx, `INSERT INTO notification_preferences(user_id,event_type,in_app_enabled,sms_enabled,email_enabled,delivery_mode,updated_at) VALUES($1,$2,$3,$4,$5,$6,NOW()) ON CONFLICT(user_id,event_type) DO UPDATE SET in_app_enabled=EXCLUDED.in_app_enabled,sms_enabled=EXCLUDED.sms_enabled,email_enabled=EXCLUDED.email_enabled,delivery_mode=EXCLUDED.delivery_mode,updated_at=NOW()`, userID, p.EventType, p.InAppEnabled, p.SMSEnabled, p.EmailEnabled, p.DeliveryMode)
+		if err != nil {
+			return err
+		}
+	}
+	if quiet != nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO notification_quiet_hours(user_id,is_enabled,starts_at,ends_at,updated_at) VALUES($1,$2,$3::time,$4::time,NOW()) ON CONFLICT(user_id) DO UPDATE SET is_enabled=EXCLUDED.is_enabled,starts_at=EXCLUDED.starts_at,ends_at=EXCLUDED.ends_at,updated_at=NOW()`, userID, quiet.Enabled, strings.TrimSpace(quiet.Start), strings.TrimSpace(quiet.End))
 		if err != nil {
 			return err
 		}
@@ -317,31 +439,64 @@ func (s *OperationsService) SaveNotificationPreferences(ctx context.Context, use
 }
 
 func (s *OperationsService) ListNotificationTemplates(ctx context.Context) ([]map[string]any, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id,event_type,channel,locale,title_template,body_template,allowed_variables,is_active,updated_at FROM notification_templates ORDER BY event_type,channel`)
+	rows, err := s.db.QueryContext(ctx, `SELECT id,event_type,channel,locale,title_template,body_template,COALESCE(html_template,''),allowed_variables,is_active,updated_at FROM notification_templates ORDER BY event_type,channel,locale`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	out := []map[string]any{}
 	for rows.Next() {
-		var id, event, channel, locale, title, body string
+		var id, event, channel, locale, title, body, htmlBody string
 		var allowed []byte
 		var active bool
 		var updated time.Time
-		if err = rows.Scan(&id, &event, &channel, &locale, &title, &body, &allowed, &active, &updated); err != nil {
+		if err = rows.Scan(&id, &event, &channel, &locale, &title, &body, &htmlBody, &allowed, &active, &updated); err != nil {
 			return nil, err
 		}
 		var vars []string
 		_ = json.Unmarshal(allowed, &vars)
-		out = append(out, map[string]any{"id": id, "event_type": event, "channel": channel, "locale": locale, "title_template": title, "body_template": body, "allowed_variables": vars, "is_active": active, "updated_at": updated})
+		out = append(out, map[string]any{"id": id, "event_type": event, "channel": channel, "locale": locale, "title_template": title, "body_template": body, "html_template": htmlBody, "allowed_variables": vars, "is_active": active, "updated_at": updated})
 	}
 	return out, rows.Err()
 }
 
-type NotificationTemplateUpdate struct {
+type NotificationTemplateTranslation struct {
+	Locale        string `json:"locale"`
 	TitleTemplate string `json:"title_template"`
 	BodyTemplate  string `json:"body_template"`
-	IsActive      bool   `json:"is_active"`
+	HTMLTemplate  string `json:"html_template"`
+	// IsActive left out keeps a stored translation's state and activates a
+	// new one.
+	IsActive *bool `json:"is_active"`
+}
+
+type NotificationTemplateUpdate struct {
+	TitleTemplate string                            `json:"title_template"`
+	BodyTemplate  string                            `json:"body_template"`
+	HTMLTemplate  string                            `json:"html_template"`
+	IsActive      bool                              `json:"is_active"`
+	Translations  []NotificationTemplateTranslation `json:"translations"`
+}
+
+// validateNotificationTemplateText checks one locale of a template against
+// the variables shared by every locale of the same event and channel.
+func validateNotificationTemplateText(channel string, allowed []string, t NotificationTemplateTranslation) error {
+	if channel != "EMAIL" && strings.TrimSpace(t.HTMLTemplate) != "" {
+		return conflict("HTML_TEMPLATE_NOT_SUPPORTED", "only email templates carry an html body")
+	}
+	if strings.TrimSpace(t.TitleTemplate) == "" || strings.TrimSpace(t.BodyTemplate) == "" {
+		return fmt.Errorf("%s template: title and body are required", t.Locale)
+	}
+	dummy := map[string]string{}
+	for _, x := range allowed {
+		dummy[x] = "x"
+	}
+	for _, text := range []string{t.TitleTemplate, t.BodyTemplate, t.HTMLTemplate} {
+		if _, err := renderNotificationTemplate(text, allowed, dummy); err != nil {
+			return fmt.Errorf("%s template: %w", t.Locale, err)
+		}
+	}
+	return nil
 }
 
 func (s *OperationsService) UpdateNotificationTemplate(ctx context.Context, actor, id, key string, p NotificationTemplateUpdate) error {
@@ -357,34 +512,92 @@ func (s *OperationsService) UpdateNotificationTemplate(ctx context.Context, acto
 	if claim.Existing {
 		return tx.Commit()
 	}
+	var eventType, channel, locale string
 	var raw []byte
-	if err = tx.QueryRowContext(ctx, `SELECT allowed_variables FROM notification_templates WHERE id=$1 FOR UPDATE`, id).Scan(&raw); err != nil {
+	if err = tx.QueryRowContext(ctx, `SELECT event_type,channel,locale,allowed_variables FROM notification_templates WHERE id=$1 FOR UPDATE`, id).Scan(&eventType, &channel, &locale, &raw); err != nil {
 		return err
 	}
 	var allowed []string
 	if err = json.Unmarshal(raw, &allowed); err != nil {
 		return err
 	}
-	dummy := map[string]string{}
-	for _, x := range allowed {
-		dummy[x] = "x"
+	edited := map[string]NotificationTemplateTranslation{locale: {Locale: locale, TitleTemplate: p.TitleTemplate, BodyTemplate: p.BodyTemplate, HTMLTemplate: p.HTMLTemplate, IsActive: &p.IsActive}}
+	for _, t := range p.Translations {
+		if !supportedLocale(t.Locale) {
+			return ErrUnsupportedLocale
+		}
+		if _, dup := edited[t.Locale]; dup {
+			return fmt.Errorf("%s template is given more than once", t.Locale)
+		}
+		edited[t.Locale] = t
 	}
-	if _, err = renderNotificationTemplate(p.TitleTemplate, allowed, dummy); err != nil {
+	// Locales not part of this edit must still agree with allowed_variables,
+	// otherwise a translation could render with variables the event never sends.
+	rows, err := tx.QueryContext(ctx, `SELECT locale,title_template,body_template,COALESCE(html_template,''),is_active FROM notification_templates WHERE event_type=$1 AND channel=$2 AND locale<>$3 ORDER BY locale FOR UPDATE`, eventType, channel, locale)
+	if err != nil {
 		return err
 	}
-	if _, err = renderNotificationTemplate(p.BodyTemplate, allowed, dummy); err != nil {
+	stored := []NotificationTemplateTranslation{}
+	for rows.Next() {
+		var t NotificationTemplateTranslation
+		if err = rows.Scan(&t.Locale, &t.TitleTemplate, &t.BodyTemplate, &t.HTMLTemplate, &t.IsActive); err != nil {
+			rows.Close()
+			return err
+		}
+		stored = append(stored, t)
+	}
+	if err = rows.Close(); err != nil {
 		return err
 	}
-	_, err = tx.ExecContext(ctx, `UPDATE notification_templates SET title_template=$2,body_template=$3,is_active=$4,updated_at=NOW() WHERE id=$1`, id, p.TitleTemplate, p.BodyTemplate, p.IsActive)
+	active := map[string]bool{}
+	for _, t := range stored {
+		active[t.Locale] = t.IsActive == nil || *t.IsActive
+		if _, ok := edited[t.Locale]; !ok {
+			if err = validateNotificationTemplateText(channel, allowed, t); err != nil {
+				return err
+			}
+		}
+	}
+	for _, code := range sortedTranslationLocales(edited) {
+		if err = validateNotificationTemplateText(channel, allowed, edited[code]); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE notification_templates SET title_template=$2,body_template=$3,html_template=NULLIF($4,''),is_active=$5,updated_at=NOW() WHERE id=$1`, id, p.TitleTemplate, p.BodyTemplate, p.HTMLTemplate, p.IsActive)
 	if err != nil {
 		return err
 	}
+	for _, t := range p.Translations {
+		_, err = tx.ExecContext(ctx, `INSERT INTO notification_templates(event_type,channel,locale,audience_type,title_template,body_template,html_template,allowed_variables,is_active) SELECT event_type,channel,$2,audience_type,$3,$4,NULLIF($5,''),allowed_variables,$6 FROM notification_templates WHERE id=$1 ON CONFLICT(event_type,channel,locale) DO UPDATE SET title_template=EXCLUDED.title_template,body_template=EXCLUDED.body_template,html_template=EXCLUDED.html_template,allowed_variables=EXCLUDED.allowed_variables,is_active=EXCLUDED.is_active,updated_at=NOW()`, id, t.Locale, t.TitleTemplate, t.BodyTemplate, t.HTMLTemplate, translationActive(t, active))
+		if err != nil {
+			return err
+		}
+	}
 	if err = finishOperationTx(ctx, tx, actor, "NOTIFICATION_TEMPLATE_UPDATE", key, map[string]bool{"updated": true}); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
+// translationActive resolves is_active for a saved translation: an omitted
+// flag keeps the stored state, and a new translation starts active.
+func translationActive(t NotificationTemplateTranslation, stored map[string]bool) bool {
+	if t.IsActive != nil {
+		return *t.IsActive
+	}
+	active, known := stored[t.Locale]
+	return active || !known
+}
+
+func sortedTranslationLocales(m map[string]NotificationTemplateTranslation) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func (s *OperationsService) RetryNotificationDelivery(ctx context.Context, actor, id, key string) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -398,7 +611,7 @@ func (s *OperationsService) RetryNotificationDelivery(ctx context.Context, actor
 	if claim.Existing {
 		return tx.Commit()
 	}
-	r, err := tx.ExecContext(ctx, `UPDATE notification_outbox SET status='RETRY',next_attempt_at=NOW(),last_error=NULL WHERE id=$1 AND status IN ('FAILED','CANCELLED')`, id)
+	r, err := tx.ExecContext(ctx, `UPDATE notification_outbox SET status='RETRY',next_attempt_at=NOW(),last_error=NULL WHERE id=$1 AND status IN ('FAILED','CANCELLED','UNDELIVERED','EXPIRED')`, id)
 	if err != nil {
 		return err
 	}
@@ -416,7 +629,7 @@ func (s *OperationsService) ListNotificationDeliveries(ctx context.Context, stat
 		limit = 100
 	}
 	status = normalizeCode(status)
-	rows, err := s.db.QueryContext(ctx, `SELECT id,user_id,channel,status,attempt_count,next_attempt_at,provider_message_id,COALESCE(last_error,''),created_at,sent_at FROM notification_outbox WHERE ($1='' OR status=$1) ORDER BY created_at DESC LIMIT $2`, status, limit)
+	rows, err := s.db.QueryContext(ctx, `SELECT id,user_id,channel,status,attempt_count,next_attempt_at,provider_message_id,COALESCE(last_error,''),created_at,sent_at,delivery_status_at FROM notification_outbox WHERE ($1='' OR status=$1) ORDER BY created_at DESC LIMIT $2`, status, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -427,90 +640,82 @@ func (s *OperationsService) ListNotificationDeliveries(ctx context.Context, stat
 		var provider sql.NullString
 		var attempts int
 		var next, created time.Time
-		var sent sql.NullTime
-		if err = rows.Scan(&id, &user, &channel, &deliveryStatus, &attempts, &next, &provider, &lastError, &created, &sent); err != nil {
+		var sent, reported sql.NullTime
+		if err = rows.Scan(&id, &user, &channel, &deliveryStatus, &attempts, &next, &provider, &lastError, &created, &sent, &reported); err != nil {
 			return nil, err
 		}
-		out = append(out, map[string]any{"id": id, "user_id": user, "channel": channel, "status": deliveryStatus, "attempt_count": attempts, "next_attempt_at": next, "provider_message_id": scanNullableString(provider), "last_error": lastError, "created_at": created, "sent_at": nullableTime(sent)})
+		out = append(out, map[string]any{"id": id, "user_id": user, "channel": channel, "status": deliveryStatus, "attempt_count": attempts, "next_attempt_at": next, "provider_message_id": scanNullableString(provider), "last_error": lastError, "created_at": created, "sent_at": nullableTime(sent), "delivery_status_at": nullableTime(reported)})
 	}
 	return out, rows.Err()
 }
 
 type WorkerResult struct {
-	Job      string `json:"job"`
-	Affected int    `json:"affected"`
-	Error    string `json:"error,omitempty"`
+	Job        string `json:"job"`
+	Trigger    string `json:"trigger"`
+	Affected   int    `json:"affected"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
 }
 
+// RunWorkerOnce runs every registered job that is due or was requested to
+// run now; jobs that were not due are left out of the results.
 func (s *OperationsService) RunWorkerOnce(ctx context.Context, retry []time.Duration) ([]WorkerResult, error) {
-	jobs := []struct {
-		name string
-		fn   func(context.Context) (int, error)
-	}{{"payment_due", s.runPaymentDueJob}, {"workflow_delay", s.runWorkflowDelayJob}, {"shipment_eta", s.runShipmentETAJob}, {"sales_followup", s.runSalesFollowupJob}, {"operations_report", s.refreshOperationsReportJob}, {"integrity_detection", s.DetectIntegrityFindings}, {"notification_outbox", func(ctx context.Context) (int, error) { return s.processNotificationOutbox(ctx, retry) }}}
-	out := make([]WorkerResult, 0, len(jobs))
-	for _, job := range jobs {
-		n, err := s.withWorkerLock(ctx, job.name, job.fn)
-		r := WorkerResult{Job: job.name, Affected: n}
+	return s.RunWorkerCycle(ctx, nil, retry)
+}
+
+// RunWorkerCycle is RunWorkerOnce for a worker that may be asked to stop:
+// once draining is closed no further job is started, while the job in
+// flight runs on until it finishes or ctx is cancelled.
+func (s *OperationsService) RunWorkerCycle(ctx context.Context, draining <-chan struct{}, retry []time.Duration) ([]WorkerResult, error) {
+	runners := s.workerJobRunners(retry)
+	out := []WorkerResult{}
+	for _, d := range scheduledJobDefinitions {
+		select {
+		case <-draining:
+			return out, nil
+		default:
+		}
+		r, ran, err := s.runScheduledJob(ctx, d, runners[d.code])
 		if err != nil {
 			r.Error = err.Error()
 		}
-		out = append(out, r)
+		if ran || err != nil {
+			out = append(out, r)
+		}
 	}
 	return out, nil
 }
 
-func (s *OperationsService) withWorkerLock(ctx context.Context, code string, fn func(context.Context) (int, error)) (int, error) {
-	conn, err := s.db.Conn(ctx)
-	if err != nil {
-		return 0, err
-	}
-	defer conn.Close()
-	var locked bool
-	if err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, "operations-worker:"+code).Scan(&locked); err != nil {
-		return 0, err
-	}
-	if !locked {
-		return 0, nil
-	}
-	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, "operations-worker:"+code)
-	bucket := time.Now().UTC().Truncate(time.Minute)
-	var runID string
-	err = s.db.QueryRowContext(ctx, `INSERT INTO scheduled_job_runs(job_code,scheduled_bucket,status) VALUES($1,$2,'RUNNING') ON CONFLICT(job_code,scheduled_bucket) DO NOTHING RETURNING id`, code, bucket).Scan(&runID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return 0, nil
-	}
-	if err != nil {
-		return 0, err
-	}
-	n, runErr := fn(ctx)
-	status := "COMPLETED"
-	var message any
-	if runErr != nil {
-		status = "FAILED"
-		message = runErr.Error()
-	}
-	_, _ = s.db.ExecContext(ctx, `UPDATE scheduled_job_runs SET status=$2,affected_count=$3,error_text=$4,completed_at=NOW() WHERE id=$1`, runID, status, n, message)
-	return n, runErr
-}
+// outboxChannelSettings maps each outbox channel to the application setting
+// that switches it on; rows of a disabled channel are cancelled, not retried.
+var outboxChannelSettings = []struct{ channel, setting string }{{"SMS", "sms_enabled"}, {"EMAIL", "email_enabled"}}
 
 func (s *OperationsService) processNotificationOutbox(ctx context.Context, retry []time.Duration) (int, error) {
-	if !s.FeatureEnabled(ctx, "sms_enabled") {
-		result, err := s.db.ExecContext(ctx, `UPDATE notification_outbox SET status='CANCELLED',last_error='provider-disabled' WHERE channel='SMS' AND status IN ('PENDING','RETRY','PROCESSING')`)
+	count := 0
+	enabled := []string{}
+	for _, x := range outboxChannelSettings {
+		if s.FeatureEnabled(ctx, x.setting) {
+			enabled = append(enabled, x.channel)
+			continue
+		}
+		result, err := s.db.ExecContext(ctx, `UPDATE notification_outbox SET status='CANCELLED',last_error='provider-disabled' WHERE channel=$1 AND status IN ('PENDING','RETRY','PROCESSING')`, x.channel)
 		if err != nil {
-			return 0, err
+			return count, err
 		}
 		affected, _ := result.RowsAffected()
-		return int(affected), nil
+		count += int(affected)
+	}
+	if len(enabled) == 0 {
+		return count, nil
 	}
-	count := 0
 	for i := 0; i < 100; i++ {
 		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
 			return count, err
 		}
-		var id, recipient, body string
+		var id, userID, channel, recipient, body, subject, htmlBody string
 		var attempts int
-		err = tx.QueryRowContext(ctx, `SELECT id,recipient,message_body,attempt_count FROM notification_outbox WHERE (status IN ('PENDING','RETRY') AND next_attempt_at<=NOW()) OR (status='PROCESSING' AND locked_at<NOW()-INTERVAL '5 minutes') ORDER BY created_at FOR UPDATE SKIP LOCKED LIMIT 1`).Scan(&id, &recipient, &body, &attempts)
+		err = tx.QueryRowContext(ctx, `SELECT id,user_id,channel,recipient,message_body,COALESCE(message_subject,''),COALESCE(message_html,''),attempt_count FROM notification_outbox WHERE channel=ANY($1) AND ((status IN ('PENDING','RETRY') AND next_attempt_at<=NOW()) OR (status='PROCESSING' AND locked_at<NOW()-INTERVAL '5 minutes')) ORDER BY created_at FOR UPDATE SKIP LOCKED LIMIT 1`, pq.Array(enabled)).Scan(&id, &userID, &channel, &recipient, &body, &subject, &htmlBody, &attempts)
 		if errors.Is(err, sql.ErrNoRows) {
 			tx.Rollback()
 			break
@@ -519,6 +724,24 @@ func (s *OperationsService) processNotificationOutbox(ctx context.Context, retry
 			tx.Rollback()
 			return count, err
 		}
+		if channel == "SMS" {
+			release, err := smsQuietUntilTx(ctx, tx, userID, time.Now())
+			if err != nil {
+				tx.Rollback()
+				return count, err
+			}
+			if !release.IsZero() {
+				// Deferred, not failed: the attempt count is left alone.
+				if _, err = tx.ExecContext(ctx, `UPDATE notification_outbox SET status=CASE WHEN status='PROCESSING' THEN 'RETRY' ELSE status END,next_attempt_at=$2,locked_at=NULL WHERE id=$1`, id, release); err != nil {
+					tx.Rollback()
+					return count, err
+				}
+				if err = tx.Commit(); err != nil {
+					return count, err
+				}
+				continue
+			}
+		}
 		if _, err = tx.ExecContext(ctx, `UPDATE notification_outbox SET status='PROCESSING',locked_at=NOW(),attempt_count=attempt_count+1 WHERE id=$1`, id); err != nil {
 			tx.Rollback()
 			return count, err
@@ -526,8 +749,14 @@ func (s *OperationsService) processNotificationOutbox(ctx context.Context, retry
 		if err = tx.Commit(); err != nil {
 			return count, err
 		}
-		providerID, sendErr := s.smsProvider.SendMessage(ctx, recipient, body)
-		if errors.Is(sendErr, ErrSMSProviderDisabled) {
+		var providerID string
+		var sendErr error
+		if channel == "EMAIL" {
+			providerID, sendErr = s.emailSender.SendEmail(ctx, EmailMessage{To: recipient, Subject: subject, TextBody: body, HTMLBody: htmlBody})
+		} else {
+			providerID, sendErr = s.smsProvider.SendMessage(ctx, recipient, body)
+		}
+		if errors.Is(sendErr, ErrSMSProviderDisabled) || errors.Is(sendErr, ErrEmailSenderDisabled) {
 			_, err = s.db.ExecContext(ctx, `UPDATE notification_outbox SET status='CANCELLED',last_error='provider-disabled' WHERE id=$1`, id)
 		} else if sendErr == nil {
 			_, err = s.db.ExecContext(ctx, `UPDATE notification_outbox SET status='SENT',provider_message_id=$2,sent_at=NOW(),last_error=NULL WHERE id=$1`, id, providerID)
@@ -547,6 +776,123 @@ func (s *OperationsService) processNotificationOutbox(ctx context.Context, retry
 	return count, nil
 }
 
+// smsDeliveryReportWindow bounds how long a SENT message is polled before it
+// is given up on as EXPIRED without a final provider report.
+const smsDeliveryReportWindow = 72 * time.Hour
+
+// smsReportMissing stands for the report of a message whose
+// smsDeliveryReportWindow passed without a final provider answer.
+const smsReportMissing = "UNKNOWN"
+
+// deliveryOutcome decides the next outbox status for a final provider report.
+// Undelivered and expired messages re-enter the retry schedule while attempts
+// remain; a zero delay with a final status means the row must be escalated.
+// A missing report is never retried: the gateway may already have delivered
+// the message, and resending it would reach the customer twice.
+func deliveryOutcome(report string, attempts int, retry []time.Duration) (string, time.Duration) {
+	if report == "DELIVERED" {
+		return "DELIVERED", 0
+	}
+	if report == smsReportMissing {
+		return "EXPIRED", 0
+	}
+	if attempts < len(retry) {
+		return "RETRY", retry[attempts]
+	}
+	return report, 0
+}
+
+func (s *OperationsService) reconcileNotificationDeliveries(ctx context.Context, retry []time.Duration) (int, error) {
+	if s.smsProvider.Name() == (DisabledSMSProvider{}).Name() {
+		return 0, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id,provider_message_id,attempt_count,sent_at<NOW()-($1::bigint*INTERVAL '1 millisecond') FROM notification_outbox WHERE channel='SMS' AND status='SENT' AND provider_message_id IS NOT NULL AND sent_at<=NOW()-INTERVAL '1 minute' AND (delivery_checked_at IS NULL OR delivery_checked_at<NOW()-INTERVAL '5 minutes') ORDER BY delivery_checked_at NULLS FIRST,sent_at LIMIT 100`, smsDeliveryReportWindow.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	type sentMessage struct {
+		id, providerID string
+		attempts       int
+		stale          bool
+	}
+	items := []sentMessage{}
+	for rows.Next() {
+		var x sentMessage
+		if err = rows.Scan(&x.id, &x.providerID, &x.attempts, &x.stale); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, x)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, x := range items {
+		report := smsReportMissing
+		if !x.stale {
+			var statusErr error
+			report, statusErr = s.smsProvider.GetDeliveryStatus(ctx, x.providerID)
+			if statusErr != nil {
+				slog.WarnContext(ctx, "sms_delivery_status_unavailable", "outboxId", x.id, "provider", s.smsProvider.Name(), "error", statusErr)
+				report = "SENT"
+			}
+		}
+		if report != "DELIVERED" && report != "UNDELIVERED" && report != "EXPIRED" && report != smsReportMissing {
+			if _, err = s.db.ExecContext(ctx, `UPDATE notification_outbox SET delivery_checked_at=NOW(),delivery_check_count=delivery_check_count+1 WHERE id=$1 AND status='SENT'`, x.id); err != nil {
+				return count, err
+			}
+			continue
+		}
+		if err = s.recordDeliveryReport(ctx, x.id, x.providerID, report, x.attempts, retry); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *OperationsService) recordDeliveryReport(ctx context.Context, id, providerID, report string, attempts int, retry []time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if report != smsReportMissing {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO notification_delivery_reports(outbox_id,provider_message_id,delivery_status) VALUES($1,$2,$3) ON CONFLICT(outbox_id,provider_message_id) DO NOTHING`, id, providerID, report); err != nil {
+			return err
+		}
+	}
+	next, delay := deliveryOutcome(report, attempts, retry)
+	var result sql.Result
+	if next == "RETRY" {
+		result, err = tx.ExecContext(ctx, `UPDATE notification_outbox SET status='RETRY',next_attempt_at=NOW()+($2::bigint*INTERVAL '1 millisecond'),last_error=$3,delivery_status_at=NOW(),delivery_checked_at=NOW(),delivery_check_count=delivery_check_count+1 WHERE id=$1 AND status='SENT'`, id, delay.Milliseconds(), strings.ToLower(report))
+	} else if report == smsReportMissing {
+		result, err = tx.ExecContext(ctx, `UPDATE notification_outbox SET status=$2,last_error='no-delivery-report',delivery_checked_at=NOW(),delivery_check_count=delivery_check_count+1 WHERE id=$1 AND status='SENT'`, id, next)
+	} else {
+		result, err = tx.ExecContext(ctx, `UPDATE notification_outbox SET status=$2,delivery_status_at=NOW(),delivery_checked_at=NOW(),delivery_check_count=delivery_check_count+1 WHERE id=$1 AND status='SENT'`, id, next)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return tx.Commit()
+	}
+	if next == "UNDELIVERED" || next == "EXPIRED" {
+		title, dedupe := "پیامک تحویل نشد", "notification:undelivered:"
+		if report == smsReportMissing {
+			// An operator decides whether to resend; the message may have arrived.
+			title, dedupe = "وضعیت تحویل پیامک نامشخص است", "notification:unknown:"
+			slog.WarnContext(ctx, "sms_delivery_report_missing", "outboxId", id, "providerMessageId", providerID)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO action_items(order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT CASE WHEN n.entity_type='ORDER' THEN n.entity_id END,CASE WHEN u.user_type='CUSTOMER' THEN u.id END,$2,ob.recipient||' — '||COALESCE(n.title,ob.event_key),'OPEN','HIGH',r.id,'notifications.retry',NOW(),$3::text||ob.id,'SMS_UNDELIVERED' FROM notification_outbox ob JOIN users u ON u.id=ob.user_id LEFT JOIN notifications n ON n.id=ob.notification_id JOIN roles r ON r.code='ADMIN' WHERE ob.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, id, title, dedupe)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (s *OperationsService) runPaymentDueJob(ctx context.Context) (int, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -616,7 +962,7 @@ func (s *OperationsService) runShipmentETAJob(ctx context.Context) (int, error)
 			rows.Close()
 			return 0, err
 		}
-		if err = emitNotificationTx(ctx, tx, user, "SHIPMENT_ETA", "shipment-eta:"+shipment+":"+time.Now().UTC().Format("2006-01-02"), "SHIPMENT", shipment, "/account", map[string]string{"shipment_number": number, "eta": eta.In(time.FixedZone("Tehran", 12600)).Format("2006-01-02 15:04")}); err != nil {
+		if err = emitNotificationTx(ctx, tx, user, "SHIPMENT_ETA", "shipment-eta:"+shipment+":"+time.Now().UTC().Format("2006-01-02"), "SHIPMENT", shipment, "/account", map[string]string{"shipment_number": number, "eta": formatJalaliDateTime(eta)}); err != nil {
 			rows.Close()
 			return 0, err
 		}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net/http"
 	"strings"
 	"time"
 
@@ -28,10 +29,16 @@ type OperationsService struct {
 	db          *sql.DB
 	documentDir string
 	smsProvider SMSProvider
+	emailSender EmailSender
+	// webhookClient refuses redirects and internal addresses so a
+	// subscription cannot be bounced to another host after validation.
+	webhookClient *http.Client
+	streamHub     *NotificationHub
+	workerMonitor *WorkerMonitor
 }
 
 func NewOperationsService(db *sql.DB) *OperationsService {
-	return &OperationsService{db: db, documentDir: "./storage/workflow-files", smsProvider: DisabledSMSProvider{}}
+	return &OperationsService{db: db, documentDir: "./storage/workflow-files", smsProvider: DisabledSMSProvider{}, emailSender: DisabledEmailSender{}, webhookClient: newWebhookClient(0, false), streamHub: NewNotificationHub()}
 }
 
 func (s *OperationsService) ConfigureFinanceAndDocuments(documentDir string, provider SMSProvider) {
@@ -576,7 +583,7 @@ func (s *OperationsService) ListActionItems(ctx context.Context, userID string,
 	if all && !s.HasPermission(ctx, userID, "action_items.view_all") {
 		return nil, ErrForbidden
 	}
-	rows, err := s.db.QueryContext(ctx, `SELECT a.id,a.workflow_instance_id,a.title_fa,a.description_fa,a.status,a.priority,a.due_at,o.id,o.order_number,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized),wt.name_fa,COALESCE(wsi.internal_title_fa,wts.internal_title_fa,'اقدام فرایند') FROM action_items a JOIN orders o ON o.id=a.order_id JOIN users u ON u.id=a.customer_user_id JOIN workflow_instances wi ON wi.id=a.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id LEFT JOIN workflow_step_instances wsi ON wsi.id=a.workflow_step_instance_id LEFT JOIN workflow_template_steps wts ON wts.id=wsi.workflow_template_step_id WHERE a.status NOT IN ('COMPLETED','CANCELLED') AND ($2 OR a.assigned_user_id=$1 OR (a.assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$1 AND ur.role_id=a.assigned_role_id))) AND (a.required_permission_code IS NULL OR EXISTS(SELECT 1 FROM user_roles ur JOIN roles r ON r.id=ur.role_id JOIN role_permissions rp ON rp.role_id=r.id JOIN permissions p ON p.id=rp.permission_id WHERE ur.user_id=$1 AND (p.code=a.required_permission_code OR r.code='SUPER_ADMIN'))) ORDER BY (a.due_at<NOW()) DESC,(a.priority='URGENT') DESC,a.due_at NULLS LAST,a.created_at DESC`, userID, all)
+	rows, err := s.db.QueryContext(ctx, `SELECT a.id,a.workflow_instance_id,a.title_fa,a.description_fa,a.status,a.priority,a.due_at,o.id,o.order_number,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized),wt.name_fa,COALESCE(wsi.internal_title_fa,wts.internal_title_fa,'اقدام فرایند') FROM action_items a JOIN orders o ON o.id=a.order_id JOIN users u ON u.id=a.customer_user_id JOIN workflow_instances wi ON wi.id=a.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id LEFT JOIN workflow_step_instances wsi ON wsi.id=a.workflow_step_instance_id LEFT JOIN workflow_template_steps wts ON wts.id=wsi.workflow_template_step_id WHERE a.status NOT IN ('COMPLETED','CANCELLED') AND ($2 OR `+workflowWorkSQL("a.assigned_user_id", "a.assigned_role_id", "$1")+`) AND (a.required_permission_code IS NULL OR EXISTS(SELECT 1 FROM workflow_acting_roles ar JOIN roles r ON r.id=ar.role_id JOIN role_permissions rp ON rp.role_id=r.id JOIN permissions p ON p.id=rp.permission_id WHERE ar.user_id=$1 AND (p.code=a.required_permission_code OR r.code='SUPER_ADMIN'))) ORDER BY (a.due_at<NOW()) DESC,(a.priority='URGENT') DESC,a.due_at NULLS LAST,a.created_at DESC`, userID, all)
 	if err != nil {
 		return nil, err
 	}
@@ -928,6 +935,10 @@ func (s *OperationsService) AuditLogs(ctx context.Context, search string) ([]map
 }
 
 func (s *OperationsService) audit(ctx context.Context, actor, action, entity, entityID string, metadata any) {
+	if onBehalf := onBehalfOfFromContext(ctx); onBehalf != "" {
+		_, _ = s.db.ExecContext(ctx, `INSERT INTO audit_logs(actor_user_id,action_code,entity_type,entity_id,metadata,request_id,on_behalf_of_user_id) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,COALESCE($5::jsonb,'{}'),NULLIF($6,''),$7::uuid)`, actor, action, entity, entityID, jsonText(metadata), RequestIDFromContext(ctx), onBehalf)
+		return
+	}
 	if requestID := RequestIDFromContext(ctx); requestID != "" {
 		_, _ = s.db.ExecContext(ctx, `INSERT INTO audit_logs(actor_user_id,action_code,entity_type,entity_id,metadata,request_id) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,COALESCE($5::jsonb,'{}'),$6)`, actor, action, entity, entityID, jsonText(metadata), requestID)
 		return
@@ -935,6 +946,10 @@ func (s *OperationsService) audit(ctx context.Context, actor, action, entity, en
 	_, _ = s.db.ExecContext(ctx, `INSERT INTO audit_logs(actor_user_id,action_code,entity_type,entity_id,metadata) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,COALESCE($5::jsonb,'{}'))`, actor, action, entity, entityID, jsonText(metadata))
 }
 func (s *OperationsService) auditTx(ctx context.Context, tx *sql.Tx, actor, action, entity, entityID string, before, after any) {
+	if onBehalf := onBehalfOfFromContext(ctx); onBehalf != "" {
+		_, _ = tx.ExecContext(ctx, `INSERT INTO audit_logs(actor_user_id,action_code,entity_type,entity_id,before_data,after_data,request_id,on_behalf_of_user_id) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,$5::jsonb,$6::jsonb,NULLIF($7,''),$8::uuid)`, actor, action, entity, entityID, jsonText(before), jsonText(after), RequestIDFromContext(ctx), onBehalf)
+		return
+	}
 	if requestID := RequestIDFromContext(ctx); requestID != "" {
 		_, _ = tx.ExecContext(ctx, `INSERT INTO audit_logs(actor_user_id,action_code,entity_type,entity_id,before_data,after_data,request_id) VALUES(NULLIF($1,'')::uuid,$2,$3,$4,$5::jsonb,$6::jsonb,$7)`, actor, action, entity, entityID, jsonText(before), jsonText(after), requestID)
 		return
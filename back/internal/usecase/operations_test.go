@@ -6,8 +6,10 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
@@ -203,3 +205,389 @@ func TestProtectedRolePermissionsCannotBeReplaced(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestWorkflowAnalyticsStepTimes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("FROM workflow_step_status_history h").WithArgs("2026-05-20T00:00:00+03:30", "", int64(3), "CUT").WillReturnRows(
+		sqlmock.NewRows([]string{"template_id", "template_group_code", "version_number", "step_code", "status", "periods", "open_periods", "median_hours", "p90_hours"}).
+			AddRow(int64(3), "stone_order", int64(2), "CUT", "IN_PROGRESS", int64(12), int64(1), []byte("4.50"), []byte("=9")))
+	service := NewOperationsService(db)
+	report, err := service.WorkflowAnalytics(context.Background(), "step-times", WorkflowAnalyticsFilter{From: "1405-02-30", TemplateID: 3, StepCode: "cut"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0]["median_hours"] != "4.50" || report.Rows[0]["periods"] != int64(12) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if got := strings.Join(report.CSVRows("")[0], ","); got != "3,stone_order,2,CUT,IN_PROGRESS,12,1,4.50,=9" {
+		t.Errorf("csv row = %s", got)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.WorkflowAnalytics(context.Background(), "cycle-times", WorkflowAnalyticsFilter{}); err == nil {
+		t.Error("unknown report accepted")
+	}
+	if _, err = service.WorkflowAnalytics(context.Background(), "rework", WorkflowAnalyticsFilter{To: "1405-13-01"}); err == nil {
+		t.Error("invalid date accepted")
+	}
+}
+
+func TestOpenedStepAssignment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT ts.assignment_strategy").WithArgs("step-1", "wf-1").WillReturnRows(sqlmock.NewRows([]string{"assignment_strategy", "responsible_role_id", "template_group_code", "step_code"}).AddRow("LEAST_OPEN_ITEMS", int64(4), "STONE_ORDER", "CUTTING"))
+	mock.ExpectQuery("ORDER BY open_items,last_assigned_at NULLS FIRST,id LIMIT 1").WithArgs(int64(4), "wf-1", "STONE_ORDER", "CUTTING").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("user-2"))
+	mock.ExpectExec("UPDATE workflow_step_instances SET assigned_user_id").WithArgs("step-1", "user-2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT ts.assignment_strategy").WithArgs("step-2", "wf-1").WillReturnRows(sqlmock.NewRows([]string{"assignment_strategy", "responsible_role_id", "template_group_code", "step_code"}).AddRow("MANUAL", int64(4), "STONE_ORDER", "PACKING"))
+	mock.ExpectCommit()
+	service := NewOperationsService(db)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = service.assignOpenedStepTx(context.Background(), tx, "wf-1", "step-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = service.assignOpenedStepTx(context.Background(), tx, "wf-1", "step-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeStepAssignment(t *testing.T) {
+	assignment := WorkflowStepPayload{AssignmentStrategy: " sticky "}
+	if err := normalizeStepAssignment(&assignment); err != nil || assignment.AssignmentStrategy != "STICKY" {
+		t.Fatalf("sticky assignment = %q, %v", assignment.AssignmentStrategy, err)
+	}
+	manual := WorkflowStepPayload{}
+	if err := normalizeStepAssignment(&manual); err != nil || manual.AssignmentStrategy != "MANUAL" {
+		t.Fatalf("default assignment = %q, %v", manual.AssignmentStrategy, err)
+	}
+	if err := normalizeStepAssignment(&WorkflowStepPayload{AssignmentStrategy: "random"}); err == nil {
+		t.Fatal("unknown assignment strategy accepted")
+	}
+}
+
+func TestRoundRobinRanksByStepCodeRotation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT ts.assignment_strategy").WithArgs("step-1", "wf-1").WillReturnRows(sqlmock.NewRows([]string{"assignment_strategy", "responsible_role_id", "template_group_code", "step_code"}).AddRow("ROUND_ROBIN", int64(4), "STONE_ORDER", "CUTTING"))
+	// The history is looked up by group and step code, so a new template
+	// version continues the rotation of the previous one.
+	mock.ExpectQuery("FROM workflow_step_assignment_rotation r WHERE r.template_group_code=\\$3 AND r.step_code=\\$4 AND r.user_id=u.id\\) last_assigned_at,.*ORDER BY last_assigned_at NULLS FIRST,id LIMIT 1").WithArgs(int64(4), "wf-1", "STONE_ORDER", "CUTTING").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("user-3"))
+	mock.ExpectExec("UPDATE workflow_step_instances SET assigned_user_id").WithArgs("step-1", "user-3").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewOperationsService(db).assignOpenedStepTx(context.Background(), tx, "wf-1", "step-1")
+	_ = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnreachableApprovalQuorumIsRefused(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("WITH si AS").WithArgs("step-1").WillReturnRows(sqlmock.NewRows([]string{"level_number", "approval_role_id", "name_fa", "required_approvals", "approvals", "overridden"}).
+		AddRow(1, int64(4), "QC", 1, 1, false).
+		AddRow(2, int64(5), "مدیر فروش", 3, 0, false))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users u WHERE u.user_type='INTERNAL' AND u.status='ACTIVE'").WithArgs(int64(5)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewOperationsService(db).createApprovalActionTx(context.Background(), tx, "step-1")
+	_ = tx.Rollback()
+	var typed *OperationConflict
+	if !errors.As(err, &typed) || typed.Code != "APPROVAL_QUORUM_UNREACHABLE" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishRejectsUnreachableApprovalQuorum(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	count := func(n int) *sqlmock.Rows { return sqlmock.NewRows([]string{"count"}).AddRow(n) }
+	mock.ExpectQuery("FROM workflow_template_steps s LEFT JOIN roles r").WithArgs(int64(7)).WillReturnRows(count(0))
+	mock.ExpectQuery("FROM workflow_step_task_templates t").WithArgs(int64(7)).WillReturnRows(count(0))
+	mock.ExpectQuery("FROM workflow_template_document_requirements r").WithArgs(int64(7)).WillReturnRows(count(0))
+	mock.ExpectQuery("FROM workflow_step_approval_levels l JOIN workflow_template_steps s ON s.id=l.workflow_template_step_id LEFT JOIN roles").WithArgs(int64(7)).WillReturnRows(count(0))
+	mock.ExpectQuery("m.members<l.required_approvals").WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"step_code", "level_number", "required_approvals", "name_fa", "members"}).AddRow("SALES_REVIEW", 2, 3, "مدیر فروش", 2))
+	err = NewOperationsService(db).validateTemplateReferences(context.Background(), 7)
+	var typed *OperationConflict
+	if !errors.As(err, &typed) || typed.Code != "APPROVAL_QUORUM_UNREACHABLE" || !strings.Contains(typed.Message, "SALES_REVIEW") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApprovalActorStandsInForDelegator(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT code FROM roles").WithArgs(int64(4)).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("QC"))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("user-2", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("FROM active_user_delegations d").WithArgs("user-2", int64(4), nil).WillReturnRows(sqlmock.NewRows([]string{"delegator_user_id"}).AddRow("user-1"))
+	mock.ExpectQuery("SELECT DISTINCT r.code").WithArgs("user-1").WillReturnRows(sqlmock.NewRows([]string{"code", "permission"}).AddRow("QC", "workflow.approve"))
+	ctx, ok := NewOperationsService(db).approvalActor(context.Background(), "user-2", "workflow.approve", sql.NullInt64{Int64: 4, Valid: true})
+	if !ok {
+		t.Fatal("expected the delegate to approve for the delegator")
+	}
+	if got := onBehalfOfFromContext(ctx); got != "user-1" {
+		t.Fatalf("expected on behalf of user-1, got %q", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelegateWorkListCoversRoleHeldWork(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// The list filters with the same scope delegatorFor checks, so work held
+	// by a role of the delegator is listed as well as their own assignments.
+	scope := regexp.QuoteMeta(delegationScopeSQL("a.assigned_user_id", "a.assigned_role_id", "$1"))
+	mock.ExpectQuery("FROM action_items a .*EXISTS\\(SELECT 1 FROM active_user_delegations d WHERE "+scope+"\\)").WithArgs("user-2", false).WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_instance_id", "title_fa", "description_fa", "status", "priority", "due_at", "order_id", "order_number", "customer", "workflow_name", "step_name"}).
+		AddRow("item-1", "wf-1", "بازرسی کیفیت", "", "OPEN", "NORMAL", nil, "order-1", "ORD-1", "مشتری", "سفارش", "کنترل کیفیت"))
+	items, err := NewOperationsService(db).ListActionItems(context.Background(), "user-2", false)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("items=%v err=%v", items, err)
+	}
+	if !strings.Contains(delegationScopeSQL("a", "r", "u"), "ur.user_id=d.delegator_user_id AND ur.role_id=r") {
+		t.Fatal("delegation scope does not cover work held by the delegator's role")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelegatesReceiveOnlyCoveredWorkNotifications(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	noTemplates := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"channel", "title_template", "body_template", "html_template", "allowed_variables"})
+	}
+	mock.ExpectBegin()
+	// An order-owner notification stays with the delegator.
+	mock.ExpectQuery("FROM notification_templates t WHERE t.event_type=\\$1").WithArgs("ORDER_CONFIRMED", "user-1").WillReturnRows(noTemplates())
+	// A step's SLA warning reaches delegates whose delegation covers the step.
+	mock.ExpectQuery("FROM notification_templates t WHERE t.event_type=\\$1").WithArgs("WORKFLOW_SLA_WARNING", "user-1").WillReturnRows(noTemplates())
+	mock.ExpectQuery("SELECT d.delegate_user_id FROM active_user_delegations d").WithArgs("user-1", "WORKFLOW_STEP", "step-1").WillReturnRows(sqlmock.NewRows([]string{"delegate_user_id"}).AddRow("user-2"))
+	mock.ExpectQuery("FROM notification_templates t WHERE t.event_type=\\$1").WithArgs("WORKFLOW_SLA_WARNING", "user-2").WillReturnRows(noTemplates())
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	err = emitNotificationWithDelegatesUnsafeTx(ctx, tx, "user-1", "ORDER_CONFIRMED", "order-confirmed:order-1", "ORDER", "order-1", "/panel/dashboard/orders/order-1", map[string]string{})
+	if err == nil {
+		err = emitNotificationWithDelegatesUnsafeTx(ctx, tx, "user-1", "WORKFLOW_SLA_WARNING", "sla-warning:step-1", "WORKFLOW_STEP", "step-1", "/panel/dashboard/workflows/wf-1", map[string]string{})
+	}
+	_ = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCustomerSubmitRequiresOwnActionableStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT DISTINCT r.code").WithArgs("customer-2").WillReturnRows(sqlmock.NewRows([]string{"code", "permission"}).AddRow("CUSTOMER", "customer_portal.workflow.submit_own"))
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM workflow_step_instances si JOIN workflow_instances wi").WithArgs("step-1").WillReturnRows(sqlmock.NewRows([]string{"workflow_instance_id", "status", "customer_user_id", "customer_visible", "customer_actionable", "path_state"}).AddRow("wf-1", "IN_PROGRESS", "customer-1", true, true, "INCLUDED"))
+	mock.ExpectRollback()
+	err = NewOperationsService(db).SubmitCustomerWorkflowStep(context.Background(), "customer-2", "step-1", StepValuesPayload{})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected forbidden for another customer's step, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMissingSMSDeliveryReportIsEscalatedNotResent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE notification_outbox SET status=\\$2,last_error='no-delivery-report'").WithArgs("outbox-1", "EXPIRED").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO action_items").WithArgs("outbox-1", sqlmock.AnyArg(), "notification:unknown:").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	retry := []time.Duration{time.Minute, 5 * time.Minute}
+	if err := NewOperationsService(db).recordDeliveryReport(context.Background(), "outbox-1", "msg-1", smsReportMissing, 1, retry); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequeuedDigestIsRebuiltAndResurfaced(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cutoff := time.Date(2026, 10, 17, 0, 0, 0, 0, tehranLocation)
+	key := "digest:user-1:ORDER_CONFIRMED:2026-10-17"
+	created := cutoff.Add(-2 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM notification_digest_items").WithArgs("user-1", "ORDER_CONFIRMED", cutoff, key).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "entity_type", "entity_id", "deep_link", "created_at", "pending"}).
+		AddRow(int64(1), "first", "", "", "", created, false).
+		AddRow(int64(2), "late", "", "", "", created.Add(time.Hour), true))
+	mock.ExpectQuery("ON CONFLICT\\(event_key\\) DO UPDATE SET .*title=EXCLUDED.title,body=EXCLUDED.body.*status='UNREAD',read_at=NULL,created_at=NOW\\(\\)").WithArgs("user-1", "ORDER_CONFIRMED", key, "خلاصه روزانه: 2 اعلان", "first\nlate", sqlmock.AnyArg(), "").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(9)))
+	mock.ExpectExec("UPDATE notification_digest_items SET digested_at=COALESCE").WithArgs(sqlmock.AnyArg(), int64(9)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("SELECT pg_notify").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := NewOperationsService(db).flushNotificationDigest(context.Background(), "user-1", "ORDER_CONFIRMED", cutoff); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateTestSendUsesConfiguredSMSProvider(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM inventory_operation_requests").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("INSERT INTO inventory_operation_requests").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("FROM notification_templates WHERE id=\\$1").WithArgs("template-1").WillReturnRows(sqlmock.NewRows([]string{"event_type", "channel", "locale", "title_template", "body_template", "html_template", "allowed_variables"}).AddRow("ORDER_CONFIRMED", "SMS", "fa", "سفارش {{order_number}}", "سفارش {{order_number}} تأیید شد.", "", []byte(`["order_number"]`)))
+	mock.ExpectQuery("SELECT phone_normalized,email FROM users").WithArgs("admin-1").WillReturnRows(sqlmock.NewRows([]string{"phone_normalized", "email"}).AddRow("+989121234567", nil))
+	mock.ExpectExec("INSERT INTO audit_logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE inventory_operation_requests SET status='COMPLETED'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	provider := &FakeSMSProvider{}
+	s := NewOperationsService(db)
+	s.ConfigureFinanceAndDocuments(t.TempDir(), provider)
+	out, err := s.TestSendNotificationTemplate(context.Background(), "admin-1", "template-1", "key-1", NotificationTemplatePreviewRequest{Values: map[string]string{"order_number": "SO-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Messages) != 1 || provider.Messages[0].Body != "سفارش SO-1 تأیید شد." || out.Provider != provider.Name() || out.ProviderMessageID == "" {
+		t.Fatalf("provider not called: messages=%d result=%+v", len(provider.Messages), out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConditionRoutesOnStoredMeasuredValue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("t.transition_type='CONDITIONAL'").WithArgs("step-1").WillReturnRows(sqlmock.NewRows([]string{"id", "transition_code", "condition_expression"}).
+		AddRow("tr-1", "REWORK", "qc.measuredValue > 1").
+		AddRow("tr-2", "REVIEW", "qc.result == 'FAIL'"))
+	// QC_CHECK stores its measured value as a decimal string.
+	mock.ExpectQuery("SELECT field_key,value_json FROM workflow_step_field_values").WithArgs("step-1").WillReturnRows(sqlmock.NewRows([]string{"field_key", "value_json"}).AddRow("qc", []byte(`{"result":"FAIL","measuredValue":"1.25","unit":"mm"}`)))
+	mock.ExpectExec("UPDATE workflow_step_instances SET condition_transition_id").WithArgs("step-1", "tr-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewOperationsService(db).evaluateStepConditionsTx(context.Background(), tx, "user-1", "wf-1", "step-1")
+	_ = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmatchedConditionFallsBackToManualSelection(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT step_code,result_code,condition_transition_id").WithArgs("step-1").WillReturnRows(sqlmock.NewRows([]string{"step_code", "result_code", "condition_transition_id"}).AddRow("QC", nil, nil))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM workflow_instance_step_transitions WHERE workflow_instance_id=\\$1 AND source_step_code=\\$2$").WithArgs("wf-1", "QC").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("transition_type='PARALLEL'").WithArgs("wf-1", "QC").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("transition_type='AUTOMATIC' AND is_default").WithArgs("wf-1", "QC").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("transition_type='MANUAL_SELECTION'").WithArgs("wf-1", "QC").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE workflow_step_instances SET status='WAITING_FOR_TRANSITION'").WithArgs("step-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE workflow_instances SET status='WAITING_FOR_TRANSITION'").WithArgs("wf-1", "step-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO action_items").WithArgs("step-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routed, err := NewOperationsService(db).routeCompletedStepTx(context.Background(), tx, "user-1", "wf-1", "step-1")
+	_ = tx.Rollback()
+	if err != nil || !routed {
+		t.Fatalf("unmatched condition blocked the step: routed=%v err=%v", routed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
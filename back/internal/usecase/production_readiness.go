@@ -45,6 +45,7 @@ var applicationSettingRules = map[string]settingRule{
 	"default_timezone":                {Kind: "timezone"},
 	"customer_portal_enabled":         {Kind: "bool"},
 	"sms_enabled":                     {Kind: "bool"},
+	"email_enabled":                   {Kind: "bool"},
 	"installation_module_enabled":     {Kind: "bool"},
 	"inventory_module_enabled":        {Kind: "bool"},
 	"supplier_module_enabled":         {Kind: "bool"},
@@ -142,7 +143,7 @@ func (s *OperationsService) FeatureEnabled(ctx context.Context, key string) bool
 }
 
 func (s *OperationsService) FeatureFlags(ctx context.Context) map[string]bool {
-	keys := []string{"customer_portal_enabled", "sms_enabled", "installation_module_enabled", "inventory_module_enabled", "supplier_module_enabled"}
+	keys := []string{"customer_portal_enabled", "sms_enabled", "email_enabled", "installation_module_enabled", "inventory_module_enabled", "supplier_module_enabled"}
 	out := map[string]bool{}
 	for _, key := range keys {
 		out[key] = false
@@ -537,11 +538,11 @@ func (s *OperationsService) Ready(ctx context.Context) error {
 		return err
 	}
 	var exists bool
-	if err := s.db.QueryRowContext(readyCtx, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=20)`).Scan(&exists); err != nil {
+	if err := s.db.QueryRowContext(readyCtx, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=40)`).Scan(&exists); err != nil {
 		return err
 	}
 	if !exists {
-		return errors.New("database migration 020 is required")
+		return errors.New("database migration 040 is required")
 	}
 	return nil
 }
@@ -567,7 +568,9 @@ func PageResult(items any, page PageRequest, total int) map[string]any {
 	return map[string]any{"items": items, "page": page.Page, "pageSize": page.PageSize, "total": total}
 }
 
-func (s *OperationsService) ExportRows(ctx context.Context, kind, search, status string, limit int) ([]string, [][]string, error) {
+// ExportRows returns CSV-ready rows. Timestamps are rendered on the Tehran
+// clock in the Jalali calendar unless calendar is "gregorian".
+func (s *OperationsService) ExportRows(ctx context.Context, kind, search, status, calendar string, limit int) ([]string, [][]string, error) {
 	if limit <= 0 || limit > 10000 {
 		limit = 10000
 	}
@@ -578,19 +581,19 @@ func (s *OperationsService) ExportRows(ctx context.Context, kind, search, status
 	switch kind {
 	case "orders":
 		headers = []string{"order_number", "customer_name", "customer_phone", "status", "created_at"}
-		query = `SELECT o.order_number,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),''),COALESCE(u.phone_normalized,''),o.status,o.created_at::text FROM orders o JOIN users u ON u.id=o.customer_user_id WHERE ($1='%%' OR o.order_number ILIKE $1 OR CONCAT_WS(' ',u.first_name,u.last_name,u.phone_normalized) ILIKE $1) AND ($2='' OR o.status=$2) ORDER BY o.created_at DESC LIMIT $3`
+		query = `SELECT o.order_number,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),''),COALESCE(u.phone_normalized,''),o.status,o.created_at FROM orders o JOIN users u ON u.id=o.customer_user_id WHERE ($1='%%' OR o.order_number ILIKE $1 OR CONCAT_WS(' ',u.first_name,u.last_name,u.phone_normalized) ILIKE $1) AND ($2='' OR o.status=$2) ORDER BY o.created_at DESC LIMIT $3`
 	case "customers":
 		headers = []string{"customer_id", "name", "phone", "status", "created_at"}
-		query = `SELECT u.id::text,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),''),COALESCE(u.phone_normalized,''),u.status,u.created_at::text FROM users u WHERE u.user_type='CUSTOMER' AND ($1='%%' OR CONCAT_WS(' ',u.first_name,u.last_name,u.phone_normalized) ILIKE $1) AND ($2='' OR u.status=$2) ORDER BY u.created_at DESC LIMIT $3`
+		query = `SELECT u.id::text,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),''),COALESCE(u.phone_normalized,''),u.status,u.created_at FROM users u WHERE u.user_type='CUSTOMER' AND ($1='%%' OR CONCAT_WS(' ',u.first_name,u.last_name,u.phone_normalized) ILIKE $1) AND ($2='' OR u.status=$2) ORDER BY u.created_at DESC LIMIT $3`
 	case "payments":
 		headers = []string{"payment_number", "order_number", "amount", "currency", "status", "paid_at"}
-		query = `SELECT p.payment_number,o.order_number,p.amount::text,p.currency,p.status,COALESCE(p.paid_at::text,'') FROM customer_payments p JOIN orders o ON o.id=p.order_id WHERE ($1='%%' OR p.payment_number ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR p.status=$2) ORDER BY p.created_at DESC LIMIT $3`
+		query = `SELECT p.payment_number,o.order_number,p.amount::text,p.currency,p.status,p.paid_at FROM customer_payments p JOIN orders o ON o.id=p.order_id WHERE ($1='%%' OR p.payment_number ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR p.status=$2) ORDER BY p.created_at DESC LIMIT $3`
 	case "costs":
 		headers = []string{"cost_id", "order_number", "cost_type", "amount", "currency", "status", "created_at"}
-		query = `SELECT c.id::text,COALESCE(o.order_number,''),c.cost_type,c.amount::text,c.currency,c.status,c.created_at::text FROM operational_cost_entries c LEFT JOIN orders o ON o.id=c.order_id WHERE ($1='%%' OR c.id::text ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR c.status=$2) ORDER BY c.created_at DESC LIMIT $3`
+		query = `SELECT c.id::text,COALESCE(o.order_number,''),c.cost_type,c.amount::text,c.currency,c.status,c.created_at FROM operational_cost_entries c LEFT JOIN orders o ON o.id=c.order_id WHERE ($1='%%' OR c.id::text ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR c.status=$2) ORDER BY c.created_at DESC LIMIT $3`
 	case "shipments":
 		headers = []string{"shipment_number", "order_number", "status", "planned_departure_at", "estimated_arrival_at"}
-		query = `SELECT s.shipment_number,o.order_number,s.status,COALESCE(s.planned_departure_at::text,''),COALESCE(s.estimated_arrival_at::text,'') FROM shipments s JOIN orders o ON o.id=s.order_id WHERE ($1='%%' OR s.shipment_number ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR s.status=$2) ORDER BY s.created_at DESC LIMIT $3`
+		query = `SELECT s.shipment_number,o.order_number,s.status,s.planned_departure_at,s.estimated_arrival_at FROM shipments s JOIN orders o ON o.id=s.order_id WHERE ($1='%%' OR s.shipment_number ILIKE $1 OR o.order_number ILIKE $1) AND ($2='' OR s.status=$2) ORDER BY s.created_at DESC LIMIT $3`
 	default:
 		return nil, nil, conflict("VALIDATION_FAILED", "نوع خروجی معتبر نیست")
 	}
@@ -601,7 +604,7 @@ func (s *OperationsService) ExportRows(ctx context.Context, kind, search, status
 	defer rows.Close()
 	result := [][]string{}
 	for rows.Next() {
-		values := make([]sql.NullString, len(headers))
+		values := make([]any, len(headers))
 		targets := make([]any, len(headers))
 		for i := range values {
 			targets[i] = &values[i]
@@ -610,14 +613,26 @@ func (s *OperationsService) ExportRows(ctx context.Context, kind, search, status
 			return nil, nil, err
 		}
 		row := make([]string, len(headers))
-		for i := range values {
-			row[i] = values[i].String
+		for i, value := range values {
+			row[i] = exportCell(value, calendar)
 		}
 		result = append(result, row)
 	}
 	return headers, result, rows.Err()
 }
 
+func exportCell(value any, calendar string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return formatCalendarTime(v, calendar)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
 func (s *OperationsService) DetectIntegrityFindings(ctx context.Context) (int, error) {
 	checks := []struct{ code, entity, query, summary, repair string }{
 		{"WORKFLOW_CURRENT_STEP_MISSING", "WORKFLOW", `SELECT id::text FROM workflow_instances WHERE status='IN_PROGRESS' AND current_step_instance_id IS NULL`, `Workflow فعال مرحله جاری ندارد`, `SET_SINGLE_CURRENT_STEP`},
@@ -657,13 +672,20 @@ func (s *OperationsService) DetectIntegrityFindings(ctx context.Context) (int, e
 
 func (s *OperationsService) AuditLogsPage(ctx context.Context, search, actor, entity, action, orderID, from, to string, page PageRequest) (map[string]any, error) {
 	where := ` WHERE ($1='' OR a.action_code ILIKE '%'||$1||'%' OR a.entity_type ILIKE '%'||$1||'%' OR COALESCE(a.entity_id,'') ILIKE '%'||$1||'%') AND ($2='' OR a.actor_user_id::text=$2) AND ($3='' OR a.entity_type=$3) AND ($4='' OR a.action_code=$4) AND ($5='' OR a.entity_id=$5 OR a.metadata->>'order_id'=$5 OR a.before_data->>'order_id'=$5 OR a.after_data->>'order_id'=$5) AND ($6='' OR a.created_at >= $6::timestamptz) AND ($7='' OR a.created_at < $7::timestamptz + INTERVAL '1 day')`
+	from, err := parseDateFilter(from)
+	if err != nil {
+		return nil, err
+	}
+	if to, err = parseDateFilter(to); err != nil {
+		return nil, err
+	}
 	args := []any{search, actor, entity, action, orderID, from, to}
 	var total int
 	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_logs a`+where, args...).Scan(&total); err != nil {
 		return nil, err
 	}
 	args = append(args, page.PageSize, (page.Page-1)*page.PageSize)
-	rows, err := s.db.QueryContext(ctx, `SELECT a.id,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),u.phone_normalized,'سیستم'),COALESCE(a.actor_user_id::text,''),a.action_code,a.entity_type,COALESCE(a.entity_id,''),a.before_data,a.after_data,a.metadata,COALESCE(a.request_id,''),a.created_at FROM audit_logs a LEFT JOIN users u ON u.id=a.actor_user_id`+where+` ORDER BY a.created_at DESC LIMIT $8 OFFSET $9`, args...)
+	rows, err := s.db.QueryContext(ctx, `SELECT a.id,COALESCE(NULLIF(CONCAT_WS(' ',u.first_name,u.last_name),''),u.phone_normalized,'سیستم'),COALESCE(a.actor_user_id::text,''),COALESCE(a.on_behalf_of_user_id::text,''),COALESCE(NULLIF(CONCAT_WS(' ',ob.first_name,ob.last_name),''),ob.phone_normalized,''),a.action_code,a.entity_type,COALESCE(a.entity_id,''),a.before_data,a.after_data,a.metadata,COALESCE(a.request_id,''),a.created_at FROM audit_logs a LEFT JOIN users u ON u.id=a.actor_user_id LEFT JOIN users ob ON ob.id=a.on_behalf_of_user_id`+where+` ORDER BY a.created_at DESC LIMIT $8 OFFSET $9`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -671,13 +693,13 @@ func (s *OperationsService) AuditLogsPage(ctx context.Context, search, actor, en
 	items := []map[string]any{}
 	for rows.Next() {
 		var id int64
-		var actorName, actorID, actionCode, entityType, entityID, requestID string
+		var actorName, actorID, onBehalfID, onBehalfName, actionCode, entityType, entityID, requestID string
 		var before, after, metadata []byte
 		var created time.Time
-		if err = rows.Scan(&id, &actorName, &actorID, &actionCode, &entityType, &entityID, &before, &after, &metadata, &requestID, &created); err != nil {
+		if err = rows.Scan(&id, &actorName, &actorID, &onBehalfID, &onBehalfName, &actionCode, &entityType, &entityID, &before, &after, &metadata, &requestID, &created); err != nil {
 			return nil, err
 		}
-		items = append(items, map[string]any{"id": id, "actor": actorName, "actor_id": actorID, "action": actionCode, "entity": entityType, "entity_id": entityID, "before": json.RawMessage(before), "after": json.RawMessage(after), "metadata": json.RawMessage(metadata), "request_id": requestID, "created_at": created})
+		items = append(items, map[string]any{"id": id, "actor": actorName, "actor_id": actorID, "on_behalf_of_id": onBehalfID, "on_behalf_of": onBehalfName, "action": actionCode, "entity": entityType, "entity_id": entityID, "before": json.RawMessage(before), "after": json.RawMessage(after), "metadata": json.RawMessage(metadata), "request_id": requestID, "created_at": created, "created_at_jalali": formatJalaliDateTime(created)})
 	}
 	return PageResult(items, page, total), rows.Err()
 }
@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// scheduledJobDefinition declares when a worker job runs and how long a run
+// may take. Schedules are cron expressions on the Tehran clock; the worker
+// tick (WORKER_POLL_SECONDS) bounds how precisely they are honoured.
+type scheduledJobDefinition struct {
+	code     string
+	schedule string
+	timeout  time.Duration
+}
+
+var scheduledJobDefinitions = []scheduledJobDefinition{
+	{"payment_due", "*/15 * * * *", 2 * time.Minute},
+	{"workflow_delay", "*/5 * * * *", 2 * time.Minute},
+	{"workflow_sla", "*/5 * * * *", 2 * time.Minute},
+	{"shipment_eta", "0 * * * *", 2 * time.Minute},
+	{"sales_followup", "*/30 * * * *", 2 * time.Minute},
+	{"operations_report", "0 * * * *", 10 * time.Minute},
+	{"integrity_detection", "30 * * * *", 5 * time.Minute},
+	{"notification_outbox", "* * * * *", 5 * time.Minute},
+	{"notification_delivery_status", "*/5 * * * *", 5 * time.Minute},
+	{"webhook_outbox", "* * * * *", 5 * time.Minute},
+	{"notification_digest", "*/30 * * * *", 5 * time.Minute},
+}
+
+var ErrScheduledJobNotFound = errors.New("scheduled job not found")
+
+func findScheduledJob(code string) (scheduledJobDefinition, bool) {
+	for _, d := range scheduledJobDefinitions {
+		if d.code == code {
+			return d, true
+		}
+	}
+	return scheduledJobDefinition{}, false
+}
+
+func (s *OperationsService) workerJobRunners(retry []time.Duration) map[string]func(context.Context) (int, error) {
+	return map[string]func(context.Context) (int, error){
+		"payment_due":                  s.runPaymentDueJob,
+		"workflow_delay":               s.runWorkflowDelayJob,
+		"workflow_sla":                 s.runWorkflowSLAJob,
+		"shipment_eta":                 s.runShipmentETAJob,
+		"sales_followup":               s.runSalesFollowupJob,
+		"operations_report":            s.refreshOperationsReportJob,
+		"integrity_detection":          s.DetectIntegrityFindings,
+		"notification_outbox":          func(ctx context.Context) (int, error) { return s.processNotificationOutbox(ctx, retry) },
+		"notification_delivery_status": func(ctx context.Context) (int, error) { return s.reconcileNotificationDeliveries(ctx, retry) },
+		"webhook_outbox":               func(ctx context.Context) (int, error) { return s.processWebhookOutbox(ctx, retry) },
+		"notification_digest":          s.runNotificationDigestJob,
+	}
+}
+
+type ScheduledJobRun struct {
+	ID          string     `json:"id"`
+	JobCode     string     `json:"job_code"`
+	TriggerType string     `json:"trigger_type"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DurationMS  *int64     `json:"duration_ms,omitempty"`
+	Affected    int        `json:"affected"`
+	Error       *string    `json:"error,omitempty"`
+}
+
+type ScheduledJob struct {
+	Code           string           `json:"code"`
+	Schedule       string           `json:"schedule"`
+	TimeoutSeconds int              `json:"timeout_seconds"`
+	Paused         bool             `json:"paused"`
+	NextRunAt      *time.Time       `json:"next_run_at,omitempty"`
+	RunRequested   bool             `json:"run_requested"`
+	LastRun        *ScheduledJobRun `json:"last_run,omitempty"`
+}
+
+func scanScheduledJobRun(scan func(...any) error) (ScheduledJobRun, error) {
+	var r ScheduledJobRun
+	var completed sql.NullTime
+	var message sql.NullString
+	if err := scan(&r.ID, &r.JobCode, &r.TriggerType, &r.Status, &r.StartedAt, &completed, &r.Affected, &message); err != nil {
+		return r, err
+	}
+	if completed.Valid {
+		ms := completed.Time.Sub(r.StartedAt).Milliseconds()
+		r.CompletedAt, r.DurationMS = &completed.Time, &ms
+	}
+	r.Error = scanNullableString(message)
+	return r, nil
+}
+
+const scheduledJobRunColumns = `id,job_code,trigger_type,status,started_at,completed_at,affected_count,error_text`
+
+func (s *OperationsService) ListScheduledJobs(ctx context.Context) ([]ScheduledJob, error) {
+	out := make([]ScheduledJob, 0, len(scheduledJobDefinitions))
+	for _, d := range scheduledJobDefinitions {
+		job := ScheduledJob{Code: d.code, Schedule: d.schedule, TimeoutSeconds: int(d.timeout / time.Second)}
+		var next time.Time
+		err := s.db.QueryRowContext(ctx, `SELECT is_paused,next_run_at,run_requested_at IS NOT NULL FROM scheduled_jobs WHERE job_code=$1`, d.code).Scan(&job.Paused, &next, &job.RunRequested)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			job.NextRunAt = &next
+		}
+		run, err := scanScheduledJobRun(s.db.QueryRowContext(ctx, `SELECT `+scheduledJobRunColumns+` FROM scheduled_job_runs WHERE job_code=$1 ORDER BY started_at DESC LIMIT 1`, d.code).Scan)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			job.LastRun = &run
+		}
+		out = append(out, job)
+	}
+	return out, nil
+}
+
+func (s *OperationsService) ListScheduledJobRuns(ctx context.Context, code string, limit int) ([]ScheduledJobRun, error) {
+	if _, ok := findScheduledJob(code); !ok {
+		return nil, ErrScheduledJobNotFound
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+scheduledJobRunColumns+` FROM scheduled_job_runs WHERE job_code=$1 ORDER BY started_at DESC LIMIT $2`, code, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ScheduledJobRun{}
+	for rows.Next() {
+		r, err := scanScheduledJobRun(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ControlScheduledJob pauses or resumes a job, or asks the worker to run it
+// on its next tick regardless of schedule and pause state.
+func (s *OperationsService) ControlScheduledJob(ctx context.Context, actor, code, action, key string) error {
+	if _, ok := findScheduledJob(code); !ok {
+		return ErrScheduledJobNotFound
+	}
+	var query string
+	switch action {
+	case "pause":
+		query = `INSERT INTO scheduled_jobs(job_code,is_paused,updated_by_user_id) VALUES($1,TRUE,$2) ON CONFLICT(job_code) DO UPDATE SET is_paused=TRUE,updated_by_user_id=$2,updated_at=NOW()`
+	case "resume":
+		query = `INSERT INTO scheduled_jobs(job_code,is_paused,updated_by_user_id) VALUES($1,FALSE,$2) ON CONFLICT(job_code) DO UPDATE SET is_paused=FALSE,updated_by_user_id=$2,updated_at=NOW()`
+	case "run":
+		query = `INSERT INTO scheduled_jobs(job_code,run_requested_at,run_requested_by_user_id,updated_by_user_id) VALUES($1,NOW(),$2,$2) ON CONFLICT(job_code) DO UPDATE SET run_requested_at=NOW(),run_requested_by_user_id=$2,updated_by_user_id=$2,updated_at=NOW()`
+	default:
+		return errors.New("unknown scheduled job action")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	claim, err := claimOperationTx(ctx, tx, actor, "SCHEDULED_JOB_CONTROL", key, map[string]string{"code": code, "action": action})
+	if err != nil {
+		return err
+	}
+	if claim.Existing {
+		return tx.Commit()
+	}
+	if _, err = tx.ExecContext(ctx, query, code, actor); err != nil {
+		return err
+	}
+	s.auditTx(ctx, tx, actor, "SCHEDULED_JOB_"+map[string]string{"pause": "PAUSED", "resume": "RESUMED", "run": "RUN_REQUESTED"}[action], "SCHEDULED_JOB", code, nil, map[string]string{"action": action})
+	if err = finishOperationTx(ctx, tx, actor, "SCHEDULED_JOB_CONTROL", key, map[string]bool{"ok": true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runScheduledJob runs one job if it is due, or if a run was requested, and
+// records the run. The advisory lock keeps replicas from running the same
+// job concurrently; the conditional update hands each due slot to one of them.
+func (s *OperationsService) runScheduledJob(ctx context.Context, d scheduledJobDefinition, fn func(context.Context) (int, error)) (WorkerResult, bool, error) {
+	result := WorkerResult{Job: d.code}
+	schedule, err := parseCronSchedule(d.schedule)
+	if err != nil {
+		return result, false, err
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return result, false, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, "operations-worker:"+d.code).Scan(&locked); err != nil {
+		return result, false, err
+	}
+	if !locked {
+		return result, false, nil
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, "operations-worker:"+d.code)
+	now := time.Now()
+	if _, err = s.db.ExecContext(ctx, `INSERT INTO scheduled_jobs(job_code,next_run_at) VALUES($1,NOW()) ON CONFLICT(job_code) DO NOTHING`, d.code); err != nil {
+		return result, false, err
+	}
+	var manual bool
+	err = s.db.QueryRowContext(ctx, `UPDATE scheduled_jobs j SET next_run_at=$2,run_requested_at=NULL,run_requested_by_user_id=NULL FROM (SELECT job_code,run_requested_at FROM scheduled_jobs WHERE job_code=$1 FOR UPDATE) prev WHERE j.job_code=prev.job_code AND (prev.run_requested_at IS NOT NULL OR (NOT j.is_paused AND j.next_run_at<=NOW())) RETURNING prev.run_requested_at IS NOT NULL`, d.code, schedule.Next(now)).Scan(&manual)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	result.Trigger = "SCHEDULE"
+	bucket := now.UTC().Truncate(time.Minute)
+	if manual {
+		result.Trigger, bucket = "MANUAL", now.UTC()
+	}
+	var runID string
+	err = s.db.QueryRowContext(ctx, `INSERT INTO scheduled_job_runs(job_code,scheduled_bucket,status,trigger_type) VALUES($1,$2,'RUNNING',$3) ON CONFLICT(job_code,scheduled_bucket) DO NOTHING RETURNING id`, d.code, bucket, result.Trigger).Scan(&runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	s.workerMonitor.jobStarted(d.code, d.timeout)
+	jobCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	n, runErr := fn(jobCtx)
+	timedOut := errors.Is(jobCtx.Err(), context.DeadlineExceeded)
+	cancel()
+	status := "COMPLETED"
+	var message any
+	if runErr != nil {
+		status = "FAILED"
+		if timedOut {
+			status = "TIMED_OUT"
+		}
+		message = runErr.Error()
+	}
+	// The run row is closed even when the worker is shutting down.
+	_, _ = s.db.ExecContext(context.WithoutCancel(ctx), `UPDATE scheduled_job_runs SET status=$2,affected_count=$3,error_text=$4,completed_at=NOW() WHERE id=$1`, runID, status, n, message)
+	result.Affected, result.DurationMS = n, time.Since(now).Milliseconds()
+	s.workerMonitor.jobFinished(result, runErr)
+	return result, true, runErr
+}
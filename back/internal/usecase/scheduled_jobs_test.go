@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(v string) time.Time {
+		out, err := time.ParseInLocation("2006-01-02 15:04", v, tehranLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	cases := []struct{ expr, from, want string }{
+		{"* * * * *", "2026-03-10 10:07", "2026-03-10 10:08"},
+		{"*/15 * * * *", "2026-03-10 10:07", "2026-03-10 10:15"},
+		{"0 * * * *", "2026-03-10 10:00", "2026-03-10 11:00"},
+		{"30 2 * * *", "2026-03-10 10:00", "2026-03-11 02:30"},
+		{"0 9-17/4 * * *", "2026-03-10 13:01", "2026-03-10 17:00"},
+		// 2026-03-13 is a Friday; 6 and 0-4 skip it.
+		{"0 8 * * 0-4,6", "2026-03-12 09:00", "2026-03-14 08:00"},
+		{"0 0 1 1 *", "2026-03-10 10:00", "2027-01-01 00:00"},
+		{"0 0 29 2 *", "2026-03-10 10:00", "2028-02-29 00:00"},
+		{"0 12 1 * 7", "2026-03-10 10:00", "2026-03-15 12:00"},
+	}
+	for _, c := range cases {
+		schedule, err := parseCronSchedule(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if got := schedule.Next(at(c.from).UTC()); !got.Equal(at(c.want)) {
+			t.Fatalf("%s after %s = %s, want %s", c.expr, c.from, got.In(tehranLocation).Format("2006-01-02 15:04"), c.want)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCronSchedule(expr); err == nil {
+			t.Fatalf("%q accepted", expr)
+		}
+	}
+}
+
+func TestScheduledJobRegistry(t *testing.T) {
+	runners := (&OperationsService{}).workerJobRunners(nil)
+	if len(runners) != len(scheduledJobDefinitions) {
+		t.Fatalf("%d runners for %d definitions", len(runners), len(scheduledJobDefinitions))
+	}
+	for _, d := range scheduledJobDefinitions {
+		if runners[d.code] == nil {
+			t.Fatalf("%s has no runner", d.code)
+		}
+		schedule, err := parseCronSchedule(d.schedule)
+		if err != nil || schedule.Next(time.Now()).IsZero() || d.timeout <= 0 {
+			t.Fatalf("%s schedule=%q timeout=%s err=%v", d.code, d.schedule, d.timeout, err)
+		}
+	}
+}
+
+func TestWorkerMonitorHealth(t *testing.T) {
+	m := NewWorkerMonitor()
+	start := m.startedAt
+	if !m.Snapshot(start.Add(time.Minute), 90*time.Second).Healthy {
+		t.Fatal("fresh worker reported stuck")
+	}
+	m.jobStarted("operations_report", 10*time.Minute)
+	if s := m.Snapshot(time.Now().Add(5*time.Minute), 90*time.Second); !s.Healthy || s.RunningJob != "operations_report" {
+		t.Fatalf("long job within its timeout: %+v", s)
+	}
+	if m.Snapshot(time.Now().Add(12*time.Minute), 90*time.Second).Healthy {
+		t.Fatal("job past its timeout reported healthy")
+	}
+	m.jobFinished(WorkerResult{Job: "operations_report", DurationMS: 1200}, errors.New("boom"))
+	m.jobStarted("payment_due", time.Minute)
+	m.jobFinished(WorkerResult{Job: "payment_due"}, nil)
+	m.CycleFinished(time.Now())
+	s := m.Snapshot(time.Now(), 90*time.Second)
+	if !s.Healthy || s.RunningJob != "" || len(s.Jobs) != 2 || s.Jobs[0].Job != "operations_report" || s.Jobs[0].Failures != 1 || s.Jobs[0].LastSuccessAt != nil || s.Jobs[1].LastSuccessAt == nil {
+		t.Fatalf("snapshot=%+v", s)
+	}
+	if m.Snapshot(time.Now().Add(2*time.Minute), 90*time.Second).Healthy {
+		t.Fatal("stalled loop reported healthy")
+	}
+}
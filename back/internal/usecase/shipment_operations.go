@@ -100,6 +100,13 @@ func (s *OperationsService) CreateShipment(ctx context.Context, actor, orderID,
 	if err = ensureActiveSupplierTx(ctx, tx, p.SupplierID); err != nil {
 		return out, err
 	}
+	destination := ""
+	if p.DestinationLocationID != nil {
+		destination = *p.DestinationLocationID
+	}
+	if err = applyShipmentTransit(ctx, tx, &p, p.OriginLocationID, destination); err != nil {
+		return out, err
+	}
 	number, err := nextReadableNumberTx(ctx, tx, "SHP")
 	if err != nil {
 		return out, err
@@ -245,10 +252,42 @@ func (s *OperationsService) ListShipmentItems(ctx context.Context, id string) ([
 	return out, rows.Err()
 }
 
+// applyShipmentTransit derives estimated_arrival_at from the planned
+// departure and transit_hours, counted in working hours of the destination
+// (or, without one, the origin). An explicit estimate wins.
+func applyShipmentTransit(ctx context.Context, q calendarQuerier, p *ShipmentPayload, origin, destination string) error {
+	if p.TransitHours == nil || p.EstimatedArrivalAt != nil {
+		return nil
+	}
+	if *p.TransitHours <= 0 || *p.TransitHours > 24*365 || p.PlannedDepartureAt == nil {
+		return errors.New("transit_hours needs a planned departure and 1 to 8760 hours")
+	}
+	location := destination
+	if location == "" {
+		location = origin
+	}
+	calendar, err := loadBusinessCalendar(ctx, q, location, *p.PlannedDepartureAt)
+	if err != nil {
+		return err
+	}
+	eta := calendar.add(*p.PlannedDepartureAt, time.Duration(*p.TransitHours)*time.Hour)
+	p.EstimatedArrivalAt = &eta
+	return nil
+}
+
 func (s *OperationsService) UpdateShipment(ctx context.Context, actor, id string, p ShipmentPayload) error {
 	if p.CustomerVisible != nil && !s.HasPermission(ctx, actor, "shipments.override") {
 		return ErrForbidden
 	}
+	if p.TransitHours != nil && p.EstimatedArrivalAt == nil {
+		var origin, destination string
+		if err := s.db.QueryRowContext(ctx, `SELECT origin_location_id::text,COALESCE(destination_location_id::text,'') FROM shipments WHERE id=$1`, id).Scan(&origin, &destination); err != nil {
+			return err
+		}
+		if err := applyShipmentTransit(ctx, s.db, &p, origin, destination); err != nil {
+			return err
+		}
+	}
 	r, err := s.db.ExecContext(ctx, `UPDATE shipments SET driver_user_id=$2,external_driver_name=NULLIF($3,''),external_driver_phone=NULLIF($4,''),carrier_name=NULLIF($5,''),vehicle_id=$6,planned_departure_at=$7,estimated_arrival_at=$8,delivery_contact_name=NULLIF($9,''),delivery_contact_phone=NULLIF($10,''),delivery_address=NULLIF($11,''),customer_title_fa=COALESCE(NULLIF($12,''),customer_title_fa),customer_visible=COALESCE($13,customer_visible),status=CASE WHEN status='DRAFT' THEN 'PLANNED' ELSE status END,notes=NULLIF($14,''),updated_at=NOW() WHERE id=$1 AND status NOT IN ('DELIVERED','CANCELLED')`, id, p.DriverUserID, p.ExternalDriverName, NormalizePhone(p.ExternalDriverPhone), p.CarrierName, p.VehicleID, p.PlannedDepartureAt, p.EstimatedArrivalAt, p.DeliveryContactName, NormalizePhone(p.DeliveryContactPhone), p.DeliveryAddress, p.CustomerTitleFA, p.CustomerVisible, p.Notes)
 	if err != nil {
 		return err
@@ -538,6 +577,9 @@ func (s *OperationsService) DispatchShipment(ctx context.Context, actor, id, key
 	if err = emitShipmentCustomerNotificationTx(ctx, tx, id, "SHIPMENT_DISPATCHED"); err != nil {
 		return nil, err
 	}
+	if err = emitWebhookEventTx(ctx, tx, "SHIPMENT_DISPATCHED", "shipment-dispatched:"+id, "SHIPMENT", id); err != nil {
+		return nil, err
+	}
 	out := map[string]any{"event_id": eventID, "status": "IN_TRANSIT"}
 	s.auditTx(ctx, tx, actor, "shipments.dispatch", "shipment", id, map[string]any{"status": status}, out)
 	if err = finishOperationTx(ctx, tx, actor, "SHIPMENT_DISPATCH", key, out); err != nil {
@@ -785,6 +827,9 @@ func (s *OperationsService) DeliverShipment(ctx context.Context, actor, id, key
 		if err = emitShipmentCustomerNotificationTx(ctx, tx, id, "SHIPMENT_DELIVERED"); err != nil {
 			return nil, err
 		}
+		if err = emitWebhookEventTx(ctx, tx, "SHIPMENT_DELIVERED", "shipment-delivered:"+id, "SHIPMENT", id); err != nil {
+			return nil, err
+		}
 	}
 	out := map[string]any{"event_id": eventID, "status": newStatus}
 	s.auditTx(ctx, tx, actor, "shipments.deliver", "shipment", id, map[string]any{"status": status}, out)
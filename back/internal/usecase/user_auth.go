@@ -33,6 +33,7 @@ var (
 	ErrInactiveUser       = errors.New("user inactive")
 	ErrPasswordTooShort   = errors.New("password must be at least 8 characters")
 	ErrPasswordTooLong    = errors.New("password exceeds bcrypt's 72-byte limit")
+	ErrUnsupportedLocale  = errors.New("preferred locale must be fa, en or ar")
 )
 
 const userJWTIssuer = "sangehassan-user"
@@ -258,7 +259,7 @@ func validateNewPassword(password string) error {
 	return nil
 }
 
-func (s *UserAuthService) UpdateMe(ctx context.Context, userID string, fullName, phone, email *string) (domain.UserInfo, error) {
+func (s *UserAuthService) UpdateMe(ctx context.Context, userID string, fullName, phone, email, locale *string) (domain.UserInfo, error) {
 	user, err := s.users.GetByID(ctx, userID)
 	if err != nil {
 		return domain.UserInfo{}, err
@@ -298,6 +299,13 @@ func (s *UserAuthService) UpdateMe(ctx context.Context, userID string, fullName,
 		}
 	}
 
+	if locale != nil {
+		if !supportedLocale(*locale) {
+			return domain.UserInfo{}, ErrUnsupportedLocale
+		}
+		user.PreferredLocale = *locale
+	}
+
 	updated, err := s.users.UpdateProfile(ctx, user)
 	if err != nil {
 		if conflictErr := resolveUniqueConflict(err); conflictErr != nil {
@@ -450,6 +458,15 @@ func NormalizePhone(raw string) string {
 
 func normalizePhone(raw string) string { return NormalizePhone(raw) }
 
+// supportedLocale lists the site languages a user may receive notifications in.
+func supportedLocale(locale string) bool {
+	return locale == "fa" || locale == "en" || locale == "ar"
+}
+
+// phoneAliasEmailDomain marks placeholder addresses for phone-only accounts;
+// they satisfy the users.email constraint but are never deliverable.
+const phoneAliasEmailDomain = "phone.sangehassan.local"
+
 func phoneAliasEmail(phone string) string {
 	var digits strings.Builder
 	digits.Grow(len(phone))
@@ -462,7 +479,7 @@ func phoneAliasEmail(phone string) string {
 	if value == "" {
 		value = "user"
 	}
-	return fmt.Sprintf("u%s@phone.sangehassan.local", value)
+	return fmt.Sprintf("u%s@%s", value, phoneAliasEmailDomain)
 }
 
 func trimOptional(value *string) *string {
@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type onBehalfOfContextKey struct{}
+
+// withOnBehalfOf marks the rest of an action as taken for delegator; every
+// audit entry written with the returned context records it.
+func withOnBehalfOf(ctx context.Context, delegator string) context.Context {
+	return context.WithValue(ctx, onBehalfOfContextKey{}, delegator)
+}
+
+func onBehalfOfFromContext(ctx context.Context) string {
+	value, _ := ctx.Value(onBehalfOfContextKey{}).(string)
+	return value
+}
+
+// UserDelegation lets DelegateUserID stand in for DelegatorUserID between
+// StartsAt and EndsAt, for all of the delegator's roles or only RoleID.
+type UserDelegation struct {
+	ID              int64      `json:"id"`
+	DelegatorUserID string     `json:"delegator_user_id"`
+	DelegatorName   string     `json:"delegator_name"`
+	DelegateUserID  string     `json:"delegate_user_id"`
+	DelegateName    string     `json:"delegate_name"`
+	RoleID          *int64     `json:"role_id,omitempty"`
+	RoleNameFA      string     `json:"role_name_fa,omitempty"`
+	StartsAt        time.Time  `json:"starts_at"`
+	EndsAt          time.Time  `json:"ends_at"`
+	Reason          string     `json:"reason"`
+	Active          bool       `json:"active"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// UserDelegationPayload creates a delegation; DelegatorUserID defaults to the
+// actor.
+type UserDelegationPayload struct {
+	DelegatorUserID string    `json:"delegator_user_id"`
+	DelegateUserID  string    `json:"delegate_user_id"`
+	RoleID          *int64    `json:"role_id"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Reason          string    `json:"reason"`
+}
+
+// delegationScopeSQL narrows active_user_delegations d to the delegations
+// that let user stand in on work assigned to assigned or held by role: the
+// delegator is the assignee or a member of the role, within the delegated
+// role. Work lists and delegatorFor share it so a delegate sees exactly the
+// work they may act on.
+func delegationScopeSQL(assigned, role, user string) string {
+	return fmt.Sprintf(`d.delegate_user_id=%[3]s AND (d.role_id IS NULL OR d.role_id=%[2]s) AND (d.delegator_user_id=%[1]s OR EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=d.delegator_user_id AND ur.role_id=%[2]s))`, assigned, role, user)
+}
+
+// workflowWorkSQL matches work assigned to user, or left to role when it
+// has no assignee, including work the user takes over through a delegation
+// in force.
+func workflowWorkSQL(assigned, role, user string) string {
+	return fmt.Sprintf(`(%[1]s=%[3]s OR EXISTS(SELECT 1 FROM active_user_delegations d WHERE %[4]s) OR (%[1]s IS NULL AND EXISTS(SELECT 1 FROM workflow_acting_roles ar WHERE ar.user_id=%[3]s AND ar.role_id=%[2]s)))`, assigned, role, user, delegationScopeSQL(assigned, role, user))
+}
+
+// delegatorFor returns the user the actor stands in for on work assigned to
+// assigned or held by role, through a delegation in force; the assignee is
+// preferred over other members of the role. It returns "" when there is none.
+func (s *OperationsService) delegatorFor(ctx context.Context, actor string, role sql.NullInt64, assigned sql.NullString) string {
+	var delegator string
+	_ = s.db.QueryRowContext(ctx, `SELECT d.delegator_user_id FROM active_user_delegations d WHERE `+delegationScopeSQL("$3", "$2", "$1")+` ORDER BY d.delegator_user_id=$3 DESC,d.starts_at LIMIT 1`, actor, role, assigned).Scan(&delegator)
+	return delegator
+}
+
+// ListUserDelegations returns the delegations the actor gives or receives,
+// or all of them with user_delegations.manage.
+func (s *OperationsService) ListUserDelegations(ctx context.Context, actor string, activeOnly bool) ([]UserDelegation, error) {
+	return s.listUserDelegations(ctx, actor, activeOnly, 0)
+}
+
+func (s *OperationsService) listUserDelegations(ctx context.Context, actor string, activeOnly bool, id int64) ([]UserDelegation, error) {
+	manage := s.HasPermission(ctx, actor, "user_delegations.manage")
+	rows, err := s.db.QueryContext(ctx, `SELECT d.id,d.delegator_user_id,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',a.first_name,a.last_name)),''),a.phone_normalized,''),d.delegate_user_id,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',b.first_name,b.last_name)),''),b.phone_normalized,''),d.role_id,COALESCE(r.name_fa,''),d.starts_at,d.ends_at,d.reason,EXISTS(SELECT 1 FROM active_user_delegations x WHERE x.id=d.id),d.revoked_at,d.created_at
+		FROM user_delegations d JOIN users a ON a.id=d.delegator_user_id JOIN users b ON b.id=d.delegate_user_id LEFT JOIN roles r ON r.id=d.role_id
+		WHERE ($2 OR d.delegator_user_id=$1 OR d.delegate_user_id=$1) AND (NOT $3 OR (d.revoked_at IS NULL AND d.ends_at>NOW())) AND ($4=0 OR d.id=$4)
+		ORDER BY d.starts_at DESC,d.id DESC LIMIT 500`, actor, manage, activeOnly, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UserDelegation{}
+	for rows.Next() {
+		var d UserDelegation
+		var role sql.NullInt64
+		var revoked sql.NullTime
+		if err = rows.Scan(&d.ID, &d.DelegatorUserID, &d.DelegatorName, &d.DelegateUserID, &d.DelegateName, &role, &d.RoleNameFA, &d.StartsAt, &d.EndsAt, &d.Reason, &d.Active, &revoked, &d.CreatedAt); err != nil {
+			return out, err
+		}
+		if role.Valid {
+			v := role.Int64
+			d.RoleID = &v
+		}
+		if revoked.Valid {
+			v := revoked.Time
+			d.RevokedAt = &v
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// CreateUserDelegation records a delegation. Users delegate their own work;
+// delegating for someone else requires user_delegations.manage.
+func (s *OperationsService) CreateUserDelegation(ctx context.Context, actor string, p UserDelegationPayload) (UserDelegation, error) {
+	if p.DelegatorUserID == "" {
+		p.DelegatorUserID = actor
+	}
+	if p.DelegatorUserID != actor && !s.HasPermission(ctx, actor, "user_delegations.manage") {
+		return UserDelegation{}, ErrForbidden
+	}
+	if p.DelegateUserID == "" || p.DelegateUserID == p.DelegatorUserID {
+		return UserDelegation{}, errors.New("delegate must be another user")
+	}
+	if p.StartsAt.IsZero() || !p.EndsAt.After(p.StartsAt) {
+		return UserDelegation{}, errors.New("delegation must end after it starts")
+	}
+	if !p.EndsAt.After(time.Now()) {
+		return UserDelegation{}, errors.New("delegation has already ended")
+	}
+	if !s.IsInternal(ctx, p.DelegatorUserID) || !s.IsInternal(ctx, p.DelegateUserID) {
+		return UserDelegation{}, errors.New("both users must be active internal users")
+	}
+	if p.RoleID != nil {
+		var held bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM user_roles WHERE user_id=$1 AND role_id=$2)`, p.DelegatorUserID, *p.RoleID).Scan(&held); err != nil {
+			return UserDelegation{}, err
+		}
+		if !held {
+			return UserDelegation{}, errors.New("delegated role must be held by the delegator")
+		}
+	}
+	p.Reason = strings.TrimSpace(p.Reason)
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO user_delegations(delegator_user_id,delegate_user_id,role_id,starts_at,ends_at,reason,created_by_user_id) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`, p.DelegatorUserID, p.DelegateUserID, p.RoleID, p.StartsAt, p.EndsAt, p.Reason, actor).Scan(&id)
+	if err != nil {
+		return UserDelegation{}, err
+	}
+	s.audit(ctx, actor, "user_delegations.create", "user_delegation", fmt.Sprint(id), p)
+	return s.userDelegation(ctx, actor, id)
+}
+
+// RevokeUserDelegation ends a delegation early. The delegator, the delegate
+// and holders of user_delegations.manage may revoke it.
+func (s *OperationsService) RevokeUserDelegation(ctx context.Context, actor string, id int64) error {
+	var delegator, delegate string
+	if err := s.db.QueryRowContext(ctx, `SELECT delegator_user_id,delegate_user_id FROM user_delegations WHERE id=$1`, id).Scan(&delegator, &delegate); err != nil {
+		return err
+	}
+	if actor != delegator && actor != delegate && !s.HasPermission(ctx, actor, "user_delegations.manage") {
+		return ErrForbidden
+	}
+	r, err := s.db.ExecContext(ctx, `UPDATE user_delegations SET revoked_at=NOW(),revoked_by_user_id=$2 WHERE id=$1 AND revoked_at IS NULL AND ends_at>NOW()`, id, actor)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return ErrInvalidTransition
+	}
+	s.audit(ctx, actor, "user_delegations.revoke", "user_delegation", fmt.Sprint(id), map[string]any{"delegator_user_id": delegator, "delegate_user_id": delegate})
+	return nil
+}
+
+func (s *OperationsService) userDelegation(ctx context.Context, actor string, id int64) (UserDelegation, error) {
+	items, err := s.listUserDelegations(ctx, actor, false, id)
+	if err != nil {
+		return UserDelegation{}, err
+	}
+	if len(items) == 0 {
+		return UserDelegation{}, sql.ErrNoRows
+	}
+	return items[0], nil
+}
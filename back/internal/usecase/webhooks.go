@@ -0,0 +1,464 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// webhookEventData builds the "data" object of each supported event from the
+// entity it refers to. The keys double as the allowlist of subscribable events.
+var webhookEventData = map[string]string{
+	"ORDER_CONFIRMED":        `SELECT jsonb_build_object('order_id',o.id,'order_number',o.order_number,'status',o.status,'customer_user_id',o.customer_user_id,'confirmed_at',o.confirmed_at)::text FROM orders o WHERE o.id=$1`,
+	"PAYMENT_CONFIRMED":      `SELECT jsonb_build_object('payment_id',p.id,'payment_number',p.payment_number,'order_id',o.id,'order_number',o.order_number,'amount',p.amount::text,'currency',p.currency,'paid_at',p.paid_at)::text FROM customer_payments p JOIN orders o ON o.id=p.order_id WHERE p.id=$1`,
+	"SHIPMENT_DISPATCHED":    `SELECT jsonb_build_object('shipment_id',s.id,'shipment_number',s.shipment_number,'order_id',o.id,'order_number',o.order_number,'status',s.status,'departed_at',s.actual_departure_at,'estimated_arrival_at',s.estimated_arrival_at)::text FROM shipments s JOIN orders o ON o.id=s.order_id WHERE s.id=$1`,
+	"SHIPMENT_DELIVERED":     `SELECT jsonb_build_object('shipment_id',s.id,'shipment_number',s.shipment_number,'order_id',o.id,'order_number',o.order_number,'status',s.status)::text FROM shipments s JOIN orders o ON o.id=s.order_id WHERE s.id=$1`,
+	"INSTALLATION_COMPLETED": `SELECT jsonb_build_object('installation_job_id',j.id,'installation_number',j.installation_number,'order_id',o.id,'order_number',o.order_number,'completed_at',j.actual_end_at)::text FROM installation_jobs j JOIN orders o ON o.id=j.order_id WHERE j.id=$1`,
+}
+
+const maxWebhookResponseBytes = 16 * 1024
+
+type WebhookSubscriptionPayload struct {
+	Name         string   `json:"name"`
+	TargetURL    string   `json:"target_url"`
+	Secret       string   `json:"secret"`
+	EventTypes   []string `json:"event_types"`
+	IsActive     *bool    `json:"is_active"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	TargetURL  string    `json:"target_url"`
+	EventTypes []string  `json:"event_types"`
+	IsActive   bool      `json:"is_active"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// webhookAddressAllowed rejects addresses a subscription must never reach:
+// loopback, private (RFC 1918 and unique-local), shared, link-local (which
+// includes the 169.254.169.254 metadata endpoint), unspecified and multicast.
+func webhookAddressAllowed(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return !webhookSharedAddressSpace.Contains(ip)
+}
+
+// webhookSharedAddressSpace is the RFC 6598 carrier-grade NAT range.
+var webhookSharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// newWebhookClient refuses redirects and, unless allowPrivate is set, checks
+// the address actually dialled, so a host that resolved to a public address
+// when the subscription was saved cannot be rebound to an internal one.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookAddressAllowed(net.ParseIP(host)) {
+				return fmt.Errorf("webhook target address %s is not allowed", host)
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout, MaxIdleConnsPerHost: 2, IdleConnTimeout: 90 * time.Second}
+	return &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+func (s *OperationsService) ConfigureWebhooks(timeout time.Duration) {
+	s.webhookClient = newWebhookClient(timeout, false)
+}
+
+// signWebhookPayload returns the X-Webhook-Signature value. Receivers compute
+// HMAC-SHA256 over "<timestamp>.<raw body>" with the subscription secret.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL accepts absolute HTTPS URLs whose host resolves only to
+// addresses allowed by webhookAddressAllowed.
+func validateWebhookURL(ctx context.Context, raw string, lookup func(context.Context, string) ([]net.IPAddr, error)) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Host == "" || parsed.User != nil || parsed.Fragment != "" {
+		return errors.New("webhook target_url must be an absolute URL without credentials")
+	}
+	if parsed.Scheme != "https" {
+		return errors.New("webhook target_url must use HTTPS")
+	}
+	addrs := []net.IPAddr{}
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	} else if addrs, err = lookup(ctx, parsed.Hostname()); err != nil || len(addrs) == 0 {
+		return fmt.Errorf("webhook target_url host %s cannot be resolved", parsed.Hostname())
+	}
+	for _, a := range addrs {
+		if !webhookAddressAllowed(a.IP) {
+			return fmt.Errorf("webhook target_url must resolve to a public address, %s resolves to %s", parsed.Hostname(), a.IP)
+		}
+	}
+	return nil
+}
+
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range events {
+		e = normalizeCode(e)
+		if _, ok := webhookEventData[e]; !ok {
+			return nil, fmt.Errorf("unsupported webhook event type %q", e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("at least one webhook event type is required")
+	}
+	return out, nil
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+func (s *OperationsService) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id,name,target_url,event_types,is_active,created_at,updated_at FROM webhook_subscriptions ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookSubscription{}
+	for rows.Next() {
+		var w WebhookSubscription
+		if err = rows.Scan(&w.ID, &w.Name, &w.TargetURL, pq.Array(&w.EventTypes), &w.IsActive, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// CreateWebhookSubscription returns the signing secret once; it is neither
+// listed afterwards nor kept in the idempotent replay response.
+func (s *OperationsService) CreateWebhookSubscription(ctx context.Context, actor, key string, p WebhookSubscriptionPayload) (WebhookSubscription, error) {
+	var out WebhookSubscription
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return out, errors.New("webhook name is required")
+	}
+	if err := validateWebhookURL(ctx, p.TargetURL, net.DefaultResolver.LookupIPAddr); err != nil {
+		return out, err
+	}
+	events, err := normalizeWebhookEvents(p.EventTypes)
+	if err != nil {
+		return out, err
+	}
+	secret := strings.TrimSpace(p.Secret)
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			return out, err
+		}
+	} else if len(secret) < 16 {
+		return out, errors.New("webhook secret must be at least 16 characters")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback()
+	claim, err := claimOperationTx(ctx, tx, actor, "WEBHOOK_SUBSCRIPTION_CREATE", key, map[string]any{"name": p.Name, "target_url": p.TargetURL, "event_types": events, "secret_hash": hashToken(p.Secret)})
+	if err != nil {
+		return out, err
+	}
+	if claim.Existing {
+		if err = json.Unmarshal(claim.Response, &out); err != nil {
+			return out, err
+		}
+		return out, tx.Commit()
+	}
+	active := p.IsActive == nil || *p.IsActive
+	err = tx.QueryRowContext(ctx, `INSERT INTO webhook_subscriptions(name,target_url,secret,event_types,is_active,created_by_user_id) VALUES($1,$2,$3,$4,$5,$6) RETURNING id,name,target_url,event_types,is_active,created_at,updated_at`, p.Name, strings.TrimSpace(p.TargetURL), secret, pq.Array(events), active, actor).Scan(&out.ID, &out.Name, &out.TargetURL, pq.Array(&out.EventTypes), &out.IsActive, &out.CreatedAt, &out.UpdatedAt)
+	if err != nil {
+		return out, err
+	}
+	s.auditTx(ctx, tx, actor, "webhooks.create", "webhook_subscription", out.ID, nil, out)
+	if err = finishOperationTx(ctx, tx, actor, "WEBHOOK_SUBSCRIPTION_CREATE", key, out); err != nil {
+		return out, err
+	}
+	out.Secret = secret
+	return out, tx.Commit()
+}
+
+func (s *OperationsService) UpdateWebhookSubscription(ctx context.Context, actor, id, key string, p WebhookSubscriptionPayload) (WebhookSubscription, error) {
+	var out WebhookSubscription
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return out, errors.New("webhook name is required")
+	}
+	if err := validateWebhookURL(ctx, p.TargetURL, net.DefaultResolver.LookupIPAddr); err != nil {
+		return out, err
+	}
+	events, err := normalizeWebhookEvents(p.EventTypes)
+	if err != nil {
+		return out, err
+	}
+	secret := strings.TrimSpace(p.Secret)
+	if secret != "" && len(secret) < 16 {
+		return out, errors.New("webhook secret must be at least 16 characters")
+	}
+	if secret == "" && p.RotateSecret {
+		if secret, err = newWebhookSecret(); err != nil {
+			return out, err
+		}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return out, err
+	}
+	defer tx.Rollback()
+	claim, err := claimOperationTx(ctx, tx, actor, "WEBHOOK_SUBSCRIPTION_UPDATE", key, map[string]any{"id": id, "name": p.Name, "target_url": p.TargetURL, "event_types": events, "is_active": p.IsActive, "rotate_secret": p.RotateSecret, "secret_hash": hashToken(p.Secret)})
+	if err != nil {
+		return out, err
+	}
+	if claim.Existing {
+		if err = json.Unmarshal(claim.Response, &out); err != nil {
+			return out, err
+		}
+		return out, tx.Commit()
+	}
+	var before WebhookSubscription
+	if err = tx.QueryRowContext(ctx, `SELECT id,name,target_url,event_types,is_active FROM webhook_subscriptions WHERE id=$1 FOR UPDATE`, id).Scan(&before.ID, &before.Name, &before.TargetURL, pq.Array(&before.EventTypes), &before.IsActive); err != nil {
+		return out, err
+	}
+	active := before.IsActive
+	if p.IsActive != nil {
+		active = *p.IsActive
+	}
+	err = tx.QueryRowContext(ctx, `UPDATE webhook_subscriptions SET name=$2,target_url=$3,event_types=$4,is_active=$5,secret=COALESCE(NULLIF($6,''),secret),updated_at=NOW() WHERE id=$1 RETURNING id,name,target_url,event_types,is_active,created_at,updated_at`, id, p.Name, strings.TrimSpace(p.TargetURL), pq.Array(events), active, secret).Scan(&out.ID, &out.Name, &out.TargetURL, pq.Array(&out.EventTypes), &out.IsActive, &out.CreatedAt, &out.UpdatedAt)
+	if err != nil {
+		return out, err
+	}
+	if !active {
+		if _, err = tx.ExecContext(ctx, `UPDATE webhook_outbox SET status='CANCELLED',last_error='subscription-disabled' WHERE subscription_id=$1 AND status IN ('PENDING','RETRY')`, id); err != nil {
+			return out, err
+		}
+	}
+	s.auditTx(ctx, tx, actor, "webhooks.update", "webhook_subscription", id, before, map[string]any{"subscription": out, "secret_rotated": secret != ""})
+	if err = finishOperationTx(ctx, tx, actor, "WEBHOOK_SUBSCRIPTION_UPDATE", key, out); err != nil {
+		return out, err
+	}
+	out.Secret = secret
+	return out, tx.Commit()
+}
+
+func (s *OperationsService) ListWebhookDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]map[string]any, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 100
+	}
+	status = normalizeCode(status)
+	rows, err := s.db.QueryContext(ctx, `SELECT o.id,o.subscription_id,w.name,o.event_id,o.event_type,o.status,o.attempt_count,o.next_attempt_at,o.last_status_code,COALESCE(o.last_error,''),o.created_at,o.delivered_at FROM webhook_outbox o JOIN webhook_subscriptions w ON w.id=o.subscription_id WHERE ($1='' OR o.subscription_id::text=$1) AND ($2='' OR o.status=$2) ORDER BY o.created_at DESC LIMIT $3`, strings.TrimSpace(subscriptionID), status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []map[string]any{}
+	for rows.Next() {
+		var id, subscription, name, eventID, eventType, deliveryStatus, lastError string
+		var attempts int
+		var code sql.NullInt64
+		var next, created time.Time
+		var delivered sql.NullTime
+		if err = rows.Scan(&id, &subscription, &name, &eventID, &eventType, &deliveryStatus, &attempts, &next, &code, &lastError, &created, &delivered); err != nil {
+			return nil, err
+		}
+		var statusCode any
+		if code.Valid {
+			statusCode = code.Int64
+		}
+		out = append(out, map[string]any{"id": id, "subscription_id": subscription, "subscription_name": name, "event_id": eventID, "event_type": eventType, "status": deliveryStatus, "attempt_count": attempts, "next_attempt_at": next, "last_status_code": statusCode, "last_error": lastError, "created_at": created, "delivered_at": nullableTime(delivered)})
+	}
+	return out, rows.Err()
+}
+
+func (s *OperationsService) RetryWebhookDelivery(ctx context.Context, actor, id, key string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	claim, err := claimOperationTx(ctx, tx, actor, "WEBHOOK_RETRY", key, map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	if claim.Existing {
+		return tx.Commit()
+	}
+	r, err := tx.ExecContext(ctx, `UPDATE webhook_outbox o SET status='RETRY',next_attempt_at=NOW(),last_error=NULL FROM webhook_subscriptions w WHERE o.id=$1 AND w.id=o.subscription_id AND w.is_active AND o.status IN ('FAILED','CANCELLED')`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return conflict("INVALID_WEBHOOK_TRANSITION", "delivery cannot be retried")
+	}
+	s.auditTx(ctx, tx, actor, "webhooks.retry", "webhook_delivery", id, nil, map[string]bool{"queued": true})
+	if err = finishOperationTx(ctx, tx, actor, "WEBHOOK_RETRY", key, map[string]bool{"queued": true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// emitWebhookEventTx queues an event for every active subscription. Like
+// notifications it is a side effect: failures are logged and never abort the
+// business transaction.
+func emitWebhookEventTx(ctx context.Context, tx *sql.Tx, eventType, eventKey, entityType, entityID string) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT webhook_side_effect`); err != nil {
+		return err
+	}
+	if err := emitWebhookEventUnsafeTx(ctx, tx, eventType, eventKey, entityType, entityID); err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT webhook_side_effect`)
+		_, releaseErr := tx.ExecContext(ctx, `RELEASE SAVEPOINT webhook_side_effect`)
+		slog.WarnContext(ctx, "webhook_side_effect_skipped", "eventType", eventType, "entityType", entityType, "entityId", entityID, "error", err)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		return releaseErr
+	}
+	_, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT webhook_side_effect`)
+	return err
+}
+
+func emitWebhookEventUnsafeTx(ctx context.Context, tx *sql.Tx, eventType, eventKey, entityType, entityID string) error {
+	query, ok := webhookEventData[eventType]
+	if !ok {
+		return fmt.Errorf("unsupported webhook event type %q", eventType)
+	}
+	var subscribed bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM webhook_subscriptions WHERE is_active AND $1=ANY(event_types))`, eventType).Scan(&subscribed); err != nil || !subscribed {
+		return err
+	}
+	var data string
+	if err := tx.QueryRowContext(ctx, query, entityID).Scan(&data); err != nil {
+		return err
+	}
+	eventID := randomUUIDText()
+	payload, err := json.Marshal(map[string]any{"event_id": eventID, "event_type": eventType, "occurred_at": time.Now().UTC(), "entity_type": entityType, "entity_id": entityID, "data": json.RawMessage(data)})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO webhook_outbox(subscription_id,event_id,event_type,event_key,payload) SELECT id,$2::uuid,$1,$3,$4::jsonb FROM webhook_subscriptions WHERE is_active AND $1=ANY(event_types) ON CONFLICT(subscription_id,event_key) DO NOTHING`, eventType, eventID, eventKey, string(payload))
+	return err
+}
+
+func (s *OperationsService) processWebhookOutbox(ctx context.Context, retry []time.Duration) (int, error) {
+	count := 0
+	for i := 0; i < 100; i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return count, err
+		}
+		var id, eventID, eventType, target, secret string
+		var body []byte
+		var attempts int
+		err = tx.QueryRowContext(ctx, `SELECT o.id,o.event_id,o.event_type,o.payload::text,o.attempt_count,w.target_url,w.secret FROM webhook_outbox o JOIN webhook_subscriptions w ON w.id=o.subscription_id WHERE w.is_active AND ((o.status IN ('PENDING','RETRY') AND o.next_attempt_at<=NOW()) OR (o.status='PROCESSING' AND o.locked_at<NOW()-INTERVAL '5 minutes')) ORDER BY o.created_at FOR UPDATE OF o SKIP LOCKED LIMIT 1`).Scan(&id, &eventID, &eventType, &body, &attempts, &target, &secret)
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			break
+		}
+		if err != nil {
+			tx.Rollback()
+			return count, err
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE webhook_outbox SET status='PROCESSING',locked_at=NOW(),attempt_count=attempt_count+1 WHERE id=$1`, id); err != nil {
+			tx.Rollback()
+			return count, err
+		}
+		if err = tx.Commit(); err != nil {
+			return count, err
+		}
+		code, sendErr := s.deliverWebhook(ctx, target, secret, id, eventID, eventType, body)
+		var statusCode any
+		if code > 0 {
+			statusCode = code
+		}
+		if sendErr == nil {
+			_, err = s.db.ExecContext(ctx, `UPDATE webhook_outbox SET status='DELIVERED',last_status_code=$2,last_error=NULL,delivered_at=NOW() WHERE id=$1`, id, statusCode)
+		} else if attempts >= len(retry) {
+			_, err = s.db.ExecContext(ctx, `UPDATE webhook_outbox SET status='FAILED',last_status_code=$2,last_error=$3 WHERE id=$1`, id, statusCode, sendErr.Error())
+		} else {
+			_, err = s.db.ExecContext(ctx, `UPDATE webhook_outbox SET status='RETRY',next_attempt_at=NOW()+($2::bigint*INTERVAL '1 millisecond'),last_status_code=$3,last_error=$4 WHERE id=$1`, id, retry[attempts].Milliseconds(), statusCode, sendErr.Error())
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// deliverWebhook posts one signed payload. Any non-2xx answer, including a
+// redirect, counts as a failed attempt.
+func (s *OperationsService) deliverWebhook(ctx context.Context, target, secret, deliveryID, eventID, eventType string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sangehassan-webhooks/1")
+	req.Header.Set("X-Webhook-Id", deliveryID)
+	req.Header.Set("X-Webhook-Event-Id", eventID)
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(secret, timestamp, body))
+	client := s.webhookClient
+	if client == nil {
+		client = newWebhookClient(0, false)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint responded with HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSubscriptionValidation(t *testing.T) {
+	hosts := map[string]string{"erp.example.test": "203.0.113.10", "internal.example.test": "10.0.0.5", "rebind.example.test": "127.0.0.1"}
+	lookup := func(_ context.Context, host string) ([]net.IPAddr, error) {
+		if ip, ok := hosts[host]; ok {
+			return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	for raw, ok := range map[string]bool{
+		"https://erp.example.test/hooks":          true,
+		"https://203.0.113.10/hook":               true,
+		"http://127.0.0.1:9000/hook":              false,
+		"https://127.0.0.1:9000/hook":             false,
+		"https://internal.example.test/hook":      false,
+		"https://rebind.example.test/hook":        false,
+		"https://169.254.169.254/latest/metadata": false,
+		"https://192.168.1.10/hook":               false,
+		"https://[::1]/hook":                      false,
+		"https://[fd00::1]/hook":                  false,
+		"https://100.64.1.1/hook":                 false,
+		"https://unknown.example.test/hook":       false,
+		"http://erp.example.test/hooks":           false,
+		"https://user:pw@erp.example.test":        false,
+		"/relative":                               false,
+	} {
+		if err := validateWebhookURL(context.Background(), raw, lookup); (err == nil) != ok {
+			t.Fatalf("validateWebhookURL(%q) err=%v", raw, err)
+		}
+	}
+	events, err := normalizeWebhookEvents([]string{"order_confirmed", "ORDER_CONFIRMED", "shipment_delivered"})
+	if err != nil || len(events) != 2 || events[0] != "ORDER_CONFIRMED" {
+		t.Fatalf("events=%v err=%v", events, err)
+	}
+	if _, err = normalizeWebhookEvents([]string{"ORDER_DELETED"}); err == nil {
+		t.Fatal("unsupported event accepted")
+	}
+	if _, err = normalizeWebhookEvents(nil); err == nil {
+		t.Fatal("empty event list accepted")
+	}
+}
+
+func TestDeliverWebhookSignsPayload(t *testing.T) {
+	const secret = "whsec_test_secret_value"
+	body := []byte(`{"event_type":"ORDER_CONFIRMED"}`)
+	var gotSignature, gotTimestamp string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature, gotTimestamp = r.Header.Get("X-Webhook-Signature"), r.Header.Get("X-Webhook-Timestamp")
+		gotBody, _ = io.ReadAll(r.Body)
+		if r.Header.Get("X-Webhook-Event") != "ORDER_CONFIRMED" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	s := &OperationsService{webhookClient: newWebhookClient(time.Second, true)}
+	code, err := s.deliverWebhook(context.Background(), server.URL, secret, "delivery-1", "event-1", "ORDER_CONFIRMED", body)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("code=%d err=%v", code, err)
+	}
+	if string(gotBody) != string(body) || gotSignature != signWebhookPayload(secret, gotTimestamp, body) {
+		t.Fatalf("signature %q does not match body %q", gotSignature, gotBody)
+	}
+	if signWebhookPayload(secret, gotTimestamp, []byte(`{}`)) == gotSignature {
+		t.Fatal("signature ignores the body")
+	}
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+	if code, err = s.deliverWebhook(context.Background(), redirect.URL, secret, "delivery-2", "event-2", "ORDER_CONFIRMED", body); err == nil || code != http.StatusFound {
+		t.Fatalf("redirect followed: code=%d err=%v", code, err)
+	}
+	guarded := &OperationsService{webhookClient: newWebhookClient(time.Second, false)}
+	if code, err = guarded.deliverWebhook(context.Background(), server.URL, secret, "delivery-3", "event-3", "ORDER_CONFIRMED", body); err == nil || code != 0 {
+		t.Fatalf("loopback target dialled: code=%d err=%v", code, err)
+	}
+}
@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkerMonitor is the operations worker's in-process view of its own
+// progress, served by the worker health listener. It is not persisted;
+// scheduled_job_runs remains the durable history.
+type WorkerMonitor struct {
+	mu           sync.Mutex
+	startedAt    time.Time
+	lastCycleAt  time.Time
+	current      string
+	currentSince time.Time
+	currentLimit time.Duration
+	jobs         map[string]*WorkerJobHealth
+}
+
+type WorkerJobHealth struct {
+	Job            string     `json:"job"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastDurationMS int64      `json:"last_duration_ms"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+}
+
+type WorkerHealth struct {
+	Healthy     bool              `json:"healthy"`
+	StartedAt   time.Time         `json:"started_at"`
+	LastCycleAt *time.Time        `json:"last_cycle_at,omitempty"`
+	RunningJob  string            `json:"running_job,omitempty"`
+	RunningFor  int64             `json:"running_for_ms,omitempty"`
+	Jobs        []WorkerJobHealth `json:"jobs"`
+}
+
+// workerStuckGrace is how long a job may overrun its timeout, e.g. while a
+// driver call ignores cancellation, before the worker reports itself stuck.
+const workerStuckGrace = time.Minute
+
+func NewWorkerMonitor() *WorkerMonitor {
+	return &WorkerMonitor{startedAt: time.Now(), jobs: map[string]*WorkerJobHealth{}}
+}
+
+func (s *OperationsService) ConfigureWorkerMonitor(m *WorkerMonitor) {
+	s.workerMonitor = m
+}
+
+func (m *WorkerMonitor) jobStarted(code string, timeout time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current, m.currentSince, m.currentLimit = code, time.Now(), timeout
+}
+
+func (m *WorkerMonitor) jobFinished(r WorkerResult, runErr error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	h := m.jobs[r.Job]
+	if h == nil {
+		h = &WorkerJobHealth{Job: r.Job}
+		m.jobs[r.Job] = h
+	}
+	h.LastRunAt, h.LastDurationMS = &now, r.DurationMS
+	h.Runs++
+	if runErr != nil {
+		h.Failures++
+		h.LastError = runErr.Error()
+	} else {
+		h.LastSuccessAt, h.LastError = &now, ""
+	}
+	m.current = ""
+}
+
+func (m *WorkerMonitor) CycleFinished(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastCycleAt = at
+}
+
+// Snapshot reports the worker unhealthy when a job has overrun its timeout,
+// or when no cycle has completed within staleAfter while no job is running.
+func (m *WorkerMonitor) Snapshot(now time.Time, staleAfter time.Duration) WorkerHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := WorkerHealth{StartedAt: m.startedAt, Jobs: make([]WorkerJobHealth, 0, len(m.jobs))}
+	if !m.lastCycleAt.IsZero() {
+		last := m.lastCycleAt
+		out.LastCycleAt = &last
+	}
+	for _, h := range m.jobs {
+		out.Jobs = append(out.Jobs, *h)
+	}
+	sort.Slice(out.Jobs, func(i, j int) bool { return out.Jobs[i].Job < out.Jobs[j].Job })
+	if m.current != "" {
+		out.RunningJob, out.RunningFor = m.current, now.Sub(m.currentSince).Milliseconds()
+		out.Healthy = now.Sub(m.currentSince) <= m.currentLimit+workerStuckGrace
+		return out
+	}
+	reference := m.lastCycleAt
+	if reference.IsZero() {
+		reference = m.startedAt
+	}
+	out.Healthy = now.Sub(reference) <= staleAfter
+	return out
+}
+
+type OutboxBacklog struct {
+	Outbox           string `json:"outbox"`
+	Pending          int    `json:"pending"`
+	Due              int    `json:"due"`
+	Processing       int    `json:"processing"`
+	OldestDueSeconds int64  `json:"oldest_due_seconds"`
+}
+
+// WorkerBacklog counts undelivered outbox rows. Due rows are waiting only
+// for the worker; pending rows may also be deferred by retries or quiet hours.
+func (s *OperationsService) WorkerBacklog(ctx context.Context) ([]OutboxBacklog, error) {
+	out := []OutboxBacklog{}
+	for _, table := range []struct{ name, query string }{
+		{"notification", `SELECT COUNT(*) FILTER (WHERE status IN ('PENDING','RETRY')),COUNT(*) FILTER (WHERE status IN ('PENDING','RETRY') AND next_attempt_at<=NOW()),COUNT(*) FILTER (WHERE status='PROCESSING'),COALESCE(EXTRACT(EPOCH FROM NOW()-MIN(next_attempt_at) FILTER (WHERE status IN ('PENDING','RETRY') AND next_attempt_at<=NOW())),0)::bigint FROM notification_outbox`},
+		{"webhook", `SELECT COUNT(*) FILTER (WHERE status IN ('PENDING','RETRY')),COUNT(*) FILTER (WHERE status IN ('PENDING','RETRY') AND next_attempt_at<=NOW()),COUNT(*) FILTER (WHERE status='PROCESSING'),COALESCE(EXTRACT(EPOCH FROM NOW()-MIN(next_attempt_at) FILTER (WHERE status IN ('PENDING','RETRY') AND next_attempt_at<=NOW())),0)::bigint FROM webhook_outbox`},
+	} {
+		b := OutboxBacklog{Outbox: table.name}
+		if err := s.db.QueryRowContext(ctx, table.query).Scan(&b.Pending, &b.Due, &b.Processing, &b.OldestDueSeconds); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+)
+
+// WorkflowAnalyticsFilter narrows a workflow analytics report. From and To
+// are calendar days, Gregorian or Jalali, and both are inclusive.
+type WorkflowAnalyticsFilter struct {
+	From       string
+	To         string
+	TemplateID int64
+	StepCode   string
+}
+
+// WorkflowAnalyticsReport is a table: Columns names the keys of every row
+// in order, which is also the column order of its CSV export.
+type WorkflowAnalyticsReport struct {
+	Kind    string           `json:"kind"`
+	Columns []string         `json:"columns"`
+	Rows    []map[string]any `json:"rows"`
+}
+
+// CSVRows renders the report for ExportCSV-style downloads.
+func (r WorkflowAnalyticsReport) CSVRows(calendar string) [][]string {
+	out := make([][]string, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		cells := make([]string, len(r.Columns))
+		for i, column := range r.Columns {
+			cells[i] = exportCell(row[column], calendar)
+		}
+		out = append(out, cells)
+	}
+	return out
+}
+
+// Every analytics query takes $1 from, $2 to, $3 template id (0 for all)
+// and $4 step code, and returns the report columns in order.
+var workflowAnalyticsQueries = map[string]struct {
+	columns []string
+	query   string
+}{
+	// Time spent in each working status, from the status history kept by
+	// migration 035. Periods still open are measured up to now.
+	"step-times": {[]string{"template_id", "template_group_code", "version_number", "step_code", "status", "periods", "open_periods", "median_hours", "p90_hours"}, `
+		SELECT wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code,h.status,COUNT(*),COUNT(*) FILTER (WHERE h.left_at IS NULL),
+			ROUND((percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM COALESCE(h.left_at,NOW())-h.entered_at)/3600))::numeric,2)::text,
+			ROUND((percentile_cont(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM COALESCE(h.left_at,NOW())-h.entered_at)/3600))::numeric,2)::text
+		FROM workflow_step_status_history h JOIN workflow_step_instances si ON si.id=h.workflow_step_instance_id JOIN workflow_instances wi ON wi.id=si.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id
+		WHERE h.status NOT IN ('NOT_STARTED','COMPLETED','SKIPPED','CANCELLED') AND ($1='' OR h.entered_at>=$1::timestamptz) AND ($2='' OR h.entered_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+		GROUP BY wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code,h.status
+		ORDER BY wt.template_group_code,wt.version_number,si.step_code,h.status`},
+	// Rework per step: repeated iterations from loops, reopened terminal
+	// steps and returns for correction, over steps created in the range.
+	"rework": {[]string{"template_id", "template_group_code", "version_number", "step_code", "workflows", "step_instances", "repeated_iterations", "max_iteration", "reopens", "corrections", "rework_rate_percent"}, `
+		SELECT wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code,COUNT(DISTINCT si.workflow_instance_id),COUNT(*),COUNT(*) FILTER (WHERE si.iteration_number>1),MAX(si.iteration_number),
+			COALESCE(SUM(x.reopens),0),COALESCE(SUM(x.corrections),0),
+			ROUND(100.0*COUNT(*) FILTER (WHERE si.iteration_number>1 OR x.reopens>0 OR x.corrections>0)/COUNT(*),2)::text
+		FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id
+		LEFT JOIN LATERAL (SELECT COUNT(*) FILTER (WHERE h.from_status IN ('COMPLETED','SKIPPED')) reopens,COUNT(*) FILTER (WHERE h.status='NEEDS_CORRECTION') corrections FROM workflow_step_status_history h WHERE h.workflow_step_instance_id=si.id) x ON TRUE
+		WHERE si.status<>'NOT_STARTED' AND ($1='' OR si.created_at>=$1::timestamptz) AND ($2='' OR si.created_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+		GROUP BY wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code
+		ORDER BY wt.template_group_code,wt.version_number,MIN(si.sequence_number),si.step_code`},
+	"rejections": {[]string{"template_id", "template_group_code", "version_number", "step_code", "rejection_reason", "rejections", "last_rejected_at"}, `
+		SELECT wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code,TRIM(h.rejection_reason),COUNT(*),MAX(h.entered_at)
+		FROM workflow_step_status_history h JOIN workflow_step_instances si ON si.id=h.workflow_step_instance_id JOIN workflow_instances wi ON wi.id=si.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id
+		WHERE h.status='NEEDS_CORRECTION' AND NULLIF(TRIM(h.rejection_reason),'') IS NOT NULL AND ($1='' OR h.entered_at>=$1::timestamptz) AND ($2='' OR h.entered_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+		GROUP BY wi.workflow_template_id,wt.template_group_code,wt.version_number,si.step_code,TRIM(h.rejection_reason)
+		ORDER BY COUNT(*) DESC,wt.template_group_code,wt.version_number,si.step_code`},
+	// Discrepancy rate per handoff metric: discrepancies reported against
+	// the IN values compared with an earlier OUT value. The step filter
+	// applies to the receiving step.
+	"discrepancies": {[]string{"template_id", "template_group_code", "version_number", "metric_key", "comparisons", "discrepancies", "blocking", "resolved", "discrepancy_rate_percent", "average_difference_percent"}, `
+		WITH comparisons AS (
+			SELECT wi.workflow_template_id,d.handoff_metric_key metric_key,COUNT(*) n
+			FROM workflow_step_field_values v JOIN workflow_instance_field_definitions d ON d.id=v.field_definition_id JOIN workflow_step_instances si ON si.id=v.workflow_step_instance_id JOIN workflow_instances wi ON wi.id=si.workflow_instance_id
+			WHERE d.handoff_direction='IN' AND d.handoff_metric_key IS NOT NULL AND ($1='' OR v.updated_at>=$1::timestamptz) AND ($2='' OR v.updated_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+			GROUP BY wi.workflow_template_id,d.handoff_metric_key
+		), found AS (
+			SELECT wi.workflow_template_id,x.metric_key,COUNT(*) n,COUNT(*) FILTER (WHERE x.is_blocking) blocking,COUNT(*) FILTER (WHERE x.status IN ('ACCEPTED','RESOLVED')) resolved,AVG(ABS(x.difference_percentage)) average
+			FROM workflow_discrepancies x JOIN workflow_instances wi ON wi.id=x.workflow_instance_id LEFT JOIN workflow_step_instances si ON si.id=x.target_step_instance_id
+			WHERE x.status<>'CANCELLED' AND ($1='' OR x.reported_at>=$1::timestamptz) AND ($2='' OR x.reported_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+			GROUP BY wi.workflow_template_id,x.metric_key
+		)
+		SELECT workflow_template_id,wt.template_group_code,wt.version_number,metric_key,COALESCE(c.n,0),COALESCE(f.n,0),COALESCE(f.blocking,0),COALESCE(f.resolved,0),
+			COALESCE(ROUND(100.0*COALESCE(f.n,0)/NULLIF(c.n,0),2)::text,''),COALESCE(ROUND(f.average,2)::text,'')
+		FROM comparisons c FULL JOIN found f USING (workflow_template_id,metric_key) JOIN workflow_templates wt ON wt.id=workflow_template_id
+		ORDER BY wt.template_group_code,wt.version_number,metric_key`},
+	// Completed steps per responsible role and the user who submitted them,
+	// or their assignee, over steps completed in the range.
+	"throughput": {[]string{"role_code", "role_name_fa", "user_id", "user_name", "completed_steps", "workflows", "median_cycle_hours", "p90_cycle_hours"}, `
+		SELECT COALESCE(r.code,''),COALESCE(r.name_fa,''),COALESCE(u.id::text,''),COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized,''),COUNT(*),COUNT(DISTINCT si.workflow_instance_id),
+			ROUND((percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM si.actual_end_at-COALESCE(si.actual_start_at,si.created_at))/3600))::numeric,2)::text,
+			ROUND((percentile_cont(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM si.actual_end_at-COALESCE(si.actual_start_at,si.created_at))/3600))::numeric,2)::text
+		FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id LEFT JOIN roles r ON r.id=si.responsible_role_id LEFT JOIN users u ON u.id=COALESCE(si.submitted_by_user_id,si.assigned_user_id)
+		WHERE si.status='COMPLETED' AND si.actual_end_at IS NOT NULL AND ($1='' OR si.actual_end_at>=$1::timestamptz) AND ($2='' OR si.actual_end_at<$2::timestamptz+INTERVAL '1 day') AND ($3=0 OR wi.workflow_template_id=$3) AND ($4='' OR si.step_code=$4)
+		GROUP BY r.code,r.name_fa,u.id,u.first_name,u.last_name,u.phone_normalized
+		ORDER BY COUNT(*) DESC,r.code`},
+}
+
+// WorkflowAnalytics runs one of the historical workflow reports: step-times,
+// rework, rejections, discrepancies or throughput.
+func (s *OperationsService) WorkflowAnalytics(ctx context.Context, kind string, f WorkflowAnalyticsFilter) (WorkflowAnalyticsReport, error) {
+	report, ok := workflowAnalyticsQueries[kind]
+	if !ok {
+		return WorkflowAnalyticsReport{}, conflict("VALIDATION_FAILED", "نوع گزارش معتبر نیست")
+	}
+	from, err := parseDateFilter(f.From)
+	if err != nil {
+		return WorkflowAnalyticsReport{}, err
+	}
+	to, err := parseDateFilter(f.To)
+	if err != nil {
+		return WorkflowAnalyticsReport{}, err
+	}
+	rows, err := s.db.QueryContext(ctx, report.query, from, to, f.TemplateID, normalizeCode(strings.TrimSpace(f.StepCode)))
+	if err != nil {
+		return WorkflowAnalyticsReport{}, err
+	}
+	defer rows.Close()
+	out := WorkflowAnalyticsReport{Kind: kind, Columns: report.columns, Rows: []map[string]any{}}
+	for rows.Next() {
+		values := make([]any, len(report.columns))
+		targets := make([]any, len(values))
+		for i := range values {
+			targets[i] = &values[i]
+		}
+		if err = rows.Scan(targets...); err != nil {
+			return out, err
+		}
+		row := map[string]any{}
+		for i, column := range report.columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out, rows.Err()
+}
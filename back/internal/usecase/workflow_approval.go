@@ -0,0 +1,294 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorkflowStepApprovalLevel is one level of a template step's approval
+// chain. Levels are decided in LevelNumber order; each needs
+// RequiredApprovals distinct members of ApprovalRoleID. A level with
+// MinOrderAmount applies only when the order's final amount, converted to
+// AmountCurrency, reaches it.
+type WorkflowStepApprovalLevel struct {
+	LevelNumber       int     `json:"level_number"`
+	ApprovalRoleID    int64   `json:"approval_role_id"`
+	RequiredApprovals int     `json:"required_approvals"`
+	MinOrderAmount    *string `json:"min_order_amount,omitempty"`
+	AmountCurrency    string  `json:"amount_currency"`
+}
+
+// maxApprovalLevels bounds both the length of a chain and a level's quorum.
+const maxApprovalLevels = 20
+
+func normalizeApprovalLevels(levels []WorkflowStepApprovalLevel) error {
+	seen := map[int]bool{}
+	for i := range levels {
+		l := &levels[i]
+		if l.LevelNumber < 1 || l.LevelNumber > maxApprovalLevels || seen[l.LevelNumber] {
+			return errors.New("approval levels need distinct level numbers between 1 and 20")
+		}
+		seen[l.LevelNumber] = true
+		if l.ApprovalRoleID <= 0 {
+			return fmt.Errorf("approval level %d requires a role", l.LevelNumber)
+		}
+		if l.RequiredApprovals == 0 {
+			l.RequiredApprovals = 1
+		}
+		if l.RequiredApprovals < 1 || l.RequiredApprovals > maxApprovalLevels {
+			return fmt.Errorf("approval level %d must require between 1 and 20 approvals", l.LevelNumber)
+		}
+		if l.MinOrderAmount != nil && !validNonNegativeDecimal(*l.MinOrderAmount) {
+			return fmt.Errorf("approval level %d has an invalid amount threshold", l.LevelNumber)
+		}
+		l.AmountCurrency = normalizeCode(l.AmountCurrency)
+		if l.AmountCurrency == "" {
+			l.AmountCurrency = "IRR"
+		}
+		if len(l.AmountCurrency) != 3 {
+			return fmt.Errorf("approval level %d has an invalid currency", l.LevelNumber)
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].LevelNumber < levels[j].LevelNumber })
+	return nil
+}
+
+func (s *OperationsService) listStepApprovalLevels(ctx context.Context, stepID int64) ([]WorkflowStepApprovalLevel, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT level_number,approval_role_id,required_approvals,min_order_amount::text,amount_currency FROM workflow_step_approval_levels WHERE workflow_template_step_id=$1 ORDER BY level_number`, stepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WorkflowStepApprovalLevel
+	for rows.Next() {
+		var l WorkflowStepApprovalLevel
+		var amount sql.NullString
+		if err = rows.Scan(&l.LevelNumber, &l.ApprovalRoleID, &l.RequiredApprovals, &amount, &l.AmountCurrency); err != nil {
+			return out, err
+		}
+		l.MinOrderAmount = scanNullableString(amount)
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// SaveWorkflowStepApprovalLevels replaces the approval chain of a draft
+// step. An empty chain leaves the step with its single approval role.
+func (s *OperationsService) SaveWorkflowStepApprovalLevels(ctx context.Context, actor string, stepID int64, levels []WorkflowStepApprovalLevel) error {
+	templateID, err := s.templateIDForStep(ctx, stepID)
+	if err != nil {
+		return err
+	}
+	if err = s.ensureDraft(ctx, templateID); err != nil {
+		return err
+	}
+	if err = normalizeApprovalLevels(levels); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, `DELETE FROM workflow_step_approval_levels WHERE workflow_template_step_id=$1`, stepID); err != nil {
+		return err
+	}
+	for _, l := range levels {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_approval_levels(workflow_template_step_id,level_number,approval_role_id,required_approvals,min_order_amount,amount_currency) VALUES($1,$2,$3,$4,$5,$6)`, stepID, l.LevelNumber, l.ApprovalRoleID, l.RequiredApprovals, l.MinOrderAmount, l.AmountCurrency); err != nil {
+			return err
+		}
+	}
+	s.auditTx(ctx, tx, actor, "workflow_steps.approval_levels.save", "workflow_template_step", fmt.Sprint(stepID), nil, map[string]any{"levels": levels})
+	return tx.Commit()
+}
+
+// applicableApprovalLevels keeps the levels whose threshold orderAmount
+// reaches, comparing amounts as given. Without an amount only levels with no
+// threshold apply. It is the simulation's version of the chain query.
+func applicableApprovalLevels(levels []WorkflowStepApprovalLevel, orderAmount *string) []WorkflowStepApprovalLevel {
+	out := []WorkflowStepApprovalLevel{}
+	for _, l := range levels {
+		if l.MinOrderAmount != nil {
+			if orderAmount == nil {
+				continue
+			}
+			if cmp, ok := decimalCmp(*orderAmount, *l.MinOrderAmount); !ok || cmp < 0 {
+				continue
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// WorkflowApprovalLevelProgress is where one level of a step instance's
+// approval chain stands in the current round.
+type WorkflowApprovalLevelProgress struct {
+	LevelNumber       int    `json:"level_number"`
+	ApprovalRoleID    int64  `json:"approval_role_id"`
+	ApprovalRoleName  string `json:"approval_role_name"`
+	RequiredApprovals int    `json:"required_approvals"`
+	Approvals         int    `json:"approvals"`
+	Overridden        bool   `json:"overridden"`
+}
+
+func (l WorkflowApprovalLevelProgress) satisfied() bool {
+	return l.Overridden || l.Approvals >= l.RequiredApprovals
+}
+
+func (l WorkflowApprovalLevelProgress) role() sql.NullInt64 {
+	return sql.NullInt64{Int64: l.ApprovalRoleID, Valid: l.ApprovalRoleID > 0}
+}
+
+// WorkflowApprovalDecision is one recorded approval or rejection.
+type WorkflowApprovalDecision struct {
+	ApprovalRound int       `json:"approval_round"`
+	LevelNumber   int       `json:"level_number"`
+	Decision      string    `json:"decision"`
+	DecidedBy     string    `json:"decided_by"`
+	OnBehalfOf    string    `json:"on_behalf_of,omitempty"`
+	IsOverride    bool      `json:"is_override"`
+	Reason        string    `json:"reason"`
+	DecidedAt     time.Time `json:"decided_at"`
+}
+
+// currentApprovalLevel returns the first level of chain still waiting for
+// approvals; ok is false once the whole chain is satisfied.
+func currentApprovalLevel(chain []WorkflowApprovalLevelProgress) (WorkflowApprovalLevelProgress, bool) {
+	for _, l := range chain {
+		if !l.satisfied() {
+			return l, true
+		}
+	}
+	return WorkflowApprovalLevelProgress{}, false
+}
+
+type approvalQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// approvalChain resolves the levels that apply to a step instance for its
+// order's amount, with the approvals of the current round. Orders without
+// commercial terms only get levels without a threshold; a threshold in a
+// currency with no exchange rate applies. A step without applicable levels
+// falls back to one approval by its approval role.
+func approvalChain(ctx context.Context, q approvalQuerier, stepID string) ([]WorkflowApprovalLevelProgress, error) {
+	rows, err := q.QueryContext(ctx, `WITH si AS (SELECT s.id,s.workflow_template_step_id,s.approval_role_id,s.approval_round,wi.order_id FROM workflow_step_instances s JOIN workflow_instances wi ON wi.id=s.workflow_instance_id WHERE s.id=$1),
+		levels AS (SELECT l.level_number,l.approval_role_id,l.required_approvals FROM si JOIN workflow_step_approval_levels l ON l.workflow_template_step_id=si.workflow_template_step_id LEFT JOIN order_commercial_terms t ON t.order_id=si.order_id
+			WHERE l.min_order_amount IS NULL OR COALESCE(CASE WHEN t.currency=l.amount_currency THEN t.final_customer_amount ELSE t.final_customer_amount*COALESCE((SELECT x.rate FROM exchange_rates x WHERE x.base_currency=t.currency AND x.quote_currency=l.amount_currency AND x.effective_at<=NOW() ORDER BY x.effective_at DESC LIMIT 1),1/(SELECT x.rate FROM exchange_rates x WHERE x.base_currency=l.amount_currency AND x.quote_currency=t.currency AND x.effective_at<=NOW() ORDER BY x.effective_at DESC LIMIT 1)) END>=l.min_order_amount,t.id IS NOT NULL)),
+		chain AS (SELECT * FROM levels UNION ALL SELECT 1,si.approval_role_id,1 FROM si WHERE si.approval_role_id IS NOT NULL AND NOT EXISTS(SELECT 1 FROM levels))
+		SELECT c.level_number,c.approval_role_id,COALESCE(r.name_fa,''),c.required_approvals,
+			(SELECT COUNT(DISTINCT COALESCE(d.on_behalf_of_user_id,d.decided_by_user_id)) FROM workflow_step_approval_decisions d JOIN si ON si.id=d.workflow_step_instance_id AND si.approval_round=d.approval_round WHERE d.level_number=c.level_number AND d.decision='APPROVED' AND NOT d.is_override),
+			EXISTS(SELECT 1 FROM workflow_step_approval_decisions d JOIN si ON si.id=d.workflow_step_instance_id AND si.approval_round=d.approval_round WHERE d.level_number=c.level_number AND d.decision='APPROVED' AND d.is_override)
+		FROM chain c LEFT JOIN roles r ON r.id=c.approval_role_id ORDER BY c.level_number`, stepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WorkflowApprovalLevelProgress{}
+	for rows.Next() {
+		var l WorkflowApprovalLevelProgress
+		if err = rows.Scan(&l.LevelNumber, &l.ApprovalRoleID, &l.ApprovalRoleName, &l.RequiredApprovals, &l.Approvals, &l.Overridden); err != nil {
+			return out, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (s *OperationsService) approvalDecisions(ctx context.Context, stepID string) ([]WorkflowApprovalDecision, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT d.approval_round,d.level_number,d.decision,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized,''),COALESCE(NULLIF(TRIM(CONCAT_WS(' ',ob.first_name,ob.last_name)),''),ob.phone_normalized,''),d.is_override,d.reason,d.decided_at FROM workflow_step_approval_decisions d LEFT JOIN users u ON u.id=d.decided_by_user_id LEFT JOIN users ob ON ob.id=d.on_behalf_of_user_id WHERE d.workflow_step_instance_id=$1 ORDER BY d.decided_at,d.id`, stepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WorkflowApprovalDecision{}
+	for rows.Next() {
+		var d WorkflowApprovalDecision
+		if err = rows.Scan(&d.ApprovalRound, &d.LevelNumber, &d.Decision, &d.DecidedBy, &d.OnBehalfOf, &d.IsOverride, &d.Reason, &d.DecidedAt); err != nil {
+			return out, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// recordApprovalDecisionTx stores a decision on the current round of a step.
+// Approving the same level twice, in person or through a delegate, is
+// refused so that a quorum counts distinct people.
+func (s *OperationsService) recordApprovalDecisionTx(ctx context.Context, tx *sql.Tx, actor, stepID string, level WorkflowApprovalLevelProgress, decision string, override bool, reason string) error {
+	onBehalf := onBehalfOfFromContext(ctx)
+	if decision == "APPROVED" && !override {
+		var dup bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_step_approval_decisions d JOIN workflow_step_instances si ON si.id=d.workflow_step_instance_id AND si.approval_round=d.approval_round WHERE d.workflow_step_instance_id=$1 AND d.level_number=$2 AND d.decision='APPROVED' AND COALESCE(d.on_behalf_of_user_id,d.decided_by_user_id)=COALESCE(NULLIF($4,'')::uuid,$3::uuid))`, stepID, level.LevelNumber, actor, onBehalf).Scan(&dup); err != nil {
+			return err
+		}
+		if dup {
+			return conflict("APPROVAL_ALREADY_RECORDED", "this approver has already approved this level")
+		}
+	}
+	var role *int64
+	if level.ApprovalRoleID > 0 {
+		role = &level.ApprovalRoleID
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO workflow_step_approval_decisions(workflow_step_instance_id,approval_round,level_number,approval_role_id,decision,decided_by_user_id,on_behalf_of_user_id,is_override,reason) SELECT id,approval_round,$2,$3,$4,NULLIF($5,'')::uuid,NULLIF($6,'')::uuid,$7,$8 FROM workflow_step_instances WHERE id=$1`, stepID, level.LevelNumber, role, decision, actor, onBehalf, override, strings.TrimSpace(reason))
+	return err
+}
+
+// checkApprovalQuorumTx refuses a chain with a pending level that needs more
+// approvals than its role has active internal members, since the step could
+// never be decided. Roles change after publishing, so this is checked again
+// whenever a step waits for a level.
+func checkApprovalQuorumTx(ctx context.Context, tx *sql.Tx, chain []WorkflowApprovalLevelProgress) error {
+	for _, l := range chain {
+		if l.satisfied() {
+			continue
+		}
+		var members int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users u WHERE u.user_type='INTERNAL' AND u.status='ACTIVE' AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=u.id AND ur.role_id=$1)`, l.ApprovalRoleID).Scan(&members); err != nil {
+			return err
+		}
+		if members < l.RequiredApprovals {
+			return conflict("APPROVAL_QUORUM_UNREACHABLE", fmt.Sprintf("approval level %d needs %d approvals but role %s has %d active members", l.LevelNumber, l.RequiredApprovals, l.ApprovalRoleName, members))
+		}
+	}
+	return nil
+}
+
+// createApprovalActionTx opens the approval action item of the level a step
+// waits for, assigned to that level's role. Items are keyed by round and
+// level, so a resubmitted step asks its approvers again.
+func (s *OperationsService) createApprovalActionTx(ctx context.Context, tx *sql.Tx, stepID string) error {
+	chain, err := approvalChain(ctx, tx, stepID)
+	if err != nil {
+		return err
+	}
+	if err = checkApprovalQuorumTx(ctx, tx, chain); err != nil {
+		return err
+	}
+	level, ok := currentApprovalLevel(chain)
+	if !ok {
+		return nil
+	}
+	suffix, description := "", "اطلاعات ثبت‌شده را بررسی کنید"
+	if len(chain) > 1 {
+		for i, l := range chain {
+			if l.LevelNumber == level.LevelNumber {
+				suffix = fmt.Sprintf(" (سطح %d از %d)", i+1, len(chain))
+			}
+		}
+	}
+	if level.RequiredApprovals > 1 {
+		description = fmt.Sprintf("اطلاعات ثبت‌شده را بررسی کنید؛ %d تأیید از اعضای این نقش لازم است", level.RequiredApprovals)
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET current_approval_level=$2 WHERE id=$1`, stepID, level.LevelNumber); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,'تأیید '||si.internal_title_fa||$3,$4,'WAITING_FOR_APPROVAL','HIGH',$2,'workflow_steps.approve',si.estimated_end_at,'approval:'||si.id||':'||si.approval_round||':'||$5,'APPROVAL' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID, level.ApprovalRoleID, suffix, description, level.LevelNumber)
+	return err
+}
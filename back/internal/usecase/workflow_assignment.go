@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// workflowAssignmentOrder ranks the candidates of each assignment strategy.
+// Ties fall back to round-robin order.
+var workflowAssignmentOrder = map[string]string{
+	"ROUND_ROBIN":      `last_assigned_at NULLS FIRST,id`,
+	"LEAST_OPEN_ITEMS": `open_items,last_assigned_at NULLS FIRST,id`,
+	"STICKY":           `handled_at DESC NULLS LAST,last_assigned_at NULLS FIRST,id`,
+}
+
+// assignOpenedStepTx applies the template step's assignment strategy to a
+// step that opened without an assignee. Candidates are the active internal
+// members of the responsible role; a step with no candidate stays with the
+// whole role. Round-robin order comes from the last time each member was
+// given a step of this template group and code, kept across reassignments
+// and template versions by migration 040.
+// STICKY prefers the member who completed the latest step of the
+// same order, or of the same workflow when it has no order.
+func (s *OperationsService) assignOpenedStepTx(ctx context.Context, tx *sql.Tx, workflowID, stepID string) error {
+	var strategy, group, stepCode string
+	var role int64
+	err := tx.QueryRowContext(ctx, `SELECT ts.assignment_strategy,si.responsible_role_id,t.template_group_code,ts.step_code FROM workflow_step_instances si JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id JOIN workflow_templates t ON t.id=ts.workflow_template_id WHERE si.id=$1 AND si.workflow_instance_id=$2 AND si.assigned_user_id IS NULL AND si.responsible_role_id IS NOT NULL`, stepID, workflowID).Scan(&strategy, &role, &group, &stepCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	order, ok := workflowAssignmentOrder[strategy]
+	if !ok {
+		return nil
+	}
+	var userID string
+	err = tx.QueryRowContext(ctx, `WITH candidates AS (
+		SELECT u.id,
+			(SELECT r.last_assigned_at FROM workflow_step_assignment_rotation r WHERE r.template_group_code=$3 AND r.step_code=$4 AND r.user_id=u.id) last_assigned_at,
+			(SELECT COUNT(*) FROM action_items a WHERE a.assigned_user_id=u.id AND a.status NOT IN ('COMPLETED','CANCELLED')) open_items,
+			(SELECT MAX(x.actual_end_at) FROM workflow_step_instances x JOIN workflow_instances xw ON xw.id=x.workflow_instance_id JOIN workflow_instances wi ON wi.id=$2 WHERE x.status='COMPLETED' AND COALESCE(x.submitted_by_user_id,x.assigned_user_id)=u.id AND (xw.id=wi.id OR xw.order_id=wi.order_id)) handled_at
+		FROM users u WHERE u.user_type='INTERNAL' AND u.status='ACTIVE' AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=u.id AND ur.role_id=$1)
+	) SELECT id FROM candidates ORDER BY `+order+` LIMIT 1`, role, workflowID, group, stepCode).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET assigned_user_id=$2,updated_at=NOW() WHERE id=$1`, stepID, userID); err != nil {
+		return err
+	}
+	s.auditTx(ctx, tx, "", "workflow_steps.auto_assign", "workflow_step_instance", stepID, nil, map[string]any{"assigned_user_id": userID, "strategy": strategy})
+	return nil
+}
+
+// WorkflowWorkload is one internal user's share of the open workflow work.
+type WorkflowWorkload struct {
+	UserID             string     `json:"user_id"`
+	Name               string     `json:"name"`
+	Roles              string     `json:"roles"`
+	OpenSteps          int        `json:"open_steps"`
+	OverdueSteps       int        `json:"overdue_steps"`
+	OpenActionItems    int        `json:"open_action_items"`
+	OverdueActionItems int        `json:"overdue_action_items"`
+	OldestAssignedAt   *time.Time `json:"oldest_assigned_at,omitempty"`
+}
+
+// WorkflowWorkload lists active internal users, optionally members of one
+// role, with the steps and action items assigned to them personally. Work
+// still waiting for a whole role is not counted against anyone.
+func (s *OperationsService) WorkflowWorkload(ctx context.Context, roleID int64) ([]WorkflowWorkload, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id,COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized,''),
+		COALESCE((SELECT STRING_AGG(r.name_fa,'، ' ORDER BY r.name_fa) FROM user_roles ur JOIN roles r ON r.id=ur.role_id WHERE ur.user_id=u.id),''),
+		COALESCE(st.open,0),COALESCE(st.overdue,0),COALESCE(ai.open,0),COALESCE(ai.overdue,0),st.oldest
+		FROM users u
+		LEFT JOIN LATERAL (SELECT COUNT(*) open,COUNT(*) FILTER (WHERE si.estimated_end_at<NOW()) overdue,MIN(si.assigned_at) oldest FROM workflow_step_instances si WHERE si.assigned_user_id=u.id AND si.status IN ('WAITING_FOR_ASSIGNEE','IN_PROGRESS','SUBMITTED','WAITING_FOR_APPROVAL','WAITING_FOR_TRANSITION','HAS_MISMATCH','NEEDS_CORRECTION','BLOCKED')) st ON TRUE
+		LEFT JOIN LATERAL (SELECT COUNT(*) open,COUNT(*) FILTER (WHERE a.due_at<NOW()) overdue FROM action_items a WHERE a.assigned_user_id=u.id AND a.status NOT IN ('COMPLETED','CANCELLED')) ai ON TRUE
+		WHERE u.user_type='INTERNAL' AND u.status='ACTIVE' AND ($1=0 OR EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=u.id AND ur.role_id=$1))
+		ORDER BY COALESCE(st.overdue,0)+COALESCE(ai.overdue,0) DESC,COALESCE(st.open,0)+COALESCE(ai.open,0) DESC,u.id`, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WorkflowWorkload{}
+	for rows.Next() {
+		var w WorkflowWorkload
+		var oldest sql.NullTime
+		if err = rows.Scan(&w.UserID, &w.Name, &w.Roles, &w.OpenSteps, &w.OverdueSteps, &w.OpenActionItems, &w.OverdueActionItems, &oldest); err != nil {
+			return out, err
+		}
+		if oldest.Valid {
+			v := oldest.Time
+			w.OldestAssignedAt = &v
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
@@ -19,18 +19,19 @@ func allowedWorkflowResult(v string) bool {
 }
 
 func (s *OperationsService) ListWorkflowTransitions(ctx context.Context, templateID int64) ([]WorkflowTransitionDefinition, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id,workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order FROM workflow_step_transitions WHERE workflow_template_id=$1 ORDER BY source_step_id,sort_order,id`, templateID)
+	rows, err := s.db.QueryContext(ctx, `SELECT id,workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,condition_expression,is_default,requires_permission_code,requires_reason,sort_order FROM workflow_step_transitions WHERE workflow_template_id=$1 ORDER BY source_step_id,sort_order,id`, templateID)
 	if err != nil {
 		return nil, err
 	}
 	out := []WorkflowTransitionDefinition{}
 	for rows.Next() {
 		var x WorkflowTransitionDefinition
-		var result, permission sql.NullString
-		if err = rows.Scan(&x.ID, &x.WorkflowTemplateID, &x.SourceStepID, &x.TargetStepID, &x.TransitionCode, &x.LabelFA, &x.TransitionType, &result, &x.IsDefault, &permission, &x.RequiresReason, &x.SortOrder); err != nil {
+		var result, condition, permission sql.NullString
+		if err = rows.Scan(&x.ID, &x.WorkflowTemplateID, &x.SourceStepID, &x.TargetStepID, &x.TransitionCode, &x.LabelFA, &x.TransitionType, &result, &condition, &x.IsDefault, &permission, &x.RequiresReason, &x.SortOrder); err != nil {
 			return nil, err
 		}
 		x.ResultCode = scanNullableString(result)
+		x.ConditionExpression = scanNullableString(condition)
 		x.RequiresPermissionCode = scanNullableString(permission)
 		out = append(out, x)
 	}
@@ -42,7 +43,7 @@ func validateTransitionPayload(p WorkflowTransitionPayload) error {
 	if p.SourceStepID == p.TargetStepID || p.SourceStepID == 0 || p.TargetStepID == 0 || p.TransitionCode == "" || strings.TrimSpace(p.LabelFA) == "" || p.SortOrder < 0 {
 		return ErrValidation
 	}
-	if p.TransitionType != "AUTOMATIC" && p.TransitionType != "MANUAL_SELECTION" && p.TransitionType != "RESULT_BASED" {
+	if p.TransitionType != "AUTOMATIC" && p.TransitionType != "MANUAL_SELECTION" && p.TransitionType != "RESULT_BASED" && p.TransitionType != "PARALLEL" && p.TransitionType != "CONDITIONAL" {
 		return ErrValidation
 	}
 	if p.TransitionType == "RESULT_BASED" && (p.ResultCode == nil || !allowedWorkflowResult(normalizeCode(*p.ResultCode))) {
@@ -51,6 +52,18 @@ func validateTransitionPayload(p WorkflowTransitionPayload) error {
 	if p.TransitionType != "RESULT_BASED" && p.ResultCode != nil {
 		return ErrValidation
 	}
+	// Field references are checked at publish, when the step's fields are
+	// final; here the expression only has to parse.
+	if p.TransitionType == "CONDITIONAL" {
+		if p.ConditionExpression == nil || p.IsDefault {
+			return ErrValidation
+		}
+		if _, err := parseCondition(*p.ConditionExpression); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+	} else if p.ConditionExpression != nil {
+		return ErrValidation
+	}
 	return nil
 }
 func (s *OperationsService) CreateWorkflowTransition(ctx context.Context, actor string, templateID int64, p WorkflowTransitionPayload) (WorkflowTransitionDefinition, error) {
@@ -62,7 +75,7 @@ func (s *OperationsService) CreateWorkflowTransition(ctx context.Context, actor
 		return out, err
 	}
 	var id int64
-	err := s.db.QueryRowContext(ctx, `INSERT INTO workflow_step_transitions(workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order) SELECT $1,$2,$3,UPPER($4),$5,$6,NULLIF(UPPER($7),''),$8,$9,$10,$11 WHERE EXISTS(SELECT 1 FROM workflow_template_steps s JOIN workflow_template_steps t ON t.workflow_template_id=s.workflow_template_id WHERE s.id=$2 AND t.id=$3 AND s.workflow_template_id=$1) RETURNING id`, templateID, p.SourceStepID, p.TargetStepID, p.TransitionCode, p.LabelFA, normalizeCode(p.TransitionType), valueOrNil(p.ResultCode), p.IsDefault, p.RequiresPermissionCode, p.RequiresReason, p.SortOrder).Scan(&id)
+	err := s.db.QueryRowContext(ctx, `INSERT INTO workflow_step_transitions(workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order,condition_expression) SELECT $1,$2,$3,UPPER($4),$5,$6,NULLIF(UPPER($7),''),$8,$9,$10,$11,$12 WHERE EXISTS(SELECT 1 FROM workflow_template_steps s JOIN workflow_template_steps t ON t.workflow_template_id=s.workflow_template_id WHERE s.id=$2 AND t.id=$3 AND s.workflow_template_id=$1) RETURNING id`, templateID, p.SourceStepID, p.TargetStepID, p.TransitionCode, p.LabelFA, normalizeCode(p.TransitionType), valueOrNil(p.ResultCode), p.IsDefault, p.RequiresPermissionCode, p.RequiresReason, p.SortOrder, p.ConditionExpression).Scan(&id)
 	if err != nil {
 		return out, err
 	}
@@ -95,7 +108,7 @@ func (s *OperationsService) UpdateWorkflowTransition(ctx context.Context, actor
 	if err := validateTransitionPayload(p); err != nil {
 		return err
 	}
-	_, err := s.db.ExecContext(ctx, `UPDATE workflow_step_transitions SET source_step_id=$2,target_step_id=$3,transition_code=UPPER($4),label_fa=$5,transition_type=$6,result_code=NULLIF(UPPER($7),''),is_default=$8,requires_permission_code=$9,requires_reason=$10,sort_order=$11,updated_at=NOW() WHERE id=$1`, id, p.SourceStepID, p.TargetStepID, p.TransitionCode, p.LabelFA, normalizeCode(p.TransitionType), valueOrNil(p.ResultCode), p.IsDefault, p.RequiresPermissionCode, p.RequiresReason, p.SortOrder)
+	_, err := s.db.ExecContext(ctx, `UPDATE workflow_step_transitions SET source_step_id=$2,target_step_id=$3,transition_code=UPPER($4),label_fa=$5,transition_type=$6,result_code=NULLIF(UPPER($7),''),is_default=$8,requires_permission_code=$9,requires_reason=$10,sort_order=$11,condition_expression=$12,updated_at=NOW() WHERE id=$1`, id, p.SourceStepID, p.TargetStepID, p.TransitionCode, p.LabelFA, normalizeCode(p.TransitionType), valueOrNil(p.ResultCode), p.IsDefault, p.RequiresPermissionCode, p.RequiresReason, p.SortOrder, p.ConditionExpression)
 	if err == nil {
 		s.audit(ctx, actor, "workflow_transitions.update", "workflow_step_transition", fmt.Sprint(id), p)
 	}
@@ -132,14 +145,14 @@ func (s *OperationsService) validateWorkflowTransitions(ctx context.Context, tem
 		return errors.New("branched template requires exactly one active entry step")
 	}
 	var invalid int
-	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id JOIN workflow_template_steps d ON d.id=t.target_step_id LEFT JOIN permissions p ON p.code=t.requires_permission_code AND p.is_active WHERE t.workflow_template_id=$1 AND (s.workflow_template_id<>$1 OR d.workflow_template_id<>$1 OR NOT s.is_active OR NOT d.is_active OR (t.requires_permission_code IS NOT NULL AND p.id IS NULL) OR (t.transition_type='RESULT_BASED' AND t.result_code IS NULL) OR (t.transition_type<>'RESULT_BASED' AND t.result_code IS NOT NULL))`, templateID).Scan(&invalid); err != nil {
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id JOIN workflow_template_steps d ON d.id=t.target_step_id LEFT JOIN permissions p ON p.code=t.requires_permission_code AND p.is_active WHERE t.workflow_template_id=$1 AND (s.workflow_template_id<>$1 OR d.workflow_template_id<>$1 OR NOT s.is_active OR NOT d.is_active OR (t.requires_permission_code IS NOT NULL AND p.id IS NULL) OR (t.transition_type='RESULT_BASED' AND t.result_code IS NULL) OR (t.transition_type<>'RESULT_BASED' AND t.result_code IS NOT NULL) OR ((t.transition_type='CONDITIONAL')<>(t.condition_expression IS NOT NULL)) OR (t.transition_type='CONDITIONAL' AND t.is_default))`, templateID).Scan(&invalid); err != nil {
 		return err
 	}
 	if invalid > 0 {
 		return errors.New("template contains invalid transition references")
 	}
 	var ambiguous int
-	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT source_step_id FROM workflow_step_transitions WHERE workflow_template_id=$1 GROUP BY source_step_id HAVING COUNT(*) FILTER(WHERE is_default)>1 OR (COUNT(*) FILTER(WHERE transition_type='AUTOMATIC')>0 AND COUNT(*) FILTER(WHERE transition_type='AUTOMATIC' AND is_default)<>1) OR COUNT(*) FILTER(WHERE transition_type='RESULT_BASED')<>COUNT(DISTINCT result_code) FILTER(WHERE transition_type='RESULT_BASED')) x`, templateID).Scan(&ambiguous); err != nil {
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT source_step_id FROM workflow_step_transitions WHERE workflow_template_id=$1 GROUP BY source_step_id HAVING COUNT(*) FILTER(WHERE is_default)>1 OR (COUNT(*) FILTER(WHERE transition_type='AUTOMATIC')>0 AND COUNT(*) FILTER(WHERE transition_type='AUTOMATIC' AND is_default)<>1) OR COUNT(*) FILTER(WHERE transition_type='RESULT_BASED')<>COUNT(DISTINCT result_code) FILTER(WHERE transition_type='RESULT_BASED') OR (COUNT(*) FILTER(WHERE transition_type='PARALLEL')>0 AND COUNT(*) FILTER(WHERE transition_type<>'PARALLEL')>0) OR COUNT(*) FILTER(WHERE transition_type='PARALLEL')<>COUNT(DISTINCT target_step_id) FILTER(WHERE transition_type='PARALLEL')) x`, templateID).Scan(&ambiguous); err != nil {
 		return err
 	}
 	if ambiguous > 0 {
@@ -158,6 +171,110 @@ func (s *OperationsService) validateWorkflowTransitions(ctx context.Context, tem
 	return nil
 }
 
+// validateWorkflowJoins checks parallel branches against the steps that
+// merge them. A join must be able to collect its required arrivals (every
+// incoming transition for ALL, join_quorum of them for QUORUM) in a single
+// run, any other step that two concurrent branches reach must be a join, and
+// a join may not sit on a loop because its arrivals are counted only once.
+func validateWorkflowJoins(steps []WorkflowTemplateStepV2, transitions []WorkflowTransitionDefinition) error {
+	active := map[int64]WorkflowTemplateStepV2{}
+	var entry int64
+	for _, st := range steps {
+		if st.IsActive {
+			active[st.ID] = st
+			if st.IsEntry {
+				entry = st.ID
+			}
+		}
+	}
+	outgoing := map[int64][]WorkflowTransitionDefinition{}
+	incoming := map[int64]int{}
+	for _, t := range transitions {
+		if _, ok := active[t.TargetStepID]; ok {
+			outgoing[t.SourceStepID] = append(outgoing[t.SourceStepID], t)
+			incoming[t.TargetStepID]++
+		}
+	}
+	for id, st := range active {
+		mode := st.JoinMode
+		if mode == "" {
+			mode = "NONE"
+		}
+		if mode != "NONE" && len(transitions) == 0 {
+			return fmt.Errorf("join step %s requires a branched template", st.StepCode)
+		}
+		if len(transitions) == 0 || entry == 0 {
+			continue
+		}
+		required := 0
+		switch mode {
+		case "ALL":
+			required = incoming[id]
+		case "QUORUM":
+			if st.JoinQuorum == nil || *st.JoinQuorum > incoming[id] {
+				return fmt.Errorf("join step %s has a quorum above its %d incoming transitions", st.StepCode, incoming[id])
+			}
+			required = *st.JoinQuorum
+		}
+		arrivals := concurrentArrivals(outgoing, entry, id)
+		if mode == "NONE" {
+			if arrivals > 1 {
+				return fmt.Errorf("step %s merges parallel branches and must be a join step", st.StepCode)
+			}
+			continue
+		}
+		if concurrentArrivals(outgoing, id, id) > 0 {
+			return fmt.Errorf("join step %s cannot be re-entered by a loop", st.StepCode)
+		}
+		if arrivals < required {
+			return fmt.Errorf("join step %s is unreachable: at most %d of %d required branches can arrive", st.StepCode, arrivals, required)
+		}
+	}
+	return nil
+}
+
+// concurrentArrivals returns how many distinct transitions into target can
+// fire in one run starting at from. PARALLEL transitions contribute all their
+// branches; any other step contributes its best single route. Loops are cut
+// at the first revisit, which can only under-count.
+func concurrentArrivals(outgoing map[int64][]WorkflowTransitionDefinition, from, target int64) int {
+	onPath := map[int64]bool{}
+	memo := map[int64]map[int64]bool{}
+	var visit func(id int64) map[int64]bool
+	visit = func(id int64) map[int64]bool {
+		if cached, ok := memo[id]; ok {
+			return cached
+		}
+		best := map[int64]bool{}
+		if onPath[id] {
+			return best
+		}
+		onPath[id] = true
+		defer delete(onPath, id)
+		for _, t := range outgoing[id] {
+			reached := map[int64]bool{}
+			if t.TargetStepID == target {
+				reached[t.ID] = true
+			} else {
+				reached = visit(t.TargetStepID)
+			}
+			if t.TransitionType == "PARALLEL" {
+				for k := range reached {
+					best[k] = true
+				}
+			} else if len(reached) > len(best) {
+				best = map[int64]bool{}
+				for k := range reached {
+					best[k] = true
+				}
+			}
+		}
+		memo[id] = best
+		return best
+	}
+	return len(visit(from))
+}
+
 func (s *OperationsService) GetRuntimeTransitions(ctx context.Context, actor, stepID string) ([]RuntimeTransition, error) {
 	var workflowID, status, stepCode string
 	if err := s.db.QueryRowContext(ctx, `SELECT workflow_instance_id,status,step_code FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&workflowID, &status, &stepCode); err != nil {
@@ -188,11 +305,11 @@ func (s *OperationsService) GetRuntimeTransitions(ctx context.Context, actor, st
 }
 
 func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx, actor, workflowID, sourceID, transitionID, reason string, override bool) (string, error) {
-	var targetCode, code, label string
+	var targetCode, code, label, transitionType string
 	var requiresReason bool
 	var permission, result sql.NullString
 	var err error
-	if err := tx.QueryRowContext(ctx, `SELECT target_step_code,transition_code,label_fa,requires_reason,requires_permission_code,result_code FROM workflow_instance_step_transitions WHERE id=$1 AND workflow_instance_id=$2 FOR UPDATE`, transitionID, workflowID).Scan(&targetCode, &code, &label, &requiresReason, &permission, &result); err != nil {
+	if err := tx.QueryRowContext(ctx, `SELECT target_step_code,transition_code,label_fa,transition_type,requires_reason,requires_permission_code,result_code FROM workflow_instance_step_transitions WHERE id=$1 AND workflow_instance_id=$2 FOR UPDATE`, transitionID, workflowID).Scan(&targetCode, &code, &label, &transitionType, &requiresReason, &permission, &result); err != nil {
 		return "", err
 	}
 	if permission.Valid && !s.HasPermission(ctx, actor, permission.String) {
@@ -201,8 +318,10 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 	if (requiresReason || override) && requireReason(reason) != nil {
 		return "", errors.New("transition reason is required")
 	}
+	// A fork selects each of its PARALLEL transitions once; any other step
+	// selects one route.
 	var existing int
-	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_transition_selections WHERE source_step_instance_id=$1`, sourceID).Scan(&existing); err != nil {
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_transition_selections WHERE source_step_instance_id=$1 AND ($2<>'PARALLEL' OR transition_snapshot_id=$3)`, sourceID, transitionType, transitionID).Scan(&existing); err != nil {
 		return "", err
 	}
 	if existing > 0 && !override {
@@ -220,14 +339,26 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 			return "", conflict("REVERSAL_REQUIRED", "downstream domain operations must be reversed before changing route")
 		}
 		_, _ = tx.ExecContext(ctx, `DELETE FROM workflow_transition_selections WHERE source_step_instance_id=$1`, sourceID)
+		_, _ = tx.ExecContext(ctx, `DELETE FROM workflow_join_arrivals a USING workflow_step_instances j WHERE a.source_step_instance_id=$1 AND j.id=a.join_step_instance_id AND j.status='NOT_STARTED'`, sourceID)
 	}
 	var targetID string
 	var targetStatus string
-	err = tx.QueryRowContext(ctx, `SELECT id,status FROM workflow_step_instances WHERE workflow_instance_id=$1 AND step_code=$2 AND iteration_number=1 FOR UPDATE`, workflowID, targetCode).Scan(&targetID, &targetStatus)
+	var joinRequired sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT id,status,join_required_count FROM workflow_step_instances WHERE workflow_instance_id=$1 AND step_code=$2 AND iteration_number=1 FOR UPDATE`, workflowID, targetCode).Scan(&targetID, &targetStatus, &joinRequired)
 	if err != nil {
 		return "", err
 	}
-	if targetStatus != "NOT_STARTED" {
+	opened := true
+	if joinRequired.Valid {
+		if opened, err = s.arriveAtJoinTx(ctx, tx, workflowID, targetID, targetStatus, sourceID, transitionID, int(joinRequired.Int64)); err != nil {
+			return "", err
+		}
+	}
+	// A join that is still waiting, or a QUORUM join that already opened,
+	// is left as it is; the arriving branch ends here.
+	switch {
+	case !opened:
+	case targetStatus != "NOT_STARTED":
 		var maxIteration, limit int
 		if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(si.iteration_number),0),wt.max_iterations FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id JOIN workflow_templates wt ON wt.id=wi.workflow_template_id WHERE si.workflow_instance_id=$1 AND si.step_code=$2 GROUP BY wt.max_iterations`, workflowID, targetCode).Scan(&maxIteration, &limit); err != nil {
 			return "", err
@@ -236,10 +367,16 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 			return "", conflict("MAX_ITERATIONS", "workflow iteration limit reached")
 		}
 		var prior string
-		if err = tx.QueryRowContext(ctx, `SELECT id FROM workflow_step_instances WHERE workflow_instance_id=$1 AND step_code=$2 ORDER BY iteration_number DESC LIMIT 1`, workflowID, targetCode).Scan(&prior); err != nil {
+		var duration int
+		if err = tx.QueryRowContext(ctx, `SELECT si.id,COALESCE(ts.default_duration_hours,24) FROM workflow_step_instances si LEFT JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id WHERE si.workflow_instance_id=$1 AND si.step_code=$2 ORDER BY si.iteration_number DESC LIMIT 1`, workflowID, targetCode).Scan(&prior, &duration); err != nil {
 			return "", err
 		}
-		err = tx.QueryRowContext(ctx, `INSERT INTO workflow_step_instances(workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,status,assigned_role_id,responsible_role_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,estimated_start_at,estimated_end_at,customer_status_text,iteration_number,path_state,predecessor_step_instance_id,domain_event_code) SELECT workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,'WAITING_FOR_ASSIGNEE',assigned_role_id,responsible_role_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,NOW(),NOW()+COALESCE(estimated_end_at-estimated_start_at,INTERVAL '24 hours'),'در انتظار شروع',$3,'INCLUDED',$4,domain_event_code FROM workflow_step_instances WHERE id=$2 RETURNING id`, workflowID, prior, maxIteration+1, sourceID).Scan(&targetID)
+		now := time.Now()
+		var calendar businessCalendar
+		if calendar, err = s.workflowCalendarTx(ctx, tx, workflowID, now); err != nil {
+			return "", err
+		}
+		err = tx.QueryRowContext(ctx, `INSERT INTO workflow_step_instances(workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,status,assigned_role_id,responsible_role_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,estimated_start_at,estimated_end_at,customer_status_text,iteration_number,path_state,predecessor_step_instance_id,domain_event_code,join_required_count) SELECT workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,'WAITING_FOR_ASSIGNEE',assigned_role_id,responsible_role_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,$5,$6,'در انتظار شروع',$3,'INCLUDED',$4,domain_event_code,join_required_count FROM workflow_step_instances WHERE id=$2 RETURNING id`, workflowID, prior, maxIteration+1, sourceID, now, calendar.add(now, time.Duration(duration)*time.Hour)).Scan(&targetID)
 		if err != nil {
 			return "", err
 		}
@@ -251,7 +388,7 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 		if err != nil {
 			return "", err
 		}
-	} else {
+	default:
 		_, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET status='WAITING_FOR_ASSIGNEE',path_state='INCLUDED',predecessor_step_instance_id=$2,customer_status_text='در انتظار شروع',updated_at=NOW() WHERE id=$1`, targetID, sourceID)
 		if err != nil {
 			return "", err
@@ -261,7 +398,11 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 	if err != nil {
 		return "", err
 	}
-	_, err = tx.ExecContext(ctx, `UPDATE workflow_instances SET status='IN_PROGRESS',current_step_instance_id=$2,updated_at=NOW() WHERE id=$1`, workflowID, targetID)
+	if opened {
+		_, err = tx.ExecContext(ctx, `UPDATE workflow_instances SET status='IN_PROGRESS',current_step_instance_id=$2,updated_at=NOW() WHERE id=$1`, workflowID, targetID)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE workflow_instances SET current_step_instance_id=COALESCE((SELECT id FROM workflow_step_instances WHERE workflow_instance_id=$1 AND path_state='INCLUDED' AND status NOT IN ('NOT_STARTED','COMPLETED','SKIPPED','CANCELLED') ORDER BY sequence_number LIMIT 1),$2),updated_at=NOW() WHERE id=$1`, workflowID, targetID)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -270,16 +411,46 @@ func (s *OperationsService) activateTransitionTx(ctx context.Context, tx *sql.Tx
 		return "", err
 	}
 	_, _ = tx.ExecContext(ctx, `UPDATE action_items SET status='COMPLETED',completed_at=NOW(),completed_by_user_id=$2,updated_at=NOW() WHERE workflow_step_instance_id=$1 AND source_trigger_type='TRANSITION' AND status NOT IN ('COMPLETED','CANCELLED')`, sourceID, actor)
-	if err = s.createMainStepActionTx(ctx, tx, workflowID, targetID); err != nil {
-		return "", err
-	}
-	if err = s.runStepTriggersTx(ctx, tx, workflowID, targetID, "ON_STEP_OPEN"); err != nil {
-		return "", err
+	if opened {
+		if err = s.createMainStepActionTx(ctx, tx, workflowID, targetID); err != nil {
+			return "", err
+		}
+		if err = s.startStepSLATx(ctx, tx, targetID); err != nil {
+			return "", err
+		}
+		if err = s.runStepTriggersTx(ctx, tx, workflowID, targetID, "ON_STEP_OPEN"); err != nil {
+			return "", err
+		}
 	}
-	s.auditTx(ctx, tx, actor, "workflow_transitions.select", "workflow_step_instance", sourceID, nil, map[string]any{"transition_code": code, "label": label, "target_step_instance_id": targetID, "reason": reason, "override": override})
+	s.auditTx(ctx, tx, actor, "workflow_transitions.select", "workflow_step_instance", sourceID, nil, map[string]any{"transition_code": code, "label": label, "target_step_instance_id": targetID, "reason": reason, "override": override, "target_opened": opened})
 	return targetID, nil
 }
 
+// arriveAtJoinTx records a branch reaching a join step and reports whether
+// the join opens now. Branches that reach a QUORUM join after it opened are
+// recorded and end there.
+func (s *OperationsService) arriveAtJoinTx(ctx context.Context, tx *sql.Tx, workflowID, joinID, joinStatus, sourceID, transitionID string, required int) (bool, error) {
+	res, err := tx.ExecContext(ctx, `INSERT INTO workflow_join_arrivals(workflow_instance_id,join_step_instance_id,transition_snapshot_id,source_step_instance_id) VALUES($1,$2,$3,$4) ON CONFLICT(join_step_instance_id,transition_snapshot_id) DO NOTHING`, workflowID, joinID, transitionID, sourceID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, conflict("INVALID_TRANSITION", "branch already arrived at the join step")
+	}
+	if joinStatus != "NOT_STARTED" {
+		return false, nil
+	}
+	var arrived int
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_join_arrivals WHERE join_step_instance_id=$1`, joinID).Scan(&arrived); err != nil {
+		return false, err
+	}
+	if arrived < required {
+		_, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET path_state='INCLUDED',customer_status_text='در انتظار تکمیل مسیرهای موازی',updated_at=NOW() WHERE id=$1`, joinID)
+		return false, err
+	}
+	return true, nil
+}
+
 func (s *OperationsService) SelectWorkflowTransition(ctx context.Context, actor, stepID, key string, p SelectTransitionPayload) (map[string]any, error) {
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
@@ -325,8 +496,8 @@ func (s *OperationsService) SelectWorkflowTransition(ctx context.Context, actor,
 
 func (s *OperationsService) routeCompletedStepTx(ctx context.Context, tx *sql.Tx, actor, workflowID, stepID string) (bool, error) {
 	var stepCode string
-	var result sql.NullString
-	if err := tx.QueryRowContext(ctx, `SELECT step_code,result_code FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&stepCode, &result); err != nil {
+	var result, conditional sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT step_code,result_code,condition_transition_id FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&stepCode, &result, &conditional); err != nil {
 		return false, err
 	}
 	var count int
@@ -336,9 +507,37 @@ func (s *OperationsService) routeCompletedStepTx(ctx context.Context, tx *sql.Tx
 	if count == 0 {
 		return false, nil
 	}
+	forks, err := tx.QueryContext(ctx, `SELECT id FROM workflow_instance_step_transitions WHERE workflow_instance_id=$1 AND source_step_code=$2 AND transition_type='PARALLEL' ORDER BY sort_order,id`, workflowID, stepCode)
+	if err != nil {
+		return false, err
+	}
+	branches := []string{}
+	for forks.Next() {
+		var id string
+		if err = forks.Scan(&id); err != nil {
+			forks.Close()
+			return false, err
+		}
+		branches = append(branches, id)
+	}
+	if err = forks.Close(); err != nil {
+		return false, err
+	}
+	if len(branches) > 0 {
+		for _, id := range branches {
+			if _, err = s.activateTransitionTx(ctx, tx, actor, workflowID, stepID, id, "", false); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+	// A condition matched at submit takes precedence over the step result.
 	var transitionID string
-	err := sql.ErrNoRows
-	if result.Valid {
+	err = sql.ErrNoRows
+	if conditional.Valid {
+		transitionID, err = conditional.String, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) && result.Valid {
 		err = tx.QueryRowContext(ctx, `SELECT id FROM workflow_instance_step_transitions WHERE workflow_instance_id=$1 AND source_step_code=$2 AND transition_type='RESULT_BASED' AND result_code=$3 ORDER BY is_default DESC,sort_order LIMIT 1`, workflowID, stepCode, result.String).Scan(&transitionID)
 	}
 	if errors.Is(err, sql.ErrNoRows) {
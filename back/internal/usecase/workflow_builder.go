@@ -89,16 +89,16 @@ func (s *OperationsService) GetWorkflowTemplateVersion(ctx context.Context, id i
 		v := published.Time
 		t.PublishedAt = &v
 	}
-	rows, err := s.db.QueryContext(ctx, `SELECT s.id,s.workflow_template_id,s.step_code,s.internal_title_fa,s.internal_description_fa,s.customer_title_fa,s.customer_description_fa,s.sequence_number,s.responsible_role_id,COALESCE(r.code,''),COALESCE(s.required_permission_code,''),s.customer_visible,s.requires_approval,s.approval_role_id,s.is_optional,s.is_skippable,s.is_active,s.default_duration_hours,s.starts_automatically,s.is_entry,s.domain_event_code FROM workflow_template_steps s LEFT JOIN roles r ON r.id=s.responsible_role_id WHERE s.workflow_template_id=$1 ORDER BY s.sequence_number`, id)
+	rows, err := s.db.QueryContext(ctx, `SELECT s.id,s.workflow_template_id,s.step_code,s.internal_title_fa,s.internal_description_fa,s.customer_title_fa,s.customer_description_fa,s.sequence_number,s.responsible_role_id,COALESCE(r.code,''),COALESCE(s.required_permission_code,''),s.customer_visible,s.requires_approval,s.approval_role_id,s.is_optional,s.is_skippable,s.is_active,s.default_duration_hours,s.starts_automatically,s.is_entry,s.domain_event_code,s.join_mode,s.join_quorum,s.assignment_strategy,s.customer_actionable FROM workflow_template_steps s LEFT JOIN roles r ON r.id=s.responsible_role_id WHERE s.workflow_template_id=$1 ORDER BY s.sequence_number`, id)
 	if err != nil {
 		return t, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var st WorkflowTemplateStepV2
-		var role, approval sql.NullInt64
+		var role, approval, quorum sql.NullInt64
 		var domainEvent sql.NullString
-		if err := rows.Scan(&st.ID, &st.WorkflowTemplateID, &st.StepCode, &st.InternalTitleFA, &st.InternalDescriptionFA, &st.CustomerTitleFA, &st.CustomerDescriptionFA, &st.SequenceNumber, &role, &st.ResponsibleRoleCode, &st.RequiredPermissionCode, &st.CustomerVisible, &st.RequiresApproval, &approval, &st.IsOptional, &st.IsSkippable, &st.IsActive, &st.DefaultDurationHours, &st.StartsAutomatically, &st.IsEntry, &domainEvent); err != nil {
+		if err := rows.Scan(&st.ID, &st.WorkflowTemplateID, &st.StepCode, &st.InternalTitleFA, &st.InternalDescriptionFA, &st.CustomerTitleFA, &st.CustomerDescriptionFA, &st.SequenceNumber, &role, &st.ResponsibleRoleCode, &st.RequiredPermissionCode, &st.CustomerVisible, &st.RequiresApproval, &approval, &st.IsOptional, &st.IsSkippable, &st.IsActive, &st.DefaultDurationHours, &st.StartsAutomatically, &st.IsEntry, &domainEvent, &st.JoinMode, &quorum, &st.AssignmentStrategy, &st.CustomerActionable); err != nil {
 			return t, err
 		}
 		if role.Valid {
@@ -110,8 +110,14 @@ func (s *OperationsService) GetWorkflowTemplateVersion(ctx context.Context, id i
 			st.ApprovalRoleID = &v
 		}
 		st.DomainEventCode = scanNullableString(domainEvent)
+		if quorum.Valid {
+			v := int(quorum.Int64)
+			st.JoinQuorum = &v
+		}
 		st.Fields, _ = s.listTemplateFields(ctx, st.ID)
 		st.Tasks, _ = s.listTemplateTasks(ctx, st.ID)
+		st.SLA, _ = s.getStepSLAPolicy(ctx, st.ID)
+		st.ApprovalLevels, _ = s.listStepApprovalLevels(ctx, st.ID)
 		t.Steps = append(t.Steps, st)
 	}
 	t.Metrics, _ = s.ListHandoffMetrics(ctx, id)
@@ -182,7 +188,7 @@ func (s *OperationsService) CloneWorkflowTemplate(ctx context.Context, actor str
 	if err = tx.QueryRowContext(ctx, `INSERT INTO workflow_templates(template_group_code,version_number,code,name_fa,description_fa,icon_key,status,start_permission_code,is_active,created_from_template_id,created_by_user_id,scope_type,max_iterations) VALUES($1,$2,$3,$4,$5,$6,'DRAFT',$7,$8,$9,$10,$11,$12) RETURNING id`, group, version, code, name, desc, icon, start, active, sourceID, actor, scope, maxIterations).Scan(&id); err != nil {
 		return WorkflowTemplateVersion{}, err
 	}
-	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code) SELECT $1,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code FROM workflow_template_steps WHERE workflow_template_id=$2`, id, sourceID)
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable) SELECT $1,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable FROM workflow_template_steps WHERE workflow_template_id=$2`, id, sourceID)
 	if err != nil {
 		return WorkflowTemplateVersion{}, err
 	}
@@ -194,6 +200,14 @@ func (s *OperationsService) CloneWorkflowTemplate(ctx context.Context, actor str
 	if err != nil {
 		return WorkflowTemplateVersion{}, err
 	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_sla_policies(workflow_template_step_id,sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer) SELECT ns.id,p.sla_hours,p.warn_at_percent,p.escalation_role_id,p.reassign_after_hours,p.notify_customer FROM workflow_step_sla_policies p JOIN workflow_template_steps os ON os.id=p.workflow_template_step_id JOIN workflow_template_steps ns ON ns.workflow_template_id=$1 AND ns.step_code=os.step_code WHERE os.workflow_template_id=$2`, id, sourceID)
+	if err != nil {
+		return WorkflowTemplateVersion{}, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_approval_levels(workflow_template_step_id,level_number,approval_role_id,required_approvals,min_order_amount,amount_currency) SELECT ns.id,l.level_number,l.approval_role_id,l.required_approvals,l.min_order_amount,l.amount_currency FROM workflow_step_approval_levels l JOIN workflow_template_steps os ON os.id=l.workflow_template_step_id JOIN workflow_template_steps ns ON ns.workflow_template_id=$1 AND ns.step_code=os.step_code WHERE os.workflow_template_id=$2`, id, sourceID)
+	if err != nil {
+		return WorkflowTemplateVersion{}, err
+	}
 	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_handoff_metric_definitions(workflow_template_id,metric_key,label_fa,unit_code,absolute_tolerance,percentage_tolerance,blocking_on_mismatch) SELECT $1,metric_key,label_fa,unit_code,absolute_tolerance,percentage_tolerance,blocking_on_mismatch FROM workflow_handoff_metric_definitions WHERE workflow_template_id=$2`, id, sourceID)
 	if err != nil {
 		return WorkflowTemplateVersion{}, err
@@ -202,7 +216,7 @@ func (s *OperationsService) CloneWorkflowTemplate(ctx context.Context, actor str
 	if err != nil {
 		return WorkflowTemplateVersion{}, err
 	}
-	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_transitions(workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order) SELECT $1,ns.id,nt.id,t.transition_code,t.label_fa,t.transition_type,t.result_code,t.is_default,t.requires_permission_code,t.requires_reason,t.sort_order FROM workflow_step_transitions t JOIN workflow_template_steps os ON os.id=t.source_step_id JOIN workflow_template_steps ot ON ot.id=t.target_step_id JOIN workflow_template_steps ns ON ns.workflow_template_id=$1 AND ns.step_code=os.step_code JOIN workflow_template_steps nt ON nt.workflow_template_id=$1 AND nt.step_code=ot.step_code WHERE t.workflow_template_id=$2`, id, sourceID)
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_transitions(workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order,condition_expression) SELECT $1,ns.id,nt.id,t.transition_code,t.label_fa,t.transition_type,t.result_code,t.is_default,t.requires_permission_code,t.requires_reason,t.sort_order,t.condition_expression FROM workflow_step_transitions t JOIN workflow_template_steps os ON os.id=t.source_step_id JOIN workflow_template_steps ot ON ot.id=t.target_step_id JOIN workflow_template_steps ns ON ns.workflow_template_id=$1 AND ns.step_code=os.step_code JOIN workflow_template_steps nt ON nt.workflow_template_id=$1 AND nt.step_code=ot.step_code WHERE t.workflow_template_id=$2`, id, sourceID)
 	if err != nil {
 		return WorkflowTemplateVersion{}, err
 	}
@@ -217,7 +231,11 @@ func (s *OperationsService) CloneWorkflowTemplate(ctx context.Context, actor str
 	return s.GetWorkflowTemplateVersion(ctx, id)
 }
 
-func (s *OperationsService) PublishWorkflowTemplate(ctx context.Context, actor string, id int64) error {
+// PublishWorkflowTemplate publishes a draft. When the draft changes the
+// published version of its group in ways that affect running instances,
+// the publisher must hold workflow_templates.sign_off_risk and give a
+// sign-off reason.
+func (s *OperationsService) PublishWorkflowTemplate(ctx context.Context, actor string, id int64, p WorkflowPublishPayload) error {
 	t, err := s.GetWorkflowTemplateVersion(ctx, id)
 	if err != nil {
 		return err
@@ -228,6 +246,26 @@ func (s *OperationsService) PublishWorkflowTemplate(ctx context.Context, actor s
 	if err = s.validateTemplateReferences(ctx, id); err != nil {
 		return err
 	}
+	after := map[string]any{"status": "PUBLISHED"}
+	baseline, hasBaseline, err := s.publishBaseline(ctx, id)
+	if err != nil {
+		return err
+	}
+	if hasBaseline {
+		diff, err := s.DiffWorkflowTemplateVersions(ctx, baseline, id)
+		if err != nil {
+			return err
+		}
+		if risky := riskyChangeSummary(diff); len(risky) > 0 {
+			if strings.TrimSpace(p.SignOffReason) == "" {
+				return conflict("WORKFLOW_RISK_SIGN_OFF_REQUIRED", "این نسخه تغییراتی دارد که Workflowهای در جریان را تحت تأثیر قرار می‌دهد؛ ثبت دلیل تأیید الزامی است")
+			}
+			if !s.HasPermission(ctx, actor, "workflow_templates.sign_off_risk") {
+				return ErrForbidden
+			}
+			after["baseline_template_id"], after["risky_changes"], after["running_on_baseline"], after["sign_off_reason"] = baseline, risky, diff.RunningOnSource, strings.TrimSpace(p.SignOffReason)
+		}
+	}
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return err
@@ -247,7 +285,7 @@ func (s *OperationsService) PublishWorkflowTemplate(ctx context.Context, actor s
 	if affected, _ := result.RowsAffected(); affected != 1 {
 		return ErrTemplateImmutable
 	}
-	s.auditTx(ctx, tx, actor, "workflow_templates.publish", "workflow_template", fmt.Sprint(id), map[string]any{"status": "DRAFT"}, map[string]any{"status": "PUBLISHED"})
+	s.auditTx(ctx, tx, actor, "workflow_templates.publish", "workflow_template", fmt.Sprint(id), map[string]any{"status": "DRAFT"}, after)
 	return tx.Commit()
 }
 
@@ -276,6 +314,25 @@ func (s *OperationsService) validateTemplateReferences(ctx context.Context, temp
 	if invalidDocuments > 0 {
 		return errors.New("template contains an invalid document requirement")
 	}
+	var invalidLevels int
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_step_approval_levels l JOIN workflow_template_steps s ON s.id=l.workflow_template_step_id LEFT JOIN roles r ON r.id=l.approval_role_id AND r.is_active WHERE s.workflow_template_id=$1 AND s.is_active AND (r.id IS NULL OR NOT s.requires_approval)`, templateID).Scan(&invalidLevels)
+	if err != nil {
+		return err
+	}
+	if invalidLevels > 0 {
+		return errors.New("template contains an approval level with an invalid role or on a step without approval")
+	}
+	var stepCode, roleName string
+	var level, required, members int
+	err = s.db.QueryRowContext(ctx, `SELECT s.step_code,l.level_number,l.required_approvals,r.name_fa,m.members FROM workflow_step_approval_levels l JOIN workflow_template_steps s ON s.id=l.workflow_template_step_id JOIN roles r ON r.id=l.approval_role_id
+		CROSS JOIN LATERAL (SELECT COUNT(*) members FROM users u WHERE u.user_type='INTERNAL' AND u.status='ACTIVE' AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=u.id AND ur.role_id=l.approval_role_id)) m
+		WHERE s.workflow_template_id=$1 AND s.is_active AND m.members<l.required_approvals ORDER BY s.sequence_number,l.level_number LIMIT 1`, templateID).Scan(&stepCode, &level, &required, &roleName, &members)
+	if err == nil {
+		return conflict("APPROVAL_QUORUM_UNREACHABLE", fmt.Sprintf("step %s approval level %d needs %d approvals but role %s has %d active members", stepCode, level, required, roleName, members))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
 	return s.validateWorkflowTransitions(ctx, templateID)
 }
 func (s *OperationsService) ArchiveWorkflowTemplate(ctx context.Context, actor string, id int64) error {
@@ -315,6 +372,17 @@ func validateTemplateForPublish(t WorkflowTemplateVersion) error {
 		if st.RequiresApproval && st.ApprovalRoleID == nil {
 			return fmt.Errorf("step %s requires approval role", st.StepCode)
 		}
+		if st.SLA != nil {
+			if err := validateSLAPolicy(*st.SLA); err != nil {
+				return fmt.Errorf("step %s SLA: %w", st.StepCode, err)
+			}
+		}
+		if len(st.ApprovalLevels) > 0 && !st.RequiresApproval {
+			return fmt.Errorf("step %s has approval levels but does not require approval", st.StepCode)
+		}
+		if err := validateCustomerActionableStep(st); err != nil {
+			return err
+		}
 		for _, f := range st.Fields {
 			if err := validateFieldDefinition(f.FieldKey, f.FieldType, f.OptionsJSON, f.ValidationJSON, f.HandoffMetricKey, f.HandoffDirection, f.UnitCode, f.CurrencyCode, f.IsInternalCost, f.IsCustomerVisible, metrics); err != nil {
 				return fmt.Errorf("field %s: %w", f.FieldKey, err)
@@ -332,7 +400,13 @@ func validateTemplateForPublish(t WorkflowTemplateVersion) error {
 	if active == 0 {
 		return errors.New("template requires at least one active step")
 	}
-	return nil
+	if err := validateWorkflowConditions(t.Steps, t.Transitions); err != nil {
+		return err
+	}
+	if err := validateWorkflowFormulas(t.Steps); err != nil {
+		return err
+	}
+	return validateWorkflowJoins(t.Steps, t.Transitions)
 }
 func validateFieldDefinition(key, kind string, options, validation json.RawMessage, metric, direction, unit, currency *string, internalCost, customerVisible bool, metrics map[string]bool) error {
 	if !codePattern.MatchString(key) {
@@ -350,6 +424,16 @@ func validateFieldDefinition(key, kind string, options, validation json.RawMessa
 	if (kind == "WEIGHT" || kind == "AREA" || kind == "VOLUME" || kind == "QUANTITY") && (unit == nil || strings.TrimSpace(*unit) == "") {
 		return errors.New("measurement unit is required")
 	}
+	if kind == "COMPUTED" {
+		if _, err := parseFormula(formulaSource(validation)); err != nil {
+			return fmt.Errorf("invalid formula: %w", err)
+		}
+		if unit != nil {
+			if _, err := lookupFormulaUnit(*unit); err != nil {
+				return err
+			}
+		}
+	}
 	if kind == "MONEY" && (currency == nil || len(strings.TrimSpace(*currency)) != 3) {
 		return errors.New("money currency is required")
 	}
@@ -371,6 +455,37 @@ func validateFieldDefinition(key, kind string, options, validation json.RawMessa
 	return nil
 }
 
+// normalizeStepJoin validates a step's join settings. A quorum is only kept
+// for QUORUM joins; whether it can be met is checked at publish time.
+func normalizeStepJoin(p *WorkflowStepPayload) error {
+	p.JoinMode = normalizeCode(p.JoinMode)
+	switch p.JoinMode {
+	case "":
+		p.JoinMode, p.JoinQuorum = "NONE", nil
+	case "NONE", "ALL":
+		p.JoinQuorum = nil
+	case "QUORUM":
+		if p.JoinQuorum == nil || *p.JoinQuorum < 1 {
+			return errors.New("join quorum must be at least 1")
+		}
+	default:
+		return errors.New("invalid join mode")
+	}
+	return nil
+}
+
+// normalizeStepAssignment defaults a step's assignment strategy to MANUAL.
+func normalizeStepAssignment(p *WorkflowStepPayload) error {
+	p.AssignmentStrategy = normalizeCode(p.AssignmentStrategy)
+	switch p.AssignmentStrategy {
+	case "":
+		p.AssignmentStrategy = "MANUAL"
+	case "MANUAL", "ROUND_ROBIN", "LEAST_OPEN_ITEMS", "STICKY":
+	default:
+		return errors.New("invalid assignment strategy")
+	}
+	return nil
+}
 func (s *OperationsService) AddWorkflowStep(ctx context.Context, actor string, templateID int64, p WorkflowStepPayload) (WorkflowTemplateStepV2, error) {
 	if err := s.ensureDraft(ctx, templateID); err != nil {
 		return WorkflowTemplateStepV2{}, err
@@ -378,13 +493,22 @@ func (s *OperationsService) AddWorkflowStep(ctx context.Context, actor string, t
 	if !codePattern.MatchString(strings.ToLower(p.StepCode)) || p.InternalTitleFA == "" || p.ResponsibleRoleID == nil || p.RequiredPermissionCode == "" {
 		return WorkflowTemplateStepV2{}, errors.New("invalid step")
 	}
+	if err := normalizeStepJoin(&p); err != nil {
+		return WorkflowTemplateStepV2{}, err
+	}
+	if err := normalizeStepAssignment(&p); err != nil {
+		return WorkflowTemplateStepV2{}, err
+	}
+	if err := checkStepCustomerAction(p); err != nil {
+		return WorkflowTemplateStepV2{}, err
+	}
 	if p.DefaultDurationHours <= 0 {
 		p.DefaultDurationHours = 24
 	}
 	var seq int
 	_ = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(sequence_number),0)+1 FROM workflow_template_steps WHERE workflow_template_id=$1`, templateID).Scan(&seq)
 	var id int64
-	err := s.db.QueryRowContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_id,responsible_role_code,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code) SELECT $1,UPPER($2),$3,$4,$5,$6,$7,$8,r.code,$9,$10,$18,$11,$12,$13,$14,$15,$16,$17,$18,$19 FROM roles r WHERE r.id=$8 RETURNING id`, templateID, p.StepCode, p.InternalTitleFA, p.InternalDescriptionFA, p.CustomerTitleFA, p.CustomerDescriptionFA, seq, p.ResponsibleRoleID, p.RequiredPermissionCode, p.CustomerVisible, p.RequiresApproval, p.ApprovalRoleID, p.IsOptional, p.IsSkippable, p.IsActive, p.DefaultDurationHours, p.StartsAutomatically, p.IsEntry, p.DomainEventCode).Scan(&id)
+	err := s.db.QueryRowContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_id,responsible_role_code,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable) SELECT $1,UPPER($2),$3,$4,$5,$6,$7,$8,r.code,$9,$10,$18,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23 FROM roles r WHERE r.id=$8 RETURNING id`, templateID, p.StepCode, p.InternalTitleFA, p.InternalDescriptionFA, p.CustomerTitleFA, p.CustomerDescriptionFA, seq, p.ResponsibleRoleID, p.RequiredPermissionCode, p.CustomerVisible, p.RequiresApproval, p.ApprovalRoleID, p.IsOptional, p.IsSkippable, p.IsActive, p.DefaultDurationHours, p.StartsAutomatically, p.IsEntry, p.DomainEventCode, p.JoinMode, p.JoinQuorum, p.AssignmentStrategy, p.CustomerActionable).Scan(&id)
 	if err != nil {
 		return WorkflowTemplateStepV2{}, err
 	}
@@ -405,10 +529,19 @@ func (s *OperationsService) UpdateWorkflowStep(ctx context.Context, actor string
 	if err = s.ensureDraft(ctx, templateID); err != nil {
 		return err
 	}
+	if err = normalizeStepJoin(&p); err != nil {
+		return err
+	}
+	if err = normalizeStepAssignment(&p); err != nil {
+		return err
+	}
+	if err = checkStepCustomerAction(p); err != nil {
+		return err
+	}
 	if p.DefaultDurationHours <= 0 {
 		p.DefaultDurationHours = 24
 	}
-	_, err = s.db.ExecContext(ctx, `UPDATE workflow_template_steps SET internal_title_fa=$2,internal_description_fa=$3,customer_title_fa=$4,customer_description_fa=$5,responsible_role_id=$6,responsible_role_code=(SELECT code FROM roles WHERE id=$6),required_permission_code=$7,customer_visible=$8,requires_approval=$9,approval_role_id=$10,is_optional=$11,is_skippable=$12,is_active=$13,default_duration_hours=$14,starts_automatically=$15,is_entry=$16,domain_event_code=$17,updated_at=NOW() WHERE id=$1`, stepID, p.InternalTitleFA, p.InternalDescriptionFA, p.CustomerTitleFA, p.CustomerDescriptionFA, p.ResponsibleRoleID, p.RequiredPermissionCode, p.CustomerVisible, p.RequiresApproval, p.ApprovalRoleID, p.IsOptional, p.IsSkippable, p.IsActive, p.DefaultDurationHours, p.StartsAutomatically, p.IsEntry, p.DomainEventCode)
+	_, err = s.db.ExecContext(ctx, `UPDATE workflow_template_steps SET internal_title_fa=$2,internal_description_fa=$3,customer_title_fa=$4,customer_description_fa=$5,responsible_role_id=$6,responsible_role_code=(SELECT code FROM roles WHERE id=$6),required_permission_code=$7,customer_visible=$8,requires_approval=$9,approval_role_id=$10,is_optional=$11,is_skippable=$12,is_active=$13,default_duration_hours=$14,starts_automatically=$15,is_entry=$16,domain_event_code=$17,join_mode=$18,join_quorum=$19,assignment_strategy=$20,customer_actionable=$21,updated_at=NOW() WHERE id=$1`, stepID, p.InternalTitleFA, p.InternalDescriptionFA, p.CustomerTitleFA, p.CustomerDescriptionFA, p.ResponsibleRoleID, p.RequiredPermissionCode, p.CustomerVisible, p.RequiresApproval, p.ApprovalRoleID, p.IsOptional, p.IsSkippable, p.IsActive, p.DefaultDurationHours, p.StartsAutomatically, p.IsEntry, p.DomainEventCode, p.JoinMode, p.JoinQuorum, p.AssignmentStrategy, p.CustomerActionable)
 	if err == nil {
 		s.audit(ctx, actor, "workflow_steps.update", "workflow_template_step", fmt.Sprint(stepID), p)
 	}
@@ -482,7 +615,7 @@ func (s *OperationsService) DuplicateWorkflowStep(ctx context.Context, actor str
 	}
 	defer tx.Rollback()
 	var newID int64
-	err = tx.QueryRowContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code) SELECT workflow_template_id,step_code||'_COPY_'||EXTRACT(EPOCH FROM NOW())::bigint,internal_title_fa||' (کپی)',internal_description_fa,customer_title_fa,customer_description_fa,(SELECT COALESCE(MAX(sequence_number),0)+1 FROM workflow_template_steps WHERE workflow_template_id=$2),responsible_role_code,responsible_role_id,required_permission_code,customer_visible,FALSE,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,FALSE,domain_event_code FROM workflow_template_steps WHERE id=$1 RETURNING id`, stepID, templateID).Scan(&newID)
+	err = tx.QueryRowContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_code,responsible_role_id,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable) SELECT workflow_template_id,step_code||'_COPY_'||EXTRACT(EPOCH FROM NOW())::bigint,internal_title_fa||' (کپی)',internal_description_fa,customer_title_fa,customer_description_fa,(SELECT COALESCE(MAX(sequence_number),0)+1 FROM workflow_template_steps WHERE workflow_template_id=$2),responsible_role_code,responsible_role_id,required_permission_code,customer_visible,FALSE,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,FALSE,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable FROM workflow_template_steps WHERE id=$1 RETURNING id`, stepID, templateID).Scan(&newID)
 	if err != nil {
 		return WorkflowTemplateStepV2{}, err
 	}
@@ -494,6 +627,14 @@ func (s *OperationsService) DuplicateWorkflowStep(ctx context.Context, actor str
 	if err != nil {
 		return WorkflowTemplateStepV2{}, err
 	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_sla_policies(workflow_template_step_id,sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer) SELECT $1,sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer FROM workflow_step_sla_policies WHERE workflow_template_step_id=$2`, newID, stepID)
+	if err != nil {
+		return WorkflowTemplateStepV2{}, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_approval_levels(workflow_template_step_id,level_number,approval_role_id,required_approvals,min_order_amount,amount_currency) SELECT $1,level_number,approval_role_id,required_approvals,min_order_amount,amount_currency FROM workflow_step_approval_levels WHERE workflow_template_step_id=$2`, newID, stepID)
+	if err != nil {
+		return WorkflowTemplateStepV2{}, err
+	}
 	if err = tx.Commit(); err != nil {
 		return WorkflowTemplateStepV2{}, err
 	}
@@ -0,0 +1,595 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A workflow bundle is a self-contained copy of one template version. It
+// carries no database IDs: steps are referenced by step_code, roles by role
+// code and permissions by permission code, so a version tested on staging can
+// be imported on prod-com or prod-ir. Import always creates a new draft.
+const (
+	workflowBundleFormat        = "sangehassan.workflow_template"
+	workflowBundleFormatVersion = 1
+)
+
+type WorkflowTemplateBundle struct {
+	Format               string                              `json:"format"`
+	FormatVersion        int                                 `json:"format_version"`
+	ExportedAt           time.Time                           `json:"exported_at"`
+	Source               WorkflowBundleSource                `json:"source"`
+	Template             WorkflowTemplatePayload             `json:"template"`
+	Steps                []WorkflowBundleStep                `json:"steps"`
+	HandoffMetrics       []HandoffMetricPayload              `json:"handoff_metrics"`
+	WorkflowTasks        []WorkflowBundleLevelTask           `json:"workflow_tasks"`
+	Transitions          []WorkflowBundleTransition          `json:"transitions"`
+	DocumentRequirements []WorkflowBundleDocumentRequirement `json:"document_requirements"`
+}
+type WorkflowBundleSource struct {
+	TemplateID        int64  `json:"template_id"`
+	TemplateGroupCode string `json:"template_group_code"`
+	VersionNumber     int    `json:"version_number"`
+	Status            string `json:"status"`
+}
+type WorkflowBundleStep struct {
+	StepCode               string                        `json:"step_code"`
+	InternalTitleFA        string                        `json:"internal_title_fa"`
+	InternalDescriptionFA  string                        `json:"internal_description_fa"`
+	CustomerTitleFA        string                        `json:"customer_title_fa"`
+	CustomerDescriptionFA  string                        `json:"customer_description_fa"`
+	SequenceNumber         int                           `json:"sequence_number"`
+	ResponsibleRoleCode    string                        `json:"responsible_role_code"`
+	RequiredPermissionCode string                        `json:"required_permission_code"`
+	CustomerVisible        bool                          `json:"customer_visible"`
+	RequiresApproval       bool                          `json:"requires_approval"`
+	ApprovalRoleCode       *string                       `json:"approval_role_code,omitempty"`
+	IsOptional             bool                          `json:"is_optional"`
+	IsSkippable            bool                          `json:"is_skippable"`
+	IsActive               bool                          `json:"is_active"`
+	DefaultDurationHours   int                           `json:"default_duration_hours"`
+	StartsAutomatically    bool                          `json:"starts_automatically"`
+	IsEntry                bool                          `json:"is_entry"`
+	DomainEventCode        *string                       `json:"domain_event_code,omitempty"`
+	JoinMode               string                        `json:"join_mode"`
+	JoinQuorum             *int                          `json:"join_quorum,omitempty"`
+	AssignmentStrategy     string                        `json:"assignment_strategy,omitempty"`
+	CustomerActionable     bool                          `json:"customer_actionable,omitempty"`
+	SLA                    *WorkflowBundleSLA            `json:"sla,omitempty"`
+	ApprovalLevels         []WorkflowBundleApprovalLevel `json:"approval_levels,omitempty"`
+	Fields                 []WorkflowFieldPayload        `json:"fields"`
+	Tasks                  []WorkflowBundleTask          `json:"tasks"`
+}
+type WorkflowBundleSLA struct {
+	SLAHours           int     `json:"sla_hours"`
+	WarnAtPercent      *int    `json:"warn_at_percent,omitempty"`
+	EscalationRoleCode *string `json:"escalation_role_code,omitempty"`
+	ReassignAfterHours *int    `json:"reassign_after_hours,omitempty"`
+	NotifyCustomer     bool    `json:"notify_customer"`
+}
+type WorkflowBundleApprovalLevel struct {
+	LevelNumber       int     `json:"level_number"`
+	ApprovalRoleCode  string  `json:"approval_role_code"`
+	RequiredApprovals int     `json:"required_approvals"`
+	MinOrderAmount    *string `json:"min_order_amount,omitempty"`
+	AmountCurrency    string  `json:"amount_currency"`
+}
+type WorkflowBundleTask struct {
+	TriggerType            string  `json:"trigger_type"`
+	TitleFA                string  `json:"title_fa"`
+	DescriptionFA          string  `json:"description_fa"`
+	AssignedRoleCode       *string `json:"assigned_role_code,omitempty"`
+	RequiredPermissionCode string  `json:"required_permission_code"`
+	Priority               string  `json:"priority"`
+	DueOffsetHours         *int    `json:"due_offset_hours,omitempty"`
+	BlocksStepCompletion   bool    `json:"blocks_step_completion"`
+}
+type WorkflowBundleLevelTask struct {
+	TriggerType            string  `json:"trigger_type"`
+	TitleFA                string  `json:"title_fa"`
+	DescriptionFA          string  `json:"description_fa"`
+	AssignedRoleCode       *string `json:"assigned_role_code,omitempty"`
+	RequiredPermissionCode string  `json:"required_permission_code"`
+	Priority               string  `json:"priority"`
+	DueOffsetHours         *int    `json:"due_offset_hours,omitempty"`
+	BlocksWorkflowProgress bool    `json:"blocks_workflow_progress"`
+}
+type WorkflowBundleTransition struct {
+	SourceStepCode         string  `json:"source_step_code"`
+	TargetStepCode         string  `json:"target_step_code"`
+	TransitionCode         string  `json:"transition_code"`
+	LabelFA                string  `json:"label_fa"`
+	TransitionType         string  `json:"transition_type"`
+	ResultCode             *string `json:"result_code,omitempty"`
+	ConditionExpression    *string `json:"condition_expression,omitempty"`
+	IsDefault              bool    `json:"is_default"`
+	RequiresPermissionCode *string `json:"requires_permission_code,omitempty"`
+	RequiresReason         bool    `json:"requires_reason"`
+	SortOrder              int     `json:"sort_order"`
+}
+type WorkflowBundleDocumentRequirement struct {
+	StepCode        *string `json:"step_code,omitempty"`
+	DocumentType    string  `json:"document_type"`
+	TitleFA         string  `json:"title_fa"`
+	IsRequired      bool    `json:"is_required"`
+	IsBlocking      bool    `json:"is_blocking"`
+	CustomerVisible bool    `json:"customer_visible"`
+	SortOrder       int     `json:"sort_order"`
+}
+
+// WorkflowTemplateImportPayload imports Bundle as a new draft version.
+// RoleMap and PermissionMap rename codes of the source installation to
+// codes of this one; unmapped codes are used as they are. TemplateGroupCode
+// overrides the group of the bundle. DryRun only returns the report.
+type WorkflowTemplateImportPayload struct {
+	Bundle            WorkflowTemplateBundle `json:"bundle"`
+	TemplateGroupCode string                 `json:"template_group_code"`
+	RoleMap           map[string]string      `json:"role_map"`
+	PermissionMap     map[string]string      `json:"permission_map"`
+	DryRun            bool                   `json:"dry_run"`
+}
+type WorkflowImportIssue struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WorkflowTemplateImportReport lists the problems found in a bundle. Errors
+// prevent the import; warnings are publish checks the new draft does not
+// pass yet and can be fixed in the builder.
+type WorkflowTemplateImportReport struct {
+	Valid       bool                  `json:"valid"`
+	DryRun      bool                  `json:"dry_run"`
+	TemplateID  *int64                `json:"template_id,omitempty"`
+	Roles       map[string]string     `json:"roles"`
+	Permissions map[string]string     `json:"permissions"`
+	Errors      []WorkflowImportIssue `json:"errors"`
+	Warnings    []WorkflowImportIssue `json:"warnings"`
+}
+
+func (s *OperationsService) ExportWorkflowTemplate(ctx context.Context, id int64) (WorkflowTemplateBundle, error) {
+	t, err := s.GetWorkflowTemplateVersion(ctx, id)
+	if err != nil {
+		return WorkflowTemplateBundle{}, err
+	}
+	roles := map[int64]string{}
+	rows, err := s.db.QueryContext(ctx, `SELECT id,code FROM roles`)
+	if err != nil {
+		return WorkflowTemplateBundle{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roleID int64
+		var code string
+		if err = rows.Scan(&roleID, &code); err != nil {
+			return WorkflowTemplateBundle{}, err
+		}
+		roles[roleID] = code
+	}
+	if err = rows.Err(); err != nil {
+		return WorkflowTemplateBundle{}, err
+	}
+	roleCode := func(id *int64) *string {
+		if id == nil {
+			return nil
+		}
+		code := roles[*id]
+		return &code
+	}
+	b := WorkflowTemplateBundle{
+		Format: workflowBundleFormat, FormatVersion: workflowBundleFormatVersion, ExportedAt: time.Now().UTC(),
+		Source:   WorkflowBundleSource{TemplateID: t.ID, TemplateGroupCode: t.TemplateGroupCode, VersionNumber: t.VersionNumber, Status: t.Status},
+		Template: WorkflowTemplatePayload{TemplateGroupCode: t.TemplateGroupCode, NameFA: t.NameFA, DescriptionFA: t.DescriptionFA, IconKey: t.IconKey, StartPermissionCode: t.StartPermissionCode, IsActive: t.IsActive, ScopeType: t.ScopeType, MaxIterations: t.MaxIterations},
+		Steps:    []WorkflowBundleStep{}, HandoffMetrics: []HandoffMetricPayload{}, WorkflowTasks: []WorkflowBundleLevelTask{}, Transitions: []WorkflowBundleTransition{}, DocumentRequirements: []WorkflowBundleDocumentRequirement{},
+	}
+	stepCodes := map[int64]string{}
+	for _, st := range t.Steps {
+		stepCodes[st.ID] = st.StepCode
+		bs := WorkflowBundleStep{StepCode: st.StepCode, InternalTitleFA: st.InternalTitleFA, InternalDescriptionFA: st.InternalDescriptionFA, CustomerTitleFA: st.CustomerTitleFA, CustomerDescriptionFA: st.CustomerDescriptionFA, SequenceNumber: st.SequenceNumber, ResponsibleRoleCode: st.ResponsibleRoleCode, RequiredPermissionCode: st.RequiredPermissionCode, CustomerVisible: st.CustomerVisible, RequiresApproval: st.RequiresApproval, ApprovalRoleCode: roleCode(st.ApprovalRoleID), IsOptional: st.IsOptional, IsSkippable: st.IsSkippable, IsActive: st.IsActive, DefaultDurationHours: st.DefaultDurationHours, StartsAutomatically: st.StartsAutomatically, IsEntry: st.IsEntry, DomainEventCode: st.DomainEventCode, JoinMode: st.JoinMode, JoinQuorum: st.JoinQuorum, AssignmentStrategy: st.AssignmentStrategy, CustomerActionable: st.CustomerActionable, Fields: []WorkflowFieldPayload{}, Tasks: []WorkflowBundleTask{}}
+		if st.SLA != nil {
+			bs.SLA = &WorkflowBundleSLA{SLAHours: st.SLA.SLAHours, WarnAtPercent: st.SLA.WarnAtPercent, EscalationRoleCode: roleCode(st.SLA.EscalationRoleID), ReassignAfterHours: st.SLA.ReassignAfterHours, NotifyCustomer: st.SLA.NotifyCustomer}
+		}
+		for _, l := range st.ApprovalLevels {
+			bs.ApprovalLevels = append(bs.ApprovalLevels, WorkflowBundleApprovalLevel{LevelNumber: l.LevelNumber, ApprovalRoleCode: *roleCode(&l.ApprovalRoleID), RequiredApprovals: l.RequiredApprovals, MinOrderAmount: l.MinOrderAmount, AmountCurrency: l.AmountCurrency})
+		}
+		for _, f := range st.Fields {
+			bs.Fields = append(bs.Fields, WorkflowFieldPayload{FieldKey: f.FieldKey, LabelFA: f.LabelFA, DescriptionFA: f.DescriptionFA, FieldType: f.FieldType, IsRequired: f.IsRequired, IsCustomerVisible: f.IsCustomerVisible, IsSalesVisible: f.IsSalesVisible, IsInternalCost: f.IsInternalCost, UnitCode: f.UnitCode, CurrencyCode: f.CurrencyCode, PlaceholderFA: f.PlaceholderFA, DefaultValue: f.DefaultValue, OptionsJSON: f.OptionsJSON, ValidationJSON: f.ValidationJSON, SortOrder: f.SortOrder, HandoffMetricKey: f.HandoffMetricKey, HandoffDirection: f.HandoffDirection})
+		}
+		for _, task := range st.Tasks {
+			bs.Tasks = append(bs.Tasks, WorkflowBundleTask{TriggerType: task.TriggerType, TitleFA: task.TitleFA, DescriptionFA: task.DescriptionFA, AssignedRoleCode: roleCode(task.AssignedRoleID), RequiredPermissionCode: task.RequiredPermissionCode, Priority: task.Priority, DueOffsetHours: task.DueOffsetHours, BlocksStepCompletion: task.BlocksStepCompletion})
+		}
+		b.Steps = append(b.Steps, bs)
+	}
+	for _, m := range t.Metrics {
+		b.HandoffMetrics = append(b.HandoffMetrics, HandoffMetricPayload{MetricKey: m.MetricKey, LabelFA: m.LabelFA, UnitCode: m.UnitCode, AbsoluteTolerance: m.AbsoluteTolerance, PercentageTolerance: m.PercentageTolerance, BlockingOnMismatch: m.BlockingOnMismatch})
+	}
+	for _, task := range t.Tasks {
+		b.WorkflowTasks = append(b.WorkflowTasks, WorkflowBundleLevelTask{TriggerType: task.TriggerType, TitleFA: task.TitleFA, DescriptionFA: task.DescriptionFA, AssignedRoleCode: roleCode(task.AssignedRoleID), RequiredPermissionCode: task.RequiredPermissionCode, Priority: task.Priority, DueOffsetHours: task.DueOffsetHours, BlocksWorkflowProgress: task.BlocksWorkflowProgress})
+	}
+	for _, tr := range t.Transitions {
+		b.Transitions = append(b.Transitions, WorkflowBundleTransition{SourceStepCode: stepCodes[tr.SourceStepID], TargetStepCode: stepCodes[tr.TargetStepID], TransitionCode: tr.TransitionCode, LabelFA: tr.LabelFA, TransitionType: tr.TransitionType, ResultCode: tr.ResultCode, ConditionExpression: tr.ConditionExpression, IsDefault: tr.IsDefault, RequiresPermissionCode: tr.RequiresPermissionCode, RequiresReason: tr.RequiresReason, SortOrder: tr.SortOrder})
+	}
+	docs, err := s.db.QueryContext(ctx, `SELECT s.step_code,r.document_type,r.title_fa,r.is_required,r.is_blocking,r.customer_visible,r.sort_order FROM workflow_template_document_requirements r LEFT JOIN workflow_template_steps s ON s.id=r.workflow_template_step_id WHERE r.workflow_template_id=$1 ORDER BY r.sort_order,r.id`, id)
+	if err != nil {
+		return WorkflowTemplateBundle{}, err
+	}
+	defer docs.Close()
+	for docs.Next() {
+		var d WorkflowBundleDocumentRequirement
+		var step sql.NullString
+		if err = docs.Scan(&step, &d.DocumentType, &d.TitleFA, &d.IsRequired, &d.IsBlocking, &d.CustomerVisible, &d.SortOrder); err != nil {
+			return WorkflowTemplateBundle{}, err
+		}
+		d.StepCode = scanNullableString(step)
+		b.DocumentRequirements = append(b.DocumentRequirements, d)
+	}
+	return b, docs.Err()
+}
+
+// bundleRoleCodes and bundlePermissionCodes list every code a bundle refers
+// to, keyed by the path of the first reference.
+func bundleRoleCodes(b WorkflowTemplateBundle) map[string]string {
+	out := map[string]string{}
+	add := func(path string, code *string) {
+		if code != nil && *code != "" {
+			if _, seen := out[*code]; !seen {
+				out[*code] = path
+			}
+		}
+	}
+	for i, st := range b.Steps {
+		add(fmt.Sprintf("steps[%d].responsible_role_code", i), &st.ResponsibleRoleCode)
+		add(fmt.Sprintf("steps[%d].approval_role_code", i), st.ApprovalRoleCode)
+		if st.SLA != nil {
+			add(fmt.Sprintf("steps[%d].sla.escalation_role_code", i), st.SLA.EscalationRoleCode)
+		}
+		for j, l := range st.ApprovalLevels {
+			add(fmt.Sprintf("steps[%d].approval_levels[%d].approval_role_code", i, j), &l.ApprovalRoleCode)
+		}
+		for j, task := range st.Tasks {
+			add(fmt.Sprintf("steps[%d].tasks[%d].assigned_role_code", i, j), task.AssignedRoleCode)
+		}
+	}
+	for i, task := range b.WorkflowTasks {
+		add(fmt.Sprintf("workflow_tasks[%d].assigned_role_code", i), task.AssignedRoleCode)
+	}
+	return out
+}
+
+func bundlePermissionCodes(b WorkflowTemplateBundle) map[string]string {
+	out := map[string]string{}
+	add := func(path string, code *string) {
+		if code != nil && *code != "" {
+			if _, seen := out[*code]; !seen {
+				out[*code] = path
+			}
+		}
+	}
+	add("template.start_permission_code", &b.Template.StartPermissionCode)
+	for i, st := range b.Steps {
+		add(fmt.Sprintf("steps[%d].required_permission_code", i), &st.RequiredPermissionCode)
+		for j, task := range st.Tasks {
+			add(fmt.Sprintf("steps[%d].tasks[%d].required_permission_code", i, j), &task.RequiredPermissionCode)
+		}
+	}
+	for i, task := range b.WorkflowTasks {
+		add(fmt.Sprintf("workflow_tasks[%d].required_permission_code", i), &task.RequiredPermissionCode)
+	}
+	for i, tr := range b.Transitions {
+		add(fmt.Sprintf("transitions[%d].requires_permission_code", i), tr.RequiresPermissionCode)
+	}
+	return out
+}
+
+// validateWorkflowBundle checks a bundle on its own, without the database:
+// the format, codes, references between steps and the same field, task,
+// SLA and transition rules the builder applies one call at a time.
+func validateWorkflowBundle(b WorkflowTemplateBundle) []WorkflowImportIssue {
+	issues := []WorkflowImportIssue{}
+	fail := func(path, code, message string) {
+		issues = append(issues, WorkflowImportIssue{Path: path, Code: code, Message: message})
+	}
+	if b.Format != workflowBundleFormat {
+		fail("format", "BUNDLE_FORMAT", "not a workflow template bundle")
+		return issues
+	}
+	if b.FormatVersion != workflowBundleFormatVersion {
+		fail("format_version", "BUNDLE_VERSION", fmt.Sprintf("bundle format version %d is not supported", b.FormatVersion))
+		return issues
+	}
+	if !codePattern.MatchString(strings.ToLower(strings.TrimSpace(b.Template.TemplateGroupCode))) || strings.TrimSpace(b.Template.NameFA) == "" || strings.TrimSpace(b.Template.StartPermissionCode) == "" {
+		fail("template", "TEMPLATE_INVALID", "template group code, name and start permission are required")
+	}
+	metrics := map[string]bool{}
+	for i, m := range b.HandoffMetrics {
+		if !codePattern.MatchString(m.MetricKey) || m.LabelFA == "" || m.UnitCode == "" || metrics[m.MetricKey] {
+			fail(fmt.Sprintf("handoff_metrics[%d]", i), "METRIC_INVALID", "invalid or duplicate handoff metric")
+		}
+		metrics[m.MetricKey] = true
+	}
+	steps := map[string]int{}
+	for i, st := range b.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		code := strings.ToUpper(st.StepCode)
+		if !codePattern.MatchString(strings.ToLower(st.StepCode)) || st.InternalTitleFA == "" || st.ResponsibleRoleCode == "" || st.RequiredPermissionCode == "" {
+			fail(path, "STEP_INVALID", "step code, title, role and permission are required")
+		}
+		if _, dup := steps[code]; dup {
+			fail(path+".step_code", "STEP_DUPLICATE", "duplicate step code "+code)
+		}
+		steps[code] = i
+		join := WorkflowStepPayload{JoinMode: st.JoinMode, JoinQuorum: st.JoinQuorum, AssignmentStrategy: st.AssignmentStrategy}
+		if err := normalizeStepJoin(&join); err != nil {
+			fail(path+".join_mode", "STEP_JOIN", err.Error())
+		}
+		if err := normalizeStepAssignment(&join); err != nil {
+			fail(path+".assignment_strategy", "STEP_ASSIGNMENT", err.Error())
+		}
+		if st.CustomerActionable {
+			check := WorkflowTemplateStepV2{StepCode: code, CustomerVisible: st.CustomerVisible, CustomerActionable: true, DomainEventCode: st.DomainEventCode}
+			for _, f := range st.Fields {
+				check.Fields = append(check.Fields, WorkflowFieldDefinition{FieldKey: f.FieldKey, FieldType: f.FieldType, IsRequired: f.IsRequired, IsCustomerVisible: f.IsCustomerVisible})
+			}
+			if err := validateCustomerActionableStep(check); err != nil {
+				fail(path+".customer_actionable", "STEP_CUSTOMER_ACTION", err.Error())
+			}
+		}
+		if st.RequiresApproval && st.ApprovalRoleCode == nil {
+			fail(path+".approval_role_code", "STEP_APPROVAL_ROLE", "approval steps need an approval role")
+		}
+		if st.SLA != nil {
+			if err := validateSLAPolicy(WorkflowStepSLAPolicy{SLAHours: st.SLA.SLAHours, WarnAtPercent: st.SLA.WarnAtPercent, ReassignAfterHours: st.SLA.ReassignAfterHours}); err != nil {
+				fail(path+".sla", "SLA_INVALID", err.Error())
+			}
+			if st.SLA.ReassignAfterHours != nil && st.SLA.EscalationRoleCode == nil {
+				fail(path+".sla", "SLA_INVALID", "reassignment needs an escalation role")
+			}
+		}
+		if len(st.ApprovalLevels) > 0 {
+			levels := make([]WorkflowStepApprovalLevel, len(st.ApprovalLevels))
+			for j, l := range st.ApprovalLevels {
+				levels[j] = WorkflowStepApprovalLevel{LevelNumber: l.LevelNumber, ApprovalRoleID: 1, RequiredApprovals: l.RequiredApprovals, MinOrderAmount: l.MinOrderAmount, AmountCurrency: l.AmountCurrency}
+				if l.ApprovalRoleCode == "" {
+					fail(fmt.Sprintf("%s.approval_levels[%d]", path, j), "APPROVAL_LEVEL_INVALID", "approval levels need an approval role")
+				}
+			}
+			if err := normalizeApprovalLevels(levels); err != nil {
+				fail(path+".approval_levels", "APPROVAL_LEVEL_INVALID", err.Error())
+			}
+			if !st.RequiresApproval {
+				fail(path+".approval_levels", "APPROVAL_LEVEL_INVALID", "approval levels need a step that requires approval")
+			}
+		}
+		keys := map[string]bool{}
+		for j, f := range st.Fields {
+			if err := validateFieldDefinition(f.FieldKey, f.FieldType, f.OptionsJSON, f.ValidationJSON, f.HandoffMetricKey, f.HandoffDirection, f.UnitCode, f.CurrencyCode, f.IsInternalCost, f.IsCustomerVisible, metrics); err != nil {
+				fail(fmt.Sprintf("%s.fields[%d]", path, j), "FIELD_INVALID", err.Error())
+			}
+			if keys[f.FieldKey] {
+				fail(fmt.Sprintf("%s.fields[%d]", path, j), "FIELD_DUPLICATE", "duplicate field key "+f.FieldKey)
+			}
+			keys[f.FieldKey] = true
+		}
+		for j, task := range st.Tasks {
+			if !stepTriggerTypes[task.TriggerType] || task.TitleFA == "" || (task.BlocksStepCompletion && (task.TriggerType == "ON_STEP_APPROVE" || task.TriggerType == "ON_STEP_COMPLETE")) {
+				fail(fmt.Sprintf("%s.tasks[%d]", path, j), "TASK_INVALID", "invalid step task")
+			}
+		}
+	}
+	for i, task := range b.WorkflowTasks {
+		if task.TriggerType != "ON_WORKFLOW_START" || strings.TrimSpace(task.TitleFA) == "" || task.AssignedRoleCode == nil || task.RequiredPermissionCode == "" {
+			fail(fmt.Sprintf("workflow_tasks[%d]", i), "TASK_INVALID", "invalid workflow task")
+		}
+	}
+	for i, tr := range b.Transitions {
+		path := fmt.Sprintf("transitions[%d]", i)
+		source, okSource := steps[strings.ToUpper(tr.SourceStepCode)]
+		target, okTarget := steps[strings.ToUpper(tr.TargetStepCode)]
+		if !okSource || !okTarget {
+			fail(path, "TRANSITION_STEP", "transition refers to a step that is not in the bundle")
+			continue
+		}
+		p := WorkflowTransitionPayload{SourceStepID: int64(source + 1), TargetStepID: int64(target + 1), TransitionCode: tr.TransitionCode, LabelFA: tr.LabelFA, TransitionType: tr.TransitionType, ResultCode: tr.ResultCode, ConditionExpression: tr.ConditionExpression, IsDefault: tr.IsDefault, RequiresPermissionCode: tr.RequiresPermissionCode, RequiresReason: tr.RequiresReason, SortOrder: tr.SortOrder}
+		if err := validateTransitionPayload(p); err != nil {
+			fail(path, "TRANSITION_INVALID", err.Error())
+		}
+	}
+	for i, d := range b.DocumentRequirements {
+		path := fmt.Sprintf("document_requirements[%d]", i)
+		if !allowedDocumentTypes[normalizeCode(d.DocumentType)] || strings.TrimSpace(d.TitleFA) == "" {
+			fail(path, "DOCUMENT_INVALID", "invalid document requirement")
+		}
+		if d.StepCode != nil {
+			if _, ok := steps[strings.ToUpper(*d.StepCode)]; !ok {
+				fail(path+".step_code", "DOCUMENT_STEP", "document requirement refers to a step that is not in the bundle")
+			}
+		}
+	}
+	return issues
+}
+
+func mappedCode(mapping map[string]string, code string) string {
+	if target := strings.TrimSpace(mapping[code]); target != "" {
+		return target
+	}
+	return code
+}
+
+// ImportWorkflowTemplate validates a bundle, maps its role and permission
+// codes onto this installation and, unless it is a dry run or an error was
+// found, creates the bundle as the next draft version of its group.
+func (s *OperationsService) ImportWorkflowTemplate(ctx context.Context, actor string, p WorkflowTemplateImportPayload) (WorkflowTemplateImportReport, error) {
+	b := p.Bundle
+	if group := strings.ToLower(strings.TrimSpace(p.TemplateGroupCode)); group != "" {
+		b.Template.TemplateGroupCode = group
+	}
+	b.Template.TemplateGroupCode = strings.ToLower(strings.TrimSpace(b.Template.TemplateGroupCode))
+	report := WorkflowTemplateImportReport{DryRun: p.DryRun, Roles: map[string]string{}, Permissions: map[string]string{}, Errors: validateWorkflowBundle(b), Warnings: []WorkflowImportIssue{}}
+	roleIDs := map[string]int64{}
+	for code, path := range bundleRoleCodes(b) {
+		target := mappedCode(p.RoleMap, code)
+		var id int64
+		err := s.db.QueryRowContext(ctx, `SELECT id FROM roles WHERE code=$1 AND is_active`, target).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			report.Errors = append(report.Errors, WorkflowImportIssue{Path: path, Code: "ROLE_NOT_FOUND", Message: "role " + target + " does not exist here; map it with role_map"})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Roles[code], roleIDs[code] = target, id
+	}
+	for code, path := range bundlePermissionCodes(b) {
+		target := mappedCode(p.PermissionMap, code)
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM permissions WHERE code=$1 AND is_active)`, target).Scan(&exists); err != nil {
+			return report, err
+		}
+		if !exists {
+			report.Errors = append(report.Errors, WorkflowImportIssue{Path: path, Code: "PERMISSION_NOT_FOUND", Message: "permission " + target + " does not exist here; map it with permission_map"})
+			continue
+		}
+		report.Permissions[code] = target
+	}
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Path < report.Errors[j].Path })
+	report.Valid = len(report.Errors) == 0
+	if !report.Valid || p.DryRun {
+		return report, nil
+	}
+	role := func(code *string) *int64 {
+		if code == nil || *code == "" {
+			return nil
+		}
+		id := roleIDs[*code]
+		return &id
+	}
+	permission := func(code string) string { return mappedCode(report.Permissions, code) }
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+	t := b.Template
+	if t.ScopeType == "" {
+		t.ScopeType = "ORDER"
+	}
+	if t.MaxIterations == 0 {
+		t.MaxIterations = 20
+	}
+	var version int
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_number),0)+1 FROM workflow_templates WHERE template_group_code=$1`, t.TemplateGroupCode).Scan(&version); err != nil {
+		return report, err
+	}
+	var templateID int64
+	if err = tx.QueryRowContext(ctx, `INSERT INTO workflow_templates(template_group_code,version_number,code,name_fa,description_fa,icon_key,status,start_permission_code,is_active,created_by_user_id,scope_type,max_iterations) VALUES($1,$2,$3,$4,$5,$6,'DRAFT',$7,$8,$9,$10,$11) RETURNING id`, t.TemplateGroupCode, version, fmt.Sprintf("%s_v%d", t.TemplateGroupCode, version), t.NameFA, t.DescriptionFA, t.IconKey, permission(t.StartPermissionCode), t.IsActive, actor, normalizeCode(t.ScopeType), t.MaxIterations).Scan(&templateID); err != nil {
+		return report, err
+	}
+	for _, m := range b.HandoffMetrics {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_handoff_metric_definitions(workflow_template_id,metric_key,label_fa,unit_code,absolute_tolerance,percentage_tolerance,blocking_on_mismatch) VALUES($1,$2,$3,$4,$5,$6,$7)`, templateID, m.MetricKey, m.LabelFA, m.UnitCode, m.AbsoluteTolerance, m.PercentageTolerance, m.BlockingOnMismatch); err != nil {
+			return report, err
+		}
+	}
+	stepIDs := map[string]int64{}
+	for i, st := range b.Steps {
+		join := WorkflowStepPayload{JoinMode: st.JoinMode, JoinQuorum: st.JoinQuorum, AssignmentStrategy: st.AssignmentStrategy}
+		_ = normalizeStepJoin(&join)
+		_ = normalizeStepAssignment(&join)
+		if st.DefaultDurationHours <= 0 {
+			st.DefaultDurationHours = 24
+		}
+		if st.SequenceNumber <= 0 {
+			st.SequenceNumber = i + 1
+		}
+		code := strings.ToUpper(st.StepCode)
+		var stepID int64
+		if err = tx.QueryRowContext(ctx, `INSERT INTO workflow_template_steps(workflow_template_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,responsible_role_id,responsible_role_code,required_permission_code,customer_visible,is_first_step,requires_approval,approval_role_id,is_optional,is_skippable,is_active,default_duration_hours,starts_automatically,is_entry,domain_event_code,join_mode,join_quorum,assignment_strategy,customer_actionable) SELECT $1,$2,$3,$4,$5,$6,$7,$8,r.code,$9,$10,$18,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23 FROM roles r WHERE r.id=$8 RETURNING id`, templateID, code, st.InternalTitleFA, st.InternalDescriptionFA, st.CustomerTitleFA, st.CustomerDescriptionFA, st.SequenceNumber, role(&st.ResponsibleRoleCode), permission(st.RequiredPermissionCode), st.CustomerVisible, st.RequiresApproval, role(st.ApprovalRoleCode), st.IsOptional, st.IsSkippable, st.IsActive, st.DefaultDurationHours, st.StartsAutomatically, st.IsEntry, st.DomainEventCode, join.JoinMode, join.JoinQuorum, join.AssignmentStrategy, st.CustomerActionable).Scan(&stepID); err != nil {
+			return report, err
+		}
+		stepIDs[code] = stepID
+		for _, f := range st.Fields {
+			if len(f.ValidationJSON) == 0 {
+				f.ValidationJSON = []byte(`{}`)
+			}
+			if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_field_definitions(workflow_template_step_id,field_key,label_fa,description_fa,field_type,is_required,is_customer_visible,is_sales_visible,is_internal_cost,unit_code,currency_code,placeholder_fa,default_value,options_json,validation_json,sort_order,handoff_metric_key,handoff_direction) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)`, stepID, f.FieldKey, f.LabelFA, f.DescriptionFA, f.FieldType, f.IsRequired, f.IsCustomerVisible, f.IsSalesVisible, f.IsInternalCost, f.UnitCode, f.CurrencyCode, f.PlaceholderFA, nullableJSON(f.DefaultValue), nullableJSON(f.OptionsJSON), f.ValidationJSON, f.SortOrder, f.HandoffMetricKey, f.HandoffDirection); err != nil {
+				return report, err
+			}
+		}
+		for _, task := range st.Tasks {
+			if task.Priority == "" {
+				task.Priority = "NORMAL"
+			}
+			if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_task_templates(workflow_template_step_id,trigger_type,title_fa,description_fa,assigned_role_id,required_permission_code,priority,due_offset_hours,blocks_step_completion) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)`, stepID, task.TriggerType, task.TitleFA, task.DescriptionFA, role(task.AssignedRoleCode), permission(task.RequiredPermissionCode), task.Priority, task.DueOffsetHours, task.BlocksStepCompletion); err != nil {
+				return report, err
+			}
+		}
+		if st.SLA != nil {
+			if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_sla_policies(workflow_template_step_id,sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer) VALUES($1,$2,$3,$4,$5,$6)`, stepID, st.SLA.SLAHours, st.SLA.WarnAtPercent, role(st.SLA.EscalationRoleCode), st.SLA.ReassignAfterHours, st.SLA.NotifyCustomer); err != nil {
+				return report, err
+			}
+		}
+		levels := make([]WorkflowStepApprovalLevel, 0, len(st.ApprovalLevels))
+		for _, l := range st.ApprovalLevels {
+			if id := role(&l.ApprovalRoleCode); id != nil {
+				levels = append(levels, WorkflowStepApprovalLevel{LevelNumber: l.LevelNumber, ApprovalRoleID: *id, RequiredApprovals: l.RequiredApprovals, MinOrderAmount: l.MinOrderAmount, AmountCurrency: l.AmountCurrency})
+			}
+		}
+		if err = normalizeApprovalLevels(levels); err != nil {
+			return report, err
+		}
+		for _, level := range levels {
+			if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_approval_levels(workflow_template_step_id,level_number,approval_role_id,required_approvals,min_order_amount,amount_currency) VALUES($1,$2,$3,$4,$5,$6)`, stepID, level.LevelNumber, level.ApprovalRoleID, level.RequiredApprovals, level.MinOrderAmount, level.AmountCurrency); err != nil {
+				return report, err
+			}
+		}
+	}
+	for _, task := range b.WorkflowTasks {
+		if task.Priority == "" {
+			task.Priority = "NORMAL"
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_task_templates(workflow_template_id,trigger_type,title_fa,description_fa,assigned_role_id,required_permission_code,priority,due_offset_hours,blocks_workflow_progress) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)`, templateID, task.TriggerType, task.TitleFA, task.DescriptionFA, role(task.AssignedRoleCode), permission(task.RequiredPermissionCode), task.Priority, task.DueOffsetHours, task.BlocksWorkflowProgress); err != nil {
+			return report, err
+		}
+	}
+	for _, tr := range b.Transitions {
+		var requires *string
+		if tr.RequiresPermissionCode != nil {
+			v := permission(*tr.RequiresPermissionCode)
+			requires = &v
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_transitions(workflow_template_id,source_step_id,target_step_id,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order,condition_expression) VALUES($1,$2,$3,UPPER($4),$5,$6,NULLIF(UPPER($7),''),$8,$9,$10,$11,$12)`, templateID, stepIDs[strings.ToUpper(tr.SourceStepCode)], stepIDs[strings.ToUpper(tr.TargetStepCode)], tr.TransitionCode, tr.LabelFA, normalizeCode(tr.TransitionType), valueOrNil(tr.ResultCode), tr.IsDefault, requires, tr.RequiresReason, tr.SortOrder, tr.ConditionExpression); err != nil {
+			return report, err
+		}
+	}
+	for _, d := range b.DocumentRequirements {
+		var stepID *int64
+		if d.StepCode != nil {
+			v := stepIDs[strings.ToUpper(*d.StepCode)]
+			stepID = &v
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_template_document_requirements(workflow_template_id,workflow_template_step_id,document_type,title_fa,is_required,is_blocking,customer_visible,sort_order) VALUES($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT(workflow_template_id,workflow_template_step_id,document_type) DO NOTHING`, templateID, stepID, normalizeCode(d.DocumentType), d.TitleFA, d.IsRequired, d.IsBlocking, d.CustomerVisible, d.SortOrder); err != nil {
+			return report, err
+		}
+	}
+	s.auditTx(ctx, tx, actor, "workflow_templates.import", "workflow_template", fmt.Sprint(templateID), nil, map[string]any{"source": b.Source, "exported_at": b.ExportedAt, "roles": report.Roles, "permissions": report.Permissions})
+	if err = tx.Commit(); err != nil {
+		return report, err
+	}
+	report.TemplateID = &templateID
+	imported, err := s.GetWorkflowTemplateVersion(ctx, templateID)
+	if err != nil {
+		return report, err
+	}
+	if err = validateTemplateForPublish(imported); err == nil {
+		err = s.validateTemplateReferences(ctx, templateID)
+	}
+	if err != nil {
+		report.Warnings = append(report.Warnings, WorkflowImportIssue{Path: "template", Code: "NOT_PUBLISHABLE", Message: err.Error()})
+	}
+	return report, nil
+}
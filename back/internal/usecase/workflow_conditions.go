@@ -0,0 +1,594 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition expressions route CONDITIONAL transitions from the values
+// submitted on their source step. The language has no functions, loops or
+// assignments: field references (field_key, or field_key.member for object
+// values such as qc.result or tonnage.unit), string, number, true, false and
+// null literals, the comparisons == != < <= > >=, and/or/not, and
+// parentheses. Measurement and money fields compare as numbers through
+// their value or amount. Comparisons between mismatched types, or against a
+// field that was not submitted, are false rather than errors, so a condition
+// never blocks a submission.
+const (
+	maxConditionLength = 1000
+	maxConditionDepth  = 32
+)
+
+// conditionMembers lists the members an object-valued field exposes.
+var conditionMembers = map[string][]string{
+	"WEIGHT": {"value", "unit"}, "AREA": {"value", "unit"}, "VOLUME": {"value", "unit"}, "QUANTITY": {"value", "unit"}, "COMPUTED": {"value", "unit"},
+	"MONEY":    {"amount", "currency"},
+	"QC_CHECK": {"result", "measuredValue", "note"},
+}
+
+type conditionToken struct {
+	kind string // ident, number, string, op, eof
+	text string
+	num  float64
+	pos  int
+}
+
+func tokenizeCondition(src string) ([]conditionToken, error) {
+	out := []conditionToken{}
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			out = append(out, conditionToken{kind: "ident", text: string(runes[start:i]), pos: start})
+		case r >= '0' && r <= '9' || r == '-' && i+1 < len(runes) && runes[i+1] >= '0' && runes[i+1] <= '9':
+			start := i
+			i++
+			for i < len(runes) && (runes[i] >= '0' && runes[i] <= '9' || runes[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at %d", start)
+			}
+			out = append(out, conditionToken{kind: "number", num: n, pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var b strings.Builder
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			out = append(out, conditionToken{kind: "string", text: b.String(), pos: start})
+		case r == '(' || r == ')':
+			out = append(out, conditionToken{kind: "op", text: string(r), pos: i})
+			i++
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			out = append(out, conditionToken{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(out, conditionToken{kind: "eof", pos: len(runes)}), nil
+}
+
+// conditionNode is a parsed expression. Literals carry their value; field
+// references carry the field key and optional member.
+type conditionNode struct {
+	op          string // literal, field, not, and, or, or a comparison
+	value       any
+	field       string
+	member      string
+	left, right *conditionNode
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	depth  int
+}
+
+func parseCondition(src string) (*conditionNode, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("condition is empty")
+	}
+	if len(src) > maxConditionLength {
+		return nil, fmt.Errorf("condition is longer than %d characters", maxConditionLength)
+	}
+	tokens, err := tokenizeCondition(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected token at %d", t.pos)
+	}
+	return node, nil
+}
+
+func (p *conditionParser) peek() conditionToken { return p.tokens[p.pos] }
+
+func (p *conditionParser) keyword(words ...string) (string, bool) {
+	t := p.peek()
+	for _, w := range words {
+		if (t.kind == "op" && t.text == w) || (t.kind == "ident" && strings.EqualFold(t.text, w)) {
+			p.pos++
+			return w, true
+		}
+	}
+	return "", false
+}
+
+func (p *conditionParser) or() (*conditionNode, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.keyword("or", "||"); !ok {
+			break
+		}
+		var right *conditionNode
+		if right, err = p.and(); err == nil {
+			left = &conditionNode{op: "or", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) and() (*conditionNode, error) {
+	left, err := p.not()
+	for err == nil {
+		if _, ok := p.keyword("and", "&&"); !ok {
+			break
+		}
+		var right *conditionNode
+		if right, err = p.not(); err == nil {
+			left = &conditionNode{op: "and", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) not() (*conditionNode, error) {
+	if _, ok := p.keyword("not", "!"); ok {
+		if p.depth++; p.depth > maxConditionDepth {
+			return nil, errors.New("condition is nested too deeply")
+		}
+		defer func() { p.depth-- }()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionNode{op: "not", left: operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *conditionParser) comparison() (*conditionNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.keyword("==", "!=", "<=", ">=", "<", ">"); ok {
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) operand() (*conditionNode, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case "number":
+		return &conditionNode{op: "literal", value: t.num}, nil
+	case "string":
+		return &conditionNode{op: "literal", value: t.text}, nil
+	case "ident":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return &conditionNode{op: "literal", value: true}, nil
+		case "false":
+			return &conditionNode{op: "literal", value: false}, nil
+		case "null":
+			return &conditionNode{op: "literal", value: nil}, nil
+		case "and", "or", "not":
+			return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+		}
+		key, member, _ := strings.Cut(t.text, ".")
+		if !codePattern.MatchString(key) || strings.Contains(member, ".") {
+			return nil, fmt.Errorf("invalid field reference %q", t.text)
+		}
+		return &conditionNode{op: "field", field: key, member: member}, nil
+	case "op":
+		if t.text == "(" {
+			if p.depth++; p.depth > maxConditionDepth {
+				return nil, errors.New("condition is nested too deeply")
+			}
+			node, err := p.or()
+			p.depth--
+			if err != nil {
+				return nil, err
+			}
+			if end := p.peek(); end.kind != "op" || end.text != ")" {
+				return nil, fmt.Errorf("missing ) at %d", end.pos)
+			}
+			p.pos++
+			return node, nil
+		}
+	case "eof":
+		return nil, errors.New("condition ends unexpectedly")
+	}
+	return nil, fmt.Errorf("unexpected token at %d", t.pos)
+}
+
+// fields returns the field references in the expression.
+func (n *conditionNode) fields(out map[string][]string) map[string][]string {
+	if n == nil {
+		return out
+	}
+	if n.op == "field" {
+		out[n.field] = append(out[n.field], n.member)
+	}
+	n.left.fields(out)
+	n.right.fields(out)
+	return out
+}
+
+// validateConditionFields checks field references against the source step's
+// field definitions, keyed by field_key with the field type as value.
+func validateConditionFields(node *conditionNode, fieldTypes map[string]string) error {
+	for key, members := range node.fields(map[string][]string{}) {
+		kind, ok := fieldTypes[key]
+		if !ok {
+			return fmt.Errorf("unknown field %s", key)
+		}
+		for _, member := range members {
+			if member == "" {
+				continue
+			}
+			valid := false
+			for _, allowed := range conditionMembers[kind] {
+				valid = valid || allowed == member
+			}
+			if !valid {
+				return fmt.Errorf("field %s has no member %s", key, member)
+			}
+		}
+	}
+	return nil
+}
+
+func (n *conditionNode) eval(values map[string]any) any {
+	switch n.op {
+	case "literal":
+		return n.value
+	case "field":
+		v := values[n.field]
+		if n.member == "" {
+			return v
+		}
+		if object, ok := v.(map[string]any); ok {
+			return object[n.member]
+		}
+		return nil
+	case "not":
+		return !conditionTrue(n.left.eval(values))
+	case "and":
+		return conditionTrue(n.left.eval(values)) && conditionTrue(n.right.eval(values))
+	case "or":
+		return conditionTrue(n.left.eval(values)) || conditionTrue(n.right.eval(values))
+	}
+	return compareConditionValues(n.op, n.left.eval(values), n.right.eval(values))
+}
+
+func conditionTrue(v any) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// conditionNumber reads a number, a decimal string such as a QC measured
+// value (accepted by the same rule as field validation), or the value or
+// amount of a measurement or money object.
+func conditionNumber(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		r, ok := new(big.Rat).SetString(strings.TrimSpace(x))
+		if !ok {
+			return 0, false
+		}
+		n, _ := r.Float64()
+		return n, true
+	case map[string]any:
+		for _, k := range []string{"value", "amount"} {
+			if n, ok := conditionNumber(x[k]); ok {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareConditionValues(op string, left, right any) bool {
+	_, leftText := left.(string)
+	_, rightText := right.(string)
+	// Two strings compare as text below; a string meets a number as one.
+	if l, ok := conditionNumber(left); ok && !(leftText && rightText) {
+		if r, ok := conditionNumber(right); ok {
+			switch op {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+			return false
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			// Strings order lexically, which is also date order for DATE,
+			// TIME and DATETIME values.
+			switch op {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+			return false
+		}
+	}
+	switch op {
+	case "==":
+		return conditionEqual(left, right)
+	case "!=":
+		return !conditionEqual(left, right)
+	}
+	return false
+}
+
+func conditionEqual(left, right any) bool {
+	switch l := left.(type) {
+	case nil:
+		return right == nil
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	}
+	return false
+}
+
+// evaluateCondition parses and evaluates src against submitted values.
+func evaluateCondition(src string, values map[string]json.RawMessage) (bool, error) {
+	node, err := parseCondition(src)
+	if err != nil {
+		return false, err
+	}
+	decoded := map[string]any{}
+	for key, raw := range values {
+		var v any
+		if json.Unmarshal(raw, &v) == nil {
+			decoded[key] = v
+		}
+	}
+	return conditionTrue(node.eval(decoded)), nil
+}
+
+// validateWorkflowConditions parses every CONDITIONAL transition and checks
+// its field references against the fields of its source step. A step routed
+// by conditions also needs a default AUTOMATIC or a MANUAL_SELECTION
+// transition to take when none of them matches; without one the step could
+// never be completed.
+func validateWorkflowConditions(steps []WorkflowTemplateStepV2, transitions []WorkflowTransitionDefinition) error {
+	fields := map[int64]map[string]string{}
+	codes := map[int64]string{}
+	for _, st := range steps {
+		codes[st.ID] = st.StepCode
+		fields[st.ID] = map[string]string{}
+		for _, f := range st.Fields {
+			fields[st.ID][f.FieldKey] = f.FieldType
+		}
+	}
+	for _, t := range transitions {
+		if t.TransitionType != "CONDITIONAL" {
+			continue
+		}
+		if t.ConditionExpression == nil {
+			return fmt.Errorf("transition %s requires a condition", t.TransitionCode)
+		}
+		node, err := parseCondition(*t.ConditionExpression)
+		if err == nil {
+			err = validateConditionFields(node, fields[t.SourceStepID])
+		}
+		if err != nil {
+			return fmt.Errorf("transition %s from step %s: %w", t.TransitionCode, codes[t.SourceStepID], err)
+		}
+	}
+	fallback := map[int64]bool{}
+	for _, t := range transitions {
+		if (t.TransitionType == "AUTOMATIC" && t.IsDefault) || t.TransitionType == "MANUAL_SELECTION" {
+			fallback[t.SourceStepID] = true
+		}
+	}
+	for _, t := range transitions {
+		if t.TransitionType == "CONDITIONAL" && !fallback[t.SourceStepID] {
+			return fmt.Errorf("step %s has conditional transitions but no default AUTOMATIC or MANUAL_SELECTION transition for when none matches", codes[t.SourceStepID])
+		}
+	}
+	return nil
+}
+
+// evaluateStepConditionsTx evaluates the CONDITIONAL transitions leaving a
+// submitted step in sort order and records the first that matches, or
+// clears the choice when none does, for routeCompletedStepTx to follow once
+// the step completes. Resubmitting after a correction evaluates again.
+func (s *OperationsService) evaluateStepConditionsTx(ctx context.Context, tx *sql.Tx, actor, workflowID, stepID string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT t.id,t.transition_code,t.condition_expression FROM workflow_instance_step_transitions t JOIN workflow_step_instances si ON si.workflow_instance_id=t.workflow_instance_id AND si.step_code=t.source_step_code WHERE si.id=$1 AND t.transition_type='CONDITIONAL' ORDER BY t.sort_order,t.id`, stepID)
+	if err != nil {
+		return err
+	}
+	type candidate struct{ id, code, expression string }
+	candidates := []candidate{}
+	for rows.Next() {
+		var c candidate
+		var expression sql.NullString
+		if err = rows.Scan(&c.id, &c.code, &expression); err != nil {
+			rows.Close()
+			return err
+		}
+		c.expression = expression.String
+		candidates = append(candidates, c)
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	values, err := stepValuesByKeyTx(ctx, tx, stepID)
+	if err != nil {
+		return err
+	}
+	var matched any
+	matchedCode := ""
+	for _, c := range candidates {
+		ok, err := evaluateCondition(c.expression, values)
+		if err != nil {
+			return conflict("INVALID_CONDITION", fmt.Sprintf("transition %s has an invalid condition: %v", c.code, err))
+		}
+		if ok {
+			matched, matchedCode = c.id, c.code
+			break
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET condition_transition_id=$2,updated_at=NOW() WHERE id=$1`, stepID, matched); err != nil {
+		return err
+	}
+	s.auditTx(ctx, tx, actor, "workflow_transitions.evaluate", "workflow_step_instance", stepID, nil, map[string]any{"workflow_instance_id": workflowID, "matched_transition_code": matchedCode})
+	return nil
+}
+
+func stepValuesByKeyTx(ctx context.Context, tx *sql.Tx, stepID string) (map[string]json.RawMessage, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT field_key,value_json FROM workflow_step_field_values WHERE workflow_step_instance_id=$1`, stepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]json.RawMessage{}
+	for rows.Next() {
+		var key string
+		var raw []byte
+		if err = rows.Scan(&key, &raw); err != nil {
+			return nil, err
+		}
+		out[key] = raw
+	}
+	return out, rows.Err()
+}
+
+// DryRunWorkflowConditions evaluates conditions against sample values
+// without touching any workflow. With an expression it evaluates only that
+// expression; otherwise it evaluates the CONDITIONAL transitions leaving
+// the source step in the order the runtime would.
+func (s *OperationsService) DryRunWorkflowConditions(ctx context.Context, templateID int64, p WorkflowConditionDryRunPayload) (WorkflowConditionDryRun, error) {
+	out := WorkflowConditionDryRun{Results: []WorkflowConditionResult{}}
+	fieldTypes := map[string]string{}
+	rows, err := s.db.QueryContext(ctx, `SELECT f.field_key,f.field_type FROM workflow_step_field_definitions f JOIN workflow_template_steps s ON s.id=f.workflow_template_step_id WHERE s.id=$1 AND s.workflow_template_id=$2`, p.SourceStepID, templateID)
+	if err != nil {
+		return out, err
+	}
+	for rows.Next() {
+		var key, kind string
+		if err = rows.Scan(&key, &kind); err != nil {
+			rows.Close()
+			return out, err
+		}
+		fieldTypes[key] = kind
+	}
+	if err = rows.Close(); err != nil {
+		return out, err
+	}
+	candidates := []WorkflowConditionResult{}
+	if p.Expression != nil {
+		candidates = append(candidates, WorkflowConditionResult{ConditionExpression: *p.Expression})
+	} else {
+		transitions, err := s.ListWorkflowTransitions(ctx, templateID)
+		if err != nil {
+			return out, err
+		}
+		for _, t := range transitions {
+			if t.SourceStepID == p.SourceStepID && t.TransitionType == "CONDITIONAL" && t.ConditionExpression != nil {
+				id, code := t.ID, t.TransitionCode
+				candidates = append(candidates, WorkflowConditionResult{TransitionID: &id, TransitionCode: &code, ConditionExpression: *t.ConditionExpression})
+			}
+		}
+	}
+	for _, c := range candidates {
+		node, err := parseCondition(c.ConditionExpression)
+		if err == nil {
+			err = validateConditionFields(node, fieldTypes)
+		}
+		if err == nil {
+			c.Matched, _ = evaluateCondition(c.ConditionExpression, p.Values)
+			if c.Matched && out.Selected == nil && c.TransitionCode != nil {
+				out.Selected = c.TransitionCode
+			}
+		} else {
+			message := err.Error()
+			c.Error = &message
+		}
+		out.Results = append(out.Results, c)
+	}
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// checkStepCustomerAction rejects customer-actionable steps the customer
+// would not see.
+func checkStepCustomerAction(p WorkflowStepPayload) error {
+	if p.CustomerActionable && !p.CustomerVisible {
+		return errors.New("customer-actionable steps must be customer visible")
+	}
+	return nil
+}
+
+// validateCustomerActionableStep checks at publish time that the customer
+// can complete a customer-actionable step alone: it has customer-visible
+// input fields, every required field is one of them, and it waits for no
+// domain operation.
+func validateCustomerActionableStep(st WorkflowTemplateStepV2) error {
+	if !st.CustomerActionable {
+		return nil
+	}
+	if !st.CustomerVisible {
+		return fmt.Errorf("step %s is customer-actionable but not customer visible", st.StepCode)
+	}
+	if st.DomainEventCode != nil {
+		return fmt.Errorf("step %s is customer-actionable but waits for a domain operation", st.StepCode)
+	}
+	inputs := 0
+	for _, f := range st.Fields {
+		if f.FieldType == "COMPUTED" {
+			continue
+		}
+		if f.IsCustomerVisible {
+			inputs++
+		} else if f.IsRequired {
+			return fmt.Errorf("step %s is customer-actionable but required field %s is hidden from the customer", st.StepCode, f.FieldKey)
+		}
+	}
+	if inputs == 0 {
+		return fmt.Errorf("step %s is customer-actionable but has no customer-visible fields", st.StepCode)
+	}
+	return nil
+}
+
+// customerStepStatuses are the statuses from which the customer may submit a
+// customer-actionable step; the first two start it on the way.
+var customerStepStatuses = map[string]bool{"WAITING_FOR_ASSIGNEE": true, "NEEDS_CORRECTION": true, "IN_PROGRESS": true}
+
+type customerStepQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// customerStep loads a step and reports whether actor is its customer and
+// the step is theirs to act on; callers check customerStepStatuses.
+// forUpdate locks the step row.
+func customerStep(ctx context.Context, q customerStepQuerier, actor, stepID string, forUpdate bool) (workflowID, status string, ok bool, err error) {
+	lock := ""
+	if forUpdate {
+		lock = " FOR UPDATE OF si"
+	}
+	var customer, pathState string
+	var visible, actionable bool
+	err = q.QueryRowContext(ctx, `SELECT si.workflow_instance_id,si.status,wi.customer_user_id,si.customer_visible,COALESCE(ts.customer_actionable,FALSE),si.path_state FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id LEFT JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id WHERE si.id=$1`+lock, stepID).Scan(&workflowID, &status, &customer, &visible, &actionable, &pathState)
+	if err != nil {
+		return
+	}
+	ok = customer == actor && visible && actionable && pathState == "INCLUDED"
+	return
+}
+
+// SubmitCustomerWorkflowStep lets the customer of a workflow fill and submit
+// a customer-actionable step from the account area. Only customer-visible
+// fields may be entered; the values are validated and the step is routed as
+// in SubmitWorkflowStep, and the submission is audited as the customer's.
+func (s *OperationsService) SubmitCustomerWorkflowStep(ctx context.Context, actor, stepID string, p StepValuesPayload) error {
+	if !s.HasPermission(ctx, actor, "customer_portal.workflow.submit_own") {
+		return ErrForbidden
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	workflowID, status, ok, err := customerStep(ctx, tx, actor, stepID, true)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	if !customerStepStatuses[status] {
+		return ErrInvalidTransition
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT field_key FROM workflow_instance_field_definitions WHERE workflow_step_instance_id=$1 AND NOT is_customer_visible`, stepID)
+	if err != nil {
+		return err
+	}
+	hidden := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		hidden[key] = true
+	}
+	rows.Close()
+	for key := range p.Values {
+		if hidden[key] {
+			return fmt.Errorf("%w: unknown field %s", ErrValidation, key)
+		}
+	}
+	if status != "IN_PROGRESS" {
+		if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET status='IN_PROGRESS',actual_start_at=COALESCE(actual_start_at,NOW()),customer_status_text='در حال انجام',updated_at=NOW() WHERE id=$1`, stepID); err != nil {
+			return err
+		}
+		_, _ = tx.ExecContext(ctx, `UPDATE action_items SET status='IN_PROGRESS',updated_at=NOW() WHERE workflow_step_instance_id=$1 AND source_trigger_type IN ('MAIN_STEP','CORRECTION') AND status='OPEN'`, stepID)
+		if err = s.runStepTriggersTx(ctx, tx, workflowID, stepID, "ON_STEP_START"); err != nil {
+			return err
+		}
+	}
+	var approval bool
+	if err = tx.QueryRowContext(ctx, `SELECT requires_approval FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&approval); err != nil {
+		return err
+	}
+	// Routing comes from the template's conditions on the submitted values;
+	// customers do not pick result codes.
+	p.ResultCode = ""
+	if err = s.processStepSubmissionTx(ctx, tx, actor, workflowID, stepID, approval, p); err != nil {
+		return err
+	}
+	s.auditTx(ctx, tx, actor, "workflow_steps.customer_submit", "workflow_step_instance", stepID, nil, map[string]any{"reason": p.Reason, "workflow_id": workflowID})
+	return tx.Commit()
+}
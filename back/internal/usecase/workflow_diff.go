@@ -0,0 +1,470 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// WorkflowTemplateDiff lists what changed from one template version to
+// another. Steps are matched by step_code, fields by field_key, transitions
+// by source step and transition_code, tasks by trigger and title, and
+// handoff metrics by metric_key, so the diff reads the same for clones,
+// imports and hand-built versions.
+type WorkflowTemplateDiff struct {
+	FromTemplateID  int64                    `json:"from_template_id"`
+	ToTemplateID    int64                    `json:"to_template_id"`
+	Changes         []WorkflowTemplateChange `json:"changes"`
+	Risky           bool                     `json:"risky"`
+	RunningOnSource int                      `json:"running_on_source"`
+}
+
+// WorkflowTemplateChange is one added, removed or modified definition.
+// AffectsRunning marks changes that running instances of the source version
+// cannot absorb as they are: removed steps, fields or transitions, fields
+// that became required or changed type or validation, changed roles and
+// approvals, and tightened handoff tolerances.
+type WorkflowTemplateChange struct {
+	Kind           string                    `json:"kind"`
+	Action         string                    `json:"action"`
+	Key            string                    `json:"key"`
+	StepCode       string                    `json:"step_code,omitempty"`
+	Attributes     []WorkflowAttributeChange `json:"attributes,omitempty"`
+	AffectsRunning bool                      `json:"affects_running"`
+	Reason         string                    `json:"reason,omitempty"`
+}
+type WorkflowAttributeChange struct {
+	Attribute string `json:"attribute"`
+	Before    any    `json:"before"`
+	After     any    `json:"after"`
+}
+
+// DiffWorkflowTemplateVersions diffs toID against fromID, or against the
+// published version it would replace when fromID is 0.
+func (s *OperationsService) DiffWorkflowTemplateVersions(ctx context.Context, fromID, toID int64) (WorkflowTemplateDiff, error) {
+	if fromID == 0 {
+		baseline, ok, err := s.publishBaseline(ctx, toID)
+		if err != nil {
+			return WorkflowTemplateDiff{}, err
+		}
+		if !ok {
+			return WorkflowTemplateDiff{}, conflict("WORKFLOW_DIFF_NO_BASELINE", "این گروه نسخه منتشرشده دیگری برای مقایسه ندارد")
+		}
+		fromID = baseline
+	}
+	from, err := s.GetWorkflowTemplateVersion(ctx, fromID)
+	if err != nil {
+		return WorkflowTemplateDiff{}, err
+	}
+	to, err := s.GetWorkflowTemplateVersion(ctx, toID)
+	if err != nil {
+		return WorkflowTemplateDiff{}, err
+	}
+	diff := diffWorkflowTemplates(from, to)
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_instances WHERE workflow_template_id=$1 AND status='IN_PROGRESS'`, fromID).Scan(&diff.RunningOnSource)
+	return diff, err
+}
+
+// publishBaseline returns the latest published version of the group a draft
+// belongs to, which is what a publish replaces.
+func (s *OperationsService) publishBaseline(ctx context.Context, draftID int64) (int64, bool, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT p.id FROM workflow_templates d JOIN workflow_templates p ON p.template_group_code=d.template_group_code AND p.status='PUBLISHED' AND p.id<>d.id WHERE d.id=$1 ORDER BY p.version_number DESC LIMIT 1`, draftID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+func diffWorkflowTemplates(from, to WorkflowTemplateVersion) WorkflowTemplateDiff {
+	d := WorkflowTemplateDiff{FromTemplateID: from.ID, ToTemplateID: to.ID, Changes: []WorkflowTemplateChange{}}
+	add := func(c WorkflowTemplateChange) {
+		d.Changes = append(d.Changes, c)
+		d.Risky = d.Risky || c.AffectsRunning
+	}
+	if attrs := changedAttributes(templateAttributes(from), templateAttributes(to)); len(attrs) > 0 {
+		add(WorkflowTemplateChange{Kind: "TEMPLATE", Action: "MODIFIED", Key: to.TemplateGroupCode, Attributes: attrs})
+	}
+
+	roles := func(id *int64) any {
+		if id == nil {
+			return nil
+		}
+		return *id
+	}
+	fromSteps, toSteps := map[string]WorkflowTemplateStepV2{}, map[string]WorkflowTemplateStepV2{}
+	for _, st := range from.Steps {
+		fromSteps[st.StepCode] = st
+	}
+	for _, st := range to.Steps {
+		toSteps[st.StepCode] = st
+	}
+	for _, code := range unionKeys(fromSteps, toSteps) {
+		before, inFrom := fromSteps[code]
+		after, inTo := toSteps[code]
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "STEP", Action: "REMOVED", Key: code, StepCode: code, AffectsRunning: true, Reason: "instances on this step or past it lose its definition"})
+			continue
+		case !inFrom:
+			add(WorkflowTemplateChange{Kind: "STEP", Action: "ADDED", Key: code, StepCode: code})
+			continue
+		default:
+			attrs := changedAttributes(stepAttributes(before, roles), stepAttributes(after, roles))
+			if len(attrs) > 0 {
+				c := WorkflowTemplateChange{Kind: "STEP", Action: "MODIFIED", Key: code, StepCode: code, Attributes: attrs}
+				for _, a := range attrs {
+					switch a.Attribute {
+					case "responsible_role_code", "required_permission_code", "requires_approval", "approval_role_id", "is_entry", "join_mode", "join_quorum":
+						c.AffectsRunning, c.Reason = true, a.Attribute+" changed"
+					case "is_active", "is_optional", "is_skippable":
+						if a.After == false {
+							c.AffectsRunning, c.Reason = true, a.Attribute+" turned off"
+						}
+					}
+				}
+				add(c)
+			}
+		}
+		diffStepSLA(code, before.SLA, after.SLA, add)
+		diffStepApprovalLevels(code, before.ApprovalLevels, after.ApprovalLevels, add)
+		diffStepFields(code, before.Fields, after.Fields, add)
+		diffStepTasks(code, before.Tasks, after.Tasks, add)
+	}
+
+	fromTasks, toTasks := map[string]WorkflowLevelTask{}, map[string]WorkflowLevelTask{}
+	for _, t := range from.Tasks {
+		fromTasks[t.TriggerType+": "+t.TitleFA] = t
+	}
+	for _, t := range to.Tasks {
+		toTasks[t.TriggerType+": "+t.TitleFA] = t
+	}
+	for _, key := range unionKeys(fromTasks, toTasks) {
+		before, inFrom := fromTasks[key]
+		after, inTo := toTasks[key]
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "WORKFLOW_TASK", Action: "REMOVED", Key: key})
+		case !inFrom:
+			add(WorkflowTemplateChange{Kind: "WORKFLOW_TASK", Action: "ADDED", Key: key})
+		default:
+			a := map[string]any{"description_fa": before.DescriptionFA, "assigned_role_id": roles(before.AssignedRoleID), "required_permission_code": before.RequiredPermissionCode, "priority": before.Priority, "due_offset_hours": intValue(before.DueOffsetHours), "blocks_workflow_progress": before.BlocksWorkflowProgress}
+			b := map[string]any{"description_fa": after.DescriptionFA, "assigned_role_id": roles(after.AssignedRoleID), "required_permission_code": after.RequiredPermissionCode, "priority": after.Priority, "due_offset_hours": intValue(after.DueOffsetHours), "blocks_workflow_progress": after.BlocksWorkflowProgress}
+			if attrs := changedAttributes(a, b); len(attrs) > 0 {
+				add(WorkflowTemplateChange{Kind: "WORKFLOW_TASK", Action: "MODIFIED", Key: key, Attributes: attrs})
+			}
+		}
+	}
+
+	stepCode := func(t WorkflowTemplateVersion, id int64) string {
+		for _, st := range t.Steps {
+			if st.ID == id {
+				return st.StepCode
+			}
+		}
+		return ""
+	}
+	transitionAttributes := func(t WorkflowTemplateVersion, tr WorkflowTransitionDefinition) map[string]any {
+		return map[string]any{"target_step_code": stepCode(t, tr.TargetStepID), "label_fa": tr.LabelFA, "transition_type": tr.TransitionType, "result_code": stringValue(tr.ResultCode), "condition_expression": stringValue(tr.ConditionExpression), "is_default": tr.IsDefault, "requires_permission_code": stringValue(tr.RequiresPermissionCode), "requires_reason": tr.RequiresReason, "sort_order": tr.SortOrder}
+	}
+	fromTransitions, toTransitions := map[string]map[string]any{}, map[string]map[string]any{}
+	for _, tr := range from.Transitions {
+		fromTransitions[stepCode(from, tr.SourceStepID)+"."+tr.TransitionCode] = transitionAttributes(from, tr)
+	}
+	for _, tr := range to.Transitions {
+		toTransitions[stepCode(to, tr.SourceStepID)+"."+tr.TransitionCode] = transitionAttributes(to, tr)
+	}
+	for _, key := range unionKeys(fromTransitions, toTransitions) {
+		before, inFrom := fromTransitions[key]
+		after, inTo := toTransitions[key]
+		source := strings.SplitN(key, ".", 2)[0]
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "TRANSITION", Action: "REMOVED", Key: key, StepCode: source, AffectsRunning: true, Reason: "routes out of " + source + " change"})
+		case !inFrom:
+			add(WorkflowTemplateChange{Kind: "TRANSITION", Action: "ADDED", Key: key, StepCode: source})
+		default:
+			if attrs := changedAttributes(before, after); len(attrs) > 0 {
+				c := WorkflowTemplateChange{Kind: "TRANSITION", Action: "MODIFIED", Key: key, StepCode: source, Attributes: attrs}
+				for _, a := range attrs {
+					if a.Attribute == "target_step_code" || a.Attribute == "transition_type" || a.Attribute == "result_code" || a.Attribute == "condition_expression" || a.Attribute == "is_default" {
+						c.AffectsRunning, c.Reason = true, a.Attribute+" changed"
+					}
+				}
+				add(c)
+			}
+		}
+	}
+
+	fromMetrics, toMetrics := map[string]HandoffMetricDefinition{}, map[string]HandoffMetricDefinition{}
+	for _, m := range from.Metrics {
+		fromMetrics[m.MetricKey] = m
+	}
+	for _, m := range to.Metrics {
+		toMetrics[m.MetricKey] = m
+	}
+	for _, key := range unionKeys(fromMetrics, toMetrics) {
+		before, inFrom := fromMetrics[key]
+		after, inTo := toMetrics[key]
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "HANDOFF_METRIC", Action: "REMOVED", Key: key, AffectsRunning: true, Reason: "handoff fields lose their metric"})
+		case !inFrom:
+			add(WorkflowTemplateChange{Kind: "HANDOFF_METRIC", Action: "ADDED", Key: key})
+		default:
+			a := map[string]any{"label_fa": before.LabelFA, "unit_code": before.UnitCode, "absolute_tolerance": floatValue(before.AbsoluteTolerance), "percentage_tolerance": floatValue(before.PercentageTolerance), "blocking_on_mismatch": before.BlockingOnMismatch}
+			b := map[string]any{"label_fa": after.LabelFA, "unit_code": after.UnitCode, "absolute_tolerance": floatValue(after.AbsoluteTolerance), "percentage_tolerance": floatValue(after.PercentageTolerance), "blocking_on_mismatch": after.BlockingOnMismatch}
+			attrs := changedAttributes(a, b)
+			if len(attrs) == 0 {
+				continue
+			}
+			c := WorkflowTemplateChange{Kind: "HANDOFF_METRIC", Action: "MODIFIED", Key: key, Attributes: attrs}
+			switch {
+			case before.UnitCode != after.UnitCode:
+				c.AffectsRunning, c.Reason = true, "unit changed"
+			case toleranceTightened(before.AbsoluteTolerance, after.AbsoluteTolerance) || toleranceTightened(before.PercentageTolerance, after.PercentageTolerance):
+				c.AffectsRunning, c.Reason = true, "tolerance tightened"
+			case after.BlockingOnMismatch && !before.BlockingOnMismatch:
+				c.AffectsRunning, c.Reason = true, "mismatches now block"
+			}
+			add(c)
+		}
+	}
+	return d
+}
+
+func diffStepSLA(step string, before, after *WorkflowStepSLAPolicy, add func(WorkflowTemplateChange)) {
+	attrs := func(p *WorkflowStepSLAPolicy) map[string]any {
+		if p == nil {
+			return nil
+		}
+		var role any
+		if p.EscalationRoleID != nil {
+			role = *p.EscalationRoleID
+		}
+		return map[string]any{"sla_hours": p.SLAHours, "warn_at_percent": intValue(p.WarnAtPercent), "escalation_role_id": role, "reassign_after_hours": intValue(p.ReassignAfterHours), "notify_customer": p.NotifyCustomer}
+	}
+	switch {
+	case before == nil && after == nil:
+	case before == nil:
+		add(WorkflowTemplateChange{Kind: "SLA", Action: "ADDED", Key: step, StepCode: step})
+	case after == nil:
+		add(WorkflowTemplateChange{Kind: "SLA", Action: "REMOVED", Key: step, StepCode: step})
+	default:
+		if changed := changedAttributes(attrs(before), attrs(after)); len(changed) > 0 {
+			add(WorkflowTemplateChange{Kind: "SLA", Action: "MODIFIED", Key: step, StepCode: step, Attributes: changed})
+		}
+	}
+}
+
+// diffStepApprovalLevels keys levels by number. Any change that adds or
+// tightens a level affects running instances, whose pending approvals are
+// counted against the new chain.
+func diffStepApprovalLevels(step string, before, after []WorkflowStepApprovalLevel, add func(WorkflowTemplateChange)) {
+	fromLevels, toLevels := map[string]WorkflowStepApprovalLevel{}, map[string]WorkflowStepApprovalLevel{}
+	for _, l := range before {
+		fromLevels[fmt.Sprintf("%02d", l.LevelNumber)] = l
+	}
+	for _, l := range after {
+		toLevels[fmt.Sprintf("%02d", l.LevelNumber)] = l
+	}
+	attrs := func(l WorkflowStepApprovalLevel) map[string]any {
+		return map[string]any{"approval_role_id": l.ApprovalRoleID, "required_approvals": l.RequiredApprovals, "min_order_amount": stringValue(l.MinOrderAmount), "amount_currency": l.AmountCurrency}
+	}
+	for _, key := range unionKeys(fromLevels, toLevels) {
+		b, inFrom := fromLevels[key]
+		a, inTo := toLevels[key]
+		path := step + ".level " + strings.TrimLeft(key, "0")
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "APPROVAL_LEVEL", Action: "REMOVED", Key: path, StepCode: step})
+		case !inFrom:
+			add(WorkflowTemplateChange{Kind: "APPROVAL_LEVEL", Action: "ADDED", Key: path, StepCode: step, AffectsRunning: true, Reason: "approval chain changed"})
+		default:
+			if changed := changedAttributes(attrs(b), attrs(a)); len(changed) > 0 {
+				add(WorkflowTemplateChange{Kind: "APPROVAL_LEVEL", Action: "MODIFIED", Key: path, StepCode: step, Attributes: changed, AffectsRunning: true, Reason: "approval chain changed"})
+			}
+		}
+	}
+}
+
+func diffStepFields(step string, before, after []WorkflowFieldDefinition, add func(WorkflowTemplateChange)) {
+	fromFields, toFields := map[string]WorkflowFieldDefinition{}, map[string]WorkflowFieldDefinition{}
+	for _, f := range before {
+		fromFields[f.FieldKey] = f
+	}
+	for _, f := range after {
+		toFields[f.FieldKey] = f
+	}
+	for _, key := range unionKeys(fromFields, toFields) {
+		b, inFrom := fromFields[key]
+		a, inTo := toFields[key]
+		path := step + "." + key
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "FIELD", Action: "REMOVED", Key: path, StepCode: step, AffectsRunning: true, Reason: "values already entered lose their definition"})
+			continue
+		case !inFrom:
+			c := WorkflowTemplateChange{Kind: "FIELD", Action: "ADDED", Key: path, StepCode: step}
+			if a.IsRequired {
+				c.AffectsRunning, c.Reason = true, "new required field"
+			}
+			add(c)
+			continue
+		}
+		attrs := changedAttributes(fieldAttributes(b), fieldAttributes(a))
+		if len(attrs) > 0 {
+			c := WorkflowTemplateChange{Kind: "FIELD", Action: "MODIFIED", Key: path, StepCode: step, Attributes: attrs}
+			for _, attr := range attrs {
+				switch attr.Attribute {
+				case "field_type", "unit_code", "currency_code", "options_json", "handoff_metric_key", "handoff_direction":
+					c.AffectsRunning, c.Reason = true, attr.Attribute+" changed"
+				case "is_required":
+					if a.IsRequired {
+						c.AffectsRunning, c.Reason = true, "field became required"
+					}
+				}
+			}
+			add(c)
+		}
+		if !reflect.DeepEqual(jsonValue(b.ValidationJSON), jsonValue(a.ValidationJSON)) {
+			add(WorkflowTemplateChange{Kind: "VALIDATION", Action: "MODIFIED", Key: path, StepCode: step, Attributes: []WorkflowAttributeChange{{Attribute: "validation_json", Before: jsonValue(b.ValidationJSON), After: jsonValue(a.ValidationJSON)}}, AffectsRunning: true, Reason: "values already entered may no longer validate"})
+		}
+	}
+}
+
+func diffStepTasks(step string, before, after []WorkflowTaskTemplate, add func(WorkflowTemplateChange)) {
+	fromTasks, toTasks := map[string]WorkflowTaskTemplate{}, map[string]WorkflowTaskTemplate{}
+	for _, t := range before {
+		fromTasks[t.TriggerType+": "+t.TitleFA] = t
+	}
+	for _, t := range after {
+		toTasks[t.TriggerType+": "+t.TitleFA] = t
+	}
+	attrs := func(t WorkflowTaskTemplate) map[string]any {
+		var role any
+		if t.AssignedRoleID != nil {
+			role = *t.AssignedRoleID
+		}
+		return map[string]any{"description_fa": t.DescriptionFA, "assigned_role_id": role, "required_permission_code": t.RequiredPermissionCode, "priority": t.Priority, "due_offset_hours": intValue(t.DueOffsetHours), "blocks_step_completion": t.BlocksStepCompletion}
+	}
+	for _, key := range unionKeys(fromTasks, toTasks) {
+		b, inFrom := fromTasks[key]
+		a, inTo := toTasks[key]
+		path := step + "." + key
+		switch {
+		case !inTo:
+			add(WorkflowTemplateChange{Kind: "TASK", Action: "REMOVED", Key: path, StepCode: step})
+		case !inFrom:
+			c := WorkflowTemplateChange{Kind: "TASK", Action: "ADDED", Key: path, StepCode: step}
+			if a.BlocksStepCompletion {
+				c.AffectsRunning, c.Reason = true, "new task blocks step completion"
+			}
+			add(c)
+		default:
+			if changed := changedAttributes(attrs(b), attrs(a)); len(changed) > 0 {
+				c := WorkflowTemplateChange{Kind: "TASK", Action: "MODIFIED", Key: path, StepCode: step, Attributes: changed}
+				if a.BlocksStepCompletion && !b.BlocksStepCompletion {
+					c.AffectsRunning, c.Reason = true, "task now blocks step completion"
+				}
+				add(c)
+			}
+		}
+	}
+}
+
+func templateAttributes(t WorkflowTemplateVersion) map[string]any {
+	return map[string]any{"name_fa": t.NameFA, "description_fa": t.DescriptionFA, "icon_key": t.IconKey, "start_permission_code": t.StartPermissionCode, "scope_type": t.ScopeType, "max_iterations": t.MaxIterations, "is_active": t.IsActive}
+}
+
+func stepAttributes(st WorkflowTemplateStepV2, role func(*int64) any) map[string]any {
+	return map[string]any{"internal_title_fa": st.InternalTitleFA, "internal_description_fa": st.InternalDescriptionFA, "customer_title_fa": st.CustomerTitleFA, "customer_description_fa": st.CustomerDescriptionFA, "sequence_number": st.SequenceNumber, "responsible_role_code": st.ResponsibleRoleCode, "required_permission_code": st.RequiredPermissionCode, "customer_visible": st.CustomerVisible, "requires_approval": st.RequiresApproval, "approval_role_id": role(st.ApprovalRoleID), "is_optional": st.IsOptional, "is_skippable": st.IsSkippable, "is_active": st.IsActive, "default_duration_hours": st.DefaultDurationHours, "starts_automatically": st.StartsAutomatically, "is_entry": st.IsEntry, "domain_event_code": stringValue(st.DomainEventCode), "join_mode": st.JoinMode, "join_quorum": intValue(st.JoinQuorum), "assignment_strategy": st.AssignmentStrategy, "customer_actionable": st.CustomerActionable}
+}
+
+func fieldAttributes(f WorkflowFieldDefinition) map[string]any {
+	return map[string]any{"label_fa": f.LabelFA, "description_fa": f.DescriptionFA, "field_type": f.FieldType, "is_required": f.IsRequired, "is_customer_visible": f.IsCustomerVisible, "is_sales_visible": f.IsSalesVisible, "is_internal_cost": f.IsInternalCost, "unit_code": stringValue(f.UnitCode), "currency_code": stringValue(f.CurrencyCode), "placeholder_fa": stringValue(f.PlaceholderFA), "default_value": jsonValue(f.DefaultValue), "options_json": jsonValue(f.OptionsJSON), "sort_order": f.SortOrder, "handoff_metric_key": stringValue(f.HandoffMetricKey), "handoff_direction": stringValue(f.HandoffDirection)}
+}
+
+// changedAttributes compares two attribute maps and returns the differing
+// attributes in name order.
+func changedAttributes(before, after map[string]any) []WorkflowAttributeChange {
+	out := []WorkflowAttributeChange{}
+	for _, key := range unionKeys(before, after) {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			out = append(out, WorkflowAttributeChange{Attribute: key, Before: before[key], After: after[key]})
+		}
+	}
+	return out
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toleranceTightened reports whether a handoff tolerance got stricter; a
+// missing tolerance does not limit the mismatch.
+func toleranceTightened(before, after *float64) bool {
+	return after != nil && (before == nil || *after < *before)
+}
+
+func jsonValue(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		return nil
+	}
+	return v
+}
+
+func stringValue(v *string) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func intValue(v *int) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func floatValue(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// riskyChangeSummary lists the keys of changes that affect running
+// instances, for the publish error and its audit entry.
+func riskyChangeSummary(d WorkflowTemplateDiff) []string {
+	out := []string{}
+	for _, c := range d.Changes {
+		if c.AffectsRunning {
+			out = append(out, fmt.Sprintf("%s %s %s", c.Kind, c.Action, c.Key))
+		}
+	}
+	return out
+}
@@ -40,7 +40,10 @@ func (s *OperationsService) PrepareWorkflowFileUpload(ctx context.Context, actor
 		return "", false, WorkflowUploadPolicy{}, ErrValidation
 	}
 	if !s.canOperateStep(ctx, actor, permission, roleID, assigned) {
-		return "", false, WorkflowUploadPolicy{}, ErrForbidden
+		_, status, own, err := customerStep(ctx, s.db, actor, stepID, false)
+		if err != nil || !own || !customerStepStatuses[status] || !customerVisible || !s.HasPermission(ctx, actor, "customer_portal.workflow.submit_own") {
+			return "", false, WorkflowUploadPolicy{}, ErrForbidden
+		}
 	}
 	policy := WorkflowUploadPolicy{MaxSizeBytes: s.MaximumUploadBytes(ctx,15 << 20)}
 	if fieldType == "FILE" {
@@ -75,6 +78,10 @@ func (s *OperationsService) RegisterWorkflowFile(ctx context.Context, actor, wor
 	var file WorkflowFile
 	err := s.db.QueryRowContext(ctx, `INSERT INTO workflow_files(workflow_instance_id,workflow_step_instance_id,field_definition_id,entity_type,entity_id,storage_key,original_file_name,mime_type,size_bytes,customer_visible,uploaded_by_user_id) VALUES($1,$2,$3,'WORKFLOW',$1,$4,$5,$6,$7,$8,$9) RETURNING id,workflow_instance_id,workflow_step_instance_id,field_definition_id,entity_type,entity_id,storage_key,original_file_name,mime_type,size_bytes,customer_visible`, workflowID, stepID, fieldID, storageKey, originalName, mimeType, size, customerVisible, actor).Scan(&file.ID, &file.WorkflowInstanceID, &file.WorkflowStepInstanceID, &file.FieldDefinitionID, &file.EntityType, &file.EntityID, &file.StorageKey, &file.OriginalFileName, &file.MIMEType, &file.SizeBytes, &file.CustomerVisible)
 	if err == nil {
+		var role sql.NullInt64
+		var assigned sql.NullString
+		_ = s.db.QueryRowContext(ctx, `SELECT responsible_role_id,assigned_user_id FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&role, &assigned)
+		ctx, _ = s.stepActor(ctx, actor, "", role, assigned)
 		s.audit(ctx, actor, "workflow_files.upload", "workflow_file", file.ID, map[string]any{"workflow_instance_id": workflowID, "step_instance_id": stepID})
 	}
 	return file, err
@@ -0,0 +1,512 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Formulas compute COMPUTED fields server-side from other fields. A formula
+// is kept in the field's validation_json as {"formula": "..."} so that it
+// travels with snapshots, bundles and diffs like the other rules. The
+// language has numbers, + - * /, unary minus, parentheses and references
+// to a field of the same step (field_key, placed before the computed field)
+// or of an earlier step (STEP_CODE.field_key, the latest iteration).
+// Measurement values carry their unit; numbers take the unit_code of their
+// field. Units of weight, length, area and volume propagate through the
+// arithmetic and the result is converted to the computed field's unit_code.
+const (
+	maxFormulaLength = 500
+	maxFormulaDepth  = 32
+)
+
+// formulaUnit is a unit as a power of mass and length and its factor to
+// kilograms and metres. Counting units are dimensionless.
+type formulaUnit struct {
+	mass, length int
+	factor       float64
+}
+
+var formulaUnits = map[string]formulaUnit{
+	"GRAM": {1, 0, 0.001}, "G": {1, 0, 0.001}, "KILOGRAM": {1, 0, 1}, "KG": {1, 0, 1}, "TON": {1, 0, 1000},
+	"MILLIMETER": {0, 1, 0.001}, "MM": {0, 1, 0.001}, "CENTIMETER": {0, 1, 0.01}, "CM": {0, 1, 0.01}, "METER": {0, 1, 1}, "M": {0, 1, 1},
+	"SQUARE_CENTIMETER": {0, 2, 0.0001}, "CM2": {0, 2, 0.0001}, "SQUARE_METER": {0, 2, 1}, "M2": {0, 2, 1},
+	"LITER": {0, 3, 0.001}, "L": {0, 3, 0.001}, "CUBIC_METER": {0, 3, 1}, "M3": {0, 3, 1},
+	"PIECE": {0, 0, 1}, "SLAB": {0, 0, 1}, "TILE": {0, 0, 1}, "BLOCK": {0, 0, 1}, "PACKAGE": {0, 0, 1}, "BUNDLE": {0, 0, 1}, "CONTAINER": {0, 0, 1}, "PERCENT": {0, 0, 0.01},
+}
+
+func lookupFormulaUnit(code string) (formulaUnit, error) {
+	if strings.TrimSpace(code) == "" {
+		return formulaUnit{factor: 1}, nil
+	}
+	u, ok := formulaUnits[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return u, fmt.Errorf("unit %s cannot be used in formulas", code)
+	}
+	return u, nil
+}
+
+func (u formulaUnit) dimension() string {
+	switch {
+	case u.mass == 0 && u.length == 0:
+		return "number"
+	case u.mass == 1 && u.length == 0:
+		return "weight"
+	case u.mass == 0 && u.length == 1:
+		return "length"
+	case u.mass == 0 && u.length == 2:
+		return "area"
+	case u.mass == 0 && u.length == 3:
+		return "volume"
+	}
+	return fmt.Sprintf("mass^%d·length^%d", u.mass, u.length)
+}
+
+// formulaQuantity is a value in kilograms and metres with its dimension.
+type formulaQuantity struct {
+	value        float64
+	mass, length int
+}
+
+type formulaNode struct {
+	op          string // number, field, neg, + - * /
+	value       float64
+	step, field string
+	left, right *formulaNode
+}
+
+type formulaParser struct {
+	src   []rune
+	pos   int
+	depth int
+}
+
+func parseFormula(src string) (*formulaNode, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("formula is empty")
+	}
+	if len(src) > maxFormulaLength {
+		return nil, fmt.Errorf("formula is longer than %d characters", maxFormulaLength)
+	}
+	p := &formulaParser{src: []rune(src)}
+	node, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.src[p.pos], p.pos)
+	}
+	return node, nil
+}
+
+func (p *formulaParser) skip() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) accept(ops string) (string, bool) {
+	p.skip()
+	if p.pos < len(p.src) && strings.ContainsRune(ops, p.src[p.pos]) {
+		p.pos++
+		return string(p.src[p.pos-1]), true
+	}
+	return "", false
+}
+
+func (p *formulaParser) sum() (*formulaNode, error) {
+	left, err := p.product()
+	for err == nil {
+		op, ok := p.accept("+-")
+		if !ok {
+			break
+		}
+		var right *formulaNode
+		if right, err = p.product(); err == nil {
+			left = &formulaNode{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *formulaParser) product() (*formulaNode, error) {
+	left, err := p.unary()
+	for err == nil {
+		op, ok := p.accept("*/")
+		if !ok {
+			break
+		}
+		var right *formulaNode
+		if right, err = p.unary(); err == nil {
+			left = &formulaNode{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *formulaParser) unary() (*formulaNode, error) {
+	if _, ok := p.accept("-"); ok {
+		if p.depth++; p.depth > maxFormulaDepth {
+			return nil, errors.New("formula is nested too deeply")
+		}
+		defer func() { p.depth-- }()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &formulaNode{op: "neg", left: operand}, nil
+	}
+	return p.operand()
+}
+
+func (p *formulaParser) operand() (*formulaNode, error) {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return nil, errors.New("formula ends unexpectedly")
+	}
+	start, r := p.pos, p.src[p.pos]
+	switch {
+	case r == '(':
+		p.pos++
+		if p.depth++; p.depth > maxFormulaDepth {
+			return nil, errors.New("formula is nested too deeply")
+		}
+		node, err := p.sum()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		return node, nil
+	case r >= '0' && r <= '9' || r == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(string(p.src[start:p.pos]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number at %d", start)
+		}
+		return &formulaNode{op: "number", value: n}, nil
+	case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] == '.' || p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' || p.src[p.pos] >= 'A' && p.src[p.pos] <= 'Z' || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+			p.pos++
+		}
+		text := string(p.src[start:p.pos])
+		step, field, qualified := strings.Cut(text, ".")
+		if !qualified {
+			step, field = "", text
+		}
+		if !codePattern.MatchString(field) || (qualified && (step == "" || strings.Contains(field, "."))) {
+			return nil, fmt.Errorf("invalid field reference %q", text)
+		}
+		return &formulaNode{op: "field", step: normalizeCode(step), field: field}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", r, start)
+}
+
+// refs returns the field references in the formula.
+func (n *formulaNode) refs(out []*formulaNode) []*formulaNode {
+	if n == nil {
+		return out
+	}
+	if n.op == "field" {
+		out = append(out, n)
+	}
+	return n.right.refs(n.left.refs(out))
+}
+
+// unit derives the dimension of the formula from the units of its fields.
+func (n *formulaNode) unit(fieldUnit func(step, field string) (formulaUnit, error)) (formulaUnit, error) {
+	switch n.op {
+	case "number":
+		return formulaUnit{factor: 1}, nil
+	case "field":
+		return fieldUnit(n.step, n.field)
+	case "neg":
+		return n.left.unit(fieldUnit)
+	}
+	left, err := n.left.unit(fieldUnit)
+	if err != nil {
+		return left, err
+	}
+	right, err := n.right.unit(fieldUnit)
+	if err != nil {
+		return right, err
+	}
+	switch n.op {
+	case "*":
+		return formulaUnit{mass: left.mass + right.mass, length: left.length + right.length, factor: 1}, nil
+	case "/":
+		return formulaUnit{mass: left.mass - right.mass, length: left.length - right.length, factor: 1}, nil
+	}
+	if left.mass != right.mass || left.length != right.length {
+		return left, fmt.Errorf("cannot %s %s and %s", map[string]string{"+": "add", "-": "subtract"}[n.op], left.dimension(), right.dimension())
+	}
+	return left, nil
+}
+
+// errFormulaOperandMissing reports an operand without a value; the
+// computed field is then left empty rather than failing the submission.
+var errFormulaOperandMissing = errors.New("formula operand has no value")
+
+func (n *formulaNode) eval(operand func(step, field string) (formulaQuantity, error)) (formulaQuantity, error) {
+	switch n.op {
+	case "number":
+		return formulaQuantity{value: n.value}, nil
+	case "field":
+		return operand(n.step, n.field)
+	case "neg":
+		q, err := n.left.eval(operand)
+		q.value = -q.value
+		return q, err
+	}
+	left, err := n.left.eval(operand)
+	if err != nil {
+		return left, err
+	}
+	right, err := n.right.eval(operand)
+	if err != nil {
+		return right, err
+	}
+	switch n.op {
+	case "*":
+		return formulaQuantity{value: left.value * right.value, mass: left.mass + right.mass, length: left.length + right.length}, nil
+	case "/":
+		if right.value == 0 {
+			return left, errors.New("division by zero")
+		}
+		return formulaQuantity{value: left.value / right.value, mass: left.mass - right.mass, length: left.length - right.length}, nil
+	}
+	if left.mass != right.mass || left.length != right.length {
+		return left, errors.New("operands have different units")
+	}
+	if n.op == "-" {
+		right.value = -right.value
+	}
+	return formulaQuantity{value: left.value + right.value, mass: left.mass, length: left.length}, nil
+}
+
+// formulaSource returns the formula of a COMPUTED field's validation_json.
+func formulaSource(validation []byte) string {
+	var rules struct {
+		Formula string `json:"formula"`
+	}
+	_ = json.Unmarshal(validation, &rules)
+	return rules.Formula
+}
+
+// formulaFieldUnit is the unit a field contributes to a formula.
+func formulaFieldUnit(f WorkflowFieldDefinition) (formulaUnit, error) {
+	switch f.FieldType {
+	case "INTEGER", "DECIMAL", "WEIGHT", "AREA", "VOLUME", "QUANTITY", "COMPUTED":
+	default:
+		return formulaUnit{}, fmt.Errorf("field %s is not numeric", f.FieldKey)
+	}
+	unit := ""
+	if f.UnitCode != nil {
+		unit = *f.UnitCode
+	}
+	return lookupFormulaUnit(unit)
+}
+
+// formulaOperand reads a stored value as a quantity; numbers take unit, the
+// unit_code of their field definition.
+func formulaOperand(raw []byte, unit string) (formulaQuantity, error) {
+	var v any
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil || v == nil {
+		return formulaQuantity{}, errFormulaOperandMissing
+	}
+	n, ok := v.(float64)
+	if object, isObject := v.(map[string]any); isObject {
+		n, ok = object["value"].(float64)
+		if code, hasUnit := object["unit"].(string); hasUnit && code != "" {
+			unit = code
+		}
+	}
+	if !ok {
+		return formulaQuantity{}, errors.New("value is not numeric")
+	}
+	u, err := lookupFormulaUnit(unit)
+	if err != nil {
+		return formulaQuantity{}, err
+	}
+	return formulaQuantity{value: n * u.factor, mass: u.mass, length: u.length}, nil
+}
+
+// computeFormula evaluates src and renders the result for a field with
+// unit_code unit: a measurement object when it has a unit, otherwise a
+// number. It returns errFormulaOperandMissing when an operand is empty.
+func computeFormula(src, unit string, operand func(step, field string) (formulaQuantity, error)) (json.RawMessage, error) {
+	node, err := parseFormula(src)
+	if err != nil {
+		return nil, err
+	}
+	q, err := node.eval(operand)
+	if err != nil {
+		return nil, err
+	}
+	target, err := lookupFormulaUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+	if q.mass != target.mass || q.length != target.length {
+		return nil, fmt.Errorf("result is %s but the field is %s", formulaUnit{mass: q.mass, length: q.length}.dimension(), target.dimension())
+	}
+	value := math.Round(q.value/target.factor*1e6) / 1e6
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, errors.New("result is not a number")
+	}
+	if strings.TrimSpace(unit) == "" {
+		return json.Marshal(value)
+	}
+	return json.Marshal(map[string]any{"value": value, "unit": unit})
+}
+
+// validateWorkflowFormulas checks every COMPUTED field: its formula parses,
+// references fields placed before it in its step or fields of an earlier
+// step, uses numeric fields only and yields the dimension of its unit.
+func validateWorkflowFormulas(steps []WorkflowTemplateStepV2) error {
+	byCode := map[string]WorkflowTemplateStepV2{}
+	for _, st := range steps {
+		if st.IsActive {
+			byCode[st.StepCode] = st
+		}
+	}
+	for _, st := range steps {
+		if !st.IsActive {
+			continue
+		}
+		for i, f := range st.Fields {
+			if f.FieldType != "COMPUTED" {
+				continue
+			}
+			node, err := parseFormula(formulaSource(f.ValidationJSON))
+			if err != nil {
+				return fmt.Errorf("field %s of step %s: %w", f.FieldKey, st.StepCode, err)
+			}
+			fieldUnit := func(step, key string) (formulaUnit, error) {
+				fields := st.Fields[:i]
+				if step != "" {
+					source, ok := byCode[step]
+					if !ok || source.SequenceNumber >= st.SequenceNumber {
+						return formulaUnit{}, fmt.Errorf("step %s is not an earlier step", step)
+					}
+					fields = source.Fields
+				}
+				for _, candidate := range fields {
+					if candidate.FieldKey == key {
+						return formulaFieldUnit(candidate)
+					}
+				}
+				if step == "" {
+					return formulaUnit{}, fmt.Errorf("field %s is not placed before %s", key, f.FieldKey)
+				}
+				return formulaUnit{}, fmt.Errorf("step %s has no field %s", step, key)
+			}
+			result, err := node.unit(fieldUnit)
+			if err == nil {
+				var target formulaUnit
+				if target, err = formulaFieldUnit(f); err == nil && (target.mass != result.mass || target.length != result.length) {
+					err = fmt.Errorf("formula yields %s but the unit is %s", result.dimension(), target.dimension())
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("field %s of step %s: %w", f.FieldKey, st.StepCode, err)
+			}
+		}
+	}
+	return nil
+}
+
+type computedFieldDefinition struct {
+	id                 int64
+	key, formula, unit string
+	required           bool
+	validation         []byte
+}
+
+// computeStepFieldsTx evaluates the COMPUTED fields of a step instance in
+// sort order after its entered values are saved, storing each result or
+// removing a stale one when an operand has no value. Values of earlier steps
+// come from their latest iteration in the same workflow instance.
+func computeStepFieldsTx(ctx context.Context, tx *sql.Tx, actor, stepID string, fields []computedFieldDefinition, requireAll bool) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	steps := []string{}
+	for _, f := range fields {
+		node, err := parseFormula(f.formula)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrValidation, f.key, err)
+		}
+		for _, ref := range node.refs(nil) {
+			if ref.step != "" {
+				steps = append(steps, ref.step)
+			}
+		}
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT CASE WHEN si.id=$1 THEN '' ELSE si.step_code END,v.field_key,v.value_json,COALESCE(d.unit_code,'') FROM workflow_step_field_values v JOIN workflow_step_instances si ON si.id=v.workflow_step_instance_id JOIN workflow_instance_field_definitions d ON d.id=v.field_definition_id WHERE si.workflow_instance_id=(SELECT workflow_instance_id FROM workflow_step_instances WHERE id=$1) AND (si.id=$1 OR (si.step_code=ANY($2) AND si.sequence_number<(SELECT sequence_number FROM workflow_step_instances WHERE id=$1))) ORDER BY si.iteration_number,si.updated_at`, stepID, pq.Array(steps))
+	if err != nil {
+		return err
+	}
+	type storedValue struct {
+		raw  []byte
+		unit string
+	}
+	stored := map[string]storedValue{}
+	for rows.Next() {
+		var step, key, unit string
+		var raw []byte
+		if err = rows.Scan(&step, &key, &raw, &unit); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[step+"."+key] = storedValue{raw: raw, unit: unit}
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		raw, err := computeFormula(f.formula, f.unit, func(step, key string) (formulaQuantity, error) {
+			v, ok := stored[step+"."+key]
+			if !ok {
+				return formulaQuantity{}, errFormulaOperandMissing
+			}
+			q, err := formulaOperand(v.raw, v.unit)
+			if err != nil && !errors.Is(err, errFormulaOperandMissing) {
+				err = fmt.Errorf("%s: %w", strings.TrimPrefix(step+"."+key, "."), err)
+			}
+			return q, err
+		})
+		if errors.Is(err, errFormulaOperandMissing) {
+			if requireAll && f.required {
+				return fmt.Errorf("%w: %s cannot be computed until its fields are entered", ErrValidation, f.key)
+			}
+			if _, err = tx.ExecContext(ctx, `DELETE FROM workflow_step_field_values WHERE workflow_step_instance_id=$1 AND field_key=$2`, stepID, f.key); err != nil {
+				return err
+			}
+			delete(stored, "."+f.key)
+			continue
+		}
+		if err == nil {
+			err = validateRuntimeValue("COMPUTED", raw, nil, f.validation, f.required, f.unit, "")
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrValidation, f.key, err)
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_field_values(workflow_step_instance_id,field_definition_id,field_key,field_type,value_json,entered_by_user_id,updated_by_user_id) VALUES($1,$2,$3,'COMPUTED',$4,$5,$5) ON CONFLICT(workflow_step_instance_id,field_key) DO UPDATE SET value_json=EXCLUDED.value_json,updated_by_user_id=EXCLUDED.updated_by_user_id,updated_at=NOW()`, stepID, f.id, f.key, []byte(raw), actor); err != nil {
+			return err
+		}
+		stored["."+f.key] = storedValue{raw: raw, unit: f.unit}
+	}
+	return nil
+}
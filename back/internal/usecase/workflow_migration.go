@@ -0,0 +1,324 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// WorkflowInstanceMigrationPayload selects the running instances to move to
+// a newer published version: InstanceIDs when given, otherwise every running
+// instance of SourceTemplateID, otherwise every running instance of an older
+// version of the same group. DryRun only returns the report.
+type WorkflowInstanceMigrationPayload struct {
+	InstanceIDs      []string `json:"instance_ids"`
+	SourceTemplateID int64    `json:"source_template_id"`
+	DryRun           bool     `json:"dry_run"`
+	Reason           string   `json:"reason"`
+}
+type WorkflowInstanceMigrationReport struct {
+	TargetTemplateID int64                       `json:"target_template_id"`
+	DryRun           bool                        `json:"dry_run"`
+	Migrated         int                         `json:"migrated"`
+	Blocked          int                         `json:"blocked"`
+	Instances        []WorkflowInstanceMigration `json:"instances"`
+}
+
+// WorkflowInstanceMigration is the plan for one instance. Errors keep the
+// instance on its version; warnings describe what the migration does to
+// steps and values the target version no longer defines.
+type WorkflowInstanceMigration struct {
+	WorkflowInstanceID string                  `json:"workflow_instance_id"`
+	FromTemplateID     int64                   `json:"from_template_id"`
+	Migrated           bool                    `json:"migrated"`
+	Steps              []WorkflowStepMigration `json:"steps"`
+	AddedSteps         []string                `json:"added_steps"`
+	Errors             []WorkflowImportIssue   `json:"errors"`
+	Warnings           []WorkflowImportIssue   `json:"warnings"`
+}
+
+// WorkflowStepMigration maps one step instance. Action is MAPPED when the
+// target defines the step_code, SKIPPED for a removed step that had not
+// started, KEPT for a removed step that already finished and UNMAPPABLE for
+// a removed step that is still open.
+type WorkflowStepMigration struct {
+	StepInstanceID  string `json:"step_instance_id"`
+	StepCode        string `json:"step_code"`
+	IterationNumber int    `json:"iteration_number"`
+	Status          string `json:"status"`
+	TargetStepID    *int64 `json:"target_step_id,omitempty"`
+	Action          string `json:"action"`
+}
+
+type migrationStepState struct {
+	ID        string
+	StepCode  string
+	Status    string
+	Iteration int
+	// Values maps the field_key of every entered value to its field type.
+	Values map[string]string
+}
+
+// MigrateWorkflowInstances moves running instances to targetID. Step
+// instances keep their ids, statuses, assignees, timers and entered values;
+// their snapshot columns, fields and task templates are refreshed from the
+// target step with the same step_code, steps new in the target are added as
+// NOT_STARTED, and the workflow-level snapshot (transitions, handoff
+// metrics, workflow tasks and document requirements) is replaced. Each
+// instance migrates in its own transaction.
+func (s *OperationsService) MigrateWorkflowInstances(ctx context.Context, actor string, targetID int64, p WorkflowInstanceMigrationPayload) (WorkflowInstanceMigrationReport, error) {
+	report := WorkflowInstanceMigrationReport{TargetTemplateID: targetID, DryRun: p.DryRun, Instances: []WorkflowInstanceMigration{}}
+	if !p.DryRun {
+		if err := requireReason(p.Reason); err != nil {
+			return report, err
+		}
+	}
+	target, err := s.GetWorkflowTemplateVersion(ctx, targetID)
+	if err != nil {
+		return report, err
+	}
+	if target.Status != "PUBLISHED" {
+		return report, conflict("WORKFLOW_MIGRATION_TARGET_NOT_PUBLISHED", "فقط به نسخه منتشرشده می‌توان مهاجرت کرد")
+	}
+	ids := p.InstanceIDs
+	if len(ids) == 0 {
+		rows, err := s.db.QueryContext(ctx, `SELECT wi.id FROM workflow_instances wi JOIN workflow_templates t ON t.id=wi.workflow_template_id WHERE t.template_group_code=$1 AND t.version_number<$2 AND wi.status NOT IN ('COMPLETED','CANCELLED') AND ($3=0 OR wi.workflow_template_id=$3) ORDER BY wi.started_at`, target.TemplateGroupCode, target.VersionNumber, p.SourceTemplateID)
+		if err != nil {
+			return report, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				return report, err
+			}
+			ids = append(ids, id)
+		}
+		if err = rows.Err(); err != nil {
+			return report, err
+		}
+	}
+	for _, id := range ids {
+		m, err := s.migrateWorkflowInstance(ctx, actor, strings.TrimSpace(id), target, p)
+		if err != nil {
+			return report, err
+		}
+		if len(m.Errors) == 0 {
+			report.Migrated++
+		} else {
+			report.Blocked++
+		}
+		report.Instances = append(report.Instances, m)
+	}
+	return report, nil
+}
+
+func (s *OperationsService) migrateWorkflowInstance(ctx context.Context, actor, id string, target WorkflowTemplateVersion, p WorkflowInstanceMigrationPayload) (WorkflowInstanceMigration, error) {
+	m := WorkflowInstanceMigration{WorkflowInstanceID: id, Steps: []WorkflowStepMigration{}, AddedSteps: []string{}, Errors: []WorkflowImportIssue{}, Warnings: []WorkflowImportIssue{}}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback()
+	var group, status string
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT wi.workflow_template_id,t.template_group_code,t.version_number,wi.status FROM workflow_instances wi JOIN workflow_templates t ON t.id=wi.workflow_template_id WHERE wi.id::text=$1 FOR UPDATE OF wi`, id).Scan(&m.FromTemplateID, &group, &version, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.Errors = append(m.Errors, WorkflowImportIssue{Path: "instance", Code: "INSTANCE_NOT_FOUND", Message: "workflow instance does not exist"})
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	switch {
+	case status == "COMPLETED" || status == "CANCELLED":
+		m.Errors = append(m.Errors, WorkflowImportIssue{Path: "instance", Code: "INSTANCE_NOT_RUNNING", Message: "workflow instance is " + status})
+	case group != target.TemplateGroupCode:
+		m.Errors = append(m.Errors, WorkflowImportIssue{Path: "instance", Code: "INSTANCE_GROUP_MISMATCH", Message: "workflow instance runs template group " + group})
+	case version >= target.VersionNumber:
+		m.Errors = append(m.Errors, WorkflowImportIssue{Path: "instance", Code: "INSTANCE_NOT_OLDER", Message: fmt.Sprintf("workflow instance already runs version %d", version)})
+	}
+	if len(m.Errors) > 0 {
+		return m, nil
+	}
+	steps, err := migrationStepStatesTx(ctx, tx, id)
+	if err != nil {
+		return m, err
+	}
+	plan := planWorkflowInstanceMigration(steps, target)
+	m.Steps, m.AddedSteps, m.Errors, m.Warnings = plan.Steps, plan.AddedSteps, plan.Errors, plan.Warnings
+	if len(m.Errors) > 0 || p.DryRun {
+		return m, nil
+	}
+	if err = s.applyWorkflowInstanceMigrationTx(ctx, tx, actor, id, target); err != nil {
+		return m, err
+	}
+	s.auditTx(ctx, tx, actor, "workflow_instances.migrate", "workflow_instance", id, map[string]any{"workflow_template_id": m.FromTemplateID, "version_number": version}, map[string]any{"workflow_template_id": target.ID, "version_number": target.VersionNumber, "reason": strings.TrimSpace(p.Reason), "steps": m.Steps, "added_steps": m.AddedSteps, "warnings": m.Warnings})
+	if err = tx.Commit(); err != nil {
+		return m, err
+	}
+	m.Migrated = true
+	return m, nil
+}
+
+func migrationStepStatesTx(ctx context.Context, tx *sql.Tx, workflowID string) ([]migrationStepState, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id,COALESCE(step_code,''),status,iteration_number FROM workflow_step_instances WHERE workflow_instance_id=$1 ORDER BY sequence_number,iteration_number FOR UPDATE`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	steps := []migrationStepState{}
+	index := map[string]int{}
+	for rows.Next() {
+		var st migrationStepState
+		if err = rows.Scan(&st.ID, &st.StepCode, &st.Status, &st.Iteration); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st.Values = map[string]string{}
+		index[st.ID] = len(steps)
+		steps = append(steps, st)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	rows, err = tx.QueryContext(ctx, `SELECT v.workflow_step_instance_id,v.field_key,v.field_type FROM workflow_step_field_values v JOIN workflow_step_instances si ON si.id=v.workflow_step_instance_id WHERE si.workflow_instance_id=$1`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stepID, key, fieldType string
+		if err = rows.Scan(&stepID, &key, &fieldType); err != nil {
+			return nil, err
+		}
+		if i, ok := index[stepID]; ok {
+			steps[i].Values[key] = fieldType
+		}
+	}
+	return steps, rows.Err()
+}
+
+// planWorkflowInstanceMigration maps step instances to the active steps of
+// target by step_code. An open step the target no longer defines, or an
+// entered value whose field changed type, blocks the migration; removed
+// steps that have not started are skipped and finished ones are kept as
+// history.
+func planWorkflowInstanceMigration(steps []migrationStepState, target WorkflowTemplateVersion) WorkflowInstanceMigration {
+	m := WorkflowInstanceMigration{Steps: []WorkflowStepMigration{}, AddedSteps: []string{}, Errors: []WorkflowImportIssue{}, Warnings: []WorkflowImportIssue{}}
+	targetSteps := map[string]WorkflowTemplateStepV2{}
+	for _, st := range target.Steps {
+		if st.IsActive {
+			targetSteps[st.StepCode] = st
+		}
+	}
+	present := map[string]bool{}
+	startedUpTo := 0
+	for _, st := range steps {
+		present[st.StepCode] = true
+		path := fmt.Sprintf("steps[%s#%d]", st.StepCode, st.Iteration)
+		mapping := WorkflowStepMigration{StepInstanceID: st.ID, StepCode: st.StepCode, IterationNumber: st.Iteration, Status: st.Status}
+		next, ok := targetSteps[st.StepCode]
+		if !ok {
+			switch st.Status {
+			case "NOT_STARTED":
+				mapping.Action = "SKIPPED"
+				m.Warnings = append(m.Warnings, WorkflowImportIssue{Path: path, Code: "STEP_REMOVED", Message: "step is not in the target version and will be skipped"})
+			case "COMPLETED", "SKIPPED", "CANCELLED":
+				mapping.Action = "KEPT"
+				m.Warnings = append(m.Warnings, WorkflowImportIssue{Path: path, Code: "STEP_REMOVED", Message: "step is not in the target version and stays as history"})
+			default:
+				mapping.Action = "UNMAPPABLE"
+				m.Errors = append(m.Errors, WorkflowImportIssue{Path: path, Code: "STEP_UNMAPPABLE", Message: "step is " + st.Status + " but the target version has no step " + st.StepCode})
+			}
+			m.Steps = append(m.Steps, mapping)
+			continue
+		}
+		targetID := next.ID
+		mapping.TargetStepID, mapping.Action = &targetID, "MAPPED"
+		m.Steps = append(m.Steps, mapping)
+		if st.Status != "NOT_STARTED" && next.SequenceNumber > startedUpTo {
+			startedUpTo = next.SequenceNumber
+		}
+		fields := map[string]WorkflowFieldDefinition{}
+		for _, f := range next.Fields {
+			fields[f.FieldKey] = f
+		}
+		keys := make([]string, 0, len(st.Values))
+		for key := range st.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, ok := fields[key]
+			switch {
+			case !ok:
+				m.Warnings = append(m.Warnings, WorkflowImportIssue{Path: path + ".fields." + key, Code: "FIELD_REMOVED", Message: "field is not in the target version; its value is kept and no longer required"})
+			case f.FieldType != st.Values[key]:
+				m.Errors = append(m.Errors, WorkflowImportIssue{Path: path + ".fields." + key, Code: "FIELD_TYPE_CHANGED", Message: "entered " + st.Values[key] + " value does not fit the target " + f.FieldType + " field"})
+			}
+		}
+	}
+	for _, st := range target.Steps {
+		if !st.IsActive || present[st.StepCode] {
+			continue
+		}
+		m.AddedSteps = append(m.AddedSteps, st.StepCode)
+		if len(target.Transitions) == 0 && st.SequenceNumber < startedUpTo {
+			m.Warnings = append(m.Warnings, WorkflowImportIssue{Path: "steps[" + st.StepCode + "]", Code: "STEP_ADDED_BEHIND", Message: "new step comes before steps that already started and will not be reached"})
+		}
+	}
+	return m
+}
+
+// applyWorkflowInstanceMigrationTx rewrites the snapshot of a planned
+// instance. Sequence numbers are negated first so that reordered steps can
+// take their new numbers without tripping the per-instance unique index;
+// removed steps are parked after the last target step.
+func (s *OperationsService) applyWorkflowInstanceMigrationTx(ctx context.Context, tx *sql.Tx, actor, workflowID string, target WorkflowTemplateVersion) error {
+	codes, maxSequence := []string{}, 0
+	for _, st := range target.Steps {
+		if st.IsActive {
+			codes = append(codes, st.StepCode)
+		}
+		if st.SequenceNumber > maxSequence {
+			maxSequence = st.SequenceNumber
+		}
+	}
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE workflow_step_instances SET sequence_number=-sequence_number WHERE workflow_instance_id=$1 AND sequence_number>0`, []any{workflowID}},
+		{`UPDATE workflow_step_instances si SET workflow_template_step_id=t.id,template_step_id=t.id,sequence_number=t.sequence_number,internal_title_fa=t.internal_title_fa,internal_description_fa=t.internal_description_fa,customer_title_fa=t.customer_title_fa,customer_description_fa=t.customer_description_fa,responsible_role_id=t.responsible_role_id,assigned_role_id=t.responsible_role_id,required_permission_code=t.required_permission_code,requires_approval=t.requires_approval,approval_role_id=t.approval_role_id,is_optional=t.is_optional,is_skippable=t.is_skippable,starts_automatically=t.starts_automatically,customer_visible=t.customer_visible,domain_event_code=t.domain_event_code,join_required_count=CASE t.join_mode WHEN 'QUORUM' THEN t.join_quorum WHEN 'ALL' THEN (SELECT COUNT(*) FROM workflow_step_transitions tr JOIN workflow_template_steps src ON src.id=tr.source_step_id WHERE tr.target_step_id=t.id AND src.is_active) END,updated_at=NOW() FROM workflow_template_steps t WHERE si.workflow_instance_id=$1 AND t.workflow_template_id=$2 AND t.is_active AND t.step_code=si.step_code`, []any{workflowID, target.ID}},
+		{`INSERT INTO workflow_step_instances(workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,status,assigned_role_id,responsible_role_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,customer_status_text,path_state,domain_event_code,join_required_count) SELECT $1,t.id,t.id,t.step_code,t.internal_title_fa,t.internal_description_fa,t.customer_title_fa,t.customer_description_fa,t.sequence_number,'NOT_STARTED',t.responsible_role_id,t.responsible_role_id,t.required_permission_code,t.requires_approval,t.approval_role_id,t.is_optional,t.is_skippable,t.starts_automatically,t.customer_visible,$3,CASE WHEN EXISTS(SELECT 1 FROM workflow_step_transitions WHERE workflow_template_id=$2) THEN 'NOT_SELECTED' ELSE 'INCLUDED' END,t.domain_event_code,CASE t.join_mode WHEN 'QUORUM' THEN t.join_quorum WHEN 'ALL' THEN (SELECT COUNT(*) FROM workflow_step_transitions tr JOIN workflow_template_steps src ON src.id=tr.source_step_id WHERE tr.target_step_id=t.id AND src.is_active) END FROM workflow_template_steps t WHERE t.workflow_template_id=$2 AND t.is_active AND NOT EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND si.step_code=t.step_code)`, []any{workflowID, target.ID, customerStatus("NOT_STARTED")}},
+		{`UPDATE workflow_step_instances SET sequence_number=$2-sequence_number,status=CASE WHEN status='NOT_STARTED' THEN 'SKIPPED' ELSE status END,skipped_at=CASE WHEN status='NOT_STARTED' THEN NOW() ELSE skipped_at END,skipped_by_user_id=CASE WHEN status='NOT_STARTED' THEN NULLIF($3,'')::uuid ELSE skipped_by_user_id END,skip_reason=CASE WHEN status='NOT_STARTED' THEN $4 ELSE skip_reason END,customer_status_text=CASE WHEN status='NOT_STARTED' THEN $5 ELSE customer_status_text END,updated_at=NOW() WHERE workflow_instance_id=$1 AND sequence_number<0`, []any{workflowID, maxSequence, actor, fmt.Sprintf("removed in version %d", target.VersionNumber), customerStatus("SKIPPED")}},
+		{`INSERT INTO workflow_instance_field_definitions(workflow_instance_id,workflow_step_instance_id,source_field_definition_id,field_key,label_fa,description_fa,field_type,is_required,is_customer_visible,is_sales_visible,is_internal_cost,unit_code,currency_code,placeholder_fa,default_value,options_json,validation_json,sort_order,handoff_metric_key,handoff_direction) SELECT $1,si.id,d.id,d.field_key,d.label_fa,d.description_fa,d.field_type,d.is_required,d.is_customer_visible,d.is_sales_visible,d.is_internal_cost,d.unit_code,d.currency_code,d.placeholder_fa,d.default_value,d.options_json,d.validation_json,d.sort_order,d.handoff_metric_key,d.handoff_direction FROM workflow_step_instances si JOIN workflow_template_steps t ON t.workflow_template_id=$2 AND t.is_active AND t.step_code=si.step_code JOIN workflow_step_field_definitions d ON d.workflow_template_step_id=t.id WHERE si.workflow_instance_id=$1 ON CONFLICT(workflow_step_instance_id,field_key) DO UPDATE SET source_field_definition_id=EXCLUDED.source_field_definition_id,label_fa=EXCLUDED.label_fa,description_fa=EXCLUDED.description_fa,field_type=EXCLUDED.field_type,is_required=EXCLUDED.is_required,is_customer_visible=EXCLUDED.is_customer_visible,is_sales_visible=EXCLUDED.is_sales_visible,is_internal_cost=EXCLUDED.is_internal_cost,unit_code=EXCLUDED.unit_code,currency_code=EXCLUDED.currency_code,placeholder_fa=EXCLUDED.placeholder_fa,default_value=EXCLUDED.default_value,options_json=EXCLUDED.options_json,validation_json=EXCLUDED.validation_json,sort_order=EXCLUDED.sort_order,handoff_metric_key=EXCLUDED.handoff_metric_key,handoff_direction=EXCLUDED.handoff_direction`, []any{workflowID, target.ID}},
+		{`DELETE FROM workflow_instance_field_definitions f USING workflow_step_instances si WHERE si.id=f.workflow_step_instance_id AND si.workflow_instance_id=$1 AND si.step_code=ANY($3) AND NOT EXISTS(SELECT 1 FROM workflow_step_field_values v WHERE v.field_definition_id=f.id) AND NOT EXISTS(SELECT 1 FROM workflow_template_steps t JOIN workflow_step_field_definitions d ON d.workflow_template_step_id=t.id WHERE t.workflow_template_id=$2 AND t.is_active AND t.step_code=si.step_code AND d.field_key=f.field_key)`, []any{workflowID, target.ID, pq.Array(codes)}},
+		{`UPDATE workflow_instance_field_definitions f SET is_required=FALSE FROM workflow_step_instances si WHERE si.id=f.workflow_step_instance_id AND si.workflow_instance_id=$1 AND si.step_code=ANY($3) AND NOT EXISTS(SELECT 1 FROM workflow_template_steps t JOIN workflow_step_field_definitions d ON d.workflow_template_step_id=t.id WHERE t.workflow_template_id=$2 AND t.is_active AND t.step_code=si.step_code AND d.field_key=f.field_key)`, []any{workflowID, target.ID, pq.Array(codes)}},
+		{`DELETE FROM workflow_instance_step_task_templates k USING workflow_step_instances si WHERE si.id=k.workflow_step_instance_id AND k.workflow_instance_id=$1 AND si.step_code=ANY($2)`, []any{workflowID, pq.Array(codes)}},
+		{`INSERT INTO workflow_instance_step_task_templates(workflow_instance_id,workflow_step_instance_id,source_task_template_id,trigger_type,title_fa,description_fa,assigned_role_id,required_permission_code,priority,due_offset_hours,blocks_step_completion) SELECT $1,si.id,k.id,k.trigger_type,k.title_fa,k.description_fa,k.assigned_role_id,k.required_permission_code,k.priority,k.due_offset_hours,k.blocks_step_completion FROM workflow_step_instances si JOIN workflow_template_steps t ON t.workflow_template_id=$2 AND t.is_active AND t.step_code=si.step_code JOIN workflow_step_task_templates k ON k.workflow_template_step_id=t.id WHERE si.workflow_instance_id=$1`, []any{workflowID, target.ID}},
+		{`INSERT INTO workflow_instance_handoff_metrics(workflow_instance_id,source_metric_definition_id,metric_key,label_fa,unit_code,absolute_tolerance,percentage_tolerance,blocking_on_mismatch) SELECT $1,id,metric_key,label_fa,unit_code,absolute_tolerance,percentage_tolerance,blocking_on_mismatch FROM workflow_handoff_metric_definitions WHERE workflow_template_id=$2 ON CONFLICT(workflow_instance_id,metric_key) DO UPDATE SET source_metric_definition_id=EXCLUDED.source_metric_definition_id,label_fa=EXCLUDED.label_fa,unit_code=EXCLUDED.unit_code,absolute_tolerance=EXCLUDED.absolute_tolerance,percentage_tolerance=EXCLUDED.percentage_tolerance,blocking_on_mismatch=EXCLUDED.blocking_on_mismatch`, []any{workflowID, target.ID}},
+		{`DELETE FROM workflow_instance_handoff_metrics m WHERE m.workflow_instance_id=$1 AND NOT EXISTS(SELECT 1 FROM workflow_handoff_metric_definitions d WHERE d.workflow_template_id=$2 AND d.metric_key=m.metric_key)`, []any{workflowID, target.ID}},
+		{`DELETE FROM workflow_instance_task_templates WHERE workflow_instance_id=$1`, []any{workflowID}},
+		{`INSERT INTO workflow_instance_task_templates(workflow_instance_id,source_task_template_id,trigger_type,title_fa,description_fa,assigned_role_id,required_permission_code,priority,due_offset_hours,blocks_workflow_progress) SELECT $1,id,trigger_type,title_fa,description_fa,assigned_role_id,required_permission_code,priority,due_offset_hours,blocks_workflow_progress FROM workflow_task_templates WHERE workflow_template_id=$2`, []any{workflowID, target.ID}},
+		{`INSERT INTO workflow_instance_step_transitions(workflow_instance_id,source_template_step_id,target_template_step_id,source_step_code,target_step_code,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order,condition_expression) SELECT $1,t.source_step_id,t.target_step_id,s.step_code,d.step_code,t.transition_code,t.label_fa,t.transition_type,t.result_code,t.is_default,t.requires_permission_code,t.requires_reason,t.sort_order,t.condition_expression FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id JOIN workflow_template_steps d ON d.id=t.target_step_id WHERE t.workflow_template_id=$2 ON CONFLICT(workflow_instance_id,source_step_code,transition_code) DO UPDATE SET source_template_step_id=EXCLUDED.source_template_step_id,target_template_step_id=EXCLUDED.target_template_step_id,target_step_code=EXCLUDED.target_step_code,label_fa=EXCLUDED.label_fa,transition_type=EXCLUDED.transition_type,result_code=EXCLUDED.result_code,is_default=EXCLUDED.is_default,requires_permission_code=EXCLUDED.requires_permission_code,requires_reason=EXCLUDED.requires_reason,sort_order=EXCLUDED.sort_order,condition_expression=EXCLUDED.condition_expression`, []any{workflowID, target.ID}},
+		{`DELETE FROM workflow_instance_step_transitions x WHERE x.workflow_instance_id=$1 AND NOT EXISTS(SELECT 1 FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id WHERE t.workflow_template_id=$2 AND s.step_code=x.source_step_code AND t.transition_code=x.transition_code) AND NOT EXISTS(SELECT 1 FROM workflow_transition_selections ts WHERE ts.transition_snapshot_id=x.id) AND NOT EXISTS(SELECT 1 FROM workflow_join_arrivals a WHERE a.transition_snapshot_id=x.id)`, []any{workflowID, target.ID}},
+		{`UPDATE workflow_instance_document_requirements r SET source_requirement_id=tr.id,title_fa=tr.title_fa,is_required=tr.is_required,is_blocking=tr.is_blocking,customer_visible=tr.customer_visible FROM workflow_template_document_requirements tr LEFT JOIN workflow_template_steps ts ON ts.id=tr.workflow_template_step_id WHERE r.workflow_instance_id=$1 AND tr.workflow_template_id=$2 AND tr.document_type=r.document_type AND COALESCE(ts.step_code,'')=COALESCE((SELECT si.step_code FROM workflow_step_instances si WHERE si.id=r.workflow_step_instance_id),'')`, []any{workflowID, target.ID}},
+		{`INSERT INTO workflow_instance_document_requirements(workflow_instance_id,workflow_step_instance_id,source_requirement_id,document_type,title_fa,is_required,is_blocking,customer_visible) SELECT $1,(SELECT si.id FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND si.step_code=ts.step_code ORDER BY si.iteration_number DESC LIMIT 1),tr.id,tr.document_type,tr.title_fa,tr.is_required,tr.is_blocking,tr.customer_visible FROM workflow_template_document_requirements tr LEFT JOIN workflow_template_steps ts ON ts.id=tr.workflow_template_step_id WHERE tr.workflow_template_id=$2 AND NOT EXISTS(SELECT 1 FROM workflow_instance_document_requirements r WHERE r.workflow_instance_id=$1 AND r.source_requirement_id=tr.id)`, []any{workflowID, target.ID}},
+		{`UPDATE workflow_instance_document_requirements SET status='CANCELLED' WHERE workflow_instance_id=$1 AND status='PENDING' AND (source_requirement_id IS NULL OR source_requirement_id NOT IN (SELECT id FROM workflow_template_document_requirements WHERE workflow_template_id=$2))`, []any{workflowID, target.ID}},
+		{`UPDATE workflow_instances SET workflow_template_id=$2,template_group_code=$3,template_version_number=$4,updated_at=NOW() WHERE id=$1`, []any{workflowID, target.ID, target.TemplateGroupCode, target.VersionNumber}},
+	}
+	for _, st := range statements {
+		if _, err := tx.ExecContext(ctx, st.query, st.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-var fieldTypes = map[string]bool{"SHORT_TEXT": true, "LONG_TEXT": true, "INTEGER": true, "DECIMAL": true, "BOOLEAN": true, "DATE": true, "TIME": true, "DATETIME": true, "MONEY": true, "SELECT": true, "MULTI_SELECT": true, "PHONE": true, "ADDRESS": true, "WEIGHT": true, "AREA": true, "VOLUME": true, "QUANTITY": true, "IMAGE": true, "FILE": true, "SIGNATURE": true, "QC_CHECK": true}
+var fieldTypes = map[string]bool{"SHORT_TEXT": true, "LONG_TEXT": true, "INTEGER": true, "DECIMAL": true, "BOOLEAN": true, "DATE": true, "TIME": true, "DATETIME": true, "MONEY": true, "SELECT": true, "MULTI_SELECT": true, "PHONE": true, "ADDRESS": true, "WEIGHT": true, "AREA": true, "VOLUME": true, "QUANTITY": true, "IMAGE": true, "FILE": true, "SIGNATURE": true, "QC_CHECK": true, "COMPUTED": true}
 var stepTriggerTypes = map[string]bool{"ON_STEP_OPEN": true, "ON_STEP_START": true, "ON_STEP_SUBMIT": true, "ON_STEP_APPROVE": true, "ON_STEP_COMPLETE": true}
 
 type WorkflowStepCatalogueItem struct {
@@ -42,29 +42,35 @@ type WorkflowTemplateVersion struct {
 	Transitions           []WorkflowTransitionDefinition `json:"transitions,omitempty"`
 }
 type WorkflowTemplateStepV2 struct {
-	ID                     int64                     `json:"id"`
-	WorkflowTemplateID     int64                     `json:"workflow_template_id"`
-	StepCode               string                    `json:"step_code"`
-	InternalTitleFA        string                    `json:"internal_title_fa"`
-	InternalDescriptionFA  string                    `json:"internal_description_fa"`
-	CustomerTitleFA        string                    `json:"customer_title_fa"`
-	CustomerDescriptionFA  string                    `json:"customer_description_fa"`
-	SequenceNumber         int                       `json:"sequence_number"`
-	ResponsibleRoleID      *int64                    `json:"responsible_role_id,omitempty"`
-	ResponsibleRoleCode    string                    `json:"responsible_role_code,omitempty"`
-	RequiredPermissionCode string                    `json:"required_permission_code"`
-	CustomerVisible        bool                      `json:"customer_visible"`
-	RequiresApproval       bool                      `json:"requires_approval"`
-	ApprovalRoleID         *int64                    `json:"approval_role_id,omitempty"`
-	IsOptional             bool                      `json:"is_optional"`
-	IsSkippable            bool                      `json:"is_skippable"`
-	IsActive               bool                      `json:"is_active"`
-	DefaultDurationHours   int                       `json:"default_duration_hours"`
-	StartsAutomatically    bool                      `json:"starts_automatically"`
-	IsEntry                bool                      `json:"is_entry"`
-	DomainEventCode        *string                   `json:"domain_event_code,omitempty"`
-	Fields                 []WorkflowFieldDefinition `json:"fields"`
-	Tasks                  []WorkflowTaskTemplate    `json:"tasks"`
+	ID                     int64                       `json:"id"`
+	WorkflowTemplateID     int64                       `json:"workflow_template_id"`
+	StepCode               string                      `json:"step_code"`
+	InternalTitleFA        string                      `json:"internal_title_fa"`
+	InternalDescriptionFA  string                      `json:"internal_description_fa"`
+	CustomerTitleFA        string                      `json:"customer_title_fa"`
+	CustomerDescriptionFA  string                      `json:"customer_description_fa"`
+	SequenceNumber         int                         `json:"sequence_number"`
+	ResponsibleRoleID      *int64                      `json:"responsible_role_id,omitempty"`
+	ResponsibleRoleCode    string                      `json:"responsible_role_code,omitempty"`
+	RequiredPermissionCode string                      `json:"required_permission_code"`
+	CustomerVisible        bool                        `json:"customer_visible"`
+	RequiresApproval       bool                        `json:"requires_approval"`
+	ApprovalRoleID         *int64                      `json:"approval_role_id,omitempty"`
+	IsOptional             bool                        `json:"is_optional"`
+	IsSkippable            bool                        `json:"is_skippable"`
+	IsActive               bool                        `json:"is_active"`
+	DefaultDurationHours   int                         `json:"default_duration_hours"`
+	StartsAutomatically    bool                        `json:"starts_automatically"`
+	IsEntry                bool                        `json:"is_entry"`
+	DomainEventCode        *string                     `json:"domain_event_code,omitempty"`
+	JoinMode               string                      `json:"join_mode"`
+	JoinQuorum             *int                        `json:"join_quorum,omitempty"`
+	AssignmentStrategy     string                      `json:"assignment_strategy"`
+	CustomerActionable     bool                        `json:"customer_actionable"`
+	SLA                    *WorkflowStepSLAPolicy      `json:"sla,omitempty"`
+	ApprovalLevels         []WorkflowStepApprovalLevel `json:"approval_levels,omitempty"`
+	Fields                 []WorkflowFieldDefinition   `json:"fields"`
+	Tasks                  []WorkflowTaskTemplate      `json:"tasks"`
 }
 type WorkflowFieldDefinition struct {
 	ID                     int64           `json:"id"`
@@ -133,6 +139,9 @@ type WorkflowTemplatePayload struct {
 	ScopeType           string `json:"scope_type"`
 	MaxIterations       int    `json:"max_iterations"`
 }
+type WorkflowPublishPayload struct {
+	SignOffReason string `json:"sign_off_reason"`
+}
 type WorkflowStepPayload struct {
 	StepCode               string  `json:"step_code"`
 	InternalTitleFA        string  `json:"internal_title_fa"`
@@ -151,6 +160,10 @@ type WorkflowStepPayload struct {
 	StartsAutomatically    bool    `json:"starts_automatically"`
 	IsEntry                bool    `json:"is_entry"`
 	DomainEventCode        *string `json:"domain_event_code"`
+	JoinMode               string  `json:"join_mode"`
+	JoinQuorum             *int    `json:"join_quorum"`
+	AssignmentStrategy     string  `json:"assignment_strategy"`
+	CustomerActionable     bool    `json:"customer_actionable"`
 }
 type WorkflowFieldPayload struct {
 	FieldKey          string          `json:"field_key"`
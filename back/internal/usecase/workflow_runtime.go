@@ -65,42 +65,48 @@ type RuntimeBlocker struct {
 }
 type RuntimeAudit struct {
 	Actor      string    `json:"actor"`
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"`
 	ActionCode string    `json:"action_code"`
 	EntityType string    `json:"entity_type"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 type RuntimeStep struct {
-	ID                     string         `json:"id"`
-	StepCode               string         `json:"step_code"`
-	InternalTitleFA        string         `json:"internal_title_fa,omitempty"`
-	CustomerTitleFA        string         `json:"customer_title_fa"`
-	InternalDescriptionFA  string         `json:"internal_description_fa,omitempty"`
-	CustomerDescriptionFA  string         `json:"customer_description_fa,omitempty"`
-	SequenceNumber         int            `json:"sequence_number"`
-	Status                 string         `json:"status"`
-	CustomerStatus         string         `json:"customer_status"`
-	ResponsibleRoleID      *int64         `json:"responsible_role_id,omitempty"`
-	ResponsibleRoleName    string         `json:"responsible_role_name,omitempty"`
-	AssignedUserID         *string        `json:"assigned_user_id,omitempty"`
-	RequiredPermissionCode string         `json:"required_permission_code,omitempty"`
-	RequiresApproval       bool           `json:"requires_approval"`
-	ApprovalRoleID         *int64         `json:"approval_role_id,omitempty"`
-	IsOptional             bool           `json:"is_optional"`
-	IsSkippable            bool           `json:"is_skippable"`
-	CustomerVisible        bool           `json:"customer_visible"`
-	EstimatedStartAt       *time.Time     `json:"estimated_start_at,omitempty"`
-	EstimatedEndAt         *time.Time     `json:"estimated_end_at,omitempty"`
-	ActualStartAt          *time.Time     `json:"actual_start_at,omitempty"`
-	ActualEndAt            *time.Time     `json:"actual_end_at,omitempty"`
-	IsOverdue              bool           `json:"is_overdue"`
-	DelayHours             int            `json:"delay_hours"`
-	RejectionReason        *string        `json:"rejection_reason,omitempty"`
-	Fields                 []RuntimeField `json:"fields"`
-	OpenActionCount        int            `json:"open_action_count"`
-	HasDiscrepancy         bool           `json:"has_discrepancy"`
-	IterationNumber        int            `json:"iteration_number"`
-	PathState              string         `json:"path_state"`
-	DomainEventCode        *string        `json:"domain_event_code,omitempty"`
+	ID                     string                          `json:"id"`
+	StepCode               string                          `json:"step_code"`
+	InternalTitleFA        string                          `json:"internal_title_fa,omitempty"`
+	CustomerTitleFA        string                          `json:"customer_title_fa"`
+	InternalDescriptionFA  string                          `json:"internal_description_fa,omitempty"`
+	CustomerDescriptionFA  string                          `json:"customer_description_fa,omitempty"`
+	SequenceNumber         int                             `json:"sequence_number"`
+	Status                 string                          `json:"status"`
+	CustomerStatus         string                          `json:"customer_status"`
+	ResponsibleRoleID      *int64                          `json:"responsible_role_id,omitempty"`
+	ResponsibleRoleName    string                          `json:"responsible_role_name,omitempty"`
+	AssignedUserID         *string                         `json:"assigned_user_id,omitempty"`
+	RequiredPermissionCode string                          `json:"required_permission_code,omitempty"`
+	RequiresApproval       bool                            `json:"requires_approval"`
+	ApprovalRoleID         *int64                          `json:"approval_role_id,omitempty"`
+	ApprovalLevels         []WorkflowApprovalLevelProgress `json:"approval_levels,omitempty"`
+	ApprovalDecisions      []WorkflowApprovalDecision      `json:"approval_decisions,omitempty"`
+	IsOptional             bool                            `json:"is_optional"`
+	IsSkippable            bool                            `json:"is_skippable"`
+	CustomerVisible        bool                            `json:"customer_visible"`
+	CustomerActionable     bool                            `json:"customer_actionable"`
+	EstimatedStartAt       *time.Time                      `json:"estimated_start_at,omitempty"`
+	EstimatedEndAt         *time.Time                      `json:"estimated_end_at,omitempty"`
+	ActualStartAt          *time.Time                      `json:"actual_start_at,omitempty"`
+	ActualEndAt            *time.Time                      `json:"actual_end_at,omitempty"`
+	IsOverdue              bool                            `json:"is_overdue"`
+	SLADueAt               *time.Time                      `json:"sla_due_at,omitempty"`
+	SLABreached            bool                            `json:"sla_breached"`
+	DelayHours             int                             `json:"delay_hours"`
+	RejectionReason        *string                         `json:"rejection_reason,omitempty"`
+	Fields                 []RuntimeField                  `json:"fields"`
+	OpenActionCount        int                             `json:"open_action_count"`
+	HasDiscrepancy         bool                            `json:"has_discrepancy"`
+	IterationNumber        int                             `json:"iteration_number"`
+	PathState              string                          `json:"path_state"`
+	DomainEventCode        *string                         `json:"domain_event_code,omitempty"`
 }
 type RuntimeField struct {
 	ID                int64           `json:"id"`
@@ -183,7 +189,7 @@ type WorkflowDashboardSummary struct {
 func (s *OperationsService) WorkflowDashboard(ctx context.Context, actor string) (WorkflowDashboardSummary, error) {
 	var out WorkflowDashboardSummary
 	viewAll := s.HasPermission(ctx, actor, "workflow_instances.view_all")
-	err := s.db.QueryRowContext(ctx, `WITH accessible AS (SELECT wi.id FROM workflow_instances wi WHERE $2 OR EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=wi.id AND (si.assigned_user_id=$1 OR (si.assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$1 AND ur.role_id=si.responsible_role_id))))) SELECT
+	err := s.db.QueryRowContext(ctx, `WITH accessible AS (SELECT wi.id FROM workflow_instances wi WHERE $2 OR EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=wi.id AND (`+workflowWorkSQL("si.assigned_user_id", "si.responsible_role_id", "$1")+`))) SELECT
 	(SELECT COUNT(*) FROM workflow_instances wi JOIN accessible a ON a.id=wi.id WHERE wi.status='IN_PROGRESS'),
 	(SELECT COUNT(*) FROM workflow_step_instances si JOIN accessible a ON a.id=si.workflow_instance_id WHERE si.status IN ('WAITING_FOR_ASSIGNEE','NEEDS_CORRECTION')),
 	(SELECT COUNT(*) FROM workflow_step_instances si JOIN accessible a ON a.id=si.workflow_instance_id WHERE si.status='WAITING_FOR_APPROVAL'),
@@ -240,7 +246,7 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 			return errors.New("only optional steps may be excluded")
 		}
 	}
-	rows, err := tx.QueryContext(ctx, `SELECT s.id,s.step_code,s.internal_title_fa,s.internal_description_fa,s.customer_title_fa,s.customer_description_fa,s.sequence_number,s.responsible_role_id,s.required_permission_code,s.customer_visible,s.requires_approval,s.approval_role_id,s.is_optional,s.is_skippable,s.default_duration_hours,s.starts_automatically,s.domain_event_code,s.is_entry FROM workflow_template_steps s WHERE s.workflow_template_id=$1 AND s.is_active ORDER BY s.sequence_number`, templateID)
+	rows, err := tx.QueryContext(ctx, `SELECT s.id,s.step_code,s.internal_title_fa,s.internal_description_fa,s.customer_title_fa,s.customer_description_fa,s.sequence_number,s.responsible_role_id,s.required_permission_code,s.customer_visible,s.requires_approval,s.approval_role_id,s.is_optional,s.is_skippable,s.default_duration_hours,s.starts_automatically,s.domain_event_code,s.is_entry,CASE s.join_mode WHEN 'QUORUM' THEN s.join_quorum WHEN 'ALL' THEN (SELECT COUNT(*) FROM workflow_step_transitions t JOIN workflow_template_steps src ON src.id=t.source_step_id WHERE t.target_step_id=s.id AND src.is_active AND NOT src.step_code=ANY($2)) END FROM workflow_template_steps s WHERE s.workflow_template_id=$1 AND s.is_active ORDER BY s.sequence_number`, templateID, pq.Array(normalizedExcluded))
 	if err != nil {
 		return err
 	}
@@ -249,13 +255,13 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 		code, it, idsc, ct, cdsc, perm                              string
 		domainEvent                                                 sql.NullString
 		seq, duration                                               int
-		role, approval                                              sql.NullInt64
+		role, approval, joinRequired                                sql.NullInt64
 		visible, requiresApproval, optional, skippable, auto, entry bool
 	}
 	steps := []snapshotStep{}
 	for rows.Next() {
 		var step snapshotStep
-		if err := rows.Scan(&step.templateStepID, &step.code, &step.it, &step.idsc, &step.ct, &step.cdsc, &step.seq, &step.role, &step.perm, &step.visible, &step.requiresApproval, &step.approval, &step.optional, &step.skippable, &step.duration, &step.auto, &step.domainEvent, &step.entry); err != nil {
+		if err := rows.Scan(&step.templateStepID, &step.code, &step.it, &step.idsc, &step.ct, &step.cdsc, &step.seq, &step.role, &step.perm, &step.visible, &step.requiresApproval, &step.approval, &step.optional, &step.skippable, &step.duration, &step.auto, &step.domainEvent, &step.entry, &step.joinRequired); err != nil {
 			rows.Close()
 			return err
 		}
@@ -271,6 +277,10 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 		return err
 	}
 	start := time.Now()
+	calendar, err := s.workflowCalendarTx(ctx, tx, workflowID, start)
+	if err != nil {
+		return err
+	}
 	cursor := start
 	var firstID string
 	var workflowEnd time.Time
@@ -280,7 +290,7 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 		role, approval := step.role, step.approval
 		visible, requiresApproval, optional, skippable, auto := step.visible, step.requiresApproval, step.optional, step.skippable, step.auto
 		estimatedStart := cursor
-		cursor = cursor.Add(time.Duration(duration) * time.Hour)
+		cursor = calendar.add(cursor, time.Duration(duration)*time.Hour)
 		estimatedEnd := cursor
 		workflowEnd = estimatedEnd
 		status := "NOT_STARTED"
@@ -303,7 +313,7 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 			}
 		}
 		var stepID string
-		err = tx.QueryRowContext(ctx, `INSERT INTO workflow_step_instances(workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,status,assigned_role_id,responsible_role_id,assigned_user_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,estimated_start_at,estimated_end_at,actual_start_at,customer_status_text,domain_event_code) VALUES($1,$2,$2,$3,$4,$5,$6,$7,$8,$9,$10,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23) RETURNING id`, workflowID, templateStepID, code, it, idsc, ct, cdsc, seq, status, nullableInt(role), assigned, perm, requiresApproval, nullableInt(approval), optional, skippable, auto, visible, estimatedStart, estimatedEnd, actualStart, customerStatus(status), step.domainEvent).Scan(&stepID)
+		err = tx.QueryRowContext(ctx, `INSERT INTO workflow_step_instances(workflow_instance_id,workflow_template_step_id,template_step_id,step_code,internal_title_fa,internal_description_fa,customer_title_fa,customer_description_fa,sequence_number,status,assigned_role_id,responsible_role_id,assigned_user_id,required_permission_code,requires_approval,approval_role_id,is_optional,is_skippable,starts_automatically,customer_visible,estimated_start_at,estimated_end_at,actual_start_at,customer_status_text,domain_event_code,join_required_count) VALUES($1,$2,$2,$3,$4,$5,$6,$7,$8,$9,$10,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24) RETURNING id`, workflowID, templateStepID, code, it, idsc, ct, cdsc, seq, status, nullableInt(role), assigned, perm, requiresApproval, nullableInt(approval), optional, skippable, auto, visible, estimatedStart, estimatedEnd, actualStart, customerStatus(status), step.domainEvent, nullableInt(step.joinRequired)).Scan(&stepID)
 		if err != nil {
 			return err
 		}
@@ -330,7 +340,7 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 	if err != nil {
 		return err
 	}
-	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_instance_step_transitions(workflow_instance_id,source_template_step_id,target_template_step_id,source_step_code,target_step_code,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order) SELECT $1,t.source_step_id,t.target_step_id,s.step_code,d.step_code,t.transition_code,t.label_fa,t.transition_type,t.result_code,t.is_default,t.requires_permission_code,t.requires_reason,t.sort_order FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id JOIN workflow_template_steps d ON d.id=t.target_step_id WHERE t.workflow_template_id=$2`, workflowID, templateID)
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_instance_step_transitions(workflow_instance_id,source_template_step_id,target_template_step_id,source_step_code,target_step_code,transition_code,label_fa,transition_type,result_code,is_default,requires_permission_code,requires_reason,sort_order,condition_expression) SELECT $1,t.source_step_id,t.target_step_id,s.step_code,d.step_code,t.transition_code,t.label_fa,t.transition_type,t.result_code,t.is_default,t.requires_permission_code,t.requires_reason,t.sort_order,t.condition_expression FROM workflow_step_transitions t JOIN workflow_template_steps s ON s.id=t.source_step_id JOIN workflow_template_steps d ON d.id=t.target_step_id WHERE t.workflow_template_id=$2`, workflowID, templateID)
 	if err != nil {
 		return err
 	}
@@ -351,6 +361,9 @@ func (s *OperationsService) snapshotWorkflowTx(ctx context.Context, tx *sql.Tx,
 	if err = s.createMainStepActionTx(ctx, tx, workflowID, firstID); err != nil {
 		return err
 	}
+	if err = s.startStepSLATx(ctx, tx, firstID); err != nil {
+		return err
+	}
 	if err = s.runWorkflowTriggersTx(ctx, tx, workflowID, "ON_WORKFLOW_START"); err != nil {
 		return err
 	}
@@ -365,11 +378,55 @@ func nullableInt(v sql.NullInt64) any {
 }
 
 func (s *OperationsService) createMainStepActionTx(ctx context.Context, tx *sql.Tx, workflowID, stepID string) error {
+	if err := s.assignOpenedStepTx(ctx, tx, workflowID, stepID); err != nil {
+		return err
+	}
 	_, err := tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,assigned_user_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,si.internal_title_fa,si.internal_description_fa,'OPEN','NORMAL',si.responsible_role_id,si.assigned_user_id,si.required_permission_code,si.estimated_end_at,'main:'||si.id,'MAIN_STEP' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 AND wi.id=$2 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID, workflowID)
 	return err
 }
+
+// taskDueTimesTx resolves the due_offset_hours of a workflow's task
+// templates in working hours from now. The pair is bound to
+// UNNEST(hours::int[],due::text[]) by the trigger queries.
+func (s *OperationsService) taskDueTimesTx(ctx context.Context, tx *sql.Tx, workflowID string) (any, any, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT due_offset_hours FROM workflow_instance_step_task_templates WHERE workflow_instance_id=$1 AND due_offset_hours IS NOT NULL UNION SELECT due_offset_hours FROM workflow_instance_task_templates WHERE workflow_instance_id=$1 AND due_offset_hours IS NOT NULL`, workflowID)
+	if err != nil {
+		return nil, nil, err
+	}
+	hours := []int64{}
+	for rows.Next() {
+		var h int64
+		if err = rows.Scan(&h); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		hours = append(hours, h)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, nil, err
+	}
+	rows.Close()
+	due := make([]string, len(hours))
+	if len(hours) > 0 {
+		now := time.Now()
+		calendar, err := s.workflowCalendarTx(ctx, tx, workflowID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, h := range hours {
+			due[i] = calendar.add(now, time.Duration(h)*time.Hour).Format(time.RFC3339)
+		}
+	}
+	return pq.Array(hours), pq.Array(due), nil
+}
+
 func (s *OperationsService) runStepTriggersTx(ctx context.Context, tx *sql.Tx, workflowID, stepID, event string) error {
-	_, err := tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type,is_blocking) SELECT wi.id,t.workflow_step_instance_id,wi.order_id,wi.customer_user_id,t.title_fa,t.description_fa,'OPEN',t.priority,t.assigned_role_id,t.required_permission_code,CASE WHEN t.due_offset_hours IS NULL THEN NULL ELSE NOW()+MAKE_INTERVAL(hours=>t.due_offset_hours) END,'step-task:'||t.id||':'||$3,t.trigger_type,t.blocks_step_completion FROM workflow_instance_step_task_templates t JOIN workflow_instances wi ON wi.id=t.workflow_instance_id WHERE t.workflow_instance_id=$1 AND t.workflow_step_instance_id=$2 AND t.trigger_type=$3 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, workflowID, stepID, event)
+	hours, due, err := s.taskDueTimesTx(ctx, tx, workflowID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type,is_blocking) SELECT wi.id,t.workflow_step_instance_id,wi.order_id,wi.customer_user_id,t.title_fa,t.description_fa,'OPEN',t.priority,t.assigned_role_id,t.required_permission_code,(SELECT u.due::timestamptz FROM UNNEST($4::int[],$5::text[]) u(hours,due) WHERE u.hours=t.due_offset_hours),'step-task:'||t.id||':'||$3,t.trigger_type,t.blocks_step_completion FROM workflow_instance_step_task_templates t JOIN workflow_instances wi ON wi.id=t.workflow_instance_id WHERE t.workflow_instance_id=$1 AND t.workflow_step_instance_id=$2 AND t.trigger_type=$3 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, workflowID, stepID, event, hours, due)
 	if err != nil {
 		return err
 	}
@@ -384,7 +441,11 @@ func (s *OperationsService) runStepTriggersTx(ctx context.Context, tx *sql.Tx, w
 	return err
 }
 func (s *OperationsService) runWorkflowTriggersTx(ctx context.Context, tx *sql.Tx, workflowID, event string) error {
-	_, err := tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type,is_blocking) SELECT wi.id,wi.order_id,wi.customer_user_id,t.title_fa,t.description_fa,'OPEN',t.priority,t.assigned_role_id,t.required_permission_code,CASE WHEN t.due_offset_hours IS NULL THEN NULL ELSE NOW()+MAKE_INTERVAL(hours=>t.due_offset_hours) END,'workflow-task:'||t.id||':'||$2,t.trigger_type,t.blocks_workflow_progress FROM workflow_instance_task_templates t JOIN workflow_instances wi ON wi.id=t.workflow_instance_id WHERE t.workflow_instance_id=$1 AND t.trigger_type=$2 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, workflowID, event)
+	hours, due, err := s.taskDueTimesTx(ctx, tx, workflowID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type,is_blocking) SELECT wi.id,wi.order_id,wi.customer_user_id,t.title_fa,t.description_fa,'OPEN',t.priority,t.assigned_role_id,t.required_permission_code,(SELECT u.due::timestamptz FROM UNNEST($3::int[],$4::text[]) u(hours,due) WHERE u.hours=t.due_offset_hours),'workflow-task:'||t.id||':'||$2,t.trigger_type,t.blocks_workflow_progress FROM workflow_instance_task_templates t JOIN workflow_instances wi ON wi.id=t.workflow_instance_id WHERE t.workflow_instance_id=$1 AND t.trigger_type=$2 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, workflowID, event, hours, due)
 	return err
 }
 
@@ -413,7 +474,7 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 	canAll := s.HasPermission(ctx, actor, "workflow_instances.view_all")
 	canAssigned := false
 	if s.HasPermission(ctx, actor, "workflow_instances.view_assigned") {
-		_ = s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND (si.assigned_user_id=$2 OR (si.assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$2 AND ur.role_id=si.responsible_role_id))))`, workflowID, actor).Scan(&canAssigned)
+		_ = s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND (`+workflowWorkSQL("si.assigned_user_id", "si.responsible_role_id", "$2")+`))`, workflowID, actor).Scan(&canAssigned)
 	}
 	if !isCustomer && !canAll && !canAssigned {
 		return w, ErrForbidden
@@ -425,7 +486,7 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 	} else {
 		w.ViewMode = "INTERNAL"
 	}
-	rows, err := s.db.QueryContext(ctx, `SELECT si.id,COALESCE(si.step_code,ts.step_code),COALESCE(si.internal_title_fa,ts.internal_title_fa),COALESCE(si.internal_description_fa,''),COALESCE(si.customer_title_fa,ts.customer_title_fa),COALESCE(si.customer_description_fa,''),COALESCE(si.sequence_number,ts.sequence_number),si.status,si.responsible_role_id,COALESCE(r.name_fa,''),si.assigned_user_id,COALESCE(si.required_permission_code,''),si.requires_approval,si.approval_role_id,si.is_optional,si.is_skippable,si.customer_visible,si.estimated_start_at,si.estimated_end_at,si.actual_start_at,si.actual_end_at,si.rejection_reason,(SELECT COUNT(*) FROM action_items a WHERE a.workflow_step_instance_id=si.id AND a.status NOT IN ('COMPLETED','CANCELLED')),(SELECT EXISTS(SELECT 1 FROM workflow_discrepancies d WHERE (d.source_step_instance_id=si.id OR d.target_step_instance_id=si.id) AND d.status NOT IN ('RESOLVED','CANCELLED'))),si.iteration_number,si.path_state,si.domain_event_code FROM workflow_step_instances si LEFT JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id LEFT JOIN roles r ON r.id=si.responsible_role_id WHERE si.workflow_instance_id=$1 ORDER BY COALESCE(si.sequence_number,ts.sequence_number),si.iteration_number`, workflowID)
+	rows, err := s.db.QueryContext(ctx, `SELECT si.id,COALESCE(si.step_code,ts.step_code),COALESCE(si.internal_title_fa,ts.internal_title_fa),COALESCE(si.internal_description_fa,''),COALESCE(si.customer_title_fa,ts.customer_title_fa),COALESCE(si.customer_description_fa,''),COALESCE(si.sequence_number,ts.sequence_number),si.status,si.responsible_role_id,COALESCE(r.name_fa,''),si.assigned_user_id,COALESCE(si.required_permission_code,''),si.requires_approval,si.approval_role_id,si.is_optional,si.is_skippable,si.customer_visible,COALESCE(ts.customer_actionable,FALSE),si.estimated_start_at,si.estimated_end_at,si.actual_start_at,si.actual_end_at,si.rejection_reason,(SELECT COUNT(*) FROM action_items a WHERE a.workflow_step_instance_id=si.id AND a.status NOT IN ('COMPLETED','CANCELLED')),(SELECT EXISTS(SELECT 1 FROM workflow_discrepancies d WHERE (d.source_step_instance_id=si.id OR d.target_step_instance_id=si.id) AND d.status NOT IN ('RESOLVED','CANCELLED'))),si.iteration_number,si.path_state,si.domain_event_code,(SELECT due_at FROM workflow_step_sla_timers WHERE workflow_step_instance_id=si.id) FROM workflow_step_instances si LEFT JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id LEFT JOIN roles r ON r.id=si.responsible_role_id WHERE si.workflow_instance_id=$1 ORDER BY COALESCE(si.sequence_number,ts.sequence_number),si.iteration_number`, workflowID)
 	if err != nil {
 		return w, err
 	}
@@ -435,8 +496,8 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 		var st RuntimeStep
 		var role, approval sql.NullInt64
 		var assigned, rejection, domainEvent sql.NullString
-		var es, ee, as, ae sql.NullTime
-		if err := rows.Scan(&st.ID, &st.StepCode, &st.InternalTitleFA, &st.InternalDescriptionFA, &st.CustomerTitleFA, &st.CustomerDescriptionFA, &st.SequenceNumber, &st.Status, &role, &st.ResponsibleRoleName, &assigned, &st.RequiredPermissionCode, &st.RequiresApproval, &approval, &st.IsOptional, &st.IsSkippable, &st.CustomerVisible, &es, &ee, &as, &ae, &rejection, &st.OpenActionCount, &st.HasDiscrepancy, &st.IterationNumber, &st.PathState, &domainEvent); err != nil {
+		var es, ee, as, ae, slaDue sql.NullTime
+		if err := rows.Scan(&st.ID, &st.StepCode, &st.InternalTitleFA, &st.InternalDescriptionFA, &st.CustomerTitleFA, &st.CustomerDescriptionFA, &st.SequenceNumber, &st.Status, &role, &st.ResponsibleRoleName, &assigned, &st.RequiredPermissionCode, &st.RequiresApproval, &approval, &st.IsOptional, &st.IsSkippable, &st.CustomerVisible, &st.CustomerActionable, &es, &ee, &as, &ae, &rejection, &st.OpenActionCount, &st.HasDiscrepancy, &st.IterationNumber, &st.PathState, &domainEvent, &slaDue); err != nil {
 			return w, err
 		}
 		if isCustomer && (!st.CustomerVisible || st.Status == "SKIPPED" || st.PathState != "INCLUDED") {
@@ -471,6 +532,11 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 				st.DelayHours = int(now.Sub(v).Hours())
 			}
 		}
+		if slaDue.Valid && !isCustomer {
+			v := slaDue.Time
+			st.SLADueAt = &v
+			st.SLABreached = now.After(v) && st.Status != "COMPLETED" && st.Status != "SKIPPED" && st.Status != "CANCELLED"
+		}
 		if as.Valid {
 			v := as.Time
 			st.ActualStartAt = &v
@@ -481,6 +547,10 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 		}
 		st.CustomerStatus = customerStatus(st.Status)
 		st.Fields, _ = s.runtimeFields(ctx, actor, st.ID, w.ViewMode)
+		if st.RequiresApproval && !isCustomer {
+			st.ApprovalLevels, _ = approvalChain(ctx, s.db, st.ID)
+			st.ApprovalDecisions, _ = s.approvalDecisions(ctx, st.ID)
+		}
 		if isCustomer {
 			st.InternalTitleFA = ""
 			st.InternalDescriptionFA = ""
@@ -526,11 +596,11 @@ func (s *OperationsService) GetWorkflowRuntime(ctx context.Context, actor, workf
 			}
 		}
 		if s.HasPermission(ctx, actor, "audit.view") {
-			rows, _ := s.db.QueryContext(ctx, `SELECT COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized,'سیستم'),a.action_code,a.entity_type,a.created_at FROM audit_logs a LEFT JOIN users u ON u.id=a.actor_user_id WHERE (a.entity_type='workflow_instance' AND a.entity_id=$1) OR (a.entity_type='workflow_step_instance' AND a.entity_id IN (SELECT id::text FROM workflow_step_instances WHERE workflow_instance_id=$1)) ORDER BY a.created_at DESC LIMIT 30`, workflowID)
+			rows, _ := s.db.QueryContext(ctx, `SELECT COALESCE(NULLIF(TRIM(CONCAT_WS(' ',u.first_name,u.last_name)),''),u.phone_normalized,'سیستم'),COALESCE(NULLIF(TRIM(CONCAT_WS(' ',ob.first_name,ob.last_name)),''),ob.phone_normalized,''),a.action_code,a.entity_type,a.created_at FROM audit_logs a LEFT JOIN users u ON u.id=a.actor_user_id LEFT JOIN users ob ON ob.id=a.on_behalf_of_user_id WHERE (a.entity_type='workflow_instance' AND a.entity_id=$1) OR (a.entity_type='workflow_step_instance' AND a.entity_id IN (SELECT id::text FROM workflow_step_instances WHERE workflow_instance_id=$1)) ORDER BY a.created_at DESC LIMIT 30`, workflowID)
 			if rows != nil {
 				for rows.Next() {
 					var item RuntimeAudit
-					if rows.Scan(&item.Actor, &item.ActionCode, &item.EntityType, &item.CreatedAt) == nil {
+					if rows.Scan(&item.Actor, &item.OnBehalfOf, &item.ActionCode, &item.EntityType, &item.CreatedAt) == nil {
 						w.AuditSummary = append(w.AuditSummary, item)
 					}
 				}
@@ -587,7 +657,7 @@ func (s *OperationsService) runtimeFields(ctx context.Context, actor, stepID, mo
 }
 func (s *OperationsService) runtimeActions(ctx context.Context, actor, workflowID string) ([]RuntimeAction, error) {
 	viewAll := s.HasPermission(ctx, actor, "action_items.view_all")
-	rows, err := s.db.QueryContext(ctx, `SELECT id,workflow_step_instance_id,title_fa,status,priority,due_at,is_blocking,COALESCE(source_trigger_type,'') FROM action_items WHERE workflow_instance_id=$1 AND status NOT IN ('COMPLETED','CANCELLED') AND COALESCE(source_trigger_type,'') NOT IN ('MAIN_STEP','APPROVAL','CORRECTION') AND ($3 OR assigned_user_id=$2 OR (assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$2 AND ur.role_id=action_items.assigned_role_id))) ORDER BY is_blocking DESC,due_at NULLS LAST`, workflowID, actor, viewAll)
+	rows, err := s.db.QueryContext(ctx, `SELECT id,workflow_step_instance_id,title_fa,status,priority,due_at,is_blocking,COALESCE(source_trigger_type,'') FROM action_items WHERE workflow_instance_id=$1 AND status NOT IN ('COMPLETED','CANCELLED') AND COALESCE(source_trigger_type,'') NOT IN ('MAIN_STEP','APPROVAL','CORRECTION') AND ($3 OR `+workflowWorkSQL("action_items.assigned_user_id", "action_items.assigned_role_id", "$2")+`) ORDER BY is_blocking DESC,due_at NULLS LAST`, workflowID, actor, viewAll)
 	if err != nil {
 		return nil, err
 	}
@@ -618,30 +688,57 @@ func (s *OperationsService) lockStepTx(ctx context.Context, tx *sql.Tx, stepID s
 	return
 }
 func (s *OperationsService) canOperateStep(ctx context.Context, actor, perm string, roleID sql.NullInt64, assigned sql.NullString) bool {
+	_, ok := s.stepActor(ctx, actor, perm, roleID, assigned)
+	return ok
+}
+
+// stepActor reports whether actor may operate a step. An actor standing in
+// for the assignee or a role member through a delegation acts with the
+// delegator's permission, and the returned context audits them on their
+// behalf.
+func (s *OperationsService) stepActor(ctx context.Context, actor, perm string, roleID sql.NullInt64, assigned sql.NullString) (context.Context, bool) {
 	if assigned.Valid && assigned.String == actor {
-		return perm == "" || s.HasPermission(ctx, actor, perm)
+		return ctx, perm == "" || s.HasPermission(ctx, actor, perm)
 	}
 	if roleID.Valid && s.userHasRole(ctx, actor, s.roleCode(ctx, roleID.Int64)) {
-		return perm == "" || s.HasPermission(ctx, actor, perm)
+		return ctx, perm == "" || s.HasPermission(ctx, actor, perm)
 	}
-	return false
+	if delegator := s.delegatorFor(ctx, actor, roleID, assigned); delegator != "" && (perm == "" || s.HasPermission(ctx, delegator, perm)) {
+		return withOnBehalfOf(ctx, delegator), true
+	}
+	return ctx, false
+}
+
+// approvalActor reports whether actor may decide a step awaiting approval
+// by role with perm, directly or standing in for a member of the role.
+func (s *OperationsService) approvalActor(ctx context.Context, actor, perm string, role sql.NullInt64) (context.Context, bool) {
+	if !role.Valid {
+		return ctx, false
+	}
+	if s.userHasRole(ctx, actor, s.roleCode(ctx, role.Int64)) && s.HasPermission(ctx, actor, perm) {
+		return ctx, true
+	}
+	if delegator := s.delegatorFor(ctx, actor, role, sql.NullString{}); delegator != "" && s.HasPermission(ctx, delegator, perm) {
+		return withOnBehalfOf(ctx, delegator), true
+	}
+	return ctx, false
 }
 func (s *OperationsService) roleCode(ctx context.Context, id int64) string {
 	var code string
 	_ = s.db.QueryRowContext(ctx, `SELECT code FROM roles WHERE id=$1`, id).Scan(&code)
 	return code
 }
-func (s *OperationsService) requireStepActor(ctx context.Context, actor, perm string, role sql.NullInt64, assigned sql.NullString, reason string) (bool, error) {
-	if s.canOperateStep(ctx, actor, perm, role, assigned) {
-		return false, nil
+func (s *OperationsService) requireStepActor(ctx context.Context, actor, perm string, role sql.NullInt64, assigned sql.NullString, reason string) (context.Context, bool, error) {
+	if stepCtx, ok := s.stepActor(ctx, actor, perm, role, assigned); ok {
+		return stepCtx, false, nil
 	}
 	if s.HasPermission(ctx, actor, "workflow_steps.override") {
 		if strings.TrimSpace(reason) == "" {
-			return false, errors.New("override reason is required")
+			return ctx, false, errors.New("override reason is required")
 		}
-		return true, nil
+		return ctx, true, nil
 	}
-	return false, ErrForbidden
+	return ctx, false, ErrForbidden
 }
 
 func (s *OperationsService) StartWorkflowStep(ctx context.Context, actor, stepID, reason string) error {
@@ -660,7 +757,7 @@ func (s *OperationsService) StartWorkflowStep(ctx context.Context, actor, stepID
 	if !validWorkflowStepTransition(status, "IN_PROGRESS") {
 		return ErrInvalidTransition
 	}
-	override, err := s.requireStepActor(ctx, actor, perm, role, assigned, reason)
+	ctx, override, err := s.requireStepActor(ctx, actor, perm, role, assigned, reason)
 	if err != nil {
 		return err
 	}
@@ -698,7 +795,7 @@ func (s *OperationsService) SaveWorkflowStepDraft(ctx context.Context, actor, st
 	if status != "IN_PROGRESS" {
 		return ErrInvalidTransition
 	}
-	override, err := s.requireStepActor(ctx, actor, perm, role, assigned, p.Reason)
+	ctx, override, err := s.requireStepActor(ctx, actor, perm, role, assigned, p.Reason)
 	if err != nil {
 		return err
 	}
@@ -737,9 +834,17 @@ func (s *OperationsService) saveValuesTx(ctx context.Context, tx *sql.Tx, actor,
 		return err
 	}
 	seen := map[string]bool{}
+	computed := []computedFieldDefinition{}
 	for _, definition := range definitions {
 		id, key, kind, required, opts, val, unit, currency := definition.id, definition.key, definition.kind, definition.required, definition.opts, definition.val, definition.unit, definition.currency
 		raw, ok := values[key]
+		if kind == "COMPUTED" {
+			if ok {
+				return fmt.Errorf("%w: %s is computed and cannot be entered", ErrValidation, key)
+			}
+			computed = append(computed, computedFieldDefinition{id: id, key: key, formula: formulaSource(val), unit: unit.String, required: required, validation: val})
+			continue
+		}
 		if !ok {
 			if requireAll && required {
 				var exists bool
@@ -784,7 +889,7 @@ func (s *OperationsService) saveValuesTx(ctx context.Context, tx *sql.Tx, actor,
 			return fmt.Errorf("%w: unknown field %s", ErrValidation, key)
 		}
 	}
-	return nil
+	return computeStepFieldsTx(ctx, tx, actor, stepID, computed, requireAll)
 }
 func validateRuntimeValue(kind string, raw, options, validation []byte, required bool, expectedUnit, expectedCurrency string) error {
 	if len(raw) == 0 || string(raw) == "null" {
@@ -845,6 +950,23 @@ func validateRuntimeValue(kind string, raw, options, validation []byte, required
 		if !ok || unit == "" || (expectedUnit != "" && unit != expectedUnit) {
 			return errors.New("invalid unit")
 		}
+	case "COMPUTED":
+		if expectedUnit == "" {
+			if _, ok := v.(float64); !ok {
+				return errors.New("numeric value required")
+			}
+			break
+		}
+		object, ok := v.(map[string]any)
+		if !ok {
+			return errors.New("measurement object required")
+		}
+		if _, ok = object["value"].(float64); !ok {
+			return errors.New("numeric value required")
+		}
+		if unit, _ := object["unit"].(string); unit != expectedUnit {
+			return errors.New("invalid unit")
+		}
 	case "MONEY":
 		object, ok := v.(map[string]any)
 		if !ok {
@@ -986,11 +1108,23 @@ func (s *OperationsService) submitWorkflowStepTx(ctx context.Context, tx *sql.Tx
 	if status != "IN_PROGRESS" {
 		return ErrInvalidTransition
 	}
-	override, err := s.requireStepActor(ctx, actor, perm, role, assigned, p.Reason)
+	ctx, override, err := s.requireStepActor(ctx, actor, perm, role, assigned, p.Reason)
 	if err != nil {
 		return err
 	}
-	if err = s.saveValuesTx(ctx, tx, actor, stepID, p.Values, true); err != nil {
+	if err = s.processStepSubmissionTx(ctx, tx, actor, workflowID, stepID, approval, p); err != nil {
+		return err
+	}
+	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.submit", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": p.Reason})
+	return nil
+}
+
+// processStepSubmissionTx saves the submitted values of an IN_PROGRESS step
+// and moves it on: to HAS_MISMATCH, BLOCKED, WAITING_FOR_APPROVAL or
+// COMPLETED. Callers authorize the actor and audit the submission.
+func (s *OperationsService) processStepSubmissionTx(ctx context.Context, tx *sql.Tx, actor, workflowID, stepID string, approval bool, p StepValuesPayload) error {
+	err := s.saveValuesTx(ctx, tx, actor, stepID, p.Values, true)
+	if err != nil {
 		return err
 	}
 	var domainEvent sql.NullString
@@ -1016,6 +1150,9 @@ func (s *OperationsService) submitWorkflowStepTx(ctx context.Context, tx *sql.Tx
 			return err
 		}
 	}
+	if err = s.evaluateStepConditionsTx(ctx, tx, actor, workflowID, stepID); err != nil {
+		return err
+	}
 	if err = s.runStepTriggersTx(ctx, tx, workflowID, stepID, "ON_STEP_SUBMIT"); err != nil {
 		return err
 	}
@@ -1055,8 +1192,7 @@ func (s *OperationsService) submitWorkflowStepTx(ctx context.Context, tx *sql.Tx
 			return err
 		}
 		_, _ = tx.ExecContext(ctx, `UPDATE action_items SET status='COMPLETED',completed_at=NOW(),completed_by_user_id=$2,updated_at=NOW() WHERE workflow_step_instance_id=$1 AND source_trigger_type='MAIN_STEP' AND status NOT IN ('COMPLETED','CANCELLED')`, stepID, actor)
-		_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,'تأیید '||si.internal_title_fa,'اطلاعات ثبت‌شده را بررسی کنید','WAITING_FOR_APPROVAL','HIGH',si.approval_role_id,'workflow_steps.approve',si.estimated_end_at,'approval:'||si.id,'APPROVAL' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID)
-		if err != nil {
+		if err = s.createApprovalActionTx(ctx, tx, stepID); err != nil {
 			return err
 		}
 	} else {
@@ -1064,7 +1200,6 @@ func (s *OperationsService) submitWorkflowStepTx(ctx context.Context, tx *sql.Tx
 			return err
 		}
 	}
-	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.submit", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": p.Reason})
 	return nil
 }
 
@@ -1208,9 +1343,26 @@ func (s *OperationsService) completeStepTx(ctx context.Context, tx *sql.Tx, acto
 	} else if handled {
 		return nil
 	}
+	// In a branched workflow a step without outgoing transitions ends its
+	// branch; the workflow completes once no other branch or join is open.
+	var branched bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_instance_step_transitions WHERE workflow_instance_id=$1)`, workflowID).Scan(&branched); err != nil {
+		return err
+	}
 	var nextID string
 	var startsAutomatically bool
-	err := tx.QueryRowContext(ctx, `SELECT id,starts_automatically FROM workflow_step_instances WHERE workflow_instance_id=$1 AND sequence_number>(SELECT sequence_number FROM workflow_step_instances WHERE id=$2) AND status='NOT_STARTED' AND path_state='INCLUDED' ORDER BY sequence_number LIMIT 1 FOR UPDATE`, workflowID, stepID).Scan(&nextID, &startsAutomatically)
+	err := sql.ErrNoRows
+	if !branched {
+		err = tx.QueryRowContext(ctx, `SELECT id,starts_automatically FROM workflow_step_instances WHERE workflow_instance_id=$1 AND sequence_number>(SELECT sequence_number FROM workflow_step_instances WHERE id=$2) AND status='NOT_STARTED' AND path_state='INCLUDED' ORDER BY sequence_number LIMIT 1 FOR UPDATE`, workflowID, stepID).Scan(&nextID, &startsAutomatically)
+	}
+	if errors.Is(err, sql.ErrNoRows) && branched {
+		var openStep string
+		err = tx.QueryRowContext(ctx, `SELECT id FROM workflow_step_instances WHERE workflow_instance_id=$1 AND id<>$2 AND path_state='INCLUDED' AND status NOT IN ('COMPLETED','SKIPPED','CANCELLED') ORDER BY status='NOT_STARTED',sequence_number LIMIT 1`, workflowID, stepID).Scan(&openStep)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `UPDATE workflow_instances SET current_step_instance_id=$2,updated_at=NOW() WHERE id=$1`, workflowID, openStep)
+			return err
+		}
+	}
 	if errors.Is(err, sql.ErrNoRows) {
 		var workflowBlockers, openDiscrepancies int
 		_ = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM action_items WHERE workflow_instance_id=$1 AND workflow_step_instance_id IS NULL AND is_blocking AND status NOT IN ('COMPLETED','CANCELLED')`, workflowID).Scan(&workflowBlockers)
@@ -1246,6 +1398,9 @@ func (s *OperationsService) completeStepTx(ctx context.Context, tx *sql.Tx, acto
 	if err = s.createMainStepActionTx(ctx, tx, workflowID, nextID); err != nil {
 		return err
 	}
+	if err = s.startStepSLATx(ctx, tx, nextID); err != nil {
+		return err
+	}
 	if err = s.runStepTriggersTx(ctx, tx, workflowID, nextID, "ON_STEP_OPEN"); err != nil {
 		return err
 	}
@@ -1272,11 +1427,12 @@ func (s *OperationsService) ApproveWorkflowStep(ctx context.Context, actor, step
 	if !validWorkflowStepTransition(status, "COMPLETED") || status != "WAITING_FOR_APPROVAL" {
 		return ErrInvalidTransition
 	}
-	var approvalRole sql.NullInt64
-	if err = tx.QueryRowContext(ctx, `SELECT approval_role_id FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&approvalRole); err != nil {
+	chain, err := approvalChain(ctx, tx, stepID)
+	if err != nil {
 		return err
 	}
-	authorized := approvalRole.Valid && s.userHasRole(ctx, actor, s.roleCode(ctx, approvalRole.Int64)) && s.HasPermission(ctx, actor, "workflow_steps.approve")
+	level, _ := currentApprovalLevel(chain)
+	ctx, authorized := s.approvalActor(ctx, actor, "workflow_steps.approve", level.role())
 	override := false
 	if !authorized {
 		if !s.HasPermission(ctx, actor, "workflow_steps.override") {
@@ -1287,6 +1443,22 @@ func (s *OperationsService) ApproveWorkflowStep(ctx context.Context, actor, step
 		}
 		override = true
 	}
+	if err = s.recordApprovalDecisionTx(ctx, tx, actor, stepID, level, "APPROVED", override, reason); err != nil {
+		return err
+	}
+	if chain, err = approvalChain(ctx, tx, stepID); err != nil {
+		return err
+	}
+	if next, pending := currentApprovalLevel(chain); pending {
+		if next.LevelNumber != level.LevelNumber {
+			_, _ = tx.ExecContext(ctx, `UPDATE action_items SET status='COMPLETED',completed_at=NOW(),completed_by_user_id=$2,updated_at=NOW() WHERE workflow_step_instance_id=$1 AND source_trigger_type='APPROVAL' AND status NOT IN ('COMPLETED','CANCELLED')`, stepID, actor)
+			if err = s.createApprovalActionTx(ctx, tx, stepID); err != nil {
+				return err
+			}
+		}
+		s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.approve", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": reason, "level": level.LevelNumber, "next_level": next.LevelNumber})
+		return tx.Commit()
+	}
 	_, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET approved_at=NOW(),approved_by_user_id=$2,result_code='APPROVED' WHERE id=$1`, stepID, actor)
 	if err != nil {
 		return err
@@ -1297,7 +1469,7 @@ func (s *OperationsService) ApproveWorkflowStep(ctx context.Context, actor, step
 	if err = s.completeStepTx(ctx, tx, actor, workflowID, stepID, "COMPLETED"); err != nil {
 		return err
 	}
-	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.approve", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": reason})
+	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.approve", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": reason, "level": level.LevelNumber})
 	return tx.Commit()
 }
 func (s *OperationsService) RejectWorkflowStep(ctx context.Context, actor, stepID, reason string) error {
@@ -1316,16 +1488,20 @@ func (s *OperationsService) RejectWorkflowStep(ctx context.Context, actor, stepI
 	if !validWorkflowStepTransition(status, "NEEDS_CORRECTION") {
 		return ErrInvalidTransition
 	}
-	var approvalRole sql.NullInt64
-	if err = tx.QueryRowContext(ctx, `SELECT approval_role_id FROM workflow_step_instances WHERE id=$1`, stepID).Scan(&approvalRole); err != nil {
+	chain, err := approvalChain(ctx, tx, stepID)
+	if err != nil {
 		return err
 	}
-	authorized := approvalRole.Valid && s.userHasRole(ctx, actor, s.roleCode(ctx, approvalRole.Int64)) && s.HasPermission(ctx, actor, "workflow_steps.reject")
+	level, _ := currentApprovalLevel(chain)
+	ctx, authorized := s.approvalActor(ctx, actor, "workflow_steps.reject", level.role())
 	override := !authorized
 	if override && !s.HasPermission(ctx, actor, "workflow_steps.override") {
 		return ErrForbidden
 	}
-	_, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET status='NEEDS_CORRECTION',rejected_at=NOW(),rejected_by_user_id=$2,rejection_reason=$3,customer_status_text='در حال تکمیل',updated_at=NOW() WHERE id=$1`, stepID, actor, reason)
+	if err = s.recordApprovalDecisionTx(ctx, tx, actor, stepID, level, "REJECTED", override, reason); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET status='NEEDS_CORRECTION',approval_round=approval_round+1,current_approval_level=NULL,rejected_at=NOW(),rejected_by_user_id=$2,rejection_reason=$3,customer_status_text='در حال تکمیل',updated_at=NOW() WHERE id=$1`, stepID, actor, reason)
 	if err != nil {
 		return err
 	}
@@ -1334,7 +1510,7 @@ func (s *OperationsService) RejectWorkflowStep(ctx context.Context, actor, stepI
 	if err != nil {
 		return err
 	}
-	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.reject", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": reason, "workflow_id": workflowID})
+	s.auditTx(ctx, tx, actor, chooseAudit("workflow_steps.reject", override), "workflow_step_instance", stepID, nil, map[string]any{"reason": reason, "workflow_id": workflowID, "level": level.LevelNumber})
 	return tx.Commit()
 }
 func (s *OperationsService) SkipWorkflowStep(ctx context.Context, actor, stepID, reason string) error {
@@ -1353,7 +1529,11 @@ func (s *OperationsService) SkipWorkflowStep(ctx context.Context, actor, stepID,
 	if !validWorkflowStepTransition(status, "SKIPPED") {
 		return ErrInvalidTransition
 	}
-	authorized := skippable && s.HasPermission(ctx, actor, "workflow_steps.skip") && s.canOperateStep(ctx, actor, permission, role, assigned)
+	stepCtx, canOperate := s.stepActor(ctx, actor, permission, role, assigned)
+	authorized := skippable && s.HasPermission(ctx, actor, "workflow_steps.skip") && canOperate
+	if authorized {
+		ctx = stepCtx
+	}
 	override := false
 	if !authorized {
 		if !s.HasPermission(ctx, actor, "workflow_steps.override") {
@@ -1402,6 +1582,9 @@ func (s *OperationsService) ReopenWorkflowStep(ctx context.Context, actor, stepI
 	if err = s.createMainStepActionTx(ctx, tx, workflowID, stepID); err != nil {
 		return err
 	}
+	if err = s.startStepSLATx(ctx, tx, stepID); err != nil {
+		return err
+	}
 	s.auditTx(ctx, tx, actor, "workflow_steps.reopen.override", "workflow_step_instance", stepID, nil, map[string]any{"reason": reason})
 	return tx.Commit()
 }
@@ -1455,14 +1638,14 @@ func (s *OperationsService) ListWorkflowDiscrepancies(ctx context.Context, actor
 	}
 	if !viewAll {
 		var assigned bool
-		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND (si.assigned_user_id=$2 OR (si.assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$2 AND ur.role_id=si.responsible_role_id))))`, workflowID, actor).Scan(&assigned); err != nil {
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.workflow_instance_id=$1 AND (`+workflowWorkSQL("si.assigned_user_id", "si.responsible_role_id", "$2")+`))`, workflowID, actor).Scan(&assigned); err != nil {
 			return nil, err
 		}
 		if !assigned {
 			return nil, ErrForbidden
 		}
 	}
-	rows, err := s.db.QueryContext(ctx, `SELECT d.id,d.source_step_instance_id,d.target_step_instance_id,d.metric_key,d.expected_value,d.actual_value,d.difference_value,d.difference_percentage,COALESCE(d.unit_code,''),d.severity,d.is_blocking,d.status,d.resolution_note,d.reported_at FROM workflow_discrepancies d WHERE d.workflow_instance_id=$1 AND ($3 OR EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.id IN (d.source_step_instance_id,d.target_step_instance_id) AND (si.assigned_user_id=$2 OR (si.assigned_user_id IS NULL AND EXISTS(SELECT 1 FROM user_roles ur WHERE ur.user_id=$2 AND ur.role_id=si.responsible_role_id))))) ORDER BY d.reported_at DESC`, workflowID, actor, viewAll)
+	rows, err := s.db.QueryContext(ctx, `SELECT d.id,d.source_step_instance_id,d.target_step_instance_id,d.metric_key,d.expected_value,d.actual_value,d.difference_value,d.difference_percentage,COALESCE(d.unit_code,''),d.severity,d.is_blocking,d.status,d.resolution_note,d.reported_at FROM workflow_discrepancies d WHERE d.workflow_instance_id=$1 AND ($3 OR EXISTS(SELECT 1 FROM workflow_step_instances si WHERE si.id IN (d.source_step_instance_id,d.target_step_instance_id) AND (`+workflowWorkSQL("si.assigned_user_id", "si.responsible_role_id", "$2")+`))) ORDER BY d.reported_at DESC`, workflowID, actor, viewAll)
 	if err != nil {
 		return nil, err
 	}
@@ -1656,6 +1839,11 @@ func (s *OperationsService) CompleteActionItem(ctx context.Context, actor, id st
 	if !allowed && role.Valid {
 		allowed = s.userHasRole(ctx, actor, s.roleCode(ctx, role.Int64))
 	}
+	if !allowed {
+		if delegator := s.delegatorFor(ctx, actor, role, assignedUser); delegator != "" {
+			ctx, allowed = withOnBehalfOf(ctx, delegator), true
+		}
+	}
 	if !allowed && !s.HasPermission(ctx, actor, "action_items.view_all") {
 		return ErrForbidden
 	}
@@ -1699,11 +1887,6 @@ func (s *OperationsService) CompleteActionItem(ctx context.Context, actor, id st
 	return tx.Commit()
 }
 
-func (s *OperationsService) createApprovalActionTx(ctx context.Context, tx *sql.Tx, stepID string) error {
-	_, err := tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,'تأیید '||si.internal_title_fa,'اطلاعات ثبت‌شده را بررسی کنید','WAITING_FOR_APPROVAL','HIGH',si.approval_role_id,'workflow_steps.approve',si.estimated_end_at,'approval:'||si.id,'APPROVAL' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID)
-	return err
-}
-
 func extractNumber(raw []byte) (float64, bool) {
 	var v any
 	if json.Unmarshal(raw, &v) != nil {
@@ -2,6 +2,9 @@ package usecase
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -87,3 +90,445 @@ func TestSelectDefinitionRequiresOptions(t *testing.T) {
 		t.Fatal("expected select options error")
 	}
 }
+
+func TestPublishValidationChecksParallelJoins(t *testing.T) {
+	quorum := 2
+	steps := func(joinMode string, quorum *int) []WorkflowTemplateStepV2 {
+		return []WorkflowTemplateStepV2{
+			{ID: 1, StepCode: "ORDER", IsActive: true, IsEntry: true, JoinMode: "NONE"},
+			{ID: 2, StepCode: "QUARRY", IsActive: true, JoinMode: "NONE"},
+			{ID: 3, StepCode: "CUTTING", IsActive: true, JoinMode: "NONE"},
+			{ID: 4, StepCode: "POLISHING", IsActive: true, JoinMode: "NONE"},
+			{ID: 5, StepCode: "PACKING", IsActive: true, JoinMode: joinMode, JoinQuorum: quorum},
+		}
+	}
+	fork := []WorkflowTransitionDefinition{
+		{ID: 1, SourceStepID: 1, TargetStepID: 2, TransitionType: "PARALLEL"},
+		{ID: 2, SourceStepID: 1, TargetStepID: 3, TransitionType: "PARALLEL"},
+		{ID: 3, SourceStepID: 1, TargetStepID: 4, TransitionType: "PARALLEL"},
+		{ID: 4, SourceStepID: 2, TargetStepID: 5, TransitionType: "AUTOMATIC", IsDefault: true},
+		{ID: 5, SourceStepID: 3, TargetStepID: 5, TransitionType: "AUTOMATIC", IsDefault: true},
+		{ID: 6, SourceStepID: 4, TargetStepID: 5, TransitionType: "AUTOMATIC", IsDefault: true},
+	}
+	if err := validateWorkflowJoins(steps("ALL", nil), fork); err != nil {
+		t.Fatalf("all-branch join rejected: %v", err)
+	}
+	if err := validateWorkflowJoins(steps("QUORUM", &quorum), fork); err != nil {
+		t.Fatalf("2-of-3 join rejected: %v", err)
+	}
+	if err := validateWorkflowJoins(steps("NONE", nil), fork); err == nil {
+		t.Fatal("parallel branches merged into a plain step")
+	}
+	choice := append([]WorkflowTransitionDefinition{}, fork...)
+	for i := 0; i < 3; i++ {
+		choice[i].TransitionType = "MANUAL_SELECTION"
+	}
+	if err := validateWorkflowJoins(steps("ALL", nil), choice); err == nil {
+		t.Fatal("join over alternative routes accepted")
+	}
+	loop := append(fork, WorkflowTransitionDefinition{ID: 7, SourceStepID: 5, TargetStepID: 2, TransitionType: "MANUAL_SELECTION"})
+	if err := validateWorkflowJoins(steps("ALL", nil), loop); err == nil {
+		t.Fatal("join on a loop accepted")
+	}
+	if err := validateWorkflowJoins(steps("ALL", nil)[4:], nil); err == nil {
+		t.Fatal("join in a sequential template accepted")
+	}
+	tooMany := 4
+	if err := normalizeStepJoin(&WorkflowStepPayload{JoinMode: "quorum"}); err == nil {
+		t.Fatal("quorum join without a quorum accepted")
+	}
+	if err := validateWorkflowJoins(steps("QUORUM", &tooMany), fork); err == nil {
+		t.Fatal("quorum above incoming branches accepted")
+	}
+}
+
+func TestConditionExpressions(t *testing.T) {
+	values := map[string]json.RawMessage{
+		"qc":       json.RawMessage(`{"result":"FAIL","note":"ترک","measuredValue":"1.25"}`),
+		"tonnage":  json.RawMessage(`{"value":32.5,"unit":"TON"}`),
+		"urgent":   json.RawMessage(`true`),
+		"due_date": json.RawMessage(`"2026-03-01"`),
+	}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`qc.result == "FAIL"`, true},
+		{`tonnage > 30 and not urgent`, false},
+		{`tonnage.value >= 32.5 && (urgent || qc.result != 'PASS')`, true},
+		{`due_date < "2026-04-01"`, true},
+		{`missing == null`, true},
+		{`missing > 1`, false},
+		{`qc.result > 3`, false},
+		{`qc.measuredValue > 1`, true},
+		{`qc.measuredValue == 1.25`, true},
+	}
+	for _, test := range tests {
+		got, err := evaluateCondition(test.expression, values)
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %v, %v; want %v", test.expression, got, err, test.want)
+		}
+	}
+	for _, invalid := range []string{``, `qc.result ==`, `(urgent`, `len(qc)`, `urgent = true`, `qc.result.x == 1`, strings.Repeat("(", 40) + "urgent" + strings.Repeat(")", 40)} {
+		if _, err := parseCondition(invalid); err == nil {
+			t.Errorf("%q parsed", invalid)
+		}
+	}
+}
+
+func TestPublishValidationChecksConditionFields(t *testing.T) {
+	steps := []WorkflowTemplateStepV2{
+		{ID: 1, StepCode: "QC", Fields: []WorkflowFieldDefinition{{FieldKey: "qc", FieldType: "QC_CHECK"}, {FieldKey: "tonnage", FieldType: "WEIGHT"}}},
+		{ID: 2, StepCode: "REWORK"},
+		{ID: 3, StepCode: "PACK"},
+	}
+	fallback := WorkflowTransitionDefinition{ID: 2, SourceStepID: 1, TargetStepID: 3, TransitionCode: "PASS", TransitionType: "AUTOMATIC", IsDefault: true}
+	condition := func(expression string) []WorkflowTransitionDefinition {
+		return []WorkflowTransitionDefinition{{ID: 1, SourceStepID: 1, TargetStepID: 2, TransitionCode: "REWORK", TransitionType: "CONDITIONAL", ConditionExpression: &expression}, fallback}
+	}
+	if err := validateWorkflowConditions(steps, condition(`qc.result == "FAIL" or tonnage.value > 40`)); err != nil {
+		t.Fatalf("valid condition rejected: %v", err)
+	}
+	for _, expression := range []string{`grade == "A"`, `tonnage.currency == "IRR"`, `qc.result ==`} {
+		if err := validateWorkflowConditions(steps, condition(expression)); err == nil {
+			t.Errorf("%q accepted", expression)
+		}
+	}
+	onlyConditional := condition(`qc.result == "FAIL"`)[:1]
+	if err := validateWorkflowConditions(steps, onlyConditional); err == nil {
+		t.Fatal("conditional step without a fallback accepted")
+	}
+	manual := WorkflowTransitionDefinition{ID: 3, SourceStepID: 1, TargetStepID: 3, TransitionCode: "CHOOSE", TransitionType: "MANUAL_SELECTION"}
+	if err := validateWorkflowConditions(steps, append(onlyConditional, manual)); err != nil {
+		t.Fatalf("manual fallback rejected: %v", err)
+	}
+	nonDefault := fallback
+	nonDefault.IsDefault = false
+	if err := validateWorkflowConditions(steps, append(onlyConditional, nonDefault)); err == nil {
+		t.Fatal("non-default automatic transition accepted as fallback")
+	}
+}
+
+func TestValidateSLAPolicy(t *testing.T) {
+	n := func(v int) *int { return &v }
+	role := int64(3)
+	if err := validateSLAPolicy(WorkflowStepSLAPolicy{SLAHours: 48, WarnAtPercent: n(75), EscalationRoleID: &role, ReassignAfterHours: n(72)}); err != nil {
+		t.Fatalf("valid policy rejected: %v", err)
+	}
+	for _, p := range []WorkflowStepSLAPolicy{{}, {SLAHours: maxSLAHours + 1}, {SLAHours: 8, WarnAtPercent: n(100)}, {SLAHours: 8, ReassignAfterHours: n(12)}} {
+		if err := validateSLAPolicy(p); err == nil {
+			t.Errorf("%+v accepted", p)
+		}
+	}
+}
+
+func TestApprovalLevels(t *testing.T) {
+	amount := func(v string) *string { return &v }
+	levels := []WorkflowStepApprovalLevel{{LevelNumber: 3, ApprovalRoleID: 9, MinOrderAmount: amount("1000000000")}, {LevelNumber: 1, ApprovalRoleID: 4, RequiredApprovals: 2, AmountCurrency: "irr"}}
+	if err := normalizeApprovalLevels(levels); err != nil {
+		t.Fatal(err)
+	}
+	if levels[0].LevelNumber != 1 || levels[0].AmountCurrency != "IRR" || levels[1].RequiredApprovals != 1 || levels[1].AmountCurrency != "IRR" {
+		t.Fatalf("levels not normalized: %+v", levels)
+	}
+	for _, invalid := range [][]WorkflowStepApprovalLevel{{{LevelNumber: 1}}, {{LevelNumber: 0, ApprovalRoleID: 1}}, {{LevelNumber: 1, ApprovalRoleID: 1}, {LevelNumber: 1, ApprovalRoleID: 2}}, {{LevelNumber: 1, ApprovalRoleID: 1, RequiredApprovals: 21}}, {{LevelNumber: 1, ApprovalRoleID: 1, MinOrderAmount: amount("-5")}}} {
+		if err := normalizeApprovalLevels(invalid); err == nil {
+			t.Errorf("%+v accepted", invalid)
+		}
+	}
+	if got := applicableApprovalLevels(levels, amount("50000000")); len(got) != 1 || got[0].LevelNumber != 1 {
+		t.Errorf("small order: %+v", got)
+	}
+	if got := applicableApprovalLevels(levels, amount("1000000000")); len(got) != 2 {
+		t.Errorf("large order: %+v", got)
+	}
+	if got := applicableApprovalLevels(levels, nil); len(got) != 1 {
+		t.Errorf("no amount: %+v", got)
+	}
+
+	chain := []WorkflowApprovalLevelProgress{{LevelNumber: 1, RequiredApprovals: 2, Approvals: 2}, {LevelNumber: 2, RequiredApprovals: 2, Approvals: 1}, {LevelNumber: 3, RequiredApprovals: 1}}
+	if level, ok := currentApprovalLevel(chain); !ok || level.LevelNumber != 2 {
+		t.Errorf("current level = %+v, %v", level, ok)
+	}
+	chain[1].Overridden = true
+	if level, ok := currentApprovalLevel(chain); !ok || level.LevelNumber != 3 {
+		t.Errorf("override did not advance: %+v", level)
+	}
+	chain[2].Approvals = 1
+	if _, ok := currentApprovalLevel(chain); ok {
+		t.Error("satisfied chain still pending")
+	}
+}
+
+func TestValidateCustomerActionableStep(t *testing.T) {
+	step := func(fields ...WorkflowFieldDefinition) WorkflowTemplateStepV2 {
+		return WorkflowTemplateStepV2{StepCode: "CONFIRM_DIMENSIONS", CustomerVisible: true, CustomerActionable: true, Fields: fields}
+	}
+	visible := WorkflowFieldDefinition{FieldKey: "approved", FieldType: "BOOLEAN", IsRequired: true, IsCustomerVisible: true}
+	if err := validateCustomerActionableStep(step(visible, WorkflowFieldDefinition{FieldKey: "note", FieldType: "LONG_TEXT"})); err != nil {
+		t.Fatalf("valid step rejected: %v", err)
+	}
+	event := "SHIPMENT_DELIVERED"
+	hiddenVisibility := step(visible)
+	hiddenVisibility.CustomerVisible = false
+	domain := step(visible)
+	domain.DomainEventCode = &event
+	for _, invalid := range []WorkflowTemplateStepV2{step(), step(visible, WorkflowFieldDefinition{FieldKey: "cost", FieldType: "MONEY", IsRequired: true}), hiddenVisibility, domain} {
+		if err := validateCustomerActionableStep(invalid); err == nil {
+			t.Errorf("%+v accepted", invalid)
+		}
+	}
+	if err := checkStepCustomerAction(WorkflowStepPayload{CustomerActionable: true}); err == nil {
+		t.Error("hidden customer-actionable step accepted")
+	}
+}
+
+func TestValidateWorkflowBundle(t *testing.T) {
+	manager, packing := "PRODUCTION_MANAGER", "PACKING"
+	bundle := WorkflowTemplateBundle{
+		Format: workflowBundleFormat, FormatVersion: workflowBundleFormatVersion,
+		Template: WorkflowTemplatePayload{TemplateGroupCode: "export_order", NameFA: "سفارش صادراتی", StartPermissionCode: "workflows.start"},
+		Steps: []WorkflowBundleStep{
+			{StepCode: "CUTTING", InternalTitleFA: "برش", ResponsibleRoleCode: manager, RequiredPermissionCode: "workflow_steps.submit", IsActive: true, IsEntry: true, Fields: []WorkflowFieldPayload{{FieldKey: "slabs", FieldType: "INTEGER"}}},
+			{StepCode: "PACKING", InternalTitleFA: "بسته‌بندی", ResponsibleRoleCode: manager, RequiredPermissionCode: "workflow_steps.submit", IsActive: true, SLA: &WorkflowBundleSLA{SLAHours: 16}},
+		},
+		Transitions:          []WorkflowBundleTransition{{SourceStepCode: "CUTTING", TargetStepCode: "PACKING", TransitionCode: "NEXT", LabelFA: "بعدی", TransitionType: "AUTOMATIC", IsDefault: true}},
+		DocumentRequirements: []WorkflowBundleDocumentRequirement{{StepCode: &packing, DocumentType: "PACKING_LIST", TitleFA: "لیست بسته‌بندی"}},
+	}
+	if issues := validateWorkflowBundle(bundle); len(issues) != 0 {
+		t.Fatalf("valid bundle rejected: %+v", issues)
+	}
+	if roles := bundleRoleCodes(bundle); len(roles) != 1 || roles[manager] != "steps[0].responsible_role_code" {
+		t.Errorf("role codes = %v", roles)
+	}
+	if permissions := bundlePermissionCodes(bundle); len(permissions) != 2 {
+		t.Errorf("permission codes = %v", permissions)
+	}
+
+	broken := bundle
+	broken.Steps = append([]WorkflowBundleStep{}, bundle.Steps...)
+	broken.Steps[1].StepCode = "CUTTING"
+	broken.Transitions = []WorkflowBundleTransition{{SourceStepCode: "CUTTING", TargetStepCode: "LOADING", TransitionCode: "NEXT", LabelFA: "بعدی", TransitionType: "AUTOMATIC"}}
+	codes := map[string]bool{}
+	for _, issue := range validateWorkflowBundle(broken) {
+		codes[issue.Code] = true
+	}
+	for _, want := range []string{"STEP_DUPLICATE", "TRANSITION_STEP", "DOCUMENT_STEP"} {
+		if !codes[want] {
+			t.Errorf("missing %s in %v", want, codes)
+		}
+	}
+	if issues := validateWorkflowBundle(WorkflowTemplateBundle{Format: workflowBundleFormat, FormatVersion: 99}); len(issues) != 1 || issues[0].Code != "BUNDLE_VERSION" {
+		t.Errorf("future format accepted: %+v", issues)
+	}
+}
+
+func TestDiffWorkflowTemplates(t *testing.T) {
+	n := func(v float64) *float64 { return &v }
+	from := WorkflowTemplateVersion{ID: 1, TemplateGroupCode: "export_order", NameFA: "سفارش",
+		Steps: []WorkflowTemplateStepV2{
+			{ID: 10, StepCode: "CUTTING", InternalTitleFA: "برش", ResponsibleRoleCode: "PRODUCTION", IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "slabs", FieldType: "INTEGER", ValidationJSON: json.RawMessage(`{"min":1}`)}, {FieldKey: "note", FieldType: "SHORT_TEXT"}}},
+			{ID: 11, StepCode: "QC", InternalTitleFA: "کنترل کیفیت", ResponsibleRoleCode: "QC", IsActive: true},
+		},
+		Metrics:     []HandoffMetricDefinition{{MetricKey: "area", UnitCode: "M2", AbsoluteTolerance: n(2)}},
+		Transitions: []WorkflowTransitionDefinition{{SourceStepID: 10, TargetStepID: 11, TransitionCode: "NEXT", TransitionType: "AUTOMATIC", IsDefault: true}},
+	}
+	to := WorkflowTemplateVersion{ID: 2, TemplateGroupCode: "export_order", NameFA: "سفارش صادراتی",
+		Steps: []WorkflowTemplateStepV2{
+			{ID: 20, StepCode: "CUTTING", InternalTitleFA: "برش سنگ", ResponsibleRoleCode: "PRODUCTION", IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "slabs", FieldType: "INTEGER", ValidationJSON: json.RawMessage(`{"min":2}`)}, {FieldKey: "note", FieldType: "SHORT_TEXT"}, {FieldKey: "grade", FieldType: "SHORT_TEXT", IsRequired: true}}},
+			{ID: 21, StepCode: "PACKING", InternalTitleFA: "بسته‌بندی", ResponsibleRoleCode: "WAREHOUSE", IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "pallets", FieldType: "INTEGER", IsRequired: true}}},
+		},
+		Metrics:     []HandoffMetricDefinition{{MetricKey: "area", UnitCode: "M2", AbsoluteTolerance: n(1)}},
+		Transitions: []WorkflowTransitionDefinition{{SourceStepID: 20, TargetStepID: 21, TransitionCode: "NEXT", TransitionType: "AUTOMATIC", IsDefault: true}},
+	}
+	diff := diffWorkflowTemplates(from, to)
+	got := map[string]bool{}
+	for _, c := range diff.Changes {
+		got[c.Kind+" "+c.Action+" "+c.Key+" "+map[bool]string{true: "risky", false: "safe"}[c.AffectsRunning]] = true
+	}
+	for _, want := range []string{
+		"TEMPLATE MODIFIED export_order safe",
+		"STEP MODIFIED CUTTING safe",
+		"STEP REMOVED QC risky",
+		"STEP ADDED PACKING safe",
+		"FIELD ADDED CUTTING.grade risky",
+		"VALIDATION MODIFIED CUTTING.slabs risky",
+		"TRANSITION MODIFIED CUTTING.NEXT risky",
+		"HANDOFF_METRIC MODIFIED area risky",
+	} {
+		if !got[want] {
+			t.Errorf("missing %q in %v", want, got)
+		}
+	}
+	if len(diff.Changes) != 8 || !diff.Risky {
+		t.Errorf("unexpected diff: %+v", diff.Changes)
+	}
+	if same := diffWorkflowTemplates(from, from); len(same.Changes) != 0 || same.Risky {
+		t.Errorf("identical versions differ: %+v", same.Changes)
+	}
+}
+
+func TestPlanWorkflowInstanceMigration(t *testing.T) {
+	target := WorkflowTemplateVersion{ID: 2, Steps: []WorkflowTemplateStepV2{
+		{ID: 20, StepCode: "INTAKE", SequenceNumber: 1, IsActive: true},
+		{ID: 21, StepCode: "SURVEY", SequenceNumber: 2, IsActive: true},
+		{ID: 22, StepCode: "CUTTING", SequenceNumber: 3, IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "slabs", FieldType: "DECIMAL"}}},
+		{ID: 23, StepCode: "PACKING", SequenceNumber: 4, IsActive: true},
+	}}
+	steps := []migrationStepState{
+		{ID: "a", StepCode: "INTAKE", Status: "COMPLETED", Iteration: 1, Values: map[string]string{"notes": "LONG_TEXT"}},
+		{ID: "b", StepCode: "CUTTING", Status: "IN_PROGRESS", Iteration: 1, Values: map[string]string{}},
+		{ID: "c", StepCode: "POLISH", Status: "NOT_STARTED", Iteration: 1, Values: map[string]string{}},
+		{ID: "d", StepCode: "PACKING", Status: "NOT_STARTED", Iteration: 1, Values: map[string]string{}},
+	}
+	m := planWorkflowInstanceMigration(steps, target)
+	actions := []string{}
+	for _, st := range m.Steps {
+		actions = append(actions, st.StepCode+":"+st.Action)
+	}
+	if strings.Join(actions, ",") != "INTAKE:MAPPED,CUTTING:MAPPED,POLISH:SKIPPED,PACKING:MAPPED" || *m.Steps[1].TargetStepID != 22 {
+		t.Fatalf("unexpected mapping: %v", actions)
+	}
+	if len(m.AddedSteps) != 1 || m.AddedSteps[0] != "SURVEY" {
+		t.Errorf("unexpected added steps: %v", m.AddedSteps)
+	}
+	codes := []string{}
+	for _, w := range m.Warnings {
+		codes = append(codes, w.Code)
+	}
+	if len(m.Errors) != 0 || strings.Join(codes, ",") != "FIELD_REMOVED,STEP_REMOVED,STEP_ADDED_BEHIND" {
+		t.Errorf("unexpected issues: %+v %+v", m.Errors, m.Warnings)
+	}
+
+	steps[1].Values["slabs"] = "INTEGER"
+	steps[2].Status = "WAITING_FOR_APPROVAL"
+	m = planWorkflowInstanceMigration(steps, target)
+	codes = codes[:0]
+	for _, e := range m.Errors {
+		codes = append(codes, e.Path+" "+e.Code)
+	}
+	if strings.Join(codes, ",") != "steps[CUTTING#1].fields.slabs FIELD_TYPE_CHANGED,steps[POLISH#1] STEP_UNMAPPABLE" {
+		t.Errorf("unexpected errors: %v", codes)
+	}
+}
+
+func TestSimulateWorkflow(t *testing.T) {
+	area, in, out, tolerance := "area", "IN", "OUT", 0.5
+	recut := `recut == true`
+	template := WorkflowTemplateVersion{ID: 7, MaxIterations: 3,
+		Steps: []WorkflowTemplateStepV2{
+			{ID: 1, StepCode: "SURVEY", SequenceNumber: 1, IsActive: true, IsEntry: true, Fields: []WorkflowFieldDefinition{{FieldKey: "area", FieldType: "DECIMAL", IsRequired: true, HandoffMetricKey: &area, HandoffDirection: &out}}, Tasks: []WorkflowTaskTemplate{{TriggerType: "ON_STEP_OPEN", TitleFA: "هماهنگی بازدید", BlocksStepCompletion: true}}},
+			{ID: 2, StepCode: "CUT", SequenceNumber: 2, IsActive: true, RequiresApproval: true, Fields: []WorkflowFieldDefinition{{FieldKey: "area", FieldType: "DECIMAL", IsRequired: true, HandoffMetricKey: &area, HandoffDirection: &in}, {FieldKey: "recut", FieldType: "BOOLEAN"}}},
+			{ID: 3, StepCode: "PACK", SequenceNumber: 3, IsActive: true},
+		},
+		Metrics: []HandoffMetricDefinition{{MetricKey: "area", UnitCode: "M2", AbsoluteTolerance: &tolerance}},
+		Transitions: []WorkflowTransitionDefinition{
+			{ID: 1, SourceStepID: 1, TargetStepID: 2, TransitionCode: "TO_CUT", TransitionType: "AUTOMATIC", IsDefault: true},
+			{ID: 2, SourceStepID: 2, TargetStepID: 1, TransitionCode: "RESURVEY", TransitionType: "CONDITIONAL", ConditionExpression: &recut},
+			{ID: 3, SourceStepID: 2, TargetStepID: 3, TransitionCode: "TO_PACK", TransitionType: "AUTOMATIC", IsDefault: true, SortOrder: 1},
+		},
+	}
+	p := WorkflowSimulationPayload{
+		Submissions: []WorkflowSimulationSubmission{
+			{StepCode: "SURVEY", Values: map[string]json.RawMessage{"area": json.RawMessage(`10`)}},
+			{StepCode: "CUT", Values: map[string]json.RawMessage{"area": json.RawMessage(`12`), "recut": json.RawMessage(`true`)}},
+			{StepCode: "SURVEY", Values: map[string]json.RawMessage{"area": json.RawMessage(`12`)}},
+			{StepCode: "CUT", Values: map[string]json.RawMessage{"area": json.RawMessage(`12.2`), "recut": json.RawMessage(`false`)}},
+		},
+		Payments: []WorkflowSimulationPayment{{TriggerType: "STEP_COMPLETE", TriggerStepCode: "PACK", TitleFA: "تسویه"}},
+	}
+	trace := simulateWorkflow(template, p)
+	opened := []string{}
+	for _, e := range trace.Events {
+		if e.Type == "STEP_OPENED" {
+			opened = append(opened, fmt.Sprintf("%s#%d", e.StepCode, e.Iteration))
+		}
+	}
+	if !trace.Completed || len(trace.Errors) != 0 || strings.Join(opened, ",") != "SURVEY#1,CUT#1,SURVEY#2,CUT#2,PACK#1" {
+		t.Fatalf("unexpected run: %v %v %+v", trace.Completed, opened, trace.Errors)
+	}
+	if len(trace.Discrepancies) != 1 || trace.Discrepancies[0].Severity != "WARNING" || trace.Discrepancies[0].DifferenceValue != 2 {
+		t.Errorf("unexpected discrepancies: %+v", trace.Discrepancies)
+	}
+	sources := map[string]int{}
+	for _, item := range trace.ActionItems {
+		sources[item.SourceTriggerType]++
+	}
+	if sources["MAIN_STEP"] != 5 || sources["ON_STEP_OPEN"] != 2 || sources["APPROVAL"] != 2 || sources["PAYMENT_BLOCK"] != 2 {
+		t.Errorf("unexpected action items: %v", sources)
+	}
+
+	template.Metrics[0].BlockingOnMismatch = true
+	trace = simulateWorkflow(template, p)
+	if trace.Completed || trace.Events[len(trace.Events)-1].Type != "STEP_HAS_MISMATCH" {
+		t.Errorf("blocking mismatch did not stop the run: %+v", trace.Events)
+	}
+
+	template.MaxIterations = 1
+	trace = simulateWorkflow(template, WorkflowSimulationPayload{Submissions: []WorkflowSimulationSubmission{{StepCode: "SURVEY"}}})
+	if trace.Completed || len(trace.Errors) != 1 || trace.Errors[0].Path != "steps[SURVEY#1].fields.area" {
+		t.Errorf("unexpected errors: %+v", trace.Errors)
+	}
+}
+
+func TestComputeFormula(t *testing.T) {
+	stored := map[string]json.RawMessage{
+		".gross":        json.RawMessage(`{"value":2.5,"unit":"TON"}`),
+		".tare":         json.RawMessage(`{"value":300,"unit":"KG"}`),
+		".width":        json.RawMessage(`120`),
+		".count":        json.RawMessage(`4`),
+		"SURVEY.length": json.RawMessage(`{"value":2,"unit":"M"}`),
+	}
+	units := map[string]string{".width": "CM"}
+	operand := func(step, key string) (formulaQuantity, error) {
+		raw, ok := stored[step+"."+key]
+		if !ok {
+			return formulaQuantity{}, errFormulaOperandMissing
+		}
+		return formulaOperand(raw, units[step+"."+key])
+	}
+	tests := []struct{ formula, unit, want string }{
+		{`gross - tare`, "KG", `{"unit":"KG","value":2200}`},
+		{`(gross - tare) / count`, "TON", `{"unit":"TON","value":0.55}`},
+		{`survey.length * width * count`, "M2", `{"unit":"M2","value":9.6}`},
+		{`-tare / gross * 100`, "", `-12`},
+	}
+	for _, test := range tests {
+		got, err := computeFormula(test.formula, test.unit, operand)
+		if err != nil || string(got) != test.want {
+			t.Errorf("%s: got %s, %v; want %s", test.formula, got, err, test.want)
+		}
+	}
+	if _, err := computeFormula(`gross + missing`, "KG", operand); !errors.Is(err, errFormulaOperandMissing) {
+		t.Errorf("missing operand: %v", err)
+	}
+	for _, invalid := range [][2]string{{`gross * count`, "M2"}, {`gross - width`, "KG"}, {`gross / (count - 4)`, "KG"}} {
+		if _, err := computeFormula(invalid[0], invalid[1], operand); err == nil || errors.Is(err, errFormulaOperandMissing) {
+			t.Errorf("%s computed", invalid[0])
+		}
+	}
+	for _, invalid := range []string{``, `gross -`, `(gross`, `gross ^ 2`, `a.b.c`, `round(gross)`} {
+		if _, err := parseFormula(invalid); err == nil {
+			t.Errorf("%q parsed", invalid)
+		}
+	}
+
+	kg, m, m2 := "KG", "M", "M2"
+	computed := func(formula, unit string) WorkflowFieldDefinition {
+		return WorkflowFieldDefinition{FieldKey: "result", FieldType: "COMPUTED", UnitCode: &unit, ValidationJSON: json.RawMessage(`{"formula":"` + formula + `"}`)}
+	}
+	steps := func(result WorkflowFieldDefinition) []WorkflowTemplateStepV2 {
+		return []WorkflowTemplateStepV2{
+			{StepCode: "SURVEY", SequenceNumber: 1, IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "length", FieldType: "QUANTITY", UnitCode: &m}, {FieldKey: "note", FieldType: "SHORT_TEXT"}}},
+			{StepCode: "WEIGH", SequenceNumber: 2, IsActive: true, Fields: []WorkflowFieldDefinition{{FieldKey: "gross", FieldType: "WEIGHT", UnitCode: &kg}, {FieldKey: "width", FieldType: "DECIMAL", UnitCode: &m}, result, {FieldKey: "tare", FieldType: "WEIGHT", UnitCode: &kg}}},
+		}
+	}
+	if err := validateWorkflowFormulas(steps(computed("SURVEY.length * width", m2))); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []WorkflowFieldDefinition{computed("gross - tare", kg), computed("gross * width", kg), computed("SURVEY.note * 2", m2), computed("WEIGH.gross", kg), computed("gross", "FURLONG")} {
+		if err := validateWorkflowFormulas(steps(invalid)); err == nil {
+			t.Errorf("%s accepted", invalid.ValidationJSON)
+		}
+	}
+}
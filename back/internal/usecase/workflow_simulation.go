@@ -0,0 +1,648 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WorkflowSimulationPayload drives a simulated run of a template version.
+// Each time a step opens it is submitted with the next submission given for
+// its step_code, the last one again when the step loops more often, or with
+// no values when there is none. Payments are sample payment schedule lines.
+// OrderAmount picks the approval levels whose threshold it reaches; it is
+// compared as-is, without currency conversion.
+type WorkflowSimulationPayload struct {
+	Submissions   []WorkflowSimulationSubmission `json:"submissions"`
+	Payments      []WorkflowSimulationPayment    `json:"payments"`
+	ExcludedSteps []string                       `json:"excluded_steps"`
+	OrderAmount   *string                        `json:"order_amount"`
+}
+type WorkflowSimulationSubmission struct {
+	StepCode       string                     `json:"step_code"`
+	Values         map[string]json.RawMessage `json:"values"`
+	ResultCode     string                     `json:"result_code"`
+	TransitionCode string                     `json:"transition_code"`
+}
+
+// WorkflowSimulationPayment is triggered by STEP_OPEN or STEP_COMPLETE of
+// TriggerStepCode, or of any step when it is empty, like a line of
+// order_payment_schedule.
+type WorkflowSimulationPayment struct {
+	TriggerType     string `json:"trigger_type"`
+	TriggerStepCode string `json:"trigger_step_code"`
+	TitleFA         string `json:"title_fa"`
+	Amount          string `json:"amount"`
+	Currency        string `json:"currency"`
+}
+
+// WorkflowSimulationTrace records what a run would have done, in order.
+// The simulation assumes that approvals are granted, blocking tasks are
+// completed, triggered payments are confirmed and domain operations are
+// recorded, and notes each assumption as an event; it stops a branch on a
+// validation failure, a blocking discrepancy or a manual route choice
+// without a transition_code.
+type WorkflowSimulationTrace struct {
+	TemplateID    int64                           `json:"template_id"`
+	Completed     bool                            `json:"completed"`
+	Events        []WorkflowSimulationEvent       `json:"events"`
+	ActionItems   []WorkflowSimulationActionItem  `json:"action_items"`
+	Discrepancies []WorkflowSimulationDiscrepancy `json:"discrepancies"`
+	Errors        []WorkflowImportIssue           `json:"errors"`
+}
+type WorkflowSimulationEvent struct {
+	Type           string `json:"type"`
+	StepCode       string `json:"step_code,omitempty"`
+	Iteration      int    `json:"iteration,omitempty"`
+	TransitionCode string `json:"transition_code,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+}
+type WorkflowSimulationActionItem struct {
+	StepCode               string `json:"step_code,omitempty"`
+	Iteration              int    `json:"iteration,omitempty"`
+	SourceTriggerType      string `json:"source_trigger_type"`
+	TitleFA                string `json:"title_fa"`
+	Priority               string `json:"priority"`
+	AssignedRoleID         *int64 `json:"assigned_role_id,omitempty"`
+	AssignedRoleCode       string `json:"assigned_role_code,omitempty"`
+	RequiredPermissionCode string `json:"required_permission_code"`
+	DueOffsetHours         *int   `json:"due_offset_hours,omitempty"`
+	IsBlocking             bool   `json:"is_blocking"`
+}
+type WorkflowSimulationDiscrepancy struct {
+	MetricKey            string   `json:"metric_key"`
+	SourceStepCode       string   `json:"source_step_code"`
+	TargetStepCode       string   `json:"target_step_code"`
+	ExpectedValue        float64  `json:"expected_value"`
+	ActualValue          float64  `json:"actual_value"`
+	DifferenceValue      float64  `json:"difference_value"`
+	DifferencePercentage *float64 `json:"difference_percentage,omitempty"`
+	UnitCode             string   `json:"unit_code"`
+	Severity             string   `json:"severity"`
+	IsBlocking           bool     `json:"is_blocking"`
+}
+
+// SimulateWorkflowTemplate walks a template version, draft or published,
+// with sample values. Nothing is written.
+func (s *OperationsService) SimulateWorkflowTemplate(ctx context.Context, id int64, p WorkflowSimulationPayload) (WorkflowSimulationTrace, error) {
+	t, err := s.GetWorkflowTemplateVersion(ctx, id)
+	if err != nil {
+		return WorkflowSimulationTrace{}, err
+	}
+	return simulateWorkflow(t, p), nil
+}
+
+type simulatedStep struct {
+	code      string
+	iteration int
+}
+type simulatedHandoff struct {
+	stepCode string
+	sequence int
+	raw      json.RawMessage
+}
+
+type workflowSimulator struct {
+	t             WorkflowTemplateVersion
+	p             WorkflowSimulationPayload
+	trace         WorkflowSimulationTrace
+	steps         map[string]WorkflowTemplateStepV2
+	order         []string
+	codes         map[int64]string
+	outgoing      map[string][]WorkflowTransitionDefinition
+	incoming      map[string]int
+	metrics       map[string]HandoffMetricDefinition
+	submissions   map[string][]WorkflowSimulationSubmission
+	used          map[string]int
+	iterations    map[string]int
+	arrivals      map[string]map[string]bool
+	handoffs      map[string][]simulatedHandoff
+	values        map[string]map[string]json.RawMessage
+	paid          map[int]bool
+	queue         []simulatedStep
+	maxIterations int
+	stalled       bool
+}
+
+// simulateWorkflow runs t the way snapshotWorkflowTx, submitWorkflowStepTx,
+// completeStepTx and routeCompletedStepTx would run an instance of it.
+func simulateWorkflow(t WorkflowTemplateVersion, p WorkflowSimulationPayload) WorkflowSimulationTrace {
+	sim := &workflowSimulator{t: t, p: p, trace: WorkflowSimulationTrace{TemplateID: t.ID, Events: []WorkflowSimulationEvent{}, ActionItems: []WorkflowSimulationActionItem{}, Discrepancies: []WorkflowSimulationDiscrepancy{}, Errors: []WorkflowImportIssue{}},
+		steps: map[string]WorkflowTemplateStepV2{}, codes: map[int64]string{}, outgoing: map[string][]WorkflowTransitionDefinition{}, incoming: map[string]int{}, metrics: map[string]HandoffMetricDefinition{},
+		submissions: map[string][]WorkflowSimulationSubmission{}, used: map[string]int{}, iterations: map[string]int{}, arrivals: map[string]map[string]bool{}, handoffs: map[string][]simulatedHandoff{}, values: map[string]map[string]json.RawMessage{}, paid: map[int]bool{}, maxIterations: t.MaxIterations}
+	if sim.maxIterations <= 0 {
+		sim.maxIterations = 20
+	}
+	if !sim.prepare() {
+		return sim.trace
+	}
+	sim.run()
+	return sim.trace
+}
+
+func (sim *workflowSimulator) fail(path, code, message string) {
+	sim.trace.Errors = append(sim.trace.Errors, WorkflowImportIssue{Path: path, Code: code, Message: message})
+}
+
+func (sim *workflowSimulator) event(e WorkflowSimulationEvent) {
+	sim.trace.Events = append(sim.trace.Events, e)
+}
+
+func (sim *workflowSimulator) prepare() bool {
+	excluded := map[string]bool{}
+	for _, code := range sim.p.ExcludedSteps {
+		excluded[normalizeCode(code)] = true
+	}
+	steps := append([]WorkflowTemplateStepV2(nil), sim.t.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].SequenceNumber < steps[j].SequenceNumber })
+	for _, st := range steps {
+		if !st.IsActive {
+			continue
+		}
+		if excluded[st.StepCode] {
+			if !st.IsOptional {
+				sim.fail("excluded_steps", "STEP_NOT_OPTIONAL", "only optional steps may be excluded: "+st.StepCode)
+			}
+			delete(excluded, st.StepCode)
+			continue
+		}
+		sim.steps[st.StepCode] = st
+		sim.order = append(sim.order, st.StepCode)
+		sim.codes[st.ID] = st.StepCode
+	}
+	for code := range excluded {
+		sim.fail("excluded_steps", "UNKNOWN_STEP", "template has no active step "+code)
+	}
+	transitions := append([]WorkflowTransitionDefinition(nil), sim.t.Transitions...)
+	sort.SliceStable(transitions, func(i, j int) bool {
+		if transitions[i].SortOrder != transitions[j].SortOrder {
+			return transitions[i].SortOrder < transitions[j].SortOrder
+		}
+		return transitions[i].ID < transitions[j].ID
+	})
+	for _, tr := range transitions {
+		source, target := sim.codes[tr.SourceStepID], sim.codes[tr.TargetStepID]
+		if source == "" {
+			continue
+		}
+		sim.outgoing[source] = append(sim.outgoing[source], tr)
+		if target != "" {
+			sim.incoming[target]++
+		}
+	}
+	for _, m := range sim.t.Metrics {
+		sim.metrics[m.MetricKey] = m
+	}
+	for i, sub := range sim.p.Submissions {
+		code := normalizeCode(sub.StepCode)
+		if _, ok := sim.steps[code]; !ok {
+			sim.fail(fmt.Sprintf("submissions[%d]", i), "UNKNOWN_STEP", "template has no active step "+code)
+			continue
+		}
+		sim.submissions[code] = append(sim.submissions[code], sub)
+	}
+	for i, pay := range sim.p.Payments {
+		if pay.TriggerType != "STEP_OPEN" && pay.TriggerType != "STEP_COMPLETE" {
+			sim.fail(fmt.Sprintf("payments[%d]", i), "INVALID_TRIGGER", "payment trigger must be STEP_OPEN or STEP_COMPLETE")
+		}
+	}
+	if len(sim.order) == 0 {
+		sim.fail("steps", "NO_ACTIVE_STEPS", "template has no active steps")
+	}
+	return len(sim.trace.Errors) == 0
+}
+
+func (sim *workflowSimulator) run() {
+	sim.event(WorkflowSimulationEvent{Type: "WORKFLOW_STARTED"})
+	for _, task := range sim.t.Tasks {
+		if task.TriggerType == "ON_WORKFLOW_START" {
+			sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{SourceTriggerType: task.TriggerType, TitleFA: task.TitleFA, Priority: task.Priority, AssignedRoleID: task.AssignedRoleID, RequiredPermissionCode: task.RequiredPermissionCode, DueOffsetHours: task.DueOffsetHours, IsBlocking: task.BlocksWorkflowProgress})
+		}
+	}
+	if len(sim.t.Transitions) == 0 {
+		sim.open(sim.order[0], "")
+	} else {
+		entries := 0
+		for _, code := range sim.order {
+			if sim.steps[code].IsEntry {
+				sim.open(code, "")
+				entries++
+			}
+		}
+		if entries == 0 {
+			sim.fail("steps", "NO_ENTRY_STEP", "branched template has no entry step")
+			sim.stalled = true
+		}
+	}
+	for len(sim.queue) > 0 {
+		next := sim.queue[0]
+		sim.queue = sim.queue[1:]
+		sim.process(next)
+	}
+	for _, code := range sim.order {
+		if len(sim.arrivals[code]) > 0 && sim.iterations[code] == 0 {
+			sim.event(WorkflowSimulationEvent{Type: "JOIN_NOT_OPENED", StepCode: code, Detail: fmt.Sprintf("%d of %d branches arrived", len(sim.arrivals[code]), sim.joinRequired(code))})
+			sim.stalled = true
+		}
+	}
+	if !sim.stalled {
+		sim.trace.Completed = true
+		sim.event(WorkflowSimulationEvent{Type: "WORKFLOW_COMPLETED"})
+	}
+}
+
+func (sim *workflowSimulator) open(code, predecessor string) {
+	if sim.iterations[code] >= sim.maxIterations {
+		sim.fail("steps["+code+"]", "MAX_ITERATIONS", fmt.Sprintf("step would open more than %d times", sim.maxIterations))
+		sim.stalled = true
+		return
+	}
+	sim.iterations[code]++
+	st := sim.steps[code]
+	iteration := sim.iterations[code]
+	sim.event(WorkflowSimulationEvent{Type: "STEP_OPENED", StepCode: code, Iteration: iteration, Detail: predecessor})
+	sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "MAIN_STEP", TitleFA: st.InternalTitleFA, Priority: "NORMAL", AssignedRoleID: st.ResponsibleRoleID, AssignedRoleCode: st.ResponsibleRoleCode, RequiredPermissionCode: st.RequiredPermissionCode})
+	sim.triggers(code, iteration, "ON_STEP_OPEN")
+	sim.queue = append(sim.queue, simulatedStep{code: code, iteration: iteration})
+}
+
+// triggers creates the step tasks of event and raises the payment blocks a
+// STEP_OPEN or STEP_COMPLETE payment line would, like runStepTriggersTx.
+func (sim *workflowSimulator) triggers(code string, iteration int, event string) {
+	for _, task := range sim.steps[code].Tasks {
+		if task.TriggerType == event {
+			sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: task.TriggerType, TitleFA: task.TitleFA, Priority: task.Priority, AssignedRoleID: task.AssignedRoleID, RequiredPermissionCode: task.RequiredPermissionCode, DueOffsetHours: task.DueOffsetHours, IsBlocking: task.BlocksStepCompletion})
+		}
+	}
+	trigger := map[string]string{"ON_STEP_OPEN": "STEP_OPEN", "ON_STEP_COMPLETE": "STEP_COMPLETE"}[event]
+	if trigger == "" {
+		return
+	}
+	for i, pay := range sim.p.Payments {
+		if sim.paid[i] || pay.TriggerType != trigger || (pay.TriggerStepCode != "" && normalizeCode(pay.TriggerStepCode) != code) {
+			continue
+		}
+		sim.paid[i] = true
+		sim.event(WorkflowSimulationEvent{Type: "PAYMENT_BLOCKED", StepCode: code, Iteration: iteration, Detail: strings.TrimSpace(pay.TitleFA + " " + pay.Amount + " " + pay.Currency + "; assumed confirmed")})
+		sim.trace.ActionItems = append(sim.trace.ActionItems,
+			WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "PAYMENT_BLOCK", TitleFA: pay.TitleFA, Priority: "URGENT", AssignedRoleCode: "ACCOUNTANT", RequiredPermissionCode: "finance.payments.confirm"},
+			WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "PAYMENT_BLOCK", TitleFA: pay.TitleFA, Priority: "HIGH", AssignedRoleCode: "SALES", RequiredPermissionCode: "finance.payments.view"})
+	}
+}
+
+func (sim *workflowSimulator) submission(code string) WorkflowSimulationSubmission {
+	subs := sim.submissions[code]
+	if len(subs) == 0 {
+		return WorkflowSimulationSubmission{}
+	}
+	i := sim.used[code]
+	sim.used[code]++
+	if i >= len(subs) {
+		i = len(subs) - 1
+	}
+	return subs[i]
+}
+
+func (sim *workflowSimulator) process(at simulatedStep) {
+	code, iteration := at.code, at.iteration
+	st := sim.steps[code]
+	path := fmt.Sprintf("steps[%s#%d]", code, iteration)
+	sim.event(WorkflowSimulationEvent{Type: "STEP_STARTED", StepCode: code, Iteration: iteration})
+	sim.triggers(code, iteration, "ON_STEP_START")
+	sub := sim.submission(code)
+	failures := len(sim.trace.Errors)
+	known := map[string]bool{}
+	for _, f := range st.Fields {
+		known[f.FieldKey] = true
+		raw, ok := sub.Values[f.FieldKey]
+		if f.FieldType == "COMPUTED" {
+			if ok {
+				sim.fail(path+".fields."+f.FieldKey, "VALIDATION_FAILED", "computed field cannot be entered")
+			}
+			continue
+		}
+		if !ok {
+			if f.IsRequired {
+				sim.fail(path+".fields."+f.FieldKey, "VALIDATION_FAILED", "value is required")
+			}
+			continue
+		}
+		unit, currency := "", ""
+		if f.UnitCode != nil {
+			unit = *f.UnitCode
+		}
+		if f.CurrencyCode != nil {
+			currency = *f.CurrencyCode
+		}
+		if err := validateRuntimeValue(f.FieldType, raw, f.OptionsJSON, f.ValidationJSON, f.IsRequired, unit, currency); err != nil {
+			sim.fail(path+".fields."+f.FieldKey, "VALIDATION_FAILED", err.Error())
+		}
+	}
+	unknown := []string{}
+	for key := range sub.Values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		sim.fail(path+".fields."+key, "UNKNOWN_FIELD", "step has no field "+key)
+	}
+	values := sim.compute(path, iteration, st, sub.Values)
+	result := normalizeCode(sub.ResultCode)
+	if result != "" && !allowedWorkflowResult(result) {
+		sim.fail(path+".result_code", "INVALID_RESULT", "unsupported workflow result "+result)
+	}
+	var conditional *WorkflowTransitionDefinition
+	for _, tr := range sim.outgoing[code] {
+		if tr.TransitionType != "CONDITIONAL" || tr.ConditionExpression == nil {
+			continue
+		}
+		ok, err := evaluateCondition(*tr.ConditionExpression, values)
+		if err != nil {
+			sim.fail(path+".transitions."+tr.TransitionCode, "INVALID_CONDITION", err.Error())
+			break
+		}
+		if ok {
+			matched := tr
+			conditional = &matched
+			break
+		}
+	}
+	if len(sim.trace.Errors) > failures {
+		sim.stop(code, iteration, "submission rejected")
+		return
+	}
+	sim.values[code] = values
+	if st.DomainEventCode != nil {
+		sim.event(WorkflowSimulationEvent{Type: "DOMAIN_OPERATION_REQUIRED", StepCode: code, Iteration: iteration, Detail: *st.DomainEventCode + "; assumed recorded"})
+	}
+	sim.event(WorkflowSimulationEvent{Type: "STEP_SUBMITTED", StepCode: code, Iteration: iteration, Detail: result})
+	if conditional != nil {
+		sim.event(WorkflowSimulationEvent{Type: "CONDITION_MATCHED", StepCode: code, Iteration: iteration, TransitionCode: conditional.TransitionCode, Detail: *conditional.ConditionExpression})
+	}
+	sim.triggers(code, iteration, "ON_STEP_SUBMIT")
+	blocking, ok := sim.handoff(code, iteration, st, values)
+	if !ok {
+		sim.stop(code, iteration, "handoff value is not numeric")
+		return
+	}
+	if blocking {
+		sim.event(WorkflowSimulationEvent{Type: "STEP_HAS_MISMATCH", StepCode: code, Iteration: iteration, Detail: "blocking discrepancy must be resolved"})
+		sim.stalled = true
+		return
+	}
+	for _, item := range sim.trace.ActionItems {
+		if item.StepCode == code && item.Iteration == iteration && item.IsBlocking {
+			sim.event(WorkflowSimulationEvent{Type: "STEP_BLOCKED", StepCode: code, Iteration: iteration, Detail: "blocking tasks; assumed completed"})
+			break
+		}
+	}
+	if st.RequiresApproval {
+		sim.event(WorkflowSimulationEvent{Type: "WAITING_FOR_APPROVAL", StepCode: code, Iteration: iteration, Detail: "assumed approved"})
+		levels := applicableApprovalLevels(st.ApprovalLevels, sim.p.OrderAmount)
+		if len(levels) == 0 {
+			sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "APPROVAL", TitleFA: "تأیید " + st.InternalTitleFA, Priority: "HIGH", AssignedRoleID: st.ApprovalRoleID, RequiredPermissionCode: "workflow_steps.approve"})
+		}
+		for i, l := range levels {
+			title := "تأیید " + st.InternalTitleFA
+			if len(levels) > 1 {
+				title += fmt.Sprintf(" (سطح %d از %d)", i+1, len(levels))
+			}
+			role := l.ApprovalRoleID
+			sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "APPROVAL", TitleFA: title, Priority: "HIGH", AssignedRoleID: &role, RequiredPermissionCode: "workflow_steps.approve"})
+		}
+		sim.triggers(code, iteration, "ON_STEP_APPROVE")
+	}
+	sim.event(WorkflowSimulationEvent{Type: "STEP_COMPLETED", StepCode: code, Iteration: iteration})
+	sim.triggers(code, iteration, "ON_STEP_COMPLETE")
+	sim.route(code, iteration, st, sub, result, conditional)
+}
+
+// compute adds the COMPUTED fields of st to the entered values like
+// computeStepFieldsTx, reading earlier steps from their latest submission.
+func (sim *workflowSimulator) compute(path string, iteration int, st WorkflowTemplateStepV2, entered map[string]json.RawMessage) map[string]json.RawMessage {
+	values := map[string]json.RawMessage{}
+	for key, raw := range entered {
+		values[key] = raw
+	}
+	unitOf := func(fields []WorkflowFieldDefinition, key string) string {
+		for _, f := range fields {
+			if f.FieldKey == key && f.UnitCode != nil {
+				return *f.UnitCode
+			}
+		}
+		return ""
+	}
+	for _, f := range st.Fields {
+		if f.FieldType != "COMPUTED" {
+			continue
+		}
+		delete(values, f.FieldKey)
+		unit := ""
+		if f.UnitCode != nil {
+			unit = *f.UnitCode
+		}
+		raw, err := computeFormula(formulaSource(f.ValidationJSON), unit, func(step, key string) (formulaQuantity, error) {
+			source, fields := values, st.Fields
+			if step != "" {
+				if prior, ok := sim.steps[step]; ok && prior.SequenceNumber < st.SequenceNumber {
+					source, fields = sim.values[step], prior.Fields
+				} else {
+					source = nil
+				}
+			}
+			v, ok := source[key]
+			if !ok {
+				return formulaQuantity{}, errFormulaOperandMissing
+			}
+			return formulaOperand(v, unitOf(fields, key))
+		})
+		if errors.Is(err, errFormulaOperandMissing) {
+			if f.IsRequired {
+				sim.fail(path+".fields."+f.FieldKey, "VALIDATION_FAILED", "cannot be computed until its fields are entered")
+			}
+			continue
+		}
+		if err == nil {
+			err = validateRuntimeValue("COMPUTED", raw, nil, f.ValidationJSON, f.IsRequired, unit, "")
+		}
+		if err != nil {
+			sim.fail(path+".fields."+f.FieldKey, "VALIDATION_FAILED", err.Error())
+			continue
+		}
+		values[f.FieldKey] = raw
+		sim.event(WorkflowSimulationEvent{Type: "FIELD_COMPUTED", StepCode: st.StepCode, Iteration: iteration, Detail: f.FieldKey + " = " + string(raw)})
+	}
+	return values
+}
+
+func (sim *workflowSimulator) stop(code string, iteration int, detail string) {
+	sim.event(WorkflowSimulationEvent{Type: "STOPPED", StepCode: code, Iteration: iteration, Detail: detail})
+	sim.stalled = true
+}
+
+// handoff compares the IN handoff fields of a submission with the latest
+// OUT value of an earlier step, like evaluateHandoffsTx, and keeps the OUT
+// fields for later steps. It reports whether a blocking discrepancy arose
+// and false when a handoff value is not numeric.
+func (sim *workflowSimulator) handoff(code string, iteration int, st WorkflowTemplateStepV2, values map[string]json.RawMessage) (bool, bool) {
+	blocking := false
+	for _, f := range st.Fields {
+		raw, ok := values[f.FieldKey]
+		if !ok || f.HandoffMetricKey == nil || f.HandoffDirection == nil {
+			continue
+		}
+		metricKey := *f.HandoffMetricKey
+		if *f.HandoffDirection == "OUT" {
+			sim.handoffs[metricKey] = append(sim.handoffs[metricKey], simulatedHandoff{stepCode: code, sequence: st.SequenceNumber, raw: raw})
+			continue
+		}
+		metric, ok := sim.metrics[metricKey]
+		if *f.HandoffDirection != "IN" || !ok {
+			continue
+		}
+		actual, ok := extractNumber(raw)
+		if !ok {
+			sim.fail(fmt.Sprintf("steps[%s#%d].fields.%s", code, iteration, f.FieldKey), "VALIDATION_FAILED", "handoff metric "+metricKey+" is not numeric")
+			return false, false
+		}
+		var source *simulatedHandoff
+		for i := range sim.handoffs[metricKey] {
+			h := &sim.handoffs[metricKey][i]
+			if h.sequence < st.SequenceNumber && (source == nil || h.sequence >= source.sequence) {
+				source = h
+			}
+		}
+		if source == nil {
+			continue
+		}
+		expected, ok := extractNumber(source.raw)
+		if !ok {
+			sim.fail("steps["+source.stepCode+"].fields", "VALIDATION_FAILED", "previous handoff metric "+metricKey+" is not numeric")
+			return false, false
+		}
+		allowed, pct := withinHandoffTolerance(expected, actual, metric.AbsoluteTolerance, metric.PercentageTolerance)
+		if allowed {
+			continue
+		}
+		severity := "WARNING"
+		if metric.BlockingOnMismatch {
+			severity, blocking = "CRITICAL", true
+		}
+		sim.trace.Discrepancies = append(sim.trace.Discrepancies, WorkflowSimulationDiscrepancy{MetricKey: metricKey, SourceStepCode: source.stepCode, TargetStepCode: code, ExpectedValue: expected, ActualValue: actual, DifferenceValue: actual - expected, DifferencePercentage: pct, UnitCode: metric.UnitCode, Severity: severity, IsBlocking: metric.BlockingOnMismatch})
+		sim.event(WorkflowSimulationEvent{Type: "DISCREPANCY", StepCode: code, Iteration: iteration, Detail: fmt.Sprintf("%s expected %g got %g (%s)", metricKey, expected, actual, severity)})
+	}
+	return blocking, true
+}
+
+func (sim *workflowSimulator) route(code string, iteration int, st WorkflowTemplateStepV2, sub WorkflowSimulationSubmission, result string, conditional *WorkflowTransitionDefinition) {
+	if len(sim.t.Transitions) == 0 {
+		for _, next := range sim.order {
+			if sim.steps[next].SequenceNumber > st.SequenceNumber && sim.iterations[next] == 0 {
+				sim.open(next, code)
+				return
+			}
+		}
+		return
+	}
+	outgoing := sim.outgoing[code]
+	if len(outgoing) == 0 {
+		sim.event(WorkflowSimulationEvent{Type: "BRANCH_ENDED", StepCode: code, Iteration: iteration})
+		return
+	}
+	forked := false
+	for _, tr := range outgoing {
+		if tr.TransitionType == "PARALLEL" {
+			forked = true
+			sim.activate(code, iteration, tr)
+		}
+	}
+	if forked {
+		return
+	}
+	choice := conditional
+	if choice == nil && result != "" {
+		for _, isDefault := range []bool{true, false} {
+			for _, tr := range outgoing {
+				if choice == nil && tr.TransitionType == "RESULT_BASED" && tr.IsDefault == isDefault && tr.ResultCode != nil && *tr.ResultCode == result {
+					matched := tr
+					choice = &matched
+				}
+			}
+		}
+	}
+	for _, tr := range outgoing {
+		if choice == nil && tr.TransitionType == "AUTOMATIC" && tr.IsDefault {
+			matched := tr
+			choice = &matched
+		}
+	}
+	if choice != nil {
+		sim.activate(code, iteration, *choice)
+		return
+	}
+	manual := false
+	for _, tr := range outgoing {
+		if tr.TransitionType != "MANUAL_SELECTION" {
+			continue
+		}
+		manual = true
+		if sub.TransitionCode != "" && tr.TransitionCode == normalizeCode(sub.TransitionCode) {
+			sim.activate(code, iteration, tr)
+			return
+		}
+	}
+	path := fmt.Sprintf("steps[%s#%d]", code, iteration)
+	switch {
+	case !manual:
+		sim.fail(path, "INVALID_TRANSITION", "no transition matches the step result")
+		sim.stop(code, iteration, "no route")
+	case sub.TransitionCode != "":
+		sim.fail(path+".transition_code", "INVALID_TRANSITION", "transition "+normalizeCode(sub.TransitionCode)+" is not a manual choice of this step")
+		sim.stop(code, iteration, "no route")
+	default:
+		sim.event(WorkflowSimulationEvent{Type: "WAITING_FOR_TRANSITION", StepCode: code, Iteration: iteration, Detail: "give transition_code in the submission to continue"})
+		sim.trace.ActionItems = append(sim.trace.ActionItems, WorkflowSimulationActionItem{StepCode: code, Iteration: iteration, SourceTriggerType: "TRANSITION", TitleFA: "انتخاب مسیر " + st.InternalTitleFA, Priority: "HIGH", AssignedRoleID: st.ResponsibleRoleID, AssignedRoleCode: st.ResponsibleRoleCode, RequiredPermissionCode: "workflow_transitions.select", IsBlocking: true})
+		sim.stalled = true
+	}
+}
+
+func (sim *workflowSimulator) joinRequired(code string) int {
+	st := sim.steps[code]
+	if st.JoinMode == "QUORUM" && st.JoinQuorum != nil {
+		return *st.JoinQuorum
+	}
+	return sim.incoming[code]
+}
+
+// activate follows one transition like activateTransitionTx: a join opens
+// once enough branches arrived, and a step that already ran opens again as
+// a new iteration.
+func (sim *workflowSimulator) activate(source string, iteration int, tr WorkflowTransitionDefinition) {
+	target, ok := sim.codes[tr.TargetStepID]
+	if !ok {
+		sim.fail(fmt.Sprintf("steps[%s#%d].transitions.%s", source, iteration, tr.TransitionCode), "INVALID_TRANSITION", "transition leads to an inactive or excluded step")
+		sim.stop(source, iteration, "no route")
+		return
+	}
+	sim.event(WorkflowSimulationEvent{Type: "TRANSITION", StepCode: source, Iteration: iteration, TransitionCode: tr.TransitionCode, Detail: source + " -> " + target})
+	if mode := sim.steps[target].JoinMode; mode == "ALL" || mode == "QUORUM" {
+		if sim.arrivals[target] == nil {
+			sim.arrivals[target] = map[string]bool{}
+		}
+		sim.arrivals[target][source+"."+tr.TransitionCode] = true
+		if sim.iterations[target] > 0 {
+			sim.event(WorkflowSimulationEvent{Type: "BRANCH_ENDED", StepCode: target, Detail: "join already open"})
+			return
+		}
+		if arrived, required := len(sim.arrivals[target]), sim.joinRequired(target); arrived < required {
+			sim.event(WorkflowSimulationEvent{Type: "JOIN_WAITING", StepCode: target, Detail: fmt.Sprintf("%d of %d branches arrived", arrived, required)})
+			return
+		}
+	}
+	sim.open(target, source)
+}
@@ -0,0 +1,242 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WorkflowStepSLAPolicy is the service level of a template step, in working
+// hours. The clock starts when a step instance opens and runs on the
+// business calendar of the workflow. The worker warns the assignee at
+// WarnAtPercent of the SLA, escalates to EscalationRoleID (or the
+// responsible role) when it is breached, hands the step to the escalation
+// role ReassignAfterHours after it opened, and tells the customer about the
+// breach when NotifyCustomer is set and the step is customer visible.
+type WorkflowStepSLAPolicy struct {
+	SLAHours           int    `json:"sla_hours"`
+	WarnAtPercent      *int   `json:"warn_at_percent,omitempty"`
+	EscalationRoleID   *int64 `json:"escalation_role_id,omitempty"`
+	ReassignAfterHours *int   `json:"reassign_after_hours,omitempty"`
+	NotifyCustomer     bool   `json:"notify_customer"`
+}
+
+// maxSLAHours bounds a policy to a year of hours.
+const maxSLAHours = 24 * 365
+
+func validateSLAPolicy(p WorkflowStepSLAPolicy) error {
+	if p.SLAHours <= 0 || p.SLAHours > maxSLAHours {
+		return errors.New("sla_hours must be between 1 and 8760")
+	}
+	if p.WarnAtPercent != nil && (*p.WarnAtPercent < 1 || *p.WarnAtPercent > 99) {
+		return errors.New("warn_at_percent must be between 1 and 99")
+	}
+	if p.ReassignAfterHours != nil {
+		if *p.ReassignAfterHours <= 0 || *p.ReassignAfterHours > maxSLAHours {
+			return errors.New("reassign_after_hours must be between 1 and 8760")
+		}
+		if p.EscalationRoleID == nil {
+			return errors.New("reassignment requires an escalation role")
+		}
+	}
+	return nil
+}
+
+func (s *OperationsService) getStepSLAPolicy(ctx context.Context, stepID int64) (*WorkflowStepSLAPolicy, error) {
+	var p WorkflowStepSLAPolicy
+	var warn, reassign, role sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer FROM workflow_step_sla_policies WHERE workflow_template_step_id=$1`, stepID).Scan(&p.SLAHours, &warn, &role, &reassign, &p.NotifyCustomer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.WarnAtPercent, p.ReassignAfterHours = nullableIntPtr(warn), nullableIntPtr(reassign)
+	if role.Valid {
+		v := role.Int64
+		p.EscalationRoleID = &v
+	}
+	return &p, nil
+}
+
+func nullableIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func (s *OperationsService) SaveWorkflowStepSLA(ctx context.Context, actor string, stepID int64, p WorkflowStepSLAPolicy) error {
+	templateID, err := s.templateIDForStep(ctx, stepID)
+	if err != nil {
+		return err
+	}
+	if err = s.ensureDraft(ctx, templateID); err != nil {
+		return err
+	}
+	if err = validateSLAPolicy(p); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO workflow_step_sla_policies(workflow_template_step_id,sla_hours,warn_at_percent,escalation_role_id,reassign_after_hours,notify_customer) VALUES($1,$2,$3,$4,$5,$6) ON CONFLICT(workflow_template_step_id) DO UPDATE SET sla_hours=EXCLUDED.sla_hours,warn_at_percent=EXCLUDED.warn_at_percent,escalation_role_id=EXCLUDED.escalation_role_id,reassign_after_hours=EXCLUDED.reassign_after_hours,notify_customer=EXCLUDED.notify_customer,updated_at=NOW()`, stepID, p.SLAHours, p.WarnAtPercent, p.EscalationRoleID, p.ReassignAfterHours, p.NotifyCustomer)
+	if err == nil {
+		s.audit(ctx, actor, "workflow_steps.sla.save", "workflow_template_step", fmt.Sprint(stepID), p)
+	}
+	return err
+}
+
+func (s *OperationsService) DeleteWorkflowStepSLA(ctx context.Context, actor string, stepID int64) error {
+	templateID, err := s.templateIDForStep(ctx, stepID)
+	if err != nil {
+		return err
+	}
+	if err = s.ensureDraft(ctx, templateID); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM workflow_step_sla_policies WHERE workflow_template_step_id=$1`, stepID)
+	if err == nil {
+		s.audit(ctx, actor, "workflow_steps.sla.delete", "workflow_template_step", fmt.Sprint(stepID), nil)
+	}
+	return err
+}
+
+// startStepSLATx starts the SLA clock of a step instance that just opened,
+// or restarts the stopped clock of a reopened one. Policies are read from the
+// published template, which no longer changes.
+func (s *OperationsService) startStepSLATx(ctx context.Context, tx *sql.Tx, stepID string) error {
+	var workflowID string
+	var hours int
+	var warn, role, reassign sql.NullInt64
+	var notify bool
+	err := tx.QueryRowContext(ctx, `SELECT si.workflow_instance_id,p.sla_hours,p.warn_at_percent,p.escalation_role_id,p.reassign_after_hours,p.notify_customer FROM workflow_step_instances si JOIN workflow_step_sla_policies p ON p.workflow_template_step_id=si.workflow_template_step_id WHERE si.id=$1`, stepID).Scan(&workflowID, &hours, &warn, &role, &reassign, &notify)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	calendar, err := s.workflowCalendarTx(ctx, tx, workflowID, now)
+	if err != nil {
+		return err
+	}
+	sla := time.Duration(hours) * time.Hour
+	var warnAt, reassignAt any
+	if warn.Valid {
+		warnAt = calendar.add(now, sla*time.Duration(warn.Int64)/100)
+	}
+	if reassign.Valid {
+		reassignAt = calendar.add(now, time.Duration(reassign.Int64)*time.Hour)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO workflow_step_sla_timers(workflow_step_instance_id,workflow_instance_id,started_at,warn_at,due_at,reassign_at,escalation_role_id,notify_customer) VALUES($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT(workflow_step_instance_id) DO UPDATE SET started_at=EXCLUDED.started_at,warn_at=EXCLUDED.warn_at,due_at=EXCLUDED.due_at,reassign_at=EXCLUDED.reassign_at,warned_at=NULL,escalated_at=NULL,reassigned_at=NULL,customer_notified_at=NULL,stopped_at=NULL WHERE workflow_step_sla_timers.stopped_at IS NOT NULL`, stepID, workflowID, now, warnAt, calendar.add(now, sla), reassignAt, role, notify)
+	return err
+}
+
+// runWorkflowSLAJob stops the timers of closed steps and executes the due
+// warn, escalate, reassign and customer-notice actions of the rest. Each
+// action is claimed by stamping its timer column, so it runs once.
+func (s *OperationsService) runWorkflowSLAJob(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_sla_timers t SET stopped_at=NOW() FROM workflow_step_instances si WHERE si.id=t.workflow_step_instance_id AND t.stopped_at IS NULL AND si.status IN ('COMPLETED','SKIPPED','CANCELLED')`); err != nil {
+		return 0, err
+	}
+	count := 0
+	warned, err := claimSLATimersTx(ctx, tx, `UPDATE workflow_step_sla_timers SET warned_at=NOW() WHERE stopped_at IS NULL AND warned_at IS NULL AND warn_at<=NOW() AND due_at>NOW() RETURNING workflow_step_instance_id`)
+	if err != nil {
+		return 0, err
+	}
+	for _, stepID := range warned {
+		var workflowID, title string
+		var assigned sql.NullString
+		var due time.Time
+		if err = tx.QueryRowContext(ctx, `SELECT si.workflow_instance_id,si.internal_title_fa,si.assigned_user_id,t.due_at FROM workflow_step_instances si JOIN workflow_step_sla_timers t ON t.workflow_step_instance_id=si.id WHERE si.id=$1`, stepID).Scan(&workflowID, &title, &assigned, &due); err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,assigned_user_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,'هشدار SLA '||si.internal_title_fa,'مهلت این مرحله رو به پایان است','OPEN','HIGH',si.responsible_role_id,si.assigned_user_id,'workflow_steps.submit',$2,'sla:warn:'||si.id,'SLA_WARNING' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID, due)
+		if err != nil {
+			return 0, err
+		}
+		if assigned.Valid {
+			if err = emitNotificationTx(ctx, tx, assigned.String, "WORKFLOW_SLA_WARNING", "sla-warning:"+stepID, "WORKFLOW_STEP", stepID, "/panel/dashboard/workflows/"+workflowID, map[string]string{"step_name": title, "due_at": formatJalaliDateTime(due)}); err != nil {
+				return 0, err
+			}
+		}
+		s.auditTx(ctx, tx, "", "workflow_sla.warned", "workflow_step_instance", stepID, nil, map[string]any{"due_at": due})
+		count++
+	}
+	escalated, err := claimSLATimersTx(ctx, tx, `UPDATE workflow_step_sla_timers SET escalated_at=NOW() WHERE stopped_at IS NULL AND escalated_at IS NULL AND due_at<=NOW() RETURNING workflow_step_instance_id`)
+	if err != nil {
+		return 0, err
+	}
+	for _, stepID := range escalated {
+		var role sql.NullInt64
+		if err = tx.QueryRowContext(ctx, `SELECT COALESCE(t.escalation_role_id,si.responsible_role_id) FROM workflow_step_instances si JOIN workflow_step_sla_timers t ON t.workflow_step_instance_id=si.id WHERE si.id=$1`, stepID).Scan(&role); err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO action_items(workflow_instance_id,workflow_step_instance_id,order_id,customer_user_id,title_fa,description_fa,status,priority,assigned_role_id,required_permission_code,due_at,deduplication_key,source_trigger_type) SELECT wi.id,si.id,wi.order_id,wi.customer_user_id,'تشدید SLA '||si.internal_title_fa,'مهلت این مرحله گذشته است','OPEN','URGENT',$2,'workflow_steps.reassign',NOW(),'sla:escalate:'||si.id,'SLA_ESCALATION' FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id WHERE si.id=$1 ON CONFLICT(deduplication_key) WHERE deduplication_key IS NOT NULL DO NOTHING`, stepID, nullableInt(role))
+		if err != nil {
+			return 0, err
+		}
+		s.auditTx(ctx, tx, "", "workflow_sla.escalated", "workflow_step_instance", stepID, nil, map[string]any{"escalation_role_id": nullableInt(role)})
+		count++
+	}
+	notices, err := claimSLATimersTx(ctx, tx, `UPDATE workflow_step_sla_timers t SET customer_notified_at=NOW() FROM workflow_step_instances si WHERE si.id=t.workflow_step_instance_id AND t.stopped_at IS NULL AND t.customer_notified_at IS NULL AND t.notify_customer AND si.customer_visible AND t.due_at<=NOW() RETURNING t.workflow_step_instance_id`)
+	if err != nil {
+		return 0, err
+	}
+	for _, stepID := range notices {
+		var customer, orderNumber, stepName string
+		if err = tx.QueryRowContext(ctx, `SELECT wi.customer_user_id,o.order_number,COALESCE(si.customer_title_fa,si.internal_title_fa) FROM workflow_step_instances si JOIN workflow_instances wi ON wi.id=si.workflow_instance_id JOIN orders o ON o.id=wi.order_id WHERE si.id=$1`, stepID).Scan(&customer, &orderNumber, &stepName); err != nil {
+			return 0, err
+		}
+		if err = emitNotificationTx(ctx, tx, customer, "WORKFLOW_STEP_DELAYED", "sla-breach:"+stepID, "WORKFLOW_STEP", stepID, "/account", map[string]string{"order_number": orderNumber, "step_name": stepName}); err != nil {
+			return 0, err
+		}
+		s.auditTx(ctx, tx, "", "workflow_sla.customer_notified", "workflow_step_instance", stepID, nil, map[string]any{"customer_user_id": customer})
+		count++
+	}
+	reassigned, err := claimSLATimersTx(ctx, tx, `UPDATE workflow_step_sla_timers SET reassigned_at=NOW() WHERE stopped_at IS NULL AND reassigned_at IS NULL AND reassign_at<=NOW() AND escalation_role_id IS NOT NULL RETURNING workflow_step_instance_id`)
+	if err != nil {
+		return 0, err
+	}
+	for _, stepID := range reassigned {
+		var assigned sql.NullString
+		var before, after sql.NullInt64
+		if err = tx.QueryRowContext(ctx, `SELECT si.assigned_user_id,si.responsible_role_id,t.escalation_role_id FROM workflow_step_instances si JOIN workflow_step_sla_timers t ON t.workflow_step_instance_id=si.id WHERE si.id=$1 FOR UPDATE OF si`, stepID).Scan(&assigned, &before, &after); err != nil {
+			return 0, err
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE workflow_step_instances SET assigned_user_id=NULL,responsible_role_id=$2,updated_at=NOW() WHERE id=$1`, stepID, after.Int64); err != nil {
+			return 0, err
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE action_items SET assigned_user_id=NULL,assigned_role_id=$2,updated_at=NOW() WHERE workflow_step_instance_id=$1 AND source_trigger_type IN ('MAIN_STEP','CORRECTION') AND status NOT IN ('COMPLETED','CANCELLED')`, stepID, after.Int64); err != nil {
+			return 0, err
+		}
+		s.auditTx(ctx, tx, "", "workflow_sla.reassigned", "workflow_step_instance", stepID, map[string]any{"assigned_user_id": assigned.String, "responsible_role_id": nullableInt(before)}, map[string]any{"responsible_role_id": after.Int64})
+		count++
+	}
+	return count, tx.Commit()
+}
+
+func claimSLATimersTx(ctx context.Context, tx *sql.Tx, query string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,28 @@
+-- SMS delivery-status reconciliation for the notification outbox.
+-- Provider delivery reports are polled by the operations worker after a message is SENT.
+
+ALTER TABLE notification_outbox
+  ADD COLUMN IF NOT EXISTS delivery_checked_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS delivery_check_count INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS delivery_status_at TIMESTAMPTZ;
+
+ALTER TABLE notification_outbox DROP CONSTRAINT IF EXISTS notification_outbox_status_check;
+ALTER TABLE notification_outbox ADD CONSTRAINT notification_outbox_status_check
+  CHECK(status IN ('PENDING','PROCESSING','SENT','RETRY','FAILED','CANCELLED','DELIVERED','UNDELIVERED','EXPIRED'));
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_awaiting_report
+  ON notification_outbox(delivery_checked_at NULLS FIRST,sent_at) WHERE status='SENT';
+
+CREATE TABLE IF NOT EXISTS notification_delivery_reports (
+  id BIGSERIAL PRIMARY KEY,
+  outbox_id UUID NOT NULL REFERENCES notification_outbox(id) ON DELETE CASCADE,
+  provider_message_id TEXT NOT NULL,
+  delivery_status TEXT NOT NULL,
+  reported_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE(outbox_id,provider_message_id),
+  CHECK(delivery_status IN ('DELIVERED','UNDELIVERED','EXPIRED'))
+);
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (21, 'notification_delivery_reports')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
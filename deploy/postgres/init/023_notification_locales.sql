@@ -0,0 +1,76 @@
+-- Per-user notification language. Templates are selected in the user's
+-- preferred locale and fall back to fa when no active translation exists.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_locale TEXT NOT NULL DEFAULT 'fa';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_preferred_locale_check;
+ALTER TABLE users ADD CONSTRAINT users_preferred_locale_check CHECK(preferred_locale IN ('fa','en','ar'));
+
+ALTER TABLE notification_templates DROP CONSTRAINT IF EXISTS notification_templates_locale_check;
+ALTER TABLE notification_templates ADD CONSTRAINT notification_templates_locale_check CHECK(locale IN ('fa','en','ar'));
+
+INSERT INTO notification_templates(event_type,channel,locale,audience_type,title_template,body_template,html_template,allowed_variables,is_active)
+SELECT fa.event_type,fa.channel,t.locale,fa.audience_type,t.title_template,t.body_template,t.html_template,fa.allowed_variables,fa.is_active
+FROM (VALUES
+  ('CUSTOMER_ACCOUNT_CREATED','SMS','en','Account created','Your Sang-e Hassan order account has been created.',NULL),
+  ('CUSTOMER_ACCOUNT_CREATED','SMS','ar','تم إنشاء الحساب','تم إنشاء حساب طلبك لدى سنگ حسن.',NULL),
+  ('CUSTOMER_ACCOUNT_ACTIVATED','SMS','en','Account activated','Your Sang-e Hassan order account is now active.',NULL),
+  ('CUSTOMER_ACCOUNT_ACTIVATED','SMS','ar','تفعيل الحساب','تم تفعيل حساب طلبك لدى سنگ حسن.',NULL),
+  ('PROFORMA_ISSUED','SMS','en','Proforma issued','A new proforma invoice is ready in your Sang-e Hassan account.',NULL),
+  ('PROFORMA_ISSUED','SMS','ar','إصدار الفاتورة المبدئية','فاتورة مبدئية جديدة جاهزة في حسابك لدى سنگ حسن.',NULL),
+  ('ORDER_CONFIRMED','SMS','en','Order confirmed','Your Sang-e Hassan order has been confirmed.',NULL),
+  ('ORDER_CONFIRMED','SMS','ar','تأكيد الطلب','تم تأكيد طلبك لدى سنگ حسن.',NULL),
+  ('PAYMENT_REQUIRED','SMS','en','Payment required','Please check the payment status of your account to continue your order.',NULL),
+  ('PAYMENT_REQUIRED','SMS','ar','طلب الدفع','يرجى مراجعة حالة الدفع في حسابك لمتابعة الطلب.',NULL),
+  ('PAYMENT_CONFIRMED','SMS','en','Payment confirmed','Payment of {{amount}} {{currency}} for order {{order_number}} was confirmed.',NULL),
+  ('PAYMENT_CONFIRMED','SMS','ar','تأكيد الدفع','تم تأكيد دفع {{amount}} {{currency}} للطلب {{order_number}}.',NULL),
+  ('SHIPMENT_DISPATCHED','SMS','en','Order dispatched','Your order shipment has been dispatched.',NULL),
+  ('SHIPMENT_DISPATCHED','SMS','ar','شحن الطلب','تم إرسال شحنة طلبك.',NULL),
+  ('SHIPMENT_ETA','SMS','en','Delivery time','The estimated delivery time of your shipment is approaching.',NULL),
+  ('SHIPMENT_ETA','SMS','ar','موعد التسليم','اقترب موعد التسليم المتوقع لشحنتك.',NULL),
+  ('SHIPMENT_DELIVERED','SMS','en','Order delivered','Delivery of your order shipment has been recorded.',NULL),
+  ('SHIPMENT_DELIVERED','SMS','ar','تسليم الطلب','تم تسجيل تسليم شحنة طلبك.',NULL),
+  ('INSTALLATION_STARTED','SMS','en','Installation started','Installation of your order has started.',NULL),
+  ('INSTALLATION_STARTED','SMS','ar','بدء التركيب','بدأت عملية تركيب طلبك.',NULL),
+  ('ORDER_COMPLETED','SMS','en','Order completed','Your Sang-e Hassan order has been completed.',NULL),
+  ('ORDER_COMPLETED','SMS','ar','اكتمال الطلب','اكتمل طلبك لدى سنگ حسن.',NULL),
+  ('PROFORMA_ISSUED','EMAIL','en','Proforma issued','A new proforma invoice for your order is ready in your Sang-e Hassan account.','<p>A new proforma invoice for your order is ready in your Sang-e Hassan account.</p>'),
+  ('PROFORMA_ISSUED','EMAIL','ar','إصدار الفاتورة المبدئية','فاتورة مبدئية جديدة لطلبك جاهزة في حسابك لدى سنگ حسن.','<p dir="rtl">فاتورة مبدئية جديدة لطلبك جاهزة في حسابك لدى سنگ حسن.</p>'),
+  ('ORDER_CONFIRMED','EMAIL','en','Order confirmed','Your Sang-e Hassan order has been confirmed and is now in progress.','<p>Your Sang-e Hassan order has been confirmed and is now in progress.</p>'),
+  ('ORDER_CONFIRMED','EMAIL','ar','تأكيد الطلب','تم تأكيد طلبك لدى سنگ حسن وبدأ تنفيذه.','<p dir="rtl">تم تأكيد طلبك لدى سنگ حسن وبدأ تنفيذه.</p>'),
+  ('PAYMENT_CONFIRMED','EMAIL','en','Payment confirmed','Payment of {{amount}} {{currency}} for order {{order_number}} was confirmed.','<p>Payment of <strong>{{amount}} {{currency}}</strong> for order {{order_number}} was confirmed.</p>'),
+  ('PAYMENT_CONFIRMED','EMAIL','ar','تأكيد الدفع','تم تأكيد دفع {{amount}} {{currency}} للطلب {{order_number}}.','<p dir="rtl">تم تأكيد دفع <strong>{{amount}} {{currency}}</strong> للطلب {{order_number}}.</p>'),
+  ('SHIPMENT_DISPATCHED','EMAIL','en','Order dispatched','Your order shipment has been dispatched.','<p>Your order shipment has been dispatched.</p>'),
+  ('SHIPMENT_DISPATCHED','EMAIL','ar','شحن الطلب','تم إرسال شحنة طلبك.','<p dir="rtl">تم إرسال شحنة طلبك.</p>'),
+  ('SHIPMENT_DELIVERED','EMAIL','en','Order delivered','Delivery of your order shipment has been recorded.','<p>Delivery of your order shipment has been recorded.</p>'),
+  ('SHIPMENT_DELIVERED','EMAIL','ar','تسليم الطلب','تم تسجيل تسليم شحنة طلبك.','<p dir="rtl">تم تسجيل تسليم شحنة طلبك.</p>'),
+  ('ORDER_COMPLETED','EMAIL','en','Order completed','Your Sang-e Hassan order has been completed.','<p>Your Sang-e Hassan order has been completed.</p>'),
+  ('ORDER_COMPLETED','EMAIL','ar','اكتمال الطلب','اكتمل طلبك لدى سنگ حسن.','<p dir="rtl">اكتمل طلبك لدى سنگ حسن.</p>'),
+  ('CUSTOMER_ACCOUNT_CREATED','IN_APP','en','Account created','Your order account has been created.',NULL),
+  ('CUSTOMER_ACCOUNT_CREATED','IN_APP','ar','تم إنشاء الحساب','تم إنشاء حساب طلبك.',NULL),
+  ('CUSTOMER_ACCOUNT_ACTIVATED','IN_APP','en','Account activated','Your account has been activated successfully.',NULL),
+  ('CUSTOMER_ACCOUNT_ACTIVATED','IN_APP','ar','تفعيل الحساب','تم تفعيل حسابك بنجاح.',NULL),
+  ('PROFORMA_ISSUED','IN_APP','en','Proforma issued','A new proforma invoice has been issued for your order.',NULL),
+  ('PROFORMA_ISSUED','IN_APP','ar','إصدار الفاتورة المبدئية','تم إصدار فاتورة مبدئية جديدة لطلبك.',NULL),
+  ('ORDER_CONFIRMED','IN_APP','en','Order confirmed','Your order has been confirmed and is now in progress.',NULL),
+  ('ORDER_CONFIRMED','IN_APP','ar','تأكيد الطلب','تم تأكيد طلبك وبدأ تنفيذه.',NULL),
+  ('PAYMENT_REQUIRED','IN_APP','en','Payment required','Please make the scheduled payment to continue your order.',NULL),
+  ('PAYMENT_REQUIRED','IN_APP','ar','طلب الدفع','يرجى إتمام الدفعة المجدولة لمتابعة طلبك.',NULL),
+  ('PAYMENT_CONFIRMED','IN_APP','en','Payment confirmed','Payment of {{amount}} {{currency}} for order {{order_number}} was confirmed.',NULL),
+  ('PAYMENT_CONFIRMED','IN_APP','ar','تأكيد الدفع','تم تأكيد دفع {{amount}} {{currency}} للطلب {{order_number}}.',NULL),
+  ('SHIPMENT_DISPATCHED','IN_APP','en','Shipment dispatched','Your order shipment has been dispatched.',NULL),
+  ('SHIPMENT_DISPATCHED','IN_APP','ar','شحن الطلب','تم إرسال شحنة طلبك.',NULL),
+  ('SHIPMENT_ETA','IN_APP','en','Estimated delivery','Shipment {{shipment_number}} is expected to be delivered on {{eta}}.',NULL),
+  ('SHIPMENT_ETA','IN_APP','ar','موعد التسليم المتوقع','من المتوقع تسليم الشحنة {{shipment_number}} في {{eta}}.',NULL),
+  ('SHIPMENT_DELIVERED','IN_APP','en','Shipment delivered','Delivery of your order shipment has been recorded.',NULL),
+  ('SHIPMENT_DELIVERED','IN_APP','ar','تسليم الشحنة','تم تسجيل تسليم شحنة طلبك.',NULL),
+  ('INSTALLATION_STARTED','IN_APP','en','Installation started','Installation of your order has started.',NULL),
+  ('INSTALLATION_STARTED','IN_APP','ar','بدء التركيب','بدأت عملية تركيب طلبك.',NULL),
+  ('ORDER_COMPLETED','IN_APP','en','Order completed','Your order has been completed successfully.',NULL),
+  ('ORDER_COMPLETED','IN_APP','ar','اكتمال الطلب','اكتمل طلبك بنجاح.',NULL)
+) AS t(event_type,channel,locale,title_template,body_template,html_template)
+JOIN notification_templates fa ON fa.event_type=t.event_type AND fa.channel=t.channel AND fa.locale='fa'
+ON CONFLICT(event_type,channel,locale) DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (23, 'notification_locales')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
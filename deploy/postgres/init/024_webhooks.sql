@@ -0,0 +1,53 @@
+-- Outbound webhooks for operations domain events. Subscriptions are managed
+-- by administrators; each matching event is copied into webhook_outbox per
+-- subscription and delivered by the operations worker with an HMAC signature.
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name TEXT NOT NULL,
+  target_url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  event_types TEXT[] NOT NULL,
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK(cardinality(event_types)>0),
+  CHECK(length(secret)>=16)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_events ON webhook_subscriptions USING gin (event_types) WHERE is_active;
+
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  event_id UUID NOT NULL,
+  event_type TEXT NOT NULL,
+  event_key TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING',
+  attempt_count INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  locked_at TIMESTAMPTZ,
+  last_status_code INT,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered_at TIMESTAMPTZ,
+  UNIQUE(subscription_id,event_key),
+  CHECK(status IN ('PENDING','PROCESSING','DELIVERED','RETRY','FAILED','CANCELLED'))
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_ready ON webhook_outbox(status,next_attempt_at) WHERE status IN ('PENDING','RETRY');
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_subscription ON webhook_outbox(subscription_id,created_at DESC);
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('webhooks.view','مشاهده Webhook','مشاهده اشتراک‌ها و گزارش ارسال Webhook','INTEGRATIONS'),
+  ('webhooks.manage','مدیریت Webhook','ایجاد، ویرایش و ارسال مجدد Webhook','INTEGRATIONS')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code IN ('SUPER_ADMIN','ADMIN') AND p.code IN ('webhooks.view','webhooks.manage')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (24, 'webhooks')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
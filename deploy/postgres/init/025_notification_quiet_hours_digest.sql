@@ -0,0 +1,38 @@
+-- Per-user quiet hours (Asia/Tehran wall clock) that hold SMS in the outbox,
+-- and a per-event daily digest mode that collapses in-app notifications.
+
+ALTER TABLE notification_preferences
+  ADD COLUMN IF NOT EXISTS delivery_mode TEXT NOT NULL DEFAULT 'IMMEDIATE';
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_delivery_mode_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_delivery_mode_check
+  CHECK(delivery_mode IN ('IMMEDIATE','DAILY_DIGEST'));
+
+CREATE TABLE IF NOT EXISTS notification_quiet_hours (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  is_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  starts_at TIME NOT NULL,
+  ends_at TIME NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK(starts_at<>ends_at)
+);
+
+CREATE TABLE IF NOT EXISTS notification_digest_items (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  event_type TEXT NOT NULL,
+  event_key TEXT NOT NULL UNIQUE,
+  title TEXT NOT NULL,
+  body TEXT NOT NULL,
+  entity_type TEXT,
+  entity_id UUID,
+  deep_link TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  digested_at TIMESTAMPTZ,
+  digest_notification_id BIGINT REFERENCES notifications(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_notification_digest_items_pending
+  ON notification_digest_items(user_id,event_type,created_at) WHERE digested_at IS NULL;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (25, 'notification_quiet_hours_digest')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
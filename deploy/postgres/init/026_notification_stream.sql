@@ -0,0 +1,26 @@
+-- Real-time notification stream. The API listens on the operations_events
+-- channel; notifications and read-state changes are announced by the
+-- application, action-item assignments by this trigger so that every code
+-- path that assigns work is covered.
+
+CREATE OR REPLACE FUNCTION notify_action_item_assignment() RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.status IN ('COMPLETED','CANCELLED') OR (NEW.assigned_user_id IS NULL AND NEW.assigned_role_id IS NULL) THEN
+    RETURN NEW;
+  END IF;
+  IF TG_OP='UPDATE' AND NEW.assigned_user_id IS NOT DISTINCT FROM OLD.assigned_user_id AND NEW.assigned_role_id IS NOT DISTINCT FROM OLD.assigned_role_id THEN
+    RETURN NEW;
+  END IF;
+  PERFORM pg_notify('operations_events', json_build_object(
+    'kind','action_item.assigned',
+    'user_id',NEW.assigned_user_id::text,
+    'role_id',NEW.assigned_role_id::text,
+    'id',NEW.id::text)::text);
+  RETURN NEW;
+END $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_notify_action_item_assignment ON action_items;
+CREATE TRIGGER trg_notify_action_item_assignment AFTER INSERT OR UPDATE OF assigned_user_id,assigned_role_id ON action_items FOR EACH ROW EXECUTE FUNCTION notify_action_item_assignment();
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (26, 'notification_stream')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
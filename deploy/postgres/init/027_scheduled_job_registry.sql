@@ -0,0 +1,37 @@
+-- Runtime state of the operations worker job registry. Schedules and
+-- timeouts are declared in code; this table only records pause state,
+-- run-now requests and the next due time computed from the schedule.
+
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+  job_code TEXT PRIMARY KEY,
+  is_paused BOOLEAN NOT NULL DEFAULT FALSE,
+  next_run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  run_requested_at TIMESTAMPTZ,
+  run_requested_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE scheduled_job_runs
+  ADD COLUMN IF NOT EXISTS trigger_type TEXT NOT NULL DEFAULT 'SCHEDULE';
+ALTER TABLE scheduled_job_runs DROP CONSTRAINT IF EXISTS scheduled_job_runs_trigger_type_check;
+ALTER TABLE scheduled_job_runs ADD CONSTRAINT scheduled_job_runs_trigger_type_check
+  CHECK(trigger_type IN ('SCHEDULE','MANUAL'));
+ALTER TABLE scheduled_job_runs DROP CONSTRAINT IF EXISTS scheduled_job_runs_status_check;
+ALTER TABLE scheduled_job_runs ADD CONSTRAINT scheduled_job_runs_status_check
+  CHECK(status IN ('RUNNING','COMPLETED','FAILED','SKIPPED','TIMED_OUT'));
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_runs_history ON scheduled_job_runs(job_code,started_at DESC);
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('scheduled_jobs.view','مشاهده کارهای زمان‌بندی‌شده','مشاهده وضعیت و تاریخچه اجرای کارهای پس‌زمینه','SYSTEM'),
+  ('scheduled_jobs.manage','مدیریت کارهای زمان‌بندی‌شده','توقف، ازسرگیری و اجرای فوری کارهای پس‌زمینه','SYSTEM')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code IN ('SUPER_ADMIN','ADMIN') AND p.code IN ('scheduled_jobs.view','scheduled_jobs.manage')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (27, 'scheduled_job_registry')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,38 @@
+-- Parallel branches and join steps. PARALLEL transitions leaving one step
+-- all fire when it completes; a join step opens once all of its incoming
+-- transitions (ALL) or join_quorum of them (QUORUM) have arrived.
+
+ALTER TABLE workflow_template_steps
+  ADD COLUMN IF NOT EXISTS join_mode TEXT NOT NULL DEFAULT 'NONE',
+  ADD COLUMN IF NOT EXISTS join_quorum INT;
+ALTER TABLE workflow_template_steps DROP CONSTRAINT IF EXISTS chk_workflow_step_join;
+ALTER TABLE workflow_template_steps ADD CONSTRAINT chk_workflow_step_join
+  CHECK((join_mode IN ('NONE','ALL') AND join_quorum IS NULL) OR (join_mode='QUORUM' AND join_quorum>=1));
+
+-- The resolved number of arrivals a join instance waits for; NULL for steps
+-- that are not joins.
+ALTER TABLE workflow_step_instances
+  ADD COLUMN IF NOT EXISTS join_required_count INT;
+
+ALTER TABLE workflow_step_transitions DROP CONSTRAINT IF EXISTS chk_transition_type;
+ALTER TABLE workflow_step_transitions ADD CONSTRAINT chk_transition_type
+  CHECK(transition_type IN ('AUTOMATIC','MANUAL_SELECTION','RESULT_BASED','PARALLEL'));
+
+-- A fork records one selection per branch it opens.
+ALTER TABLE workflow_transition_selections DROP CONSTRAINT IF EXISTS workflow_transition_selections_source_step_instance_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_workflow_transition_selection_branch ON workflow_transition_selections(source_step_instance_id,transition_snapshot_id);
+
+CREATE TABLE IF NOT EXISTS workflow_join_arrivals (
+  id BIGSERIAL PRIMARY KEY,
+  workflow_instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  join_step_instance_id UUID NOT NULL REFERENCES workflow_step_instances(id) ON DELETE CASCADE,
+  transition_snapshot_id UUID NOT NULL REFERENCES workflow_instance_step_transitions(id) ON DELETE RESTRICT,
+  source_step_instance_id UUID NOT NULL REFERENCES workflow_step_instances(id) ON DELETE RESTRICT,
+  arrived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE(join_step_instance_id,transition_snapshot_id)
+);
+CREATE INDEX IF NOT EXISTS idx_workflow_join_arrivals_source ON workflow_join_arrivals(source_step_instance_id);
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (28, 'workflow_parallel_branches')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
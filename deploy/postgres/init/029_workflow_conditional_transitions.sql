@@ -0,0 +1,23 @@
+-- Conditional transitions. A CONDITIONAL transition carries an expression
+-- over the source step's submitted field values; the first one that matches
+-- when the step is submitted is recorded on the step and followed once it
+-- completes.
+
+ALTER TABLE workflow_step_transitions
+  ADD COLUMN IF NOT EXISTS condition_expression TEXT;
+ALTER TABLE workflow_instance_step_transitions
+  ADD COLUMN IF NOT EXISTS condition_expression TEXT;
+
+ALTER TABLE workflow_step_transitions DROP CONSTRAINT IF EXISTS chk_transition_type;
+ALTER TABLE workflow_step_transitions ADD CONSTRAINT chk_transition_type
+  CHECK(transition_type IN ('AUTOMATIC','MANUAL_SELECTION','RESULT_BASED','PARALLEL','CONDITIONAL'));
+ALTER TABLE workflow_step_transitions DROP CONSTRAINT IF EXISTS chk_transition_condition;
+ALTER TABLE workflow_step_transitions ADD CONSTRAINT chk_transition_condition
+  CHECK((transition_type='CONDITIONAL')=(condition_expression IS NOT NULL));
+
+ALTER TABLE workflow_step_instances
+  ADD COLUMN IF NOT EXISTS condition_transition_id UUID REFERENCES workflow_instance_step_transitions(id) ON DELETE SET NULL;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (29, 'workflow_conditional_transitions')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
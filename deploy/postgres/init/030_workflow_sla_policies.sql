@@ -0,0 +1,41 @@
+-- Step SLA policies. A template step may carry an SLA measured in business
+-- hours, so Fridays do not count. Timers are started when a step instance
+-- opens and are driven by the workflow_sla job.
+
+CREATE TABLE IF NOT EXISTS workflow_step_sla_policies (
+  workflow_template_step_id BIGINT PRIMARY KEY REFERENCES workflow_template_steps(id) ON DELETE CASCADE,
+  sla_hours INTEGER NOT NULL CHECK(sla_hours BETWEEN 1 AND 8760),
+  warn_at_percent INTEGER CHECK(warn_at_percent BETWEEN 1 AND 99),
+  escalation_role_id BIGINT REFERENCES roles(id),
+  reassign_after_hours INTEGER CHECK(reassign_after_hours BETWEEN 1 AND 8760),
+  notify_customer BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT chk_sla_reassign_role CHECK(reassign_after_hours IS NULL OR escalation_role_id IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS workflow_step_sla_timers (
+  workflow_step_instance_id UUID PRIMARY KEY REFERENCES workflow_step_instances(id) ON DELETE CASCADE,
+  workflow_instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  started_at TIMESTAMPTZ NOT NULL,
+  warn_at TIMESTAMPTZ,
+  due_at TIMESTAMPTZ NOT NULL,
+  reassign_at TIMESTAMPTZ,
+  escalation_role_id BIGINT REFERENCES roles(id),
+  notify_customer BOOLEAN NOT NULL DEFAULT FALSE,
+  warned_at TIMESTAMPTZ,
+  escalated_at TIMESTAMPTZ,
+  reassigned_at TIMESTAMPTZ,
+  customer_notified_at TIMESTAMPTZ,
+  stopped_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_workflow_sla_timers_open ON workflow_step_sla_timers(due_at) WHERE stopped_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_workflow_sla_timers_instance ON workflow_step_sla_timers(workflow_instance_id);
+
+INSERT INTO notification_templates(event_type,channel,locale,audience_type,title_template,body_template,allowed_variables) VALUES
+('WORKFLOW_SLA_WARNING','IN_APP','fa','ASSIGNED_USER','مهلت مرحله رو به پایان است','مهلت مرحله {{step_name}} در {{due_at}} به پایان می‌رسد.','["step_name","due_at"]'::jsonb),
+('WORKFLOW_STEP_DELAYED','IN_APP','fa','CUSTOMER','تأخیر در سفارش {{order_number}}','انجام مرحله {{step_name}} سفارش شما بیش از زمان پیش‌بینی‌شده طول کشیده است. کارشناسان ما در حال پیگیری هستند.','["order_number","step_name"]'::jsonb)
+ON CONFLICT(event_type,channel,locale) DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (30, 'workflow_sla_policies')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
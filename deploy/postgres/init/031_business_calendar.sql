@@ -0,0 +1,69 @@
+-- Business calendar. Weekly working hours (shared, or per inventory location)
+-- and dated overrides: closed days for public holidays, or working days with
+-- their own hours. Deadlines, step estimates, task due dates and shipment
+-- ETAs are counted in working time.
+
+CREATE TABLE IF NOT EXISTS business_calendar_hours (
+  id BIGSERIAL PRIMARY KEY,
+  location_id UUID REFERENCES inventory_locations(id) ON DELETE CASCADE,
+  weekday SMALLINT NOT NULL CHECK(weekday BETWEEN 0 AND 6),
+  start_minute INTEGER NOT NULL CHECK(start_minute BETWEEN 0 AND 1440),
+  end_minute INTEGER NOT NULL CHECK(end_minute BETWEEN 0 AND 1440),
+  CONSTRAINT chk_business_hours_span CHECK(start_minute<end_minute)
+);
+CREATE INDEX IF NOT EXISTS idx_business_calendar_hours_location ON business_calendar_hours(location_id,weekday);
+
+CREATE TABLE IF NOT EXISTS business_calendar_days (
+  id BIGSERIAL PRIMARY KEY,
+  location_id UUID REFERENCES inventory_locations(id) ON DELETE CASCADE,
+  calendar_date DATE NOT NULL,
+  title_fa VARCHAR(200) NOT NULL,
+  is_working BOOLEAN NOT NULL DEFAULT FALSE,
+  start_minute INTEGER CHECK(start_minute BETWEEN 0 AND 1440),
+  end_minute INTEGER CHECK(end_minute BETWEEN 0 AND 1440),
+  recurs_annually BOOLEAN NOT NULL DEFAULT FALSE,
+  source TEXT NOT NULL DEFAULT 'MANUAL' CHECK(source IN ('MANUAL','ICS')),
+  ics_uid TEXT,
+  created_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT chk_business_day_hours CHECK(
+    (is_working AND start_minute IS NOT NULL AND end_minute IS NOT NULL AND start_minute<end_minute)
+    OR (NOT is_working AND start_minute IS NULL AND end_minute IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_business_calendar_days
+  ON business_calendar_days(COALESCE(location_id,'00000000-0000-0000-0000-000000000000'::uuid),calendar_date);
+CREATE INDEX IF NOT EXISTS idx_business_calendar_days_annual ON business_calendar_days(location_id) WHERE recurs_annually;
+
+-- Saturday to Wednesday 08:00-17:00, Thursday 08:00-13:00.
+INSERT INTO business_calendar_hours(location_id,weekday,start_minute,end_minute)
+SELECT NULL,d,480,CASE WHEN d=4 THEN 780 ELSE 1020 END FROM unnest(ARRAY[6,0,1,2,3,4]) d
+WHERE NOT EXISTS(SELECT 1 FROM business_calendar_hours WHERE location_id IS NULL);
+
+-- Fixed-date Solar Hijri public holidays; lunar holidays move every year and
+-- are entered or imported per year.
+INSERT INTO business_calendar_days(calendar_date,title_fa,recurs_annually) VALUES
+  ('2025-03-21','نوروز',TRUE),
+  ('2025-03-22','نوروز',TRUE),
+  ('2025-03-23','نوروز',TRUE),
+  ('2025-03-24','نوروز',TRUE),
+  ('2025-04-01','روز جمهوری اسلامی',TRUE),
+  ('2025-04-02','روز طبیعت',TRUE),
+  ('2025-06-04','رحلت امام خمینی',TRUE),
+  ('2025-06-05','قیام ۱۵ خرداد',TRUE),
+  ('2026-02-11','پیروزی انقلاب اسلامی',TRUE),
+  ('2026-03-20','ملی شدن صنعت نفت',TRUE)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('business_calendar.view','مشاهده تقویم کاری','مشاهده ساعات کاری و تعطیلات مورد استفاده در محاسبه مهلت‌ها','WORKFLOWS'),
+  ('business_calendar.manage','مدیریت تقویم کاری','تنظیم ساعات کاری، ثبت و حذف تعطیلات و ورود تقویم ICS','WORKFLOWS')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code IN ('SUPER_ADMIN','ADMIN') AND p.code IN ('business_calendar.view','business_calendar.manage')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (31, 'business_calendar')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,18 @@
+-- Publishing a template version whose diff against the published version of
+-- its group contains changes that affect running instances (removed steps or
+-- fields, new required fields, changed validations, roles or routes,
+-- tightened handoff tolerances) requires a sign-off reason from a holder of
+-- workflow_templates.sign_off_risk. The sign-off is kept in the audit log.
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('workflow_templates.sign_off_risk','تأیید تغییرات پرخطر گردش‌کار','تأیید انتشار نسخه‌ای که Workflowهای در جریان را تحت تأثیر قرار می‌دهد','WORKFLOWS')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code IN ('SUPER_ADMIN','ADMIN') AND p.code='workflow_templates.sign_off_risk'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (32, 'workflow_publish_sign_off')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
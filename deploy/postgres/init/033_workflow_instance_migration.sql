@@ -0,0 +1,16 @@
+-- Moving running workflow instances to a newer published version of their
+-- template. Step instances are matched by step_code; each migration is
+-- recorded in the audit log as workflow_instances.migrate.
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('workflow_instances.migrate','مهاجرت Workflowهای در جریان','انتقال Workflowهای در جریان به نسخه جدیدتر قالب','WORKFLOWS')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code IN ('SUPER_ADMIN','ADMIN') AND p.code='workflow_instances.migrate'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (33, 'workflow_instance_migration')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,12 @@
+-- COMPUTED workflow fields. The formula lives in validation_json.formula and
+-- the value is calculated by the server when the step is saved.
+
+DO $$
+BEGIN
+  ALTER TABLE workflow_step_field_definitions DROP CONSTRAINT IF EXISTS chk_workflow_field_definition_type;
+  ALTER TABLE workflow_step_field_definitions ADD CONSTRAINT chk_workflow_field_definition_type CHECK(field_type IN ('SHORT_TEXT','LONG_TEXT','INTEGER','DECIMAL','BOOLEAN','DATE','TIME','DATETIME','MONEY','SELECT','MULTI_SELECT','PHONE','ADDRESS','WEIGHT','AREA','VOLUME','QUANTITY','IMAGE','FILE','SIGNATURE','QC_CHECK','COMPUTED'));
+END $$;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (34, 'workflow_computed_fields')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,45 @@
+-- Step status history for workflow analytics. Every status change of a step
+-- instance closes the open history row and opens a new one; it is recorded
+-- by this trigger so that every code path that moves a step is covered.
+-- Steps that existed before this migration start with their current status.
+
+CREATE TABLE IF NOT EXISTS workflow_step_status_history (
+  id BIGSERIAL PRIMARY KEY,
+  workflow_step_instance_id UUID NOT NULL REFERENCES workflow_step_instances(id) ON DELETE CASCADE,
+  workflow_instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  from_status TEXT,
+  status TEXT NOT NULL,
+  assigned_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  responsible_role_id BIGINT REFERENCES roles(id) ON DELETE SET NULL,
+  rejection_reason TEXT,
+  entered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  left_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_workflow_step_status_history_step ON workflow_step_status_history(workflow_step_instance_id, entered_at);
+CREATE INDEX IF NOT EXISTS idx_workflow_step_status_history_entered ON workflow_step_status_history(entered_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_workflow_step_status_history_open ON workflow_step_status_history(workflow_step_instance_id) WHERE left_at IS NULL;
+
+CREATE OR REPLACE FUNCTION record_workflow_step_status() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP='UPDATE' THEN
+    IF NEW.status IS NOT DISTINCT FROM OLD.status THEN
+      RETURN NEW;
+    END IF;
+    UPDATE workflow_step_status_history SET left_at=NOW() WHERE workflow_step_instance_id=NEW.id AND left_at IS NULL;
+  END IF;
+  INSERT INTO workflow_step_status_history(workflow_step_instance_id,workflow_instance_id,from_status,status,assigned_user_id,responsible_role_id,rejection_reason)
+  VALUES(NEW.id,NEW.workflow_instance_id,CASE WHEN TG_OP='UPDATE' THEN OLD.status END,NEW.status,NEW.assigned_user_id,NEW.responsible_role_id,
+    CASE WHEN NEW.status='NEEDS_CORRECTION' AND (TG_OP='INSERT' OR NEW.rejected_at IS DISTINCT FROM OLD.rejected_at) THEN NEW.rejection_reason END);
+  RETURN NEW;
+END $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_record_workflow_step_status ON workflow_step_instances;
+CREATE TRIGGER trg_record_workflow_step_status AFTER INSERT OR UPDATE OF status ON workflow_step_instances FOR EACH ROW EXECUTE FUNCTION record_workflow_step_status();
+
+INSERT INTO workflow_step_status_history(workflow_step_instance_id,workflow_instance_id,status,assigned_user_id,responsible_role_id,entered_at)
+SELECT si.id,si.workflow_instance_id,si.status,si.assigned_user_id,si.responsible_role_id,si.updated_at
+FROM workflow_step_instances si
+WHERE NOT EXISTS(SELECT 1 FROM workflow_step_status_history h WHERE h.workflow_step_instance_id=si.id);
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (35, 'workflow_step_status_history')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,33 @@
+-- Automatic assignment of opened steps. MANUAL leaves a step waiting for its
+-- whole responsible role; ROUND_ROBIN picks the role member assigned least
+-- recently, LEAST_OPEN_ITEMS the one with fewest open action items, and
+-- STICKY the member who most recently handled a step of the same order.
+
+ALTER TABLE workflow_template_steps
+  ADD COLUMN IF NOT EXISTS assignment_strategy TEXT NOT NULL DEFAULT 'MANUAL';
+ALTER TABLE workflow_template_steps DROP CONSTRAINT IF EXISTS chk_workflow_step_assignment_strategy;
+ALTER TABLE workflow_template_steps ADD CONSTRAINT chk_workflow_step_assignment_strategy
+  CHECK(assignment_strategy IN ('MANUAL','ROUND_ROBIN','LEAST_OPEN_ITEMS','STICKY'));
+
+-- When the current assignee was set, for round-robin ordering. It is kept by
+-- this trigger so that manual, automatic and start-time assignments count.
+ALTER TABLE workflow_step_instances
+  ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMPTZ;
+UPDATE workflow_step_instances SET assigned_at=updated_at WHERE assigned_user_id IS NOT NULL AND assigned_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_workflow_step_instances_assignee ON workflow_step_instances(assigned_user_id, assigned_at) WHERE assigned_user_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION stamp_workflow_step_assignment() RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.assigned_user_id IS NULL THEN
+    NEW.assigned_at := NULL;
+  ELSIF TG_OP='INSERT' OR NEW.assigned_user_id IS DISTINCT FROM OLD.assigned_user_id THEN
+    NEW.assigned_at := NOW();
+  END IF;
+  RETURN NEW;
+END $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_stamp_workflow_step_assignment ON workflow_step_instances;
+CREATE TRIGGER trg_stamp_workflow_step_assignment BEFORE INSERT OR UPDATE OF assigned_user_id ON workflow_step_instances FOR EACH ROW EXECUTE FUNCTION stamp_workflow_step_assignment();
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (36, 'workflow_assignment_strategies')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,46 @@
+-- Multi-level and quorum approvals. A template step that requires approval
+-- may define ordered approval levels; each level needs required_approvals
+-- distinct members of its role and, with min_order_amount, applies only to
+-- orders whose final amount reaches it. Steps without levels, or whose
+-- levels all fall below the order amount, keep the single approval_role_id.
+
+CREATE TABLE IF NOT EXISTS workflow_step_approval_levels (
+  id BIGSERIAL PRIMARY KEY,
+  workflow_template_step_id BIGINT NOT NULL REFERENCES workflow_template_steps(id) ON DELETE CASCADE,
+  level_number INTEGER NOT NULL CHECK(level_number BETWEEN 1 AND 20),
+  approval_role_id BIGINT NOT NULL REFERENCES roles(id),
+  required_approvals INTEGER NOT NULL DEFAULT 1 CHECK(required_approvals BETWEEN 1 AND 20),
+  min_order_amount NUMERIC(18,4) CHECK(min_order_amount IS NULL OR min_order_amount>=0),
+  amount_currency CHAR(3) NOT NULL DEFAULT 'IRR' REFERENCES currencies(code),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE(workflow_template_step_id, level_number)
+);
+
+-- A rejection starts a new round, so the chain is walked again from the
+-- first level after the step is corrected and resubmitted.
+ALTER TABLE workflow_step_instances
+  ADD COLUMN IF NOT EXISTS approval_round INTEGER NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS current_approval_level INTEGER;
+
+CREATE TABLE IF NOT EXISTS workflow_step_approval_decisions (
+  id BIGSERIAL PRIMARY KEY,
+  workflow_step_instance_id UUID NOT NULL REFERENCES workflow_step_instances(id) ON DELETE CASCADE,
+  approval_round INTEGER NOT NULL,
+  level_number INTEGER NOT NULL,
+  approval_role_id BIGINT REFERENCES roles(id) ON DELETE SET NULL,
+  decision TEXT NOT NULL CHECK(decision IN ('APPROVED','REJECTED')),
+  decided_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  on_behalf_of_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  is_override BOOLEAN NOT NULL DEFAULT FALSE,
+  reason TEXT NOT NULL DEFAULT '',
+  decided_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_workflow_step_approval_decisions_step ON workflow_step_approval_decisions(workflow_step_instance_id, approval_round, level_number);
+-- One approval per approver and level in a round; a delegate approving for
+-- someone counts as that person.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_workflow_step_approval_decisions_approver ON workflow_step_approval_decisions(workflow_step_instance_id, approval_round, level_number, COALESCE(on_behalf_of_user_id, decided_by_user_id)) WHERE decision='APPROVED';
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (38, 'workflow_approval_levels')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,23 @@
+-- Customer-actionable steps. The customer of a workflow fills the
+-- customer-visible fields of such a step and submits it from the account
+-- area, through the same validation, routing and audit as internal
+-- submissions.
+
+ALTER TABLE workflow_template_steps
+  ADD COLUMN IF NOT EXISTS customer_actionable BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE workflow_template_steps DROP CONSTRAINT IF EXISTS chk_workflow_step_customer_actionable;
+ALTER TABLE workflow_template_steps ADD CONSTRAINT chk_workflow_step_customer_actionable
+  CHECK(NOT customer_actionable OR customer_visible);
+
+INSERT INTO permissions(code,name_fa,description_fa,group_code) VALUES
+  ('customer_portal.workflow.submit_own','ثبت مرحله سفارش خود','تکمیل و ارسال مراحل قابل اقدام مشتری در سفارش خود','CUSTOMER_PORTAL')
+ON CONFLICT(code) DO UPDATE SET name_fa=EXCLUDED.name_fa,description_fa=EXCLUDED.description_fa,group_code=EXCLUDED.group_code,is_active=TRUE;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r CROSS JOIN permissions p
+WHERE r.code='CUSTOMER' AND p.code='customer_portal.workflow.submit_own'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (39, 'customer_actionable_steps')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -0,0 +1,42 @@
+-- Round-robin history. workflow_step_instances.assigned_at only describes the
+-- current assignee and is cleared on reassignment, so the last time each
+-- member was given a step is kept here. It is keyed by template group and
+-- step code rather than template step ID, so it carries over to every new
+-- version of the template and survives reassignment and completed steps.
+
+CREATE TABLE IF NOT EXISTS workflow_step_assignment_rotation (
+  template_group_code TEXT NOT NULL,
+  step_code TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  last_assigned_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY(template_group_code, step_code, user_id)
+);
+
+INSERT INTO workflow_step_assignment_rotation(template_group_code,step_code,user_id,last_assigned_at)
+SELECT t.template_group_code,ts.step_code,si.assigned_user_id,MAX(COALESCE(si.assigned_at,si.updated_at))
+FROM workflow_step_instances si
+JOIN workflow_template_steps ts ON ts.id=si.workflow_template_step_id
+JOIN workflow_templates t ON t.id=ts.workflow_template_id
+WHERE si.assigned_user_id IS NOT NULL
+GROUP BY t.template_group_code,ts.step_code,si.assigned_user_id
+ON CONFLICT(template_group_code,step_code,user_id) DO UPDATE SET last_assigned_at=GREATEST(workflow_step_assignment_rotation.last_assigned_at,EXCLUDED.last_assigned_at);
+
+-- Manual, automatic and start-time assignments all count.
+CREATE OR REPLACE FUNCTION record_workflow_step_rotation() RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.assigned_user_id IS NOT NULL
+     AND (TG_OP='INSERT' OR NEW.assigned_user_id IS DISTINCT FROM OLD.assigned_user_id) THEN
+    INSERT INTO workflow_step_assignment_rotation(template_group_code,step_code,user_id,last_assigned_at)
+    SELECT t.template_group_code,ts.step_code,NEW.assigned_user_id,NOW()
+    FROM workflow_template_steps ts JOIN workflow_templates t ON t.id=ts.workflow_template_id
+    WHERE ts.id=NEW.workflow_template_step_id
+    ON CONFLICT(template_group_code,step_code,user_id) DO UPDATE SET last_assigned_at=EXCLUDED.last_assigned_at;
+  END IF;
+  RETURN NULL;
+END $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS trg_record_workflow_step_rotation ON workflow_step_instances;
+CREATE TRIGGER trg_record_workflow_step_rotation AFTER INSERT OR UPDATE OF assigned_user_id ON workflow_step_instances FOR EACH ROW EXECUTE FUNCTION record_workflow_step_rotation();
+
+INSERT INTO schema_migrations(version, migration_name)
+VALUES (40, 'workflow_assignment_rotation')
+ON CONFLICT(version) DO UPDATE SET migration_name = EXCLUDED.migration_name;
@@ -52,6 +52,10 @@ export default function DynamicFieldRenderer({ field, value, onChange, onUpload,
       {qc.fileId&&<a className="text-sm underline" href={`/api/v1/workflow-files/${qc.fileId}`} target="_blank" rel="noreferrer">مشاهده تصویر</a>}
     </div>;
   }
+  else if (field.field_type === "COMPUTED") {
+    const computed = field.value && typeof field.value === "object" ? field.value.value : field.value;
+    control = <div className="flex"><output className="w-full rounded-r-xl border bg-primary/5 p-3">{computed ?? "پس از ذخیره محاسبه می‌شود"}</output>{field.unit_code&&<span className="rounded-l-xl border border-r-0 bg-primary/5 px-4 py-3">{field.unit_code}</span>}</div>;
+  }
   else if (field.field_type === "SIGNATURE") control = <SignaturePad disabled={disabled} onUpload={onUpload}/>;
   else if (["FILE", "IMAGE"].includes(field.field_type)) control = <div><input disabled={disabled} type="file" accept={field.field_type==="IMAGE"?"image/png,image/jpeg":"image/png,image/jpeg,application/pdf"} onChange={event=>event.target.files?.[0]&&onUpload(event.target.files[0])}/>{value?.fileId&&<a className="mr-3 text-sm underline" href={`/api/v1/workflow-files/${value.fileId}`} target="_blank" rel="noreferrer">مشاهده فایل</a>}</div>;
   else control = <input {...common} type={field.field_type === "PHONE" ? "tel" : "text"} placeholder={field.placeholder_fa||""}/>;
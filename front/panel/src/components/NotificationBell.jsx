@@ -1,6 +1,6 @@
 import { useEffect, useState } from "react";
 import { Link } from "react-router-dom";
-import { fetchJSON } from "../lib/api";
+import { API_BASE, fetchJSON } from "../lib/api";
 import { useAuth } from "../lib/auth";
 
 export default function NotificationBell() {
@@ -17,8 +17,20 @@ export default function NotificationBell() {
       } catch { /* session guard handles auth errors */ }
     }
     refresh();
-    const timer = window.setInterval(refresh, 30000);
-    return () => { active = false; window.clearInterval(timer); };
+    // The stream pushes unread counts; polling stays as a slow fallback.
+    const timer = window.setInterval(refresh, 120000);
+    let stream;
+    if (typeof EventSource !== "undefined") {
+      stream = new EventSource(`${API_BASE}/api/v1/notifications/stream`, { withCredentials: true });
+      const apply = (event) => {
+        try {
+          const payload = JSON.parse(event.data);
+          if (active && typeof payload.unread_count === "number") setUnread(payload.unread_count);
+        } catch { /* ignore malformed events */ }
+      };
+      ["stream.resync", "notification.created", "notification.read"].forEach((kind) => stream.addEventListener(kind, apply));
+    }
+    return () => { active = false; window.clearInterval(timer); stream?.close(); };
   }, [canView]);
   if (!canView) return null;
   return <Link aria-label="اعلان‌ها" to="/dashboard/notifications" className="relative rounded-full border border-primary/20 px-3 py-2 text-lg">🔔{unread > 0 && <span className="absolute -left-2 -top-2 min-w-5 rounded-full bg-red-700 px-1 text-center text-[10px] text-white">{unread}</span>}</Link>;
@@ -36,6 +36,9 @@ const navItems = [
   { key: "audit", path: "/dashboard/audit", text: "گزارش تغییرات", permission: "audit.view" }
   ,{ key: "settings", path: "/dashboard/settings", text: "تنظیمات سیستم", permission: "settings.view" }
   ,{ key: "adminTools", path: "/dashboard/admin-tools", text: "ابزارهای اصلاح", permission: "admin_tools.view" }
+  ,{ key: "scheduledJobs", path: "/dashboard/scheduled-jobs", text: "کارهای زمان‌بندی‌شده", permissions: ["scheduled_jobs.view", "scheduled_jobs.manage"] }
+  ,{ key: "businessCalendar", path: "/dashboard/business-calendar", text: "تقویم کاری", permissions: ["business_calendar.view", "business_calendar.manage"] }
+  ,{ key: "delegations", path: "/dashboard/delegations", text: "جانشینی" }
 ];
 
 export default function PanelLayout() {
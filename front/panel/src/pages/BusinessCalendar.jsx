@@ -0,0 +1,29 @@
+import { useEffect, useState } from "react";
+import { fetchJSON } from "../lib/api";
+import { useAuth } from "../lib/auth";
+import { AsyncState } from "../components/OperationalUI";
+
+const weekdays = [[6, "شنبه"], [0, "یکشنبه"], [1, "دوشنبه"], [2, "سه‌شنبه"], [3, "چهارشنبه"], [4, "پنجشنبه"], [5, "جمعه"]];
+const emptyDay = { jalali_date: "", title_fa: "", is_working: false, start: "08:00", end: "13:00", recurs_annually: false };
+export default function BusinessCalendar() {
+  const { hasPermission } = useAuth();
+  const canManage = hasPermission("business_calendar.manage");
+  const [locations, setLocations] = useState([]), [location, setLocation] = useState(""), [year, setYear] = useState(""), [calendar, setCalendar] = useState({ hours: [], days: [] }), [hours, setHours] = useState([]), [day, setDay] = useState(emptyDay), [imported, setImported] = useState(null), [error, setError] = useState("");
+  const load = async () => { try { const response = await fetchJSON(`/api/v1/admin/business-calendar?location_id=${location}&year=${Number(year) || 0}`); setCalendar(response.data); setHours(response.data.hours || []); setError(""); } catch (e) { setError(e.message); } };
+  const call = async (path, options) => { try { const response = await fetchJSON(path, options); await load(); return response; } catch (e) { setError(e.message); } };
+  const locationID = location || null;
+  const saveHours = (next) => call("/api/v1/admin/business-calendar/hours", { method: "PUT", body: JSON.stringify({ location_id: locationID, hours: next }) });
+  const saveDay = async (e) => { e.preventDefault(); const body = { ...day, location_id: locationID, start: day.is_working ? day.start : null, end: day.is_working ? day.end : null }; if (await call("/api/v1/admin/business-calendar/days", { method: "POST", body: JSON.stringify(body) })) setDay(emptyDay); };
+  const importICS = async (file) => { if (!file) return; const response = await call("/api/v1/admin/business-calendar/import", { method: "POST", body: JSON.stringify({ location_id: locationID, ics: await file.text() }) }); if (response) setImported(response.data); };
+  useEffect(() => { fetchJSON("/api/v1/inventory/locations").then((r) => setLocations(r.data || [])).catch(() => setLocations([])); }, []);
+  useEffect(() => { load(); }, [location, year]);
+  const setSpan = (i, patch) => setHours(hours.map((h, j) => j === i ? { ...h, ...patch } : h));
+  return <div className="space-y-5" dir="rtl"><header className="panel-card"><h2 className="font-display text-2xl">تقویم کاری</h2><p className="mt-2 text-sm text-primary/60">مهلت مراحل، SLA، سررسید اقدامات و پرداخت‌ها و زمان رسیدن محموله‌ها بر اساس ساعات کاری این تقویم محاسبه می‌شوند.</p><div className="mt-4 flex flex-wrap gap-3"><select className="rounded-xl border p-2" value={location} onChange={(e) => setLocation(e.target.value)}><option value="">تقویم مشترک</option>{locations.map((l) => <option key={l.id} value={l.id}>{l.name_fa}</option>)}</select><input className="w-32 rounded-xl border p-2" placeholder="سال شمسی" value={year} onChange={(e) => setYear(e.target.value)} /></div></header>{error && <AsyncState error={error} />}
+    <section className="panel-card space-y-3"><div className="flex justify-between"><h3 className="font-semibold">ساعات کاری هفته</h3>{location && <span className="text-xs text-primary/60">{calendar.hours_overridden ? "ساعات اختصاصی این محل" : "از تقویم مشترک پیروی می‌کند"}</span>}</div>
+      {hours.map((h, i) => <div key={i} className="flex flex-wrap items-center gap-2"><select disabled={!canManage} className="rounded-xl border p-2" value={h.weekday} onChange={(e) => setSpan(i, { weekday: Number(e.target.value) })}>{weekdays.map(([value, label]) => <option key={value} value={value}>{label}</option>)}</select><input disabled={!canManage} dir="ltr" className="w-24 rounded-xl border p-2" value={h.start} onChange={(e) => setSpan(i, { start: e.target.value })} /><span>تا</span><input disabled={!canManage} dir="ltr" className="w-24 rounded-xl border p-2" value={h.end} onChange={(e) => setSpan(i, { end: e.target.value })} />{canManage && <button onClick={() => setHours(hours.filter((_, j) => j !== i))} className="text-red-700 underline">حذف</button>}</div>)}
+      {canManage && <div className="flex flex-wrap gap-3"><button onClick={() => setHours([...hours, { weekday: 6, start: "08:00", end: "17:00" }])} className="underline">افزودن بازه</button><button onClick={() => saveHours(hours)} className="rounded-full bg-primary px-5 py-2 text-sand">ذخیره ساعات</button>{location && calendar.hours_overridden && <button onClick={() => saveHours([])} className="underline">بازگشت به تقویم مشترک</button>}</div>}</section>
+    {canManage && <section className="panel-card space-y-3"><h3 className="font-semibold">ثبت تعطیلی یا روز کاری</h3><form onSubmit={saveDay} className="flex flex-wrap items-center gap-3"><input required dir="ltr" className="w-32 rounded-xl border p-2" placeholder="1405-01-01" value={day.jalali_date} onChange={(e) => setDay({ ...day, jalali_date: e.target.value })} /><input required className="flex-1 rounded-xl border p-2" placeholder="عنوان" value={day.title_fa} onChange={(e) => setDay({ ...day, title_fa: e.target.value })} /><label><input type="checkbox" checked={day.is_working} onChange={(e) => setDay({ ...day, is_working: e.target.checked })} /> روز کاری</label>{day.is_working && <><input dir="ltr" className="w-24 rounded-xl border p-2" value={day.start} onChange={(e) => setDay({ ...day, start: e.target.value })} /><input dir="ltr" className="w-24 rounded-xl border p-2" value={day.end} onChange={(e) => setDay({ ...day, end: e.target.value })} /></>}<label><input type="checkbox" checked={day.recurs_annually} onChange={(e) => setDay({ ...day, recurs_annually: e.target.checked })} /> هر سال</label><button className="rounded-full bg-primary px-5 py-2 text-sand">ثبت</button></form>
+      <label className="block text-sm">ورود از فایل iCalendar (ics): <input type="file" accept=".ics,text/calendar" onChange={(e) => importICS(e.target.files?.[0])} /></label>{imported && <p className="text-sm text-green-700">{imported.imported} روز وارد شد؛ {imported.skipped} مورد نادیده گرفته شد.</p>}</section>}
+    <section className="panel-card overflow-auto"><table className="w-full text-sm"><thead><tr className="text-right"><th>تاریخ</th><th>عنوان</th><th>وضعیت</th><th>دامنه</th><th></th></tr></thead><tbody>{calendar.days.map((d) => <tr key={d.id} className="border-t"><td className="py-2 font-mono" dir="ltr">{d.jalali_date}{d.recurs_annually && " ↻"}</td><td>{d.title_fa}</td><td>{d.is_working ? `کاری ${d.start}–${d.end}` : "تعطیل"}</td><td>{d.location_id ? "این محل" : "مشترک"}{d.source === "ICS" && " · ics"}</td><td>{canManage && (!location || d.location_id) && <button onClick={() => call(`/api/v1/admin/business-calendar/days/${d.id}`, { method: "DELETE" })} className="text-red-700 underline">حذف</button>}</td></tr>)}</tbody></table></section>
+  </div>;
+}
@@ -0,0 +1,23 @@
+import { useEffect, useState } from "react";
+import { fetchJSON } from "../lib/api";
+import { useAuth } from "../lib/auth";
+import { AsyncState, PersianDate } from "../components/OperationalUI";
+
+const emptyForm = { delegator_user_id: "", delegate_user_id: "", role_id: "", starts_at: "", ends_at: "", reason: "" };
+export default function Delegations() {
+  const { user, hasPermission } = useAuth();
+  const canManage = hasPermission("user_delegations.manage");
+  const [items, setItems] = useState([]), [users, setUsers] = useState([]), [roles, setRoles] = useState([]), [form, setForm] = useState(emptyForm), [activeOnly, setActiveOnly] = useState(true), [loading, setLoading] = useState(true), [error, setError] = useState("");
+  const load = () => { setLoading(true); fetchJSON(`/api/v1/delegations?active=${activeOnly}`).then((r) => { setItems(r.data || []); setError(""); }).catch((e) => setError(e.message)).finally(() => setLoading(false)); };
+  useEffect(() => { load(); }, [activeOnly]);
+  useEffect(() => { if (hasPermission("users.view")) fetchJSON("/api/v1/admin/users?status=ACTIVE").then((r) => setUsers((r.data || []).filter((u) => u.user_type === "INTERNAL"))).catch(() => setUsers([])); if (hasPermission("roles.view")) fetchJSON("/api/v1/admin/roles").then((r) => setRoles(r.data || [])).catch(() => setRoles([])); }, []);
+  const set = (key, value) => setForm((current) => ({ ...current, [key]: value }));
+  const userName = (u) => [u.first_name, u.last_name].filter(Boolean).join(" ") || u.phone;
+  const userField = (key, label) => users.length ? <select required={key === "delegate_user_id"} className="rounded-xl border p-2" aria-label={label} value={form[key]} onChange={(e) => set(key, e.target.value)}><option value="">{key === "delegator_user_id" ? "خودم" : label}</option>{users.filter((u) => u.id !== user?.id || key === "delegator_user_id").map((u) => <option key={u.id} value={u.id}>{userName(u)}</option>)}</select> : <input required={key === "delegate_user_id"} dir="ltr" className="rounded-xl border p-2" placeholder={`${label} (User ID)`} value={form[key]} onChange={(e) => set(key, e.target.value)} />;
+  const submit = async (e) => { e.preventDefault(); try { await fetchJSON("/api/v1/delegations", { method: "POST", body: JSON.stringify({ ...form, role_id: form.role_id ? Number(form.role_id) : null, starts_at: new Date(form.starts_at).toISOString(), ends_at: new Date(form.ends_at).toISOString() }) }); setForm(emptyForm); load(); } catch (err) { setError(err.message); } };
+  const revoke = async (id) => { if (!window.confirm("این جانشینی لغو شود؟")) return; try { await fetchJSON(`/api/v1/delegations/${id}/revoke`, { method: "POST" }); load(); } catch (err) { setError(err.message); } };
+  return <div className="space-y-5" dir="rtl"><header className="panel-card"><h2 className="font-display text-2xl">جانشینی در مرخصی</h2><p className="mt-2 text-sm text-primary/60">در بازه جانشینی، جانشین مراحل، اقدامات و تأییدهای شما را می‌بیند و انجام می‌دهد، اعلان‌های شما را دریافت می‌کند و همه کارهایش «به جای» شما ثبت می‌شود.</p></header>
+    <section className="panel-card space-y-3"><h3 className="font-semibold">ثبت جانشینی</h3><form onSubmit={submit} className="flex flex-wrap items-center gap-3">{canManage && userField("delegator_user_id", "واگذارکننده")}{userField("delegate_user_id", "جانشین")}{roles.length > 0 && <select className="rounded-xl border p-2" aria-label="نقش" value={form.role_id} onChange={(e) => set("role_id", e.target.value)}><option value="">همه نقش‌ها</option>{roles.map((r) => <option key={r.id} value={r.id}>{r.name_fa}</option>)}</select>}<label className="text-xs">از<input required type="datetime-local" className="mt-1 block rounded-xl border p-2" value={form.starts_at} onChange={(e) => set("starts_at", e.target.value)} /></label><label className="text-xs">تا<input required type="datetime-local" className="mt-1 block rounded-xl border p-2" value={form.ends_at} onChange={(e) => set("ends_at", e.target.value)} /></label><input className="rounded-xl border p-2" placeholder="دلیل" value={form.reason} onChange={(e) => set("reason", e.target.value)} /><button className="rounded-full bg-primary px-5 py-2 text-sand">ثبت</button></form></section>
+    <section className="panel-card overflow-auto"><label className="text-sm"><input type="checkbox" checked={activeOnly} onChange={(e) => setActiveOnly(e.target.checked)} /> فقط جانشینی‌های جاری و آینده</label><AsyncState loading={loading} error={error} empty={!items.length} emptyText="جانشینی ثبت نشده است." retry={load}><table className="mt-3 w-full text-right text-sm"><thead><tr><th>واگذارکننده</th><th>جانشین</th><th>نقش</th><th>از</th><th>تا</th><th>دلیل</th><th>وضعیت</th><th></th></tr></thead><tbody>{items.map((d) => <tr key={d.id} className="border-t"><td className="py-2">{d.delegator_name}</td><td>{d.delegate_name}</td><td>{d.role_name_fa || "همه نقش‌ها"}</td><td><PersianDate value={d.starts_at} /></td><td><PersianDate value={d.ends_at} /></td><td>{d.reason || "—"}</td><td>{d.revoked_at ? "لغوشده" : d.active ? "فعال" : "غیرفعال"}</td><td>{!d.revoked_at && new Date(d.ends_at) > new Date() && <button type="button" onClick={() => revoke(d.id)} className="rounded-full border px-3 py-1 text-xs">لغو</button>}</td></tr>)}</tbody></table></AsyncState></section>
+  </div>;
+}
@@ -0,0 +1,19 @@
+import { useEffect, useState } from "react";
+import { fetchJSON, idempotentHeaders } from "../lib/api";
+import { useAuth } from "../lib/auth";
+import { AsyncState, PersianDate } from "../components/OperationalUI";
+
+const statusClass = { COMPLETED: "text-green-700", FAILED: "text-red-700", TIMED_OUT: "text-red-700", RUNNING: "text-amber-700" };
+export default function ScheduledJobs() {
+  const { hasPermission } = useAuth();
+  const canManage = hasPermission("scheduled_jobs.manage");
+  const [jobs, setJobs] = useState([]), [history, setHistory] = useState({ code: "", items: [] }), [error, setError] = useState(""), [pending, setPending] = useState("");
+  const load = async () => { try { const response = await fetchJSON("/api/v1/admin/scheduled-jobs"); setJobs(response.data || []); setError(""); } catch (e) { setError(e.message); } };
+  const showHistory = async (code) => { try { const response = await fetchJSON(`/api/v1/admin/scheduled-jobs/${code}/runs?limit=50`); setHistory({ code, items: response.data || [] }); } catch (e) { setError(e.message); } };
+  const control = async (code, action) => { setPending(`${code}:${action}`); try { await fetchJSON(`/api/v1/admin/scheduled-jobs/${code}/${action}`, { method: "POST", headers: idempotentHeaders(), body: "{}" }); await load(); } catch (e) { setError(e.message); } finally { setPending(""); } };
+  useEffect(() => { load(); }, []);
+  return <div className="space-y-5" dir="rtl"><header className="panel-card"><h2 className="font-display text-2xl">کارهای زمان‌بندی‌شده</h2><p className="mt-2 text-sm text-primary/60">زمان‌بندی هر کار به وقت تهران است؛ اجرای فوری در چرخه بعدی Worker انجام می‌شود.</p></header>{error && <AsyncState error={error} />}
+    <section className="panel-card overflow-auto"><table className="w-full text-sm"><thead><tr className="text-right"><th>کار</th><th>زمان‌بندی</th><th>اجرای بعدی</th><th>آخرین اجرا</th><th>مدت</th><th></th></tr></thead><tbody>{jobs.map((job) => <tr key={job.code} className="border-t align-top"><td className="py-2"><button onClick={() => showHistory(job.code)} className="font-mono underline">{job.code}</button>{job.paused && <span className="mr-2 rounded-full bg-amber-100 px-2 text-xs">متوقف</span>}{job.run_requested && <span className="mr-2 rounded-full bg-blue-100 px-2 text-xs">در صف اجرا</span>}</td><td className="font-mono" dir="ltr">{job.schedule}</td><td>{job.next_run_at && !job.paused ? <PersianDate value={job.next_run_at} /> : "—"}</td><td className={statusClass[job.last_run?.status] || ""}>{job.last_run ? <>{job.last_run.status} · <PersianDate value={job.last_run.started_at} />{job.last_run.error && <p className="text-xs">{job.last_run.error}</p>}</> : "—"}</td><td>{job.last_run?.duration_ms != null ? `${(job.last_run.duration_ms / 1000).toFixed(1)}s` : "—"}</td><td className="whitespace-nowrap">{canManage && <><button disabled={!!pending} onClick={() => control(job.code, job.paused ? "resume" : "pause")} className="rounded-full border px-3 py-1">{job.paused ? "ازسرگیری" : "توقف"}</button><button disabled={!!pending || job.run_requested} onClick={() => control(job.code, "run")} className="mr-2 rounded-full border px-3 py-1">اجرای فوری</button></>}</td></tr>)}</tbody></table></section>
+    {history.code && <section className="panel-card overflow-auto"><h3 className="mb-3 font-semibold">تاریخچه <span className="font-mono">{history.code}</span></h3><table className="w-full text-sm"><thead><tr className="text-right"><th>شروع</th><th>نوع</th><th>وضعیت</th><th>مدت</th><th>تعداد</th><th>خطا</th></tr></thead><tbody>{history.items.map((run) => <tr key={run.id} className="border-t"><td><PersianDate value={run.started_at} /></td><td>{run.trigger_type === "MANUAL" ? "دستی" : "زمان‌بندی"}</td><td className={statusClass[run.status] || ""}>{run.status}</td><td>{run.duration_ms != null ? `${(run.duration_ms / 1000).toFixed(1)}s` : "—"}</td><td>{run.affected}</td><td className="text-xs">{run.error}</td></tr>)}</tbody></table></section>}
+  </div>;
+}
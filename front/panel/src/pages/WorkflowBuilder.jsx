@@ -2,16 +2,46 @@ import { useEffect, useMemo, useState } from "react";
 import { Link, useNavigate, useParams } from "react-router-dom";
 import { fetchJSON } from "../lib/api";
 
-const fieldTypes=["SHORT_TEXT","LONG_TEXT","INTEGER","DECIMAL","BOOLEAN","DATE","TIME","DATETIME","MONEY","SELECT","MULTI_SELECT","PHONE","ADDRESS","WEIGHT","AREA","VOLUME","QUANTITY","IMAGE","FILE","SIGNATURE","QC_CHECK"];
+const fieldTypes=["SHORT_TEXT","LONG_TEXT","INTEGER","DECIMAL","BOOLEAN","DATE","TIME","DATETIME","MONEY","SELECT","MULTI_SELECT","PHONE","ADDRESS","WEIGHT","AREA","VOLUME","QUANTITY","IMAGE","FILE","SIGNATURE","QC_CHECK","COMPUTED"];
 const triggers=["ON_STEP_OPEN","ON_STEP_START","ON_STEP_SUBMIT","ON_STEP_APPROVE","ON_STEP_COMPLETE"];
-const transitionTypes=["AUTOMATIC","MANUAL_SELECTION","RESULT_BASED"];
+const transitionTypes=["AUTOMATIC","MANUAL_SELECTION","RESULT_BASED","PARALLEL","CONDITIONAL"];
+const joinModes=[["NONE","بدون Join"],["ALL","Join: همه شاخه‌ها"],["QUORUM","Join: حداقل N شاخه"]];
+const assignmentStrategies=[["MANUAL","واگذاری دستی به نقش"],["ROUND_ROBIN","نوبتی بین اعضای نقش"],["LEAST_OPEN_ITEMS","کم‌کارترین عضو نقش"],["STICKY","مسئول مرحله قبلی همین سفارش"]];
 const transitionResults=["APPROVED","REJECTED","HAS_DISCREPANCY","CORRECTION_REQUIRED","CUSTOMER_CANCELLED","PAYMENT_PENDING"];
 
 function BranchEditor({template,readOnly,api}){
   const first=template.steps?.[0];
-  const [form,setForm]=useState({source_step_id:first?.id||"",target_step_id:"",transition_code:"",label_fa:"",transition_type:"AUTOMATIC",result_code:null,is_default:true,requires_permission_code:null,requires_reason:false,sort_order:1});
-  const submit=e=>{e.preventDefault();api(`/api/v1/admin/workflow-templates/${template.id}/transitions`,{method:"POST",body:JSON.stringify({...form,source_step_id:Number(form.source_step_id),target_step_id:Number(form.target_step_id),result_code:form.transition_type==="RESULT_BASED"?form.result_code:null})})};
-  return <section className="panel-card"><div className="flex flex-wrap items-center justify-between gap-3"><div><h3 className="font-semibold">Scope و Branching کنترل‌شده</h3><p className="text-sm text-primary/60">Scope: <b dir="ltr">{template.scope_type}</b> • سقف iteration: <b>{template.max_iterations}</b></p></div></div><div className="mt-4 space-y-2">{template.transitions?.map(x=><div key={x.id} className="flex flex-wrap items-center justify-between gap-2 rounded-xl border p-3 text-sm"><span><b>{x.transition_code}</b> — {template.steps.find(s=>s.id===x.source_step_id)?.step_code} ← {template.steps.find(s=>s.id===x.target_step_id)?.step_code}</span><span>{x.transition_type}{x.result_code?` / ${x.result_code}`:""}</span>{!readOnly&&<button className="text-red-700 underline" onClick={()=>api(`/api/v1/admin/workflow-templates/${template.id}/transitions/${x.id}`,{method:"DELETE"})}>حذف</button>}</div>)}</div>{!readOnly&&<form onSubmit={submit} className="mt-4 grid gap-2 border-t pt-4 md:grid-cols-3"><select required className="rounded-lg border p-2" value={form.source_step_id} onChange={e=>setForm({...form,source_step_id:e.target.value})}><option value="">مرحله مبدأ</option>{template.steps.map(x=><option value={x.id} key={x.id}>{x.step_code}</option>)}</select><select required className="rounded-lg border p-2" value={form.target_step_id} onChange={e=>setForm({...form,target_step_id:e.target.value})}><option value="">مرحله مقصد</option>{template.steps.map(x=><option value={x.id} key={x.id}>{x.step_code}</option>)}</select><input required dir="ltr" className="rounded-lg border p-2" placeholder="TRANSITION_CODE" value={form.transition_code} onChange={e=>setForm({...form,transition_code:e.target.value.toUpperCase()})}/><input required className="rounded-lg border p-2" placeholder="عنوان فارسی" value={form.label_fa} onChange={e=>setForm({...form,label_fa:e.target.value})}/><select className="rounded-lg border p-2" value={form.transition_type} onChange={e=>setForm({...form,transition_type:e.target.value,result_code:e.target.value==="RESULT_BASED"?"APPROVED":null})}>{transitionTypes.map(x=><option key={x}>{x}</option>)}</select>{form.transition_type==="RESULT_BASED"&&<select className="rounded-lg border p-2" value={form.result_code||""} onChange={e=>setForm({...form,result_code:e.target.value})}>{transitionResults.map(x=><option key={x}>{x}</option>)}</select>}<label><input type="checkbox" checked={form.is_default} onChange={e=>setForm({...form,is_default:e.target.checked})}/> مسیر پیش‌فرض</label><label><input type="checkbox" checked={form.requires_reason} onChange={e=>setForm({...form,requires_reason:e.target.checked})}/> دلیل الزامی</label><button className="rounded-full border py-2">افزودن Transition</button></form>}</section>;
+  const [form,setForm]=useState({source_step_id:first?.id||"",target_step_id:"",transition_code:"",label_fa:"",transition_type:"AUTOMATIC",result_code:null,condition_expression:null,is_default:true,requires_permission_code:null,requires_reason:false,sort_order:1});
+  const submit=e=>{e.preventDefault();api(`/api/v1/admin/workflow-templates/${template.id}/transitions`,{method:"POST",body:JSON.stringify({...form,source_step_id:Number(form.source_step_id),target_step_id:Number(form.target_step_id),result_code:form.transition_type==="RESULT_BASED"?form.result_code:null,condition_expression:form.transition_type==="CONDITIONAL"?form.condition_expression:null,is_default:form.transition_type==="CONDITIONAL"?false:form.is_default})})};
+  const [dryRun,setDryRun]=useState({values:"{}",result:null,error:""});
+  const runDryRun=async()=>{try{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${template.id}/transitions/dry-run`,{method:"POST",body:JSON.stringify({source_step_id:Number(form.source_step_id),expression:form.transition_type==="CONDITIONAL"&&form.condition_expression?form.condition_expression:null,values:JSON.parse(dryRun.values||"{}")})});setDryRun({...dryRun,result:response.data,error:""})}catch(e){setDryRun({...dryRun,result:null,error:e.message})}};
+  return <section className="panel-card"><div className="flex flex-wrap items-center justify-between gap-3"><div><h3 className="font-semibold">Scope و Branching کنترل‌شده</h3><p className="text-sm text-primary/60">Scope: <b dir="ltr">{template.scope_type}</b> • سقف iteration: <b>{template.max_iterations}</b></p></div></div><div className="mt-4 space-y-2">{template.transitions?.map(x=><div key={x.id} className="flex flex-wrap items-center justify-between gap-2 rounded-xl border p-3 text-sm"><span><b>{x.transition_code}</b> — {template.steps.find(s=>s.id===x.source_step_id)?.step_code} ← {template.steps.find(s=>s.id===x.target_step_id)?.step_code}</span><span>{x.transition_type}{x.result_code?` / ${x.result_code}`:""}{x.condition_expression&&<code dir="ltr" className="ms-2 text-xs">{x.condition_expression}</code>}</span>{!readOnly&&<button className="text-red-700 underline" onClick={()=>api(`/api/v1/admin/workflow-templates/${template.id}/transitions/${x.id}`,{method:"DELETE"})}>حذف</button>}</div>)}</div>{!readOnly&&<form onSubmit={submit} className="mt-4 grid gap-2 border-t pt-4 md:grid-cols-3"><select required className="rounded-lg border p-2" value={form.source_step_id} onChange={e=>setForm({...form,source_step_id:e.target.value})}><option value="">مرحله مبدأ</option>{template.steps.map(x=><option value={x.id} key={x.id}>{x.step_code}</option>)}</select><select required className="rounded-lg border p-2" value={form.target_step_id} onChange={e=>setForm({...form,target_step_id:e.target.value})}><option value="">مرحله مقصد</option>{template.steps.map(x=><option value={x.id} key={x.id}>{x.step_code}</option>)}</select><input required dir="ltr" className="rounded-lg border p-2" placeholder="TRANSITION_CODE" value={form.transition_code} onChange={e=>setForm({...form,transition_code:e.target.value.toUpperCase()})}/><input required className="rounded-lg border p-2" placeholder="عنوان فارسی" value={form.label_fa} onChange={e=>setForm({...form,label_fa:e.target.value})}/><select className="rounded-lg border p-2" value={form.transition_type} onChange={e=>setForm({...form,transition_type:e.target.value,result_code:e.target.value==="RESULT_BASED"?"APPROVED":null})}>{transitionTypes.map(x=><option key={x}>{x}</option>)}</select>{form.transition_type==="RESULT_BASED"&&<select className="rounded-lg border p-2" value={form.result_code||""} onChange={e=>setForm({...form,result_code:e.target.value})}>{transitionResults.map(x=><option key={x}>{x}</option>)}</select>}{form.transition_type==="CONDITIONAL"&&<input required dir="ltr" className="rounded-lg border p-2 font-mono md:col-span-2" placeholder='qc.result == "FAIL" or tonnage.value > 30' value={form.condition_expression||""} onChange={e=>setForm({...form,condition_expression:e.target.value})}/>}<label><input type="checkbox" checked={form.is_default} onChange={e=>setForm({...form,is_default:e.target.checked})}/> مسیر پیش‌فرض</label><label><input type="checkbox" checked={form.requires_reason} onChange={e=>setForm({...form,requires_reason:e.target.checked})}/> دلیل الزامی</label><button className="rounded-full border py-2">افزودن Transition</button><div className="grid gap-2 md:col-span-3 md:grid-cols-3"><textarea dir="ltr" className="rounded-lg border p-2 font-mono text-xs md:col-span-2" rows={2} placeholder='{"qc":{"result":"FAIL"}}' value={dryRun.values} onChange={e=>setDryRun({...dryRun,values:e.target.value})}/><button type="button" disabled={!form.source_step_id} className="rounded-full border py-2" onClick={runDryRun}>آزمایش شرط‌ها با مقادیر نمونه</button>{dryRun.error&&<p className="text-sm text-red-700 md:col-span-3">{dryRun.error}</p>}{dryRun.result&&<div className="space-y-1 text-sm md:col-span-3">{dryRun.result.results.map((r,i)=><p key={i} dir="ltr">{r.transition_code||"—"}: <code>{r.condition_expression}</code> → {r.error?<span className="text-red-700">{r.error}</span>:r.matched?"✓":"✗"}</p>)}<p>مسیر انتخابی: <b dir="ltr">{dryRun.result.selected_transition_code||"بدون تطابق"}</b></p></div>}</div></form>}</section>;
+}
+
+function SLAEditor({step,roles,readOnly,api,templateId}){
+  const initial=()=>({sla_hours:step.sla?.sla_hours||"",warn_at_percent:step.sla?.warn_at_percent||"",escalation_role_id:step.sla?.escalation_role_id||"",reassign_after_hours:step.sla?.reassign_after_hours||"",notify_customer:!!step.sla?.notify_customer});
+  const [form,setForm]=useState(initial);
+  useEffect(()=>setForm(initial()),[step.id,step.sla]);
+  const path=`/api/v1/admin/workflow-templates/${templateId}/steps/${step.id}/sla`;
+  const save=()=>api(path,{method:"PUT",body:JSON.stringify({sla_hours:Number(form.sla_hours),warn_at_percent:Number(form.warn_at_percent)||null,escalation_role_id:Number(form.escalation_role_id)||null,reassign_after_hours:Number(form.reassign_after_hours)||null,notify_customer:form.notify_customer})});
+  return <section className="panel-card"><div className="flex justify-between"><h3 className="text-xl font-semibold">SLA مرحله</h3>{!readOnly&&step.sla&&<button onClick={()=>api(path,{method:"DELETE"})} className="text-red-700 underline">حذف SLA</button>}</div><p className="mt-1 text-xs text-primary/60">بر حسب ساعات کاری تقویم کاری؛ تعطیلات در محاسبه مهلت شمرده نمی‌شوند.</p><div className="mt-4 grid gap-3 md:grid-cols-2"><input disabled={readOnly} type="number" min="1" className="rounded-xl border p-3" placeholder="مهلت (ساعت)" value={form.sla_hours} onChange={e=>setForm({...form,sla_hours:e.target.value})}/><input disabled={readOnly} type="number" min="1" max="99" className="rounded-xl border p-3" placeholder="هشدار در درصد" value={form.warn_at_percent} onChange={e=>setForm({...form,warn_at_percent:e.target.value})}/><select disabled={readOnly} className="rounded-xl border p-3" value={form.escalation_role_id} onChange={e=>setForm({...form,escalation_role_id:e.target.value})}><option value="">ارجاع به Role مسئول مرحله</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><input disabled={readOnly||!form.escalation_role_id} type="number" min="1" className="rounded-xl border p-3" placeholder="واگذاری پس از (ساعت)" value={form.reassign_after_hours} onChange={e=>setForm({...form,reassign_after_hours:e.target.value})}/><label><input disabled={readOnly} type="checkbox" checked={form.notify_customer} onChange={e=>setForm({...form,notify_customer:e.target.checked})}/> اطلاع به مشتری هنگام تأخیر</label>{!readOnly&&<button disabled={!form.sla_hours} onClick={save} className="rounded-full bg-primary px-5 py-2 text-sand disabled:opacity-50">ذخیره SLA</button>}</div></section>;
+}
+
+function ApprovalLevelsEditor({step,roles,readOnly,api,templateId}){
+  const initial=()=>(step.approval_levels||[]).map(l=>({approval_role_id:l.approval_role_id,required_approvals:l.required_approvals,min_order_amount:l.min_order_amount||"",amount_currency:l.amount_currency||"IRR"}));
+  const [levels,setLevels]=useState(initial);
+  useEffect(()=>setLevels(initial()),[step.id,step.approval_levels]);
+  const set=(i,patch)=>setLevels(levels.map((l,j)=>j===i?{...l,...patch}:l));
+  const save=()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${step.id}/approval-levels`,{method:"PUT",body:JSON.stringify(levels.map((l,i)=>({level_number:i+1,approval_role_id:Number(l.approval_role_id),required_approvals:Number(l.required_approvals)||1,min_order_amount:l.min_order_amount===""?null:String(l.min_order_amount),amount_currency:l.amount_currency})))});
+  return <section className="panel-card"><h3 className="text-xl font-semibold">زنجیره تأیید</h3><p className="mt-1 text-xs text-primary/60">سطوح به ترتیب تأیید می‌شوند و هر سطح به تعداد مشخصی تأیید از اعضای متفاوت Role نیاز دارد. سطحی که حداقل مبلغ دارد فقط برای سفارش‌هایی با مبلغ نهایی بیشتر یا برابر آن فعال می‌شود. بدون سطح، Role تأییدکننده مرحله کافی است.</p><div className="mt-4 space-y-2">{levels.map((l,i)=><div key={i} className="flex flex-wrap items-center gap-2"><span className="text-sm">سطح {i+1}</span><select disabled={readOnly} className="rounded-xl border p-2" value={l.approval_role_id||""} onChange={e=>set(i,{approval_role_id:e.target.value})}><option value="">Role تأییدکننده</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><input disabled={readOnly} type="number" min="1" max="20" className="w-24 rounded-xl border p-2" title="تعداد تأیید لازم" value={l.required_approvals} onChange={e=>set(i,{required_approvals:e.target.value})}/><input disabled={readOnly} dir="ltr" className="w-40 rounded-xl border p-2" placeholder="حداقل مبلغ سفارش" value={l.min_order_amount} onChange={e=>set(i,{min_order_amount:e.target.value})}/><input disabled={readOnly} dir="ltr" maxLength="3" className="w-20 rounded-xl border p-2" value={l.amount_currency} onChange={e=>set(i,{amount_currency:e.target.value.toUpperCase()})}/>{!readOnly&&<button onClick={()=>setLevels(levels.filter((_,j)=>j!==i))} className="text-red-700 underline">حذف</button>}</div>)}</div>{!readOnly&&<div className="mt-3 flex gap-2"><button disabled={levels.length>=20} onClick={()=>setLevels([...levels,{approval_role_id:step.approval_role_id||"",required_approvals:1,min_order_amount:"",amount_currency:"IRR"}])} className="rounded-full border px-4 py-2">افزودن سطح</button><button disabled={levels.some(l=>!l.approval_role_id)} onClick={save} className="rounded-full bg-primary px-5 py-2 text-sand disabled:opacity-50">ذخیره زنجیره تأیید</button></div>}</section>;
+}
+
+const changeActionFA={ADDED:"افزوده",REMOVED:"حذف",MODIFIED:"تغییر"};
+
+function VersionDiff({template,api}){
+  const [diff,setDiff]=useState(null),[reason,setReason]=useState(""),[error,setError]=useState("");
+  const load=async()=>{setError("");try{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${template.id}/diff`);setDiff(response.data)}catch(e){setError(e.message)}};
+  return <section className="panel-card"><div className="flex flex-wrap items-center justify-between gap-3"><div><h3 className="font-semibold">مقایسه با نسخه منتشرشده</h3><p className="text-sm text-primary/60">تغییرات پرخطر روی Workflowهای در جریان اثر دارند و انتشار آن‌ها به تأیید و ثبت دلیل نیاز دارد.</p></div><button onClick={load} className="rounded-full border px-4 py-2 text-sm">نمایش تغییرات</button></div>{error&&<p className="mt-3 rounded-xl bg-amber-50 p-3 text-amber-900">{error}</p>}{diff&&<div className="mt-3 space-y-2"><p className="text-sm">{diff.changes.length} تغییر نسبت به نسخه {diff.from_template_id}{diff.running_on_source>0&&` • ${diff.running_on_source} Workflow در جریان`}</p><div className="max-h-80 overflow-y-auto">{diff.changes.map((change,index)=><div key={index} className={`mt-1 rounded-xl border p-2 text-sm ${change.affects_running?"border-red-300 bg-red-50":""}`}><b>{changeActionFA[change.action]}</b> <span dir="ltr" className="font-mono">{change.kind} {change.key}</span>{change.reason&&<small className="mr-2 text-red-700">{change.reason}</small>}{change.attributes?.map(attr=><p key={attr.attribute} dir="ltr" className="font-mono text-xs text-primary/60">{attr.attribute}: {JSON.stringify(attr.before)} → {JSON.stringify(attr.after)}</p>)}</div>)}</div>{diff.risky&&<div className="flex flex-wrap gap-2"><input className="flex-1 rounded-xl border p-2" placeholder="دلیل تأیید تغییرات پرخطر" value={reason} onChange={e=>setReason(e.target.value)}/><button disabled={!reason.trim()} onClick={()=>api(`/api/v1/admin/workflow-templates/${template.id}/publish`,{method:"POST",body:JSON.stringify({sign_off_reason:reason})})} className="rounded-full bg-red-700 px-4 py-2 text-white disabled:opacity-50">تأیید و انتشار</button></div>}</div>}</section>;
 }
 
 export default function WorkflowBuilder(){
@@ -37,11 +67,11 @@ export default function WorkflowBuilder(){
   const addWorkflowTask=event=>{event.preventDefault();api(`/api/v1/admin/workflow-templates/${templateId}/tasks`,{method:"POST",body:JSON.stringify({...newWorkflowTask,assigned_role_id:Number(newWorkflowTask.assigned_role_id)||null})})};
   const addMetric=event=>{event.preventDefault();api(`/api/v1/admin/workflow-templates/${templateId}/handoff-metrics`,{method:"POST",body:JSON.stringify(newMetric)})};
   if(!template)return <div className="panel-card" dir="rtl">{error||"در حال بارگذاری…"}</div>;
-  return <div className="space-y-5" dir="rtl"><section className="panel-card flex flex-wrap justify-between gap-3"><div><Link to="/dashboard/workflows" className="text-sm underline">بازگشت به نسخه‌ها</Link><h2 className="mt-2 font-display text-2xl">{template.name_fa} — نسخه {template.version_number}</h2><p dir="ltr" className="text-xs text-primary/55">{template.template_group_code} / {template.status} / {template.scope_type}</p></div><div className="flex items-center gap-2">{template.status==="PUBLISHED"&&<button onClick={async()=>{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${template.id}/clone`,{method:"POST"});navigate(`/dashboard/workflows/${response.data.id}/builder`)}} className="rounded-full bg-primary px-5 py-2 text-sand">ساخت نسخه جدید</button>}{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${template.id}/publish`,{method:"POST"})} className="rounded-full bg-green-700 px-5 py-2 text-white">اعتبارسنجی و انتشار</button>}</div></section>{readOnly&&<p className="rounded-xl bg-amber-50 p-4 text-amber-900">نسخه منتشرشده immutable و فقط خواندنی است.</p>}{error&&<p className="rounded-xl bg-red-50 p-4 text-red-700">{error}</p>}<BranchEditor template={template} readOnly={readOnly} api={api}/>
+  return <div className="space-y-5" dir="rtl"><section className="panel-card flex flex-wrap justify-between gap-3"><div><Link to="/dashboard/workflows" className="text-sm underline">بازگشت به نسخه‌ها</Link><h2 className="mt-2 font-display text-2xl">{template.name_fa} — نسخه {template.version_number}</h2><p dir="ltr" className="text-xs text-primary/55">{template.template_group_code} / {template.status} / {template.scope_type}</p></div><div className="flex items-center gap-2">{template.status==="PUBLISHED"&&<button onClick={async()=>{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${template.id}/clone`,{method:"POST"});navigate(`/dashboard/workflows/${response.data.id}/builder`)}} className="rounded-full bg-primary px-5 py-2 text-sand">ساخت نسخه جدید</button>}{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${template.id}/publish`,{method:"POST"})} className="rounded-full bg-green-700 px-5 py-2 text-white">اعتبارسنجی و انتشار</button>}</div></section>{readOnly&&<p className="rounded-xl bg-amber-50 p-4 text-amber-900">نسخه منتشرشده immutable و فقط خواندنی است.</p>}{error&&<p className="rounded-xl bg-red-50 p-4 text-red-700">{error}</p>}{!readOnly&&<VersionDiff template={template} api={api}/>}<BranchEditor template={template} readOnly={readOnly} api={api}/>
   <section className="panel-card"><h3 className="font-semibold">چک‌لیست اسناد Snapshot</h3><p className="mt-1 text-sm text-primary/60">فقط Workflowهای جدید این نسخه، الزام‌های زیر را دریافت می‌کنند.</p><div className="mt-3 space-y-2">{requirements.map(r=><div key={r.id} className="flex flex-wrap items-center justify-between rounded-xl border p-3 text-sm"><span>{r.title_fa} • {r.document_type}{r.workflow_template_step_id?` • مرحله ${template.steps.find(s=>s.id===r.workflow_template_step_id)?.step_code||""}`:" • کل Workflow"}</span><span>{r.is_blocking?"مسدودکننده":"غیرمسدودکننده"}</span>{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/document-requirements/${r.id}`,{method:"DELETE"})} className="text-red-700 underline">حذف</button>}</div>)}</div>{!readOnly&&<form onSubmit={e=>{e.preventDefault();api(`/api/v1/admin/workflow-templates/${templateId}/document-requirements`,{method:"POST",body:JSON.stringify({...newRequirement,workflow_template_step_id:newRequirement.workflow_template_step_id?Number(newRequirement.workflow_template_step_id):null})})}} className="mt-4 grid gap-2 border-t pt-4 md:grid-cols-3"><select className="rounded-lg border p-2" value={newRequirement.document_type} onChange={e=>setNewRequirement({...newRequirement,document_type:e.target.value})}>{["PROFORMA","PAYMENT_RECEIPT","ORDER_SUMMARY","PACKING_LIST","DELIVERY_NOTE","COMMERCIAL_INVOICE","CERTIFICATE_OF_ORIGIN","CUSTOMS_DECLARATION","BILL_OF_LADING","OTHER"].map(x=><option key={x}>{x}</option>)}</select><select className="rounded-lg border p-2" value={newRequirement.workflow_template_step_id||""} onChange={e=>setNewRequirement({...newRequirement,workflow_template_step_id:e.target.value||null})}><option value="">کل Workflow</option>{template.steps.map(s=><option key={s.id} value={s.id}>{s.step_code}</option>)}</select><input required className="rounded-lg border p-2" placeholder="عنوان فارسی" value={newRequirement.title_fa} onChange={e=>setNewRequirement({...newRequirement,title_fa:e.target.value})}/><label><input type="checkbox" checked={newRequirement.is_required} onChange={e=>setNewRequirement({...newRequirement,is_required:e.target.checked})}/> الزامی</label><label><input type="checkbox" checked={newRequirement.is_blocking} onChange={e=>setNewRequirement({...newRequirement,is_blocking:e.target.checked})}/> مسدودکننده</label><label><input type="checkbox" checked={newRequirement.customer_visible} onChange={e=>setNewRequirement({...newRequirement,customer_visible:e.target.checked})}/> قابل نمایش مشتری</label><button className="rounded-full border py-2 md:col-span-3">افزودن الزام سند</button></form>}</section>
   <div className="grid gap-5 xl:grid-cols-[300px,1fr]"><aside className="panel-card h-fit"><div className="flex items-center justify-between"><h3 className="font-semibold">مراحل</h3>{selected&&!readOnly&&<div><button className="px-2" onClick={()=>move(-1)}>↑</button><button className="px-2" onClick={()=>move(1)}>↓</button></div>}</div><ol className="mt-3 space-y-2">{template.steps.map(step=><li key={step.id}><button onClick={()=>setSelectedID(step.id)} className={`w-full rounded-xl border p-3 text-right ${selectedID===step.id?"bg-primary text-sand":""}`}><small>{step.sequence_number}. {step.step_code}</small><b className="block">{step.internal_title_fa}</b>{step.is_optional&&<span className="text-xs">اختیاری</span>}</button></li>)}</ol>{!readOnly&&<form onSubmit={addStep} className="mt-5 space-y-2 border-t pt-4"><b className="text-sm">افزودن مرحله</b><input required dir="ltr" className="w-full rounded-lg border p-2" placeholder="STEP_CODE" value={newStep.step_code} onChange={e=>setNewStep({...newStep,step_code:e.target.value})}/><input required className="w-full rounded-lg border p-2" placeholder="عنوان داخلی" value={newStep.internal_title_fa} onChange={e=>setNewStep({...newStep,internal_title_fa:e.target.value,customer_title_fa:e.target.value})}/><select required className="w-full rounded-lg border p-2" value={newStep.responsible_role_id||""} onChange={e=>setNewStep({...newStep,responsible_role_id:e.target.value})}><option value="">Role مسئول</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><select className="w-full rounded-lg border p-2" value={newStep.required_permission_code} onChange={e=>setNewStep({...newStep,required_permission_code:e.target.value})}>{permissions.map(permission=><option key={permission.code}>{permission.code}</option>)}</select><button className="w-full rounded-full border py-2">افزودن</button></form>}</aside>
-  <main className="space-y-5">{selected&&<><section className="panel-card"><div className="flex justify-between"><h3 className="text-xl font-semibold">تنظیمات مرحله</h3>{!readOnly&&<div className="flex gap-2"><button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}/duplicate`,{method:"POST"})} className="underline">Duplicate</button><button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}`,{method:"DELETE"})} className="text-red-700 underline">حذف</button></div>}</div><div className="mt-4 grid gap-3 md:grid-cols-2"><input disabled={readOnly} className="rounded-xl border p-3" value={selected.internal_title_fa} onChange={e=>updateStep({internal_title_fa:e.target.value})}/><input disabled={readOnly} className="rounded-xl border p-3" value={selected.customer_title_fa} onChange={e=>updateStep({customer_title_fa:e.target.value})}/><select disabled={readOnly} className="rounded-xl border p-3" value={selected.responsible_role_id||""} onChange={e=>updateStep({responsible_role_id:Number(e.target.value)||null})}>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><input disabled={readOnly} type="number" min="1" className="rounded-xl border p-3" value={selected.default_duration_hours} onChange={e=>updateStep({default_duration_hours:Number(e.target.value)})}/><label><input disabled={readOnly} type="checkbox" checked={selected.customer_visible} onChange={e=>updateStep({customer_visible:e.target.checked})}/> نمایش به مشتری</label><label><input disabled={readOnly} type="checkbox" checked={selected.is_optional} onChange={e=>updateStep({is_optional:e.target.checked,is_skippable:e.target.checked||selected.is_skippable})}/> اختیاری</label><label><input disabled={readOnly} type="checkbox" checked={selected.is_entry} onChange={e=>updateStep({is_entry:e.target.checked})}/> نقطه ورود مسیر</label><select disabled={readOnly} className="rounded-xl border p-3" value={selected.domain_event_code||""} onChange={e=>updateStep({domain_event_code:e.target.value||null})}><option value="">بدون عملیات دامنه</option><option>BATCH_STOCK_RESERVED</option><option>PRODUCTION_CONVERSION_RECORDED</option><option>SHIPMENT_LOADED</option><option>SHIPMENT_DISPATCHED</option><option>SHIPMENT_ARRIVED</option><option>SHIPMENT_DELIVERED</option></select><label><input disabled={readOnly} type="checkbox" checked={selected.requires_approval} onChange={e=>updateStep({requires_approval:e.target.checked})}/> نیازمند تأیید</label>{selected.requires_approval&&<select disabled={readOnly} className="rounded-xl border p-3" value={selected.approval_role_id||""} onChange={e=>updateStep({approval_role_id:Number(e.target.value)||null})}><option value="">Role تأییدکننده</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select>}</div></section>
-  <section className="panel-card"><div className="flex flex-wrap justify-between gap-2"><h3 className="font-semibold">Fieldها</h3><select value={preview} onChange={e=>setPreview(e.target.value)} className="rounded-full border px-3 py-1 text-sm"><option>INTERNAL</option><option>SALES</option><option>CUSTOMER</option></select></div><div className="mt-4 grid gap-3 md:grid-cols-2">{selected.fields.filter(field=>preview==="INTERNAL"||(preview==="SALES"&&field.is_sales_visible)||(preview==="CUSTOMER"&&field.is_customer_visible)).map(field=><div key={field.id} className="rounded-xl border p-3"><b>{field.label_fa}</b><small className="block">{field.field_key} • {field.field_type}</small>{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}/fields/${field.id}`,{method:"DELETE"})} className="mt-2 text-xs text-red-700 underline">حذف</button>}</div>)}</div>{!readOnly&&<form onSubmit={addField} className="mt-5 grid gap-2 border-t pt-4 md:grid-cols-3"><input required dir="ltr" className="rounded-lg border p-2" placeholder="field_key" value={newField.field_key} onChange={e=>setNewField({...newField,field_key:e.target.value})}/><input required className="rounded-lg border p-2" placeholder="عنوان" value={newField.label_fa} onChange={e=>setNewField({...newField,label_fa:e.target.value})}/><select className="rounded-lg border p-2" value={newField.field_type} onChange={e=>setNewField({...newField,field_type:e.target.value})}>{fieldTypes.map(type=><option key={type}>{type}</option>)}</select>{["WEIGHT","AREA","VOLUME","QUANTITY"].includes(newField.field_type)&&<input required dir="ltr" className="rounded-lg border p-2" placeholder="unit (TON, KG, M2...)" value={newField.unit_code||""} onChange={e=>setNewField({...newField,unit_code:e.target.value})}/>} {newField.field_type==="MONEY"&&<input required dir="ltr" maxLength="3" className="rounded-lg border p-2" placeholder="currency (IRR)" value={newField.currency_code||""} onChange={e=>setNewField({...newField,currency_code:e.target.value.toUpperCase()})}/>} {["SELECT","MULTI_SELECT"].includes(newField.field_type)&&<input required className="rounded-lg border p-2" placeholder="گزینه‌ها با ویرگول" value={(newField.options_json||[]).join?.(",")||""} onChange={e=>setNewField({...newField,options_json:e.target.value.split(",").map(item=>item.trim()).filter(Boolean)})}/>}<label><input type="checkbox" checked={newField.is_required} onChange={e=>setNewField({...newField,is_required:e.target.checked})}/> اجباری</label><label><input type="checkbox" checked={newField.is_customer_visible} onChange={e=>setNewField({...newField,is_customer_visible:e.target.checked})}/> مشتری</label><label><input type="checkbox" checked={newField.is_internal_cost} onChange={e=>setNewField({...newField,is_internal_cost:e.target.checked})}/> هزینه داخلی</label><button className="rounded-full border py-2 md:col-span-3">افزودن Field</button></form>}</section>
+  <main className="space-y-5">{selected&&<><section className="panel-card"><div className="flex justify-between"><h3 className="text-xl font-semibold">تنظیمات مرحله</h3>{!readOnly&&<div className="flex gap-2"><button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}/duplicate`,{method:"POST"})} className="underline">Duplicate</button><button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}`,{method:"DELETE"})} className="text-red-700 underline">حذف</button></div>}</div><div className="mt-4 grid gap-3 md:grid-cols-2"><input disabled={readOnly} className="rounded-xl border p-3" value={selected.internal_title_fa} onChange={e=>updateStep({internal_title_fa:e.target.value})}/><input disabled={readOnly} className="rounded-xl border p-3" value={selected.customer_title_fa} onChange={e=>updateStep({customer_title_fa:e.target.value})}/><select disabled={readOnly} className="rounded-xl border p-3" value={selected.responsible_role_id||""} onChange={e=>updateStep({responsible_role_id:Number(e.target.value)||null})}>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><input disabled={readOnly} type="number" min="1" className="rounded-xl border p-3" value={selected.default_duration_hours} onChange={e=>updateStep({default_duration_hours:Number(e.target.value)})}/><label><input disabled={readOnly} type="checkbox" checked={selected.customer_visible} onChange={e=>updateStep({customer_visible:e.target.checked,customer_actionable:e.target.checked&&selected.customer_actionable})}/> نمایش به مشتری</label><label title="مشتری Fieldهای قابل نمایش این مرحله را از حساب کاربری خود تکمیل و ارسال می‌کند."><input disabled={readOnly||!selected.customer_visible} type="checkbox" checked={!!selected.customer_actionable} onChange={e=>updateStep({customer_actionable:e.target.checked})}/> قابل اقدام توسط مشتری</label><label><input disabled={readOnly} type="checkbox" checked={selected.is_optional} onChange={e=>updateStep({is_optional:e.target.checked,is_skippable:e.target.checked||selected.is_skippable})}/> اختیاری</label><label><input disabled={readOnly} type="checkbox" checked={selected.is_entry} onChange={e=>updateStep({is_entry:e.target.checked})}/> نقطه ورود مسیر</label><select disabled={readOnly} className="rounded-xl border p-3" value={selected.join_mode||"NONE"} onChange={e=>updateStep({join_mode:e.target.value,join_quorum:e.target.value==="QUORUM"?(selected.join_quorum||1):null})}>{joinModes.map(([value,label])=><option key={value} value={value}>{label}</option>)}</select>{selected.join_mode==="QUORUM"&&<input disabled={readOnly} type="number" min="1" className="rounded-xl border p-3" placeholder="تعداد شاخه لازم" value={selected.join_quorum||1} onChange={e=>updateStep({join_quorum:Number(e.target.value)||1})}/>}<select disabled={readOnly} className="rounded-xl border p-3" value={selected.assignment_strategy||"MANUAL"} onChange={e=>updateStep({assignment_strategy:e.target.value})}>{assignmentStrategies.map(([value,label])=><option key={value} value={value}>{label}</option>)}</select><select disabled={readOnly} className="rounded-xl border p-3" value={selected.domain_event_code||""} onChange={e=>updateStep({domain_event_code:e.target.value||null})}><option value="">بدون عملیات دامنه</option><option>BATCH_STOCK_RESERVED</option><option>PRODUCTION_CONVERSION_RECORDED</option><option>SHIPMENT_LOADED</option><option>SHIPMENT_DISPATCHED</option><option>SHIPMENT_ARRIVED</option><option>SHIPMENT_DELIVERED</option></select><label><input disabled={readOnly} type="checkbox" checked={selected.requires_approval} onChange={e=>updateStep({requires_approval:e.target.checked})}/> نیازمند تأیید</label>{selected.requires_approval&&<select disabled={readOnly} className="rounded-xl border p-3" value={selected.approval_role_id||""} onChange={e=>updateStep({approval_role_id:Number(e.target.value)||null})}><option value="">Role تأییدکننده</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select>}</div></section><SLAEditor step={selected} roles={roles} readOnly={readOnly} api={api} templateId={templateId}/>{selected.requires_approval&&<ApprovalLevelsEditor step={selected} roles={roles} readOnly={readOnly} api={api} templateId={templateId}/>}
+  <section className="panel-card"><div className="flex flex-wrap justify-between gap-2"><h3 className="font-semibold">Fieldها</h3><select value={preview} onChange={e=>setPreview(e.target.value)} className="rounded-full border px-3 py-1 text-sm"><option>INTERNAL</option><option>SALES</option><option>CUSTOMER</option></select></div><div className="mt-4 grid gap-3 md:grid-cols-2">{selected.fields.filter(field=>preview==="INTERNAL"||(preview==="SALES"&&field.is_sales_visible)||(preview==="CUSTOMER"&&field.is_customer_visible)).map(field=><div key={field.id} className="rounded-xl border p-3"><b>{field.label_fa}</b><small className="block">{field.field_key} • {field.field_type}</small>{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}/fields/${field.id}`,{method:"DELETE"})} className="mt-2 text-xs text-red-700 underline">حذف</button>}</div>)}</div>{!readOnly&&<form onSubmit={addField} className="mt-5 grid gap-2 border-t pt-4 md:grid-cols-3"><input required dir="ltr" className="rounded-lg border p-2" placeholder="field_key" value={newField.field_key} onChange={e=>setNewField({...newField,field_key:e.target.value})}/><input required className="rounded-lg border p-2" placeholder="عنوان" value={newField.label_fa} onChange={e=>setNewField({...newField,label_fa:e.target.value})}/><select className="rounded-lg border p-2" value={newField.field_type} onChange={e=>setNewField({...newField,field_type:e.target.value})}>{fieldTypes.map(type=><option key={type}>{type}</option>)}</select>{newField.field_type==="COMPUTED"&&<><input required dir="ltr" className="rounded-lg border p-2 font-mono md:col-span-2" placeholder="formula: gross - tare, SURVEY.length * width" value={newField.validation_json?.formula||""} onChange={e=>setNewField({...newField,validation_json:{...newField.validation_json,formula:e.target.value}})}/><input dir="ltr" className="rounded-lg border p-2" placeholder="unit (KG, M2, M3...)" value={newField.unit_code||""} onChange={e=>setNewField({...newField,unit_code:e.target.value})}/></>}{["WEIGHT","AREA","VOLUME","QUANTITY"].includes(newField.field_type)&&<input required dir="ltr" className="rounded-lg border p-2" placeholder="unit (TON, KG, M2...)" value={newField.unit_code||""} onChange={e=>setNewField({...newField,unit_code:e.target.value})}/>} {newField.field_type==="MONEY"&&<input required dir="ltr" maxLength="3" className="rounded-lg border p-2" placeholder="currency (IRR)" value={newField.currency_code||""} onChange={e=>setNewField({...newField,currency_code:e.target.value.toUpperCase()})}/>} {["SELECT","MULTI_SELECT"].includes(newField.field_type)&&<input required className="rounded-lg border p-2" placeholder="گزینه‌ها با ویرگول" value={(newField.options_json||[]).join?.(",")||""} onChange={e=>setNewField({...newField,options_json:e.target.value.split(",").map(item=>item.trim()).filter(Boolean)})}/>}<label><input type="checkbox" checked={newField.is_required} onChange={e=>setNewField({...newField,is_required:e.target.checked})}/> اجباری</label><label><input type="checkbox" checked={newField.is_customer_visible} onChange={e=>setNewField({...newField,is_customer_visible:e.target.checked})}/> مشتری</label><label><input type="checkbox" checked={newField.is_internal_cost} onChange={e=>setNewField({...newField,is_internal_cost:e.target.checked})}/> هزینه داخلی</label><button className="rounded-full border py-2 md:col-span-3">افزودن Field</button></form>}</section>
   <section className="panel-card"><h3 className="font-semibold">Task Triggerها</h3>{selected.tasks.map(task=><div key={task.id} className="mt-2 rounded-xl border p-3"><b>{task.title_fa}</b><small className="mr-2">{task.trigger_type}{task.blocks_step_completion?" • مسدودکننده":""}</small>{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/steps/${selected.id}/tasks/${task.id}`,{method:"DELETE"})} className="mr-3 text-red-700 underline">حذف</button>}</div>)}{!readOnly&&<form onSubmit={addTask} className="mt-4 grid gap-2 border-t pt-4 md:grid-cols-2"><input required className="rounded-lg border p-2" placeholder="عنوان اقدام" value={newTask.title_fa} onChange={e=>setNewTask({...newTask,title_fa:e.target.value})}/><select className="rounded-lg border p-2" value={newTask.trigger_type} onChange={e=>setNewTask({...newTask,trigger_type:e.target.value})}>{triggers.map(trigger=><option key={trigger}>{trigger}</option>)}</select><select className="rounded-lg border p-2" value={newTask.assigned_role_id||""} onChange={e=>setNewTask({...newTask,assigned_role_id:e.target.value})}><option value="">Role</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><label><input type="checkbox" checked={newTask.blocks_step_completion} onChange={e=>setNewTask({...newTask,blocks_step_completion:e.target.checked})}/> مسدودکننده تکمیل</label><button className="rounded-full border py-2 md:col-span-2">افزودن Task</button></form>}</section></>}</main></div>
   <section className="panel-card"><h3 className="font-semibold">Taskهای سطح Workflow</h3><p className="mt-1 text-sm text-primary/60">این اقدام‌ها هنگام شروع Workflow ساخته می‌شوند.</p>{template.workflow_tasks?.map(task=><div key={task.id} className="mt-2 rounded-xl border p-3"><b>{task.title_fa}</b><small className="mr-2">{task.trigger_type}{task.blocks_workflow_progress?" • مسدودکننده پیشرفت":""}</small>{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/tasks/${task.id}`,{method:"DELETE"})} className="mr-3 text-red-700 underline">حذف</button>}</div>)}{!readOnly&&<form onSubmit={addWorkflowTask} className="mt-4 grid gap-2 border-t pt-4 md:grid-cols-2"><input required className="rounded-lg border p-2" placeholder="عنوان اقدام شروع Workflow" value={newWorkflowTask.title_fa} onChange={e=>setNewWorkflowTask({...newWorkflowTask,title_fa:e.target.value})}/><select required className="rounded-lg border p-2" value={newWorkflowTask.assigned_role_id||""} onChange={e=>setNewWorkflowTask({...newWorkflowTask,assigned_role_id:e.target.value})}><option value="">Role مسئول</option>{roles.map(role=><option key={role.id} value={role.id}>{role.name_fa}</option>)}</select><select className="rounded-lg border p-2" value={newWorkflowTask.required_permission_code} onChange={e=>setNewWorkflowTask({...newWorkflowTask,required_permission_code:e.target.value})}>{permissions.map(permission=><option key={permission.code}>{permission.code}</option>)}</select><label><input type="checkbox" checked={newWorkflowTask.blocks_workflow_progress} onChange={e=>setNewWorkflowTask({...newWorkflowTask,blocks_workflow_progress:e.target.checked})}/> مسدودکننده پیشرفت Workflow</label><button className="rounded-full border py-2 md:col-span-2">افزودن Task سطح Workflow</button></form>}</section>
   <section className="panel-card"><h3 className="font-semibold">Handoff Metricها</h3><div className="mt-3 flex flex-wrap gap-2">{template.handoff_metrics?.map(metric=><span key={metric.id} className="rounded-full border px-3 py-2 text-sm">{metric.label_fa}: ±{metric.absolute_tolerance??"—"} {metric.unit_code}{!readOnly&&<button onClick={()=>api(`/api/v1/admin/workflow-templates/${templateId}/handoff-metrics/${metric.id}`,{method:"DELETE"})} className="mr-2 text-red-700">×</button>}</span>)}</div>{!readOnly&&<form onSubmit={addMetric} className="mt-4 grid gap-2 md:grid-cols-4"><input required dir="ltr" className="rounded-lg border p-2" placeholder="metric_key" value={newMetric.metric_key} onChange={e=>setNewMetric({...newMetric,metric_key:e.target.value})}/><input required className="rounded-lg border p-2" placeholder="عنوان" value={newMetric.label_fa} onChange={e=>setNewMetric({...newMetric,label_fa:e.target.value})}/><input className="rounded-lg border p-2" placeholder="Unit" value={newMetric.unit_code} onChange={e=>setNewMetric({...newMetric,unit_code:e.target.value})}/><input type="number" step="any" className="rounded-lg border p-2" placeholder="تلورانس مطلق" value={newMetric.absolute_tolerance??""} onChange={e=>setNewMetric({...newMetric,absolute_tolerance:e.target.value===""?null:Number(e.target.value)})}/><button className="rounded-full border py-2 md:col-span-4">افزودن Metric</button></form>}</section></div>;
@@ -28,7 +28,7 @@ export default function WorkflowRuntime(){
   const step=useMemo(()=>workflow?.steps?.find(item=>item.id===selectedID),[workflow,selectedID]);
   const isQC=Boolean(step?.fields?.some(field=>field.field_type==="QC_CHECK"));
   const draftKey=step?.id?`workflow-draft:${step.id}`:"";
-  useEffect(()=>{if(step){const initial={};step.fields?.forEach(field=>{if(field.value!==undefined&&field.value!==null)initial[field.field_key]=field.value;else if(field.default_value!==undefined&&field.default_value!==null)initial[field.field_key]=field.default_value});try{const local=step.status==="IN_PROGRESS"&&draftKey?JSON.parse(localStorage.getItem(draftKey)||"null"):null;setValues(local?{...initial,...local}:initial);if(local)setDraftNotice("پیش‌نویس موقت این دستگاه بازیابی شد.")}catch{setValues(initial)}}},[step?.id]);
+  useEffect(()=>{if(step){const initial={};step.fields?.forEach(field=>{if(field.field_type==="COMPUTED")return;if(field.value!==undefined&&field.value!==null)initial[field.field_key]=field.value;else if(field.default_value!==undefined&&field.default_value!==null)initial[field.field_key]=field.default_value});try{const local=step.status==="IN_PROGRESS"&&draftKey?JSON.parse(localStorage.getItem(draftKey)||"null"):null;setValues(local?{...initial,...local}:initial);if(local)setDraftNotice("پیش‌نویس موقت این دستگاه بازیابی شد.")}catch{setValues(initial)}}},[step?.id]);
   useEffect(()=>{if(!draftKey||step?.status!=="IN_PROGRESS")return undefined;const timer=setTimeout(()=>{const allowed=new Set((step.fields||[]).filter(field=>!field.is_sensitive&&!localDraftExcludedTypes.has(field.field_type)).map(field=>field.field_key));const safe=Object.fromEntries(Object.entries(values).filter(([key,value])=>allowed.has(key)&&!containsFileReference(value)));localStorage.setItem(draftKey,JSON.stringify(safe));setDraftNotice("پیش‌نویس موقت در این دستگاه ذخیره شد.")},500);return()=>clearTimeout(timer)},[values,draftKey,step?.status,step?.fields]);
   useEffect(()=>{const warn=event=>{if(step?.status==="IN_PROGRESS"&&draftKey&&localStorage.getItem(draftKey)){event.preventDefault();event.returnValue=""}};window.addEventListener("beforeunload",warn);return()=>window.removeEventListener("beforeunload",warn)},[step?.status,draftKey]);
   useEffect(()=>{if(!step||!hasPermission("workflow_transitions.view")){setTransitions([]);return}fetchJSON(`/api/v1/workflow-step-instances/${step.id}/transitions`).then(r=>setTransitions(r.data||[])).catch(()=>setTransitions([]))},[step?.id]);
@@ -44,13 +44,14 @@ export default function WorkflowRuntime(){
       <main className="space-y-5">{step&&<section className="panel-card"><div className="flex flex-wrap justify-between gap-3"><div><h3 className="text-xl font-semibold">{step.internal_title_fa}</h3><p className="text-sm text-primary/60">{step.internal_description_fa}</p></div><span className="rounded-full bg-amber-50 px-3 py-1 text-sm">{statusFA[step.status]||step.status}</span></div>
         {workflow.blockers?.filter(x=>!x.step_instance_id||x.step_instance_id===step.id).map((blocker,index)=><div key={`${blocker.kind}-${index}`} className="mt-4 rounded-xl bg-red-50 p-4 text-red-800"><b>{blocker.kind==="PAYMENT"?"مسدودکننده مالی":"سند الزامی"}</b><p>{blocker.title_fa}{blocker.amount?` • ${blocker.amount} ${blocker.currency}`:""}</p></div>)}
         {draftNotice&&<p className="mt-4 text-xs text-green-700" role="status">{draftNotice}</p>}{step.fields?.length>0&&<div className="mt-6 grid gap-5 md:grid-cols-2">{step.fields.map(field=><DynamicFieldRenderer key={field.id} field={field} value={values[field.field_key]} disabled={terminal.has(step.status)||step.status==="WAITING_FOR_APPROVAL"} onChange={value=>setValues(current=>({...current,[field.field_key]:value}))} onUpload={file=>upload(field,file)}/>)}</div>}
+        {step.approval_levels?.length>0&&<div className="mt-6 rounded-xl border p-4"><h4 className="font-semibold">زنجیره تأیید</h4><ol className="mt-2 space-y-1 text-sm">{step.approval_levels.map((level,index)=><li key={level.level_number} className="flex flex-wrap justify-between gap-2"><span>سطح {index+1}: {level.approval_role_name}</span><span className={level.overridden||level.approvals>=level.required_approvals?"text-green-700":"text-primary/60"}>{level.overridden?"تأیید با Override":`${level.approvals} از ${level.required_approvals} تأیید`}</span></li>)}</ol>{step.approval_decisions?.length>0&&<div className="mt-3 space-y-1 border-t pt-3 text-xs">{step.approval_decisions.map((item,index)=><div key={`${item.decided_at}-${index}`} className="flex flex-wrap justify-between gap-2"><span>دور {item.approval_round} • سطح {item.level_number} • {item.decision==="APPROVED"?"تأیید":"رد"}{item.is_override&&" (Override)"} • {item.decided_by}{item.on_behalf_of&&` (به جای ${item.on_behalf_of})`}{item.reason&&` — ${item.reason}`}</span><PersianDate value={item.decided_at}/></div>)}</div>}</div>}
         {step.step_code==="ISSUE_PROFORMA"&&!terminal.has(step.status)&&<ProformaPanel orderId={workflow.order_id} onIssued={load}/>} 
         {step.step_code!=="ISSUE_PROFORMA"&&<div className="mt-6 flex flex-wrap gap-2">{["WAITING_FOR_ASSIGNEE","NEEDS_CORRECTION"].includes(step.status)&&<button disabled={busy} onClick={()=>call("start",{})} className="rounded-full bg-primary px-5 py-2 text-sand">شروع مرحله</button>}{step.status==="IN_PROGRESS"&&<><button disabled={busy} onClick={()=>call("draft",{values})} className="rounded-full border px-5 py-2">ذخیره پیش‌نویس</button>{isQC?<button disabled={busy} onClick={openQC} className="rounded-full bg-green-700 px-5 py-2 text-white">ثبت و تصمیم‌گیری QC</button>:step.domain_event_code?<button disabled={busy} onClick={completeDomain} className="rounded-full bg-green-700 px-5 py-2 text-white">ثبت عملیات {step.internal_title_fa}</button>:<button disabled={busy} onClick={()=>call("submit",{values})} className="rounded-full bg-green-700 px-5 py-2 text-white">ثبت مرحله</button>}</>}{step.status==="WAITING_FOR_APPROVAL"&&hasPermission("workflow_steps.approve")&&<><button disabled={busy} onClick={()=>call("approve",{reason:""})} className="rounded-full bg-green-700 px-5 py-2 text-white">تأیید</button><button disabled={busy} onClick={()=>{const value=reason("رد");if(value)call("reject",{reason:value})}} className="rounded-full bg-red-700 px-5 py-2 text-white">رد برای اصلاح</button></>}{step.status==="WAITING_FOR_TRANSITION"&&hasPermission("workflow_transitions.select")&&transitions.map(x=><button key={x.id} disabled={busy} onClick={async()=>{const why=x.requires_reason?reason("انتخاب مسیر"):"";if(x.requires_reason&&!why)return;setBusy(true);try{await fetchJSON(`/api/v1/workflow-step-instances/${step.id}/select-transition`,{method:"POST",headers:{"Idempotency-Key":crypto.randomUUID()},body:JSON.stringify({transition_code:x.transition_code,reason:why})});await load()}catch(e){setError(e.message)}finally{setBusy(false)}}} className="rounded-full bg-blue-700 px-5 py-2 text-white">{x.label_fa}</button>)}{step.is_skippable&&!terminal.has(step.status)&&step.status!=="WAITING_FOR_TRANSITION"&&<button disabled={busy} onClick={()=>{const value=reason("عبور");if(value)call("skip",{reason:value})}} className="rounded-full border px-5 py-2">عبور از مرحله</button>}{terminal.has(step.status)&&hasPermission("workflow_steps.reopen")&&<button disabled={busy} onClick={()=>{const value=reason("بازگشایی");if(value)call("reopen",{reason:value})}} className="rounded-full border px-5 py-2">بازگشایی</button>}{hasPermission("workflow_steps.reassign")&&!terminal.has(step.status)&&<button disabled={busy} onClick={()=>{const user=window.prompt("شناسه کاربر جدید:");const why=reason("تخصیص مجدد");if(user&&why)call("reassign",{assigned_user_id:user,reason:why})}} className="rounded-full border px-5 py-2">تخصیص مجدد</button>}</div>}
       </section>}
       {workflow.discrepancies?.length>0&&<section className="panel-card"><h3 className="font-semibold">مغایرت‌ها</h3><div className="mt-3 space-y-2">{workflow.discrepancies.map(item=><div key={item.id} className="rounded-xl border p-3"><b>{item.metric_key}</b> — انتظار {item.expected_value} / ثبت {item.actual_value}<span className={`mr-3 rounded-full px-2 py-1 text-xs ${item.is_blocking?"bg-red-100":"bg-amber-100"}`}>{item.severity}</span>{hasPermission("workflow_discrepancies.resolve")&&!terminal.has(item.status)&&<button onClick={async()=>{const note=reason("رفع مغایرت");if(note){await fetchJSON(`/api/v1/workflow-discrepancies/${item.id}/resolve`,{method:"POST",body:JSON.stringify({status:"RESOLVED",note})});load()}}} className="mr-3 underline">رفع شد</button>}</div>)}</div></section>}
       {workflow.action_items?.length>0&&<section className="panel-card"><h3 className="font-semibold">اقدام‌های باز</h3>{workflow.action_items.map(item=><div key={item.id} className="mt-3 flex items-center justify-between rounded-xl border p-3"><span>{item.title_fa}{item.is_blocking&&<b className="mr-2 text-red-700">مسدودکننده</b>}</span>{hasPermission("action_items.complete")&&<button onClick={async()=>{await fetchJSON(`/api/v1/action-items/${item.id}/complete`,{method:"POST",headers:idempotentHeaders()});load()}} className="rounded-full border px-3 py-1 text-xs">تکمیل</button>}</div>)}</section>}
       {workflow.proformas?.length>0&&<section className="panel-card"><h3 className="font-semibold">پیش‌فاکتورها و اطلاعات مالی مجاز</h3>{workflow.proformas.map(item=><div key={item.id} className="mt-3 grid grid-cols-2 gap-2 rounded-xl border p-3 text-sm"><b>{item.proforma_number}</b><span>{item.status}</span><span>جمع: {item.subtotal} {item.currency}</span><span>تخفیف: {item.discount_amount} {item.currency}</span><strong>مبلغ نهایی: {item.total_amount} {item.currency}</strong></div>)}</section>}
-      {workflow.audit_summary?.length>0&&<section className="panel-card"><h3 className="font-semibold">خلاصه Audit</h3>{workflow.audit_summary.map((item,index)=><div key={`${item.created_at}-${index}`} className="mt-2 flex flex-wrap justify-between rounded-xl border p-3 text-xs"><span>{item.actor} • {item.action_code}</span><PersianDate value={item.created_at}/></div>)}</section>}
+      {workflow.audit_summary?.length>0&&<section className="panel-card"><h3 className="font-semibold">خلاصه Audit</h3>{workflow.audit_summary.map((item,index)=><div key={`${item.created_at}-${index}`} className="mt-2 flex flex-wrap justify-between rounded-xl border p-3 text-xs"><span>{item.actor}{item.on_behalf_of&&` (به جای ${item.on_behalf_of})`} • {item.action_code}</span><PersianDate value={item.created_at}/></div>)}</section>}
       </main></div>{error&&<p className="rounded-xl bg-red-50 p-4 text-red-700">{error}</p>}
   </div>
 }
@@ -4,9 +4,30 @@ import { fetchJSON } from "../lib/api";
 
 const statusFA={DRAFT:"پیش‌نویس",PUBLISHED:"منتشرشده",ARCHIVED:"آرشیوشده"};
 
+function ImportDialog({onClose,onImported}){
+  const [bundle,setBundle]=useState(null),[form,setForm]=useState({template_group_code:"",role_map:"{}",permission_map:"{}"}),[report,setReport]=useState(null),[error,setError]=useState("");
+  const readFile=async event=>{const file=event.target.files?.[0];if(!file)return;try{setBundle(JSON.parse(await file.text()));setReport(null);setError("")}catch{setError("فایل JSON معتبر نیست.")}};
+  const run=async dryRun=>{setError("");try{const response=await fetchJSON("/api/v1/admin/workflow-templates/import",{method:"POST",body:JSON.stringify({bundle,template_group_code:form.template_group_code,role_map:JSON.parse(form.role_map||"{}"),permission_map:JSON.parse(form.permission_map||"{}"),dry_run:dryRun})});setReport(response.data);if(response.data.template_id)onImported(response.data.template_id)}catch(e){setError(e.message)}};
+  return <div className="fixed inset-0 z-50 flex items-center justify-center bg-black/40 p-4"><div className="w-full max-w-2xl space-y-3 rounded-3xl bg-white p-6"><h3 className="text-xl font-semibold">ورود Bundle نسخه Workflow</h3><p className="text-sm text-primary/60">Bundle همیشه به‌صورت نسخه Draft جدید ساخته می‌شود. کد نقش‌ها و دسترسی‌هایی را که در این محیط نام دیگری دارند نگاشت کنید.</p><input type="file" accept="application/json,.json" onChange={readFile}/>{bundle&&<p dir="ltr" className="text-xs text-primary/60">{bundle.source?.template_group_code} v{bundle.source?.version_number} / {bundle.steps?.length||0} steps</p>}<input dir="ltr" className="w-full rounded-xl border p-3" placeholder="template_group_code (optional)" value={form.template_group_code} onChange={e=>setForm({...form,template_group_code:e.target.value})}/><label className="block text-sm">نگاشت نقش‌ها<textarea dir="ltr" className="mt-1 w-full rounded-xl border p-3 font-mono text-xs" value={form.role_map} onChange={e=>setForm({...form,role_map:e.target.value})}/></label><label className="block text-sm">نگاشت دسترسی‌ها<textarea dir="ltr" className="mt-1 w-full rounded-xl border p-3 font-mono text-xs" value={form.permission_map} onChange={e=>setForm({...form,permission_map:e.target.value})}/></label>{error&&<p className="rounded-xl bg-red-50 p-3 text-red-700">{error}</p>}{report&&<div className="max-h-60 overflow-y-auto rounded-xl border p-3 text-sm"><p className={report.valid?"text-green-700":"text-red-700"}>{report.valid?(report.template_id?"نسخه Draft ساخته شد.":"Bundle معتبر است."):"Bundle قابل ورود نیست."}</p>{[...report.errors,...report.warnings].map((issue,index)=><p key={index} dir="ltr" className="mt-1 font-mono text-xs">{issue.path} — {issue.code}: {issue.message}</p>)}</div>}<div className="flex gap-2"><button disabled={!bundle} onClick={()=>run(true)} className="rounded-full border px-5 py-2 disabled:opacity-50">اعتبارسنجی</button><button disabled={!bundle} onClick={()=>run(false)} className="rounded-full bg-primary px-5 py-2 text-sand disabled:opacity-50">ورود</button><button type="button" onClick={onClose} className="rounded-full border px-5 py-2">بستن</button></div></div></div>;
+}
+
+const actionFA={MAPPED:"نگاشت شد",SKIPPED:"عبور",KEPT:"سابقه",UNMAPPABLE:"ناسازگار"};
+
+function MigrateDialog({item,onClose}){
+  const [form,setForm]=useState({instance_ids:"",reason:""}),[report,setReport]=useState(null),[error,setError]=useState("");
+  const run=async dryRun=>{setError("");try{const instance_ids=form.instance_ids.split(/[\s,]+/).filter(Boolean);const response=await fetchJSON(`/api/v1/admin/workflow-templates/${item.id}/migrate-instances`,{method:"POST",body:JSON.stringify({instance_ids,reason:form.reason,dry_run:dryRun})});setReport(response.data)}catch(e){setError(e.message)}};
+  return <div className="fixed inset-0 z-50 flex items-center justify-center bg-black/40 p-4"><div className="w-full max-w-2xl space-y-3 rounded-3xl bg-white p-6"><h3 className="text-xl font-semibold">مهاجرت Workflowهای در جریان به v{item.version_number}</h3><p className="text-sm text-primary/60">مراحل بر اساس کد مرحله نگاشت می‌شوند و وضعیت و مقادیر واردشده حفظ می‌شود. بدون شناسه، همه Workflowهای در جریان نسخه‌های قدیمی‌تر این گروه بررسی می‌شوند.</p><textarea dir="ltr" className="w-full rounded-xl border p-3 font-mono text-xs" placeholder="instance ids (optional)" value={form.instance_ids} onChange={e=>setForm({...form,instance_ids:e.target.value})}/><input className="w-full rounded-xl border p-3" placeholder="دلیل مهاجرت" value={form.reason} onChange={e=>setForm({...form,reason:e.target.value})}/>{error&&<p className="rounded-xl bg-red-50 p-3 text-red-700">{error}</p>}{report&&<div className="max-h-72 space-y-3 overflow-y-auto rounded-xl border p-3 text-sm"><p>{report.dry_run?"پیش‌نمایش":"نتیجه"}: {report.migrated} قابل مهاجرت، {report.blocked} مسدود</p>{report.instances.map(instance=><div key={instance.workflow_instance_id} className="border-t pt-2"><p dir="ltr" className={`font-mono text-xs ${instance.errors.length?"text-red-700":"text-green-700"}`}>{instance.workflow_instance_id}</p><p className="text-xs text-primary/60">{instance.steps.map(step=>`${step.step_code}: ${actionFA[step.action]||step.action}`).join("، ")}{instance.added_steps.length>0&&` — مراحل جدید: ${instance.added_steps.join("، ")}`}</p>{[...instance.errors,...instance.warnings].map((issue,index)=><p key={index} dir="ltr" className="mt-1 font-mono text-xs">{issue.path} — {issue.code}: {issue.message}</p>)}</div>)}</div>}<div className="flex gap-2"><button onClick={()=>run(true)} className="rounded-full border px-5 py-2">پیش‌نمایش</button><button disabled={!form.reason.trim()} onClick={()=>run(false)} className="rounded-full bg-primary px-5 py-2 text-sand disabled:opacity-50">مهاجرت</button><button type="button" onClick={onClose} className="rounded-full border px-5 py-2">بستن</button></div></div></div>;
+}
+
+function SimulateDialog({item,onClose}){
+  const [payload,setPayload]=useState(JSON.stringify({submissions:[],payments:[]},null,2)),[trace,setTrace]=useState(null),[error,setError]=useState("");
+  const run=async()=>{setError("");try{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${item.id}/simulate`,{method:"POST",body:JSON.stringify(JSON.parse(payload))});setTrace(response.data)}catch(e){setError(e.message)}};
+  return <div className="fixed inset-0 z-50 flex items-center justify-center bg-black/40 p-4"><div className="w-full max-w-2xl space-y-3 rounded-3xl bg-white p-6"><h3 className="text-xl font-semibold">شبیه‌سازی v{item.version_number}</h3><p className="text-sm text-primary/60">مراحل با مقادیر نمونه اجرا می‌شوند و هیچ سفارشی تغییر نمی‌کند. تأییدها، کارهای مسدودکننده و پرداخت‌ها انجام‌شده فرض می‌شوند.</p><textarea dir="ltr" rows={8} className="w-full rounded-xl border p-3 font-mono text-xs" value={payload} onChange={e=>setPayload(e.target.value)}/>{error&&<p className="rounded-xl bg-red-50 p-3 text-red-700">{error}</p>}{trace&&<div className="max-h-72 space-y-2 overflow-y-auto rounded-xl border p-3 text-sm"><p className={trace.completed?"text-green-700":"text-red-700"}>{trace.completed?"Workflow به پایان رسید":"Workflow متوقف شد"} — {trace.action_items.length} کار، {trace.discrepancies.length} مغایرت</p>{trace.events.map((event,index)=><p key={index} dir="ltr" className="font-mono text-xs">{event.type} {event.step_code}{event.iteration?`#${event.iteration}`:""} {event.transition_code} {event.detail}</p>)}{trace.errors.map((issue,index)=><p key={index} dir="ltr" className="font-mono text-xs text-red-700">{issue.path} — {issue.code}: {issue.message}</p>)}</div>}<div className="flex gap-2"><button onClick={run} className="rounded-full bg-primary px-5 py-2 text-sand">اجرا</button><button type="button" onClick={onClose} className="rounded-full border px-5 py-2">بستن</button></div></div></div>;
+}
+
 export default function WorkflowTemplates(){
   const navigate=useNavigate();
-  const [items,setItems]=useState([]),[open,setOpen]=useState(false),[error,setError]=useState("");
+  const [items,setItems]=useState([]),[open,setOpen]=useState(false),[importing,setImporting]=useState(false),[migrating,setMigrating]=useState(null),[simulating,setSimulating]=useState(null),[error,setError]=useState("");
   const [form,setForm]=useState({template_group_code:"",name_fa:"",description_fa:"",icon_key:"workflow",start_permission_code:"",is_active:true});
   const load=async(isCancelled=()=>false)=>{
     try {
@@ -25,6 +46,7 @@ export default function WorkflowTemplates(){
   },[]);
   const create=async event=>{event.preventDefault();const response=await fetchJSON("/api/v1/admin/workflow-templates",{method:"POST",body:JSON.stringify(form)});navigate(`/dashboard/workflows/${response.data.id}/builder`)};
   const command=async(id,action)=>{await fetchJSON(`/api/v1/admin/workflow-templates/${id}/${action}`,{method:"POST"});void load()};
+  const exportBundle=async item=>{try{const response=await fetchJSON(`/api/v1/admin/workflow-templates/${item.id}/export`);const url=URL.createObjectURL(new Blob([JSON.stringify(response.data,null,2)],{type:"application/json"}));const link=document.createElement("a");link.href=url;link.download=`${item.code}.workflow.json`;link.click();URL.revokeObjectURL(url)}catch(e){setError(e.message)}};
   const groups=items.reduce((all,item)=>({...all,[item.template_group_code]:[...(all[item.template_group_code]||[]),item]}),{});
-  return <div className="space-y-5" dir="rtl"><section className="panel-card flex flex-wrap items-center justify-between gap-3"><div><h2 className="font-display text-2xl">نسخه‌های Workflow</h2><p className="text-sm text-primary/60">هر سفارش Snapshot مستقل نسخه منتشرشده را نگه می‌دارد.</p></div><button onClick={()=>setOpen(true)} className="rounded-full bg-primary px-5 py-2 text-sand">الگوی جدید</button></section>{error&&<p className="rounded-xl bg-red-50 p-4 text-red-700">{error}</p>}<div className="grid gap-4">{Object.entries(groups).map(([group,versions])=><section key={group} className="panel-card"><h3 dir="ltr" className="font-mono font-semibold">{group}</h3><div className="mt-4 overflow-x-auto"><table className="w-full text-sm"><thead><tr className="text-right text-primary/55"><th className="p-2">نسخه</th><th>عنوان</th><th>وضعیت</th><th>انتشار</th><th>عملیات</th></tr></thead><tbody>{versions.map(item=><tr key={item.id} className="border-t"><td className="p-2">v{item.version_number}</td><td>{item.name_fa}</td><td><span className="rounded-full bg-primary/5 px-2 py-1">{statusFA[item.status]}</span></td><td>{item.published_at?new Date(item.published_at).toLocaleDateString("fa-IR"):"—"}</td><td className="space-x-2 space-x-reverse"><Link className="underline" to={`/dashboard/workflows/${item.id}/builder`}>{item.status==="DRAFT"?"ویرایش":"مشاهده"}</Link>{item.status==="PUBLISHED"&&<><button className="underline" onClick={()=>command(item.id,"clone")}>ساخت نسخه جدید</button><button className="text-red-700 underline" onClick={()=>command(item.id,"archive")}>آرشیو</button></>}</td></tr>)}</tbody></table></div></section>)}</div>{open&&<div className="fixed inset-0 z-50 flex items-center justify-center bg-black/40 p-4"><form onSubmit={create} className="w-full max-w-lg space-y-3 rounded-3xl bg-white p-6"><h3 className="text-xl font-semibold">ساخت Template Draft</h3><input required dir="ltr" className="w-full rounded-xl border p-3" placeholder="group_code" value={form.template_group_code} onChange={e=>setForm({...form,template_group_code:e.target.value,start_permission_code:`workflow_start.${e.target.value}`})}/><input required className="w-full rounded-xl border p-3" placeholder="عنوان فارسی" value={form.name_fa} onChange={e=>setForm({...form,name_fa:e.target.value})}/><textarea className="w-full rounded-xl border p-3" placeholder="توضیحات" value={form.description_fa} onChange={e=>setForm({...form,description_fa:e.target.value})}/><input required dir="ltr" className="w-full rounded-xl border p-3" placeholder="permission code" value={form.start_permission_code} onChange={e=>setForm({...form,start_permission_code:e.target.value})}/><div className="flex gap-2"><button className="rounded-full bg-primary px-5 py-2 text-sand">ساخت</button><button type="button" onClick={()=>setOpen(false)} className="rounded-full border px-5 py-2">انصراف</button></div></form></div>}</div>;
+  return <div className="space-y-5" dir="rtl"><section className="panel-card flex flex-wrap items-center justify-between gap-3"><div><h2 className="font-display text-2xl">نسخه‌های Workflow</h2><p className="text-sm text-primary/60">هر سفارش Snapshot مستقل نسخه منتشرشده را نگه می‌دارد.</p></div><div className="flex gap-2"><button onClick={()=>setImporting(true)} className="rounded-full border px-5 py-2">ورود Bundle</button><button onClick={()=>setOpen(true)} className="rounded-full bg-primary px-5 py-2 text-sand">الگوی جدید</button></div></section>{error&&<p className="rounded-xl bg-red-50 p-4 text-red-700">{error}</p>}<div className="grid gap-4">{Object.entries(groups).map(([group,versions])=><section key={group} className="panel-card"><h3 dir="ltr" className="font-mono font-semibold">{group}</h3><div className="mt-4 overflow-x-auto"><table className="w-full text-sm"><thead><tr className="text-right text-primary/55"><th className="p-2">نسخه</th><th>عنوان</th><th>وضعیت</th><th>انتشار</th><th>عملیات</th></tr></thead><tbody>{versions.map(item=><tr key={item.id} className="border-t"><td className="p-2">v{item.version_number}</td><td>{item.name_fa}</td><td><span className="rounded-full bg-primary/5 px-2 py-1">{statusFA[item.status]}</span></td><td>{item.published_at?new Date(item.published_at).toLocaleDateString("fa-IR"):"—"}</td><td className="space-x-2 space-x-reverse"><Link className="underline" to={`/dashboard/workflows/${item.id}/builder`}>{item.status==="DRAFT"?"ویرایش":"مشاهده"}</Link><button className="underline" onClick={()=>exportBundle(item)}>خروجی JSON</button><button className="underline" onClick={()=>setSimulating(item)}>شبیه‌سازی</button>{item.status==="PUBLISHED"&&<><button className="underline" onClick={()=>command(item.id,"clone")}>ساخت نسخه جدید</button><button className="underline" onClick={()=>setMigrating(item)}>مهاجرت Workflowها</button><button className="text-red-700 underline" onClick={()=>command(item.id,"archive")}>آرشیو</button></>}</td></tr>)}</tbody></table></div></section>)}</div>{open&&<div className="fixed inset-0 z-50 flex items-center justify-center bg-black/40 p-4"><form onSubmit={create} className="w-full max-w-lg space-y-3 rounded-3xl bg-white p-6"><h3 className="text-xl font-semibold">ساخت Template Draft</h3><input required dir="ltr" className="w-full rounded-xl border p-3" placeholder="group_code" value={form.template_group_code} onChange={e=>setForm({...form,template_group_code:e.target.value,start_permission_code:`workflow_start.${e.target.value}`})}/><input required className="w-full rounded-xl border p-3" placeholder="عنوان فارسی" value={form.name_fa} onChange={e=>setForm({...form,name_fa:e.target.value})}/><textarea className="w-full rounded-xl border p-3" placeholder="توضیحات" value={form.description_fa} onChange={e=>setForm({...form,description_fa:e.target.value})}/><input required dir="ltr" className="w-full rounded-xl border p-3" placeholder="permission code" value={form.start_permission_code} onChange={e=>setForm({...form,start_permission_code:e.target.value})}/><div className="flex gap-2"><button className="rounded-full bg-primary px-5 py-2 text-sand">ساخت</button><button type="button" onClick={()=>setOpen(false)} className="rounded-full border px-5 py-2">انصراف</button></div></form></div>}{importing&&<ImportDialog onClose={()=>setImporting(false)} onImported={()=>void load()}/>}{migrating&&<MigrateDialog item={migrating} onClose={()=>setMigrating(null)}/>}{simulating&&<SimulateDialog item={simulating} onClose={()=>setSimulating(null)}/>}</div>;
 }
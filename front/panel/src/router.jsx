@@ -33,6 +33,9 @@ const Reports = lazy(() => import("./pages/Reports"));
 const Finance = lazy(() => import("./pages/Finance"));
 const Settings = lazy(() => import("./pages/Settings"));
 const AdminTools = lazy(() => import("./pages/AdminTools"));
+const ScheduledJobs = lazy(() => import("./pages/ScheduledJobs"));
+const BusinessCalendar = lazy(() => import("./pages/BusinessCalendar"));
+const Delegations = lazy(() => import("./pages/Delegations"));
 const AccessDenied = lazy(() => import("./pages/AccessDenied"));
 const PanelNotFound = lazy(() => import("./pages/PanelNotFound"));
 const lazyNamed = (loader, name) => lazy(() => loader().then((module) => ({ default: module[name] })));
@@ -130,6 +133,9 @@ export default function AppRoutes() {
         <Route path="installations/:id" element={<AnyPermissionRoute permissions={["installation.view_assigned","installation.view_all"]}><InstallationDetail /></AnyPermissionRoute>} />
 		<Route path="settings" element={<PermissionRoute permission="settings.view"><Settings /></PermissionRoute>} />
 		<Route path="admin-tools" element={<PermissionRoute permission="admin_tools.view"><AdminTools /></PermissionRoute>} />
+		<Route path="scheduled-jobs" element={<AnyPermissionRoute permissions={["scheduled_jobs.view","scheduled_jobs.manage"]}><ScheduledJobs /></AnyPermissionRoute>} />
+		<Route path="business-calendar" element={<AnyPermissionRoute permissions={["business_calendar.view","business_calendar.manage"]}><BusinessCalendar /></AnyPermissionRoute>} />
+		<Route path="delegations" element={<Delegations />} />
       </Route>
       <Route path="/access-denied" element={<AccessDenied />} />
 	  <Route path="*" element={<PanelNotFound />} />
@@ -12,6 +12,28 @@ const showValue=value=>{
   return Array.isArray(value)?value.join("، "):String(value);
 };
 
+const measurementTypes=new Set(["WEIGHT","AREA","VOLUME","QUANTITY"]),fileTypes=new Set(["FILE","IMAGE","SIGNATURE"]);
+function CustomerStepForm({step,onSubmitted}){
+  const editable=step.fields.filter(field=>field.field_type!=="COMPUTED");
+  const [values,setValues]=useState(()=>Object.fromEntries(editable.filter(field=>field.value!==undefined&&field.value!==null).map(field=>[field.field_key,field.value]))),[busy,setBusy]=useState(false),[error,setError]=useState("");
+  const set=(key,value)=>setValues(current=>({...current,[key]:value}));
+  const upload=async(field,file)=>{const data=new FormData();data.append("field_definition_id",field.id);data.append("file",file);try{const response=await fetchJSON(`/api/v1/account/workflow-steps/${step.id}/files`,{method:"POST",body:data});set(field.field_key,{fileId:response.data.id})}catch(e){setError(e.message)}};
+  const control=field=>{const options=Array.isArray(field.options_json)?field.options_json:[],optionValue=o=>typeof o==="string"?o:o.value,optionLabel=o=>typeof o==="string"?o:(o.label_fa||o.label||o.value),value=values[field.field_key],common={required:field.is_required,className:"w-full rounded-xl border bg-white p-2",value:value??"",onChange:e=>set(field.field_key,e.target.value)};
+    if(field.field_type==="BOOLEAN")return <input type="checkbox" checked={Boolean(value)} onChange={e=>set(field.field_key,e.target.checked)}/>;
+    if(field.field_type==="LONG_TEXT"||field.field_type==="ADDRESS")return <textarea {...common} rows="3"/>;
+    if(field.field_type==="INTEGER"||field.field_type==="DECIMAL")return <input {...common} type="number" step={field.field_type==="INTEGER"?"1":"any"} onChange={e=>set(field.field_key,e.target.value===""?null:Number(e.target.value))}/>;
+    if(["DATE","TIME","DATETIME"].includes(field.field_type))return <input {...common} type={field.field_type==="DATETIME"?"datetime-local":field.field_type.toLowerCase()}/>;
+    if(field.field_type==="SELECT")return <select {...common}><option value="">انتخاب کنید</option>{options.map(o=><option key={optionValue(o)} value={optionValue(o)}>{optionLabel(o)}</option>)}</select>;
+    if(field.field_type==="MULTI_SELECT")return <div className="flex flex-wrap gap-3">{options.map(o=><label key={optionValue(o)} className="text-sm"><input type="checkbox" checked={(value||[]).includes(optionValue(o))} onChange={e=>set(field.field_key,e.target.checked?[...(value||[]),optionValue(o)]:(value||[]).filter(x=>x!==optionValue(o)))}/> {optionLabel(o)}</label>)}</div>;
+    if(measurementTypes.has(field.field_type))return <div className="flex items-center gap-2"><input {...common} type="number" step="any" value={value?.value??""} onChange={e=>set(field.field_key,e.target.value===""?null:{value:Number(e.target.value),unit:field.unit_code})}/><span className="text-sm">{field.unit_code}</span></div>;
+    if(field.field_type==="MONEY")return <div className="flex items-center gap-2"><input {...common} type="number" step="any" value={value?.amount??""} onChange={e=>set(field.field_key,e.target.value===""?null:{amount:Number(e.target.value),currency:field.currency_code||"IRR"})}/><span className="text-sm">{field.currency_code||"IRR"}</span></div>;
+    if(fileTypes.has(field.field_type))return <div><input type="file" accept={field.field_type==="FILE"?"image/png,image/jpeg,application/pdf":field.field_type==="SIGNATURE"?"image/png":"image/png,image/jpeg"} onChange={e=>e.target.files?.[0]&&upload(field,e.target.files[0])}/>{value?.fileId&&<a className="mr-3 text-sm underline" href={`/api/v1/workflow-files/${value.fileId}`} target="_blank" rel="noreferrer">مشاهده فایل</a>}</div>;
+    return <input {...common} type={field.field_type==="PHONE"?"tel":"text"} placeholder={field.placeholder_fa||""}/>;
+  };
+  const submit=async e=>{e.preventDefault();setBusy(true);setError("");try{await fetchJSON(`/api/v1/account/workflow-steps/${step.id}/submit`,{method:"POST",body:JSON.stringify({values:Object.fromEntries(Object.entries(values).filter(([,value])=>value!==null&&value!==""))})});onSubmitted()}catch(err){setError(err.message)}finally{setBusy(false)}};
+  return <form onSubmit={submit} className="mt-3 space-y-3 rounded-xl border border-primary/20 bg-white p-4"><p className="text-sm font-semibold">این مرحله منتظر اقدام شماست.</p>{editable.map(field=><label key={field.id} className="block space-y-1"><span className="text-sm">{field.label_fa}{field.is_required&&<b className="text-red-600"> *</b>}</span>{field.description_fa&&<small className="block text-primary/55">{field.description_fa}</small>}{control(field)}</label>)}{error&&<p className="text-sm text-red-700">{error}</p>}<button disabled={busy} className="rounded-full bg-primary px-5 py-2 text-sm text-sand disabled:opacity-50">ثبت و ارسال</button></form>;
+}
+
 function OrderRuntime({id}){
   const [runtime,setRuntime]=useState(null),[progress,setProgress]=useState(null),[shipments,setShipments]=useState([]),[error,setError]=useState("");
   const load=()=>fetchJSON(`/api/v1/workflow-instances/${id}/runtime`).then(async response=>{setRuntime(response.data);const orderID=response.data.order_id;const [p,s]=await Promise.all([fetchJSON(`/api/v1/account/orders/${orderID}/progress`),fetchJSON(`/api/v1/account/orders/${orderID}/shipments`)]);setProgress(p.data);setShipments(s.data||[])}).catch(e=>setError(e.message));
@@ -19,7 +41,7 @@ function OrderRuntime({id}){
   if(error)return <p className="mt-4 text-sm text-red-700">نمایش جزئیات ممکن نیست.</p>;
   if(!runtime)return <p className="mt-4 text-sm">در حال دریافت جزئیات…</p>;
   const confirm=async shipment=>{const receiver=prompt("نام تحویل‌گیرنده:");if(!receiver)return;await fetchJSON(`/api/v1/account/orders/${runtime.order_id}/shipments/${shipment.id}/confirm-delivery`,{method:"POST",headers:{"Idempotency-Key":crypto.randomUUID()},body:JSON.stringify({receiver_name:receiver,reason:"تأیید مشتری"})});load()};
-  return <div className="mt-5 space-y-5">{progress&&<section className="rounded-2xl bg-primary/5 p-4"><div className="flex justify-between"><b>پیشرفت کل سفارش</b><strong>{progress.overall_progress}%</strong></div><div className="mt-2 h-2 overflow-hidden rounded-full bg-white"><div className="h-full bg-primary" style={{width:`${progress.overall_progress}%`}}/></div>{progress.items.map(item=><div key={item.order_item_id} className="mt-4 rounded-xl bg-white/70 p-3"><div className="flex justify-between"><b>{item.stone_name}</b><span>{item.overall_progress}%</span></div><p className="mt-1 text-xs text-primary/60">آماده {item.packaged.quantity} • ارسال {item.shipped.quantity} • تحویل {item.delivered.quantity} از {item.ordered_quantity} {item.quantity_unit}</p></div>)}</section>}<ol className="border-r-2 border-primary/15 pr-5">{runtime.steps.map(step=><li key={step.id} className="relative mb-5"><span className="absolute -right-[1.65rem] top-1 h-3 w-3 rounded-full bg-primary"/><b>{step.customer_title_fa}</b><span className="mr-2 rounded-full bg-primary/5 px-2 py-1 text-xs">{statusFA[step.status]||step.customer_status}</span>{step.customer_description_fa&&<p className="text-sm text-primary/60">{step.customer_description_fa}</p>}{step.fields?.length>0&&<dl className="mt-2 grid gap-2 rounded-xl bg-white/60 p-3 sm:grid-cols-2">{step.fields.map(field=><div key={field.id}><dt className="text-xs text-primary/55">{field.label_fa}</dt><dd>{field.field_type==="FILE"||field.field_type==="IMAGE"||field.field_type==="SIGNATURE"?(field.value?.fileId?<a className="underline" href={`/api/v1/workflow-files/${field.value.fileId}`} target="_blank" rel="noreferrer">مشاهده فایل</a>:"—"):showValue(field.value)}</dd></div>)}</dl>}</li>)}</ol>{shipments.length>0&&<section><h3 className="font-semibold">محموله‌های سفارش</h3>{shipments.map(s=><article key={s.id} className="mt-3 rounded-xl border p-4"><div className="flex flex-wrap justify-between gap-2"><div><b>{s.customer_title_fa||`محموله ${s.shipment_number}`}</b><p className="text-xs text-primary/60">ETA: {persianDate(s.estimated_arrival_at)}</p></div><span>{statusFA[s.status]||s.status}</span></div>{["ARRIVED","PARTIALLY_DELIVERED"].includes(s.status)&&<button onClick={()=>confirm(s)} className="mt-3 rounded-full bg-primary px-4 py-2 text-sm text-sand">تأیید دریافت کامل</button>}</article>)}</section>}</div>;
+  return <div className="mt-5 space-y-5">{progress&&<section className="rounded-2xl bg-primary/5 p-4"><div className="flex justify-between"><b>پیشرفت کل سفارش</b><strong>{progress.overall_progress}%</strong></div><div className="mt-2 h-2 overflow-hidden rounded-full bg-white"><div className="h-full bg-primary" style={{width:`${progress.overall_progress}%`}}/></div>{progress.items.map(item=><div key={item.order_item_id} className="mt-4 rounded-xl bg-white/70 p-3"><div className="flex justify-between"><b>{item.stone_name}</b><span>{item.overall_progress}%</span></div><p className="mt-1 text-xs text-primary/60">آماده {item.packaged.quantity} • ارسال {item.shipped.quantity} • تحویل {item.delivered.quantity} از {item.ordered_quantity} {item.quantity_unit}</p></div>)}</section>}<ol className="border-r-2 border-primary/15 pr-5">{runtime.steps.map(step=><li key={step.id} className="relative mb-5"><span className="absolute -right-[1.65rem] top-1 h-3 w-3 rounded-full bg-primary"/><b>{step.customer_title_fa}</b><span className="mr-2 rounded-full bg-primary/5 px-2 py-1 text-xs">{statusFA[step.status]||step.customer_status}</span>{step.customer_description_fa&&<p className="text-sm text-primary/60">{step.customer_description_fa}</p>}{step.customer_actionable&&["WAITING_FOR_ASSIGNEE","NEEDS_CORRECTION","IN_PROGRESS"].includes(step.status)?<CustomerStepForm step={step} onSubmitted={load}/>:step.fields?.length>0&&<dl className="mt-2 grid gap-2 rounded-xl bg-white/60 p-3 sm:grid-cols-2">{step.fields.map(field=><div key={field.id}><dt className="text-xs text-primary/55">{field.label_fa}</dt><dd>{field.field_type==="FILE"||field.field_type==="IMAGE"||field.field_type==="SIGNATURE"?(field.value?.fileId?<a className="underline" href={`/api/v1/workflow-files/${field.value.fileId}`} target="_blank" rel="noreferrer">مشاهده فایل</a>:"—"):showValue(field.value)}</dd></div>)}</dl>}</li>)}</ol>{shipments.length>0&&<section><h3 className="font-semibold">محموله‌های سفارش</h3>{shipments.map(s=><article key={s.id} className="mt-3 rounded-xl border p-4"><div className="flex flex-wrap justify-between gap-2"><div><b>{s.customer_title_fa||`محموله ${s.shipment_number}`}</b><p className="text-xs text-primary/60">ETA: {persianDate(s.estimated_arrival_at)}</p></div><span>{statusFA[s.status]||s.status}</span></div>{["ARRIVED","PARTIALLY_DELIVERED"].includes(s.status)&&<button onClick={()=>confirm(s)} className="mt-3 rounded-full bg-primary px-4 py-2 text-sm text-sand">تأیید دریافت کامل</button>}</article>)}</section>}</div>;
 }
 
 export default function Account(){